@@ -1,22 +1,40 @@
 package hz
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"os"
-	"strconv"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
 	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/internal/router"
 	"github.com/zymawy/hz/pkg/types"
-	"gopkg.in/yaml.v3"
 )
 
 var (
 	addDefault bool
 	addRoutes  []string
 	addRewrite string
+	addHeaders []string
+	addApply   bool
+	addNoApply bool
+
+	addHealthPath     string
+	addHealthType     string
+	addHealthInterval time.Duration
+	addHealthTimeout  time.Duration
 )
 
+// addHealthTypes are the health check types hz add can set up; exec checks
+// need a command, which is easier to write in the config file
+var addHealthTypes = []string{types.HealthCheckHTTP, types.HealthCheckTCP, types.HealthCheckWebSocket}
+
 var addCmd = &cobra.Command{
 	Use:   "add <name> <port|url>",
 	Short: "Add a service to the configuration",
@@ -29,15 +47,31 @@ Examples:
   hz add api http://localhost:8080       # Add api with full URL
   hz add php 8080 --default              # Add as default service
   hz add sabry 3008 --route '/api/*'     # Add with path route
-  hz add ws 9000 --route 'header:b-service=ws'  # Add with header route`,
+  hz add ws 9000 --route 'header:b-service=ws'  # Add with header route
+  hz add api 8080 --health /health --health-interval 10s  # With a health check
+  hz add db 5432 --health-type tcp       # Check that the port accepts connections
+  hz add api 8080 --header 'X-Env: dev'  # Add a header to proxied requests
+
+When hz is running, the service is registered with it right away and its
+routes are live; --no-apply only writes the file, for the next reload.`,
 	Args: cobra.ExactArgs(2),
 	RunE: runAdd,
 }
 
 func init() {
 	addCmd.Flags().BoolVar(&addDefault, "default", false, "set as default service")
-	addCmd.Flags().StringArrayVar(&addRoutes, "route", nil, "add routing rule (path, header:key=value, subdomain:name)")
+	addCmd.Flags().StringArrayVar(&addRoutes, "route", nil, "add routing rule (path, header:key=value|key|!key|key=~regex, subdomain:name, host:domain, query:key=value, method:GET,HEAD)")
 	addCmd.Flags().StringVar(&addRewrite, "rewrite", "", "URL rewrite prefix")
+	addCmd.Flags().StringArrayVar(&addHeaders, "header", nil, "header added to proxied requests, as 'Key: value' (repeatable)")
+	addCmd.Flags().StringVar(&addHealthPath, "health", "", "health check path, like /health")
+	addCmd.Flags().StringVar(&addHealthType, "health-type", "", "health check type: "+strings.Join(addHealthTypes, ", ")+" (default http)")
+	addCmd.Flags().DurationVar(&addHealthInterval, "health-interval", 30*time.Second, "time between health checks")
+	addCmd.Flags().DurationVar(&addHealthTimeout, "health-timeout", 5*time.Second, "longest time a health check may take")
+	addCmd.Flags().BoolVar(&addApply, "apply", false, "register the service with the running hz (default when one is running)")
+	addCmd.Flags().BoolVar(&addNoApply, "no-apply", false, "only write the config file")
+	addCmd.MarkFlagsMutuallyExclusive("apply", "no-apply")
+	_ = addCmd.RegisterFlagCompletionFunc("route", completeRoute)
+	_ = addCmd.RegisterFlagCompletionFunc("health-type", cobra.FixedCompletions(addHealthTypes, cobra.ShellCompDirectiveNoFileComp))
 
 	rootCmd.AddCommand(addCmd)
 }
@@ -47,12 +81,7 @@ func runAdd(cmd *cobra.Command, args []string) error {
 	targetArg := args[1]
 
 	// Parse target (port or URL)
-	var target string
-	if port, err := strconv.Atoi(targetArg); err == nil {
-		target = fmt.Sprintf("http://localhost:%d", port)
-	} else {
-		target = targetArg
-	}
+	target := config.TargetArg(targetArg)
 
 	// Build service
 	service := types.Service{
@@ -63,7 +92,7 @@ func runAdd(cmd *cobra.Command, args []string) error {
 
 	// Parse routes
 	for _, r := range addRoutes {
-		route := parseRouteArg(r)
+		route := config.ParseRouteArg(r)
 		service.Routes = append(service.Routes, route)
 	}
 
@@ -74,6 +103,26 @@ func runAdd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Parse headers
+	for _, h := range addHeaders {
+		key, value, ok := strings.Cut(h, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return fmt.Errorf("invalid header %q; use 'Key: value'", h)
+		}
+		if service.Headers == nil {
+			service.Headers = make(map[string]string)
+		}
+		service.Headers[key] = strings.TrimSpace(value)
+	}
+
+	// Set up the health check, checked like the config file's
+	health, err := addHealth(cmd)
+	if err != nil {
+		return err
+	}
+	service.Health = health
+
 	// Find config file
 	configPath := cfgFile
 	if configPath == "" {
@@ -99,26 +148,38 @@ func runAdd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Add service
-	cfg.Services = append(cfg.Services, &service)
-
-	// If setting as default, unset others
+	// Services from included files stay in their own files
 	if addDefault {
 		for _, svc := range cfg.Services {
-			if svc.Name != name {
-				svc.Default = false
+			if src := cfgManager.IncludedFrom(svc.Name); svc.Default && src != "" {
+				return fmt.Errorf("'%s' in %s is already the default service", svc.Name, src)
 			}
 		}
 	}
 
-	// Write updated config
-	data, err := yaml.Marshal(cfg)
+	// Add service to the main config file, keeping its comments and layout
+	file, err := config.OpenFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
+	}
+	if err := file.AddService(&service); err != nil {
+		return err
+	}
+
+	// If setting as default, unset others
+	if addDefault {
+		for _, svc := range cfgManager.Main().Services {
+			if svc.Name != name && svc.Default && file.HasService(svc.Name) {
+				if err := file.SetServiceField(svc.Name, "default", false); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	// Write updated config
+	if err := file.Save(); err != nil {
+		return err
 	}
 
 	fmt.Printf("✅ Added service '%s' → %s\n", name, target)
@@ -129,35 +190,164 @@ func runAdd(cmd *cobra.Command, args []string) error {
 				fmt.Printf("     • path: %s\n", r.Path)
 			}
 			if r.Header != "" {
-				fmt.Printf("     • header: %s\n", r.Header)
+				fmt.Printf("     • header: %s\n", router.DescribeHeader(r.Header))
 			}
 			if r.Subdomain != "" {
 				fmt.Printf("     • subdomain: %s\n", r.Subdomain)
 			}
+			if r.Host != "" {
+				fmt.Printf("     • host: %s\n", r.Host)
+			}
+			if r.Query != "" {
+				fmt.Printf("     • query: %s\n", r.Query)
+			}
+			if len(r.Methods) > 0 {
+				fmt.Printf("     • methods: %s\n", strings.Join(r.Methods, ", "))
+			}
 		}
 	}
 	if addDefault {
 		fmt.Printf("   Default: yes\n")
 	}
+	if h := service.Health; h != nil {
+		fmt.Printf("   Health: %s every %s (timeout %s)\n", describeHealthCheck(h), h.Interval, h.Timeout)
+	}
+	if len(service.Headers) > 0 {
+		keys := make([]string, 0, len(service.Headers))
+		for key := range service.Headers {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		fmt.Printf("   Headers:\n")
+		for _, key := range keys {
+			fmt.Printf("     • %s: %s\n", key, service.Headers[key])
+		}
+	}
+
+	// Register it with a running hz, so it routes without a reload
+	if !addNoApply {
+		cmd.SilenceUsage = true
+		if err := applyAdded(cfg.Server, configPath, &service); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-// parseRouteArg parses a route argument like "path:/api/*" or "header:x-service=api"
-func parseRouteArg(arg string) types.RouteConfig {
-	route := types.RouteConfig{}
+// applyAdded registers a service just written to the config file with the
+// running hz. The file change stands either way; when the running hz doesn't
+// take the service, it says when it will. It returns an error only when the
+// running hz has a different service of that name.
+func applyAdded(server types.ServerConfig, configPath string, service *types.Service) error {
+	addr := localAddr(server)
+	later := "   The config file is saved; hz picks the service up when it reloads\n" +
+		"   (kill -HUP <pid> or POST /__hz/reload) or restarts.\n"
 
-	// Check for prefixed formats
-	if len(arg) > 7 && arg[:7] == "header:" {
-		route.Header = arg[7:]
-	} else if len(arg) > 10 && arg[:10] == "subdomain:" {
-		route.Subdomain = arg[10:]
-	} else if len(arg) > 5 && arg[:5] == "path:" {
-		route.Path = arg[5:]
-	} else {
-		// Default to path
-		route.Path = arg
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(addr + "/__hz/health")
+	if err != nil {
+		if addApply {
+			fmt.Printf("\n⚠️  hz isn't running at %s; it picks '%s' up when it starts\n", addr, service.Name)
+		}
+		return nil
+	}
+	resp.Body.Close()
+
+	// Send the service as hz reads it, with the file's defaults block merged in
+	if saved, err := config.NewManager(configPath); err == nil {
+		if svc := saved.GetService(service.Name); svc != nil {
+			service = svc
+		}
+	}
+	body, err := json.Marshal(service)
+	if err != nil {
+		fmt.Printf("\n⚠️  Couldn't send '%s' to the running hz: %v\n%s", service.Name, err, later)
+		return nil
+	}
+
+	client.Timeout = 10 * time.Second
+	resp, err = client.Post(addr+"/__hz/services", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("\n⚠️  The running hz at %s didn't answer: %v\n%s", addr, err, later)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		var info admin.ServiceInfo
+		_ = json.NewDecoder(resp.Body).Decode(&info)
+		fmt.Printf("\n🔄 Registered with the running hz at %s; '%s' is routing now (%s)\n", addr, service.Name, plural(info.Routes, "route"))
+	case http.StatusConflict:
+		return fmt.Errorf("the running hz at %s already has a service named '%s', so it wasn't registered; the config file is saved, and a reload replaces the running service with it", addr, service.Name)
+	case http.StatusOK, http.StatusNotFound, http.StatusMethodNotAllowed:
+		fmt.Printf("\n⚠️  The running hz at %s can't register services while it runs\n%s", addr, later)
+	default:
+		var failure struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&failure)
+		if failure.Error == "" {
+			failure.Error = resp.Status
+		}
+		fmt.Printf("\n⚠️  The running hz at %s rejected '%s': %s\n%s", addr, service.Name, failure.Error, later)
 	}
+	return nil
+}
 
-	return route
+// addHealth builds the health check the flags describe, or returns nil if
+// none was asked for
+func addHealth(cmd *cobra.Command) (*types.HealthConfig, error) {
+	flags := cmd.Flags()
+	if addHealthPath == "" && addHealthType == "" {
+		for _, name := range []string{"health-interval", "health-timeout"} {
+			if flags.Changed(name) {
+				return nil, fmt.Errorf("--%s needs --health or --health-type", name)
+			}
+		}
+		return nil, nil
+	}
+	if addHealthType != "" && !slices.Contains(addHealthTypes, addHealthType) {
+		return nil, fmt.Errorf("unknown health check type %q; use %s", addHealthType, strings.Join(addHealthTypes, ", "))
+	}
+	if (addHealthType == "" || addHealthType == types.HealthCheckHTTP) && addHealthPath == "" {
+		return nil, fmt.Errorf("http health checks need a path: --health /health")
+	}
+	if addHealthPath != "" && !strings.HasPrefix(addHealthPath, "/") {
+		return nil, fmt.Errorf("health path %q must start with /", addHealthPath)
+	}
+	if addHealthInterval <= 0 || addHealthTimeout <= 0 {
+		return nil, fmt.Errorf("--health-interval and --health-timeout must be positive")
+	}
+
+	h := &types.HealthConfig{
+		Type:     addHealthType,
+		Path:     addHealthPath,
+		Interval: types.Duration(addHealthInterval),
+		Timeout:  types.Duration(addHealthTimeout),
+	}
+	if err := registry.ValidateHealth(h); err != nil {
+		return nil, fmt.Errorf("health: %w", err)
+	}
+	return h, nil
+}
+
+// describeHealthCheck says what a health check does, like "GET /health"
+func describeHealthCheck(h *types.HealthConfig) string {
+	switch h.Type {
+	case types.HealthCheckTCP:
+		return "tcp connect"
+	case types.HealthCheckWebSocket:
+		path := h.Path
+		if path == "" {
+			path = "/"
+		}
+		return "websocket " + path
+	}
+	method := h.Method
+	if method == "" {
+		method = "GET"
+	}
+	return method + " " + h.Path
 }
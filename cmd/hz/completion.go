@@ -0,0 +1,174 @@
+package hz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// completionTimeout bounds asking the running hz for its services, so a
+// stuck instance doesn't stall the shell
+const completionTimeout = 25 * time.Millisecond
+
+// completeServices completes the first argument with the names of the
+// services keep accepts, described by their targets
+func completeServices(keep func(*types.Service) bool) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return serviceCompletions(keep, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// Services to complete: in the config file, for commands that edit it;
+// enabled or disabled ones; and ones whose health checks can be paused
+func inConfig(svc *types.Service) bool        { return !svc.Dynamic }
+func disabledService(svc *types.Service) bool { return svc.Disabled && !svc.Dynamic }
+func enabledService(svc *types.Service) bool  { return !svc.Disabled && !svc.Dynamic }
+func healthChecked(svc *types.Service) bool {
+	return !svc.Disabled && (svc.Dynamic || svc.Health.Enabled()) // a dynamic service's checks aren't known
+}
+
+// completeServiceFlag completes a flag's value with any service's name
+func completeServiceFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return serviceCompletions(nil, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// serviceCompletions returns "name\ttarget" for the services starting with
+// prefix that keep accepts, or all of them if keep is nil
+func serviceCompletions(keep func(*types.Service) bool, prefix string) []string {
+	var out []string
+	for _, svc := range completionServices() {
+		if strings.HasPrefix(svc.Name, prefix) && (keep == nil || keep(svc)) {
+			out = append(out, svc.Name+"\t"+svc.Target)
+		}
+	}
+	return out
+}
+
+// completionServices returns the configured services and those only the
+// running hz has, marked Dynamic. Errors leave services out: completions
+// print nothing rather than a message in the middle of the command line.
+func completionServices() []*types.Service {
+	server := types.ServerConfig{Port: config.DefaultPort}
+	var services []*types.Service
+	if cfg := completionConfig(); cfg != nil {
+		server = cfg.Server
+		services = cfg.Services
+	}
+
+	client := &http.Client{Timeout: completionTimeout}
+	resp, err := client.Get(localAddr(server) + "/__hz/services")
+	if err != nil {
+		return services
+	}
+	defer resp.Body.Close()
+	var infos []admin.ServiceInfo
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&infos) != nil {
+		return services
+	}
+	for _, info := range infos {
+		known := slices.ContainsFunc(services, func(svc *types.Service) bool { return svc.Name == info.Name })
+		if !known {
+			services = append(services, &types.Service{Name: info.Name, Target: info.Target, Dynamic: true})
+		}
+	}
+	return services
+}
+
+// completionConfig loads the local config file, or returns nil. Remote
+// configs are skipped: fetching one would be too slow to complete with.
+func completionConfig() *types.Config {
+	path := cfgFile
+	if path == "" {
+		var err error
+		if path, err = config.FindConfigFile(); err != nil {
+			return nil
+		}
+	}
+	if config.IsRemote(path) {
+		return nil
+	}
+	m, err := config.NewManager(path)
+	if err != nil {
+		return nil
+	}
+	return m.Get()
+}
+
+// routeKinds are the --route forms besides a path, as "prefix\tdescription"
+var routeKinds = []string{
+	"header:\tmatch a header: key=value, key, !key or key=~regex",
+	"subdomain:\tmatch a subdomain of the host",
+	"host:\tmatch the whole host",
+	"query:\tmatch a query parameter: key=value",
+	"method:\tmatch methods: GET,HEAD",
+}
+
+// completeRoute completes --route with the route kinds, the methods after
+// method:, and the path prefixes other services route already
+func completeRoute(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if rest, ok := strings.CutPrefix(toComplete, "method:"); ok {
+		// Complete the last of a comma-separated list
+		done, last := "", rest
+		if i := strings.LastIndex(rest, ","); i >= 0 {
+			done, last = rest[:i+1], rest[i+1:]
+		}
+		var out []string
+		for _, m := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"} {
+			if strings.HasPrefix(m, strings.ToUpper(last)) {
+				out = append(out, "method:"+done+m)
+			}
+		}
+		return out, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+
+	var out []string
+	for _, kind := range routeKinds {
+		if strings.HasPrefix(kind, toComplete) {
+			out = append(out, kind)
+		}
+	}
+	if strings.HasPrefix(toComplete, "/") || toComplete == "" {
+		out = append(out, routePrefixes(toComplete)...)
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// routePrefixes returns the first path segments of the configured path
+// routes starting with prefix, like "/api/", described by their services
+func routePrefixes(prefix string) []string {
+	cfg := completionConfig()
+	if cfg == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, svc := range cfg.Services {
+		for _, r := range svc.Routes {
+			// Regex paths and parameters have no prefix to offer
+			if strings.HasPrefix(r.Path, "~") {
+				continue
+			}
+			first, _, _ := strings.Cut(strings.TrimPrefix(r.Path, "/"), "/")
+			if first == "" || strings.ContainsAny(first, "*{:") {
+				continue
+			}
+			p := "/" + first + "/"
+			if !seen[p] && strings.HasPrefix(p, prefix) {
+				seen[p] = true
+				out = append(out, fmt.Sprintf("%s\troutes to %s", p, svc.Name))
+			}
+		}
+	}
+	return out
+}
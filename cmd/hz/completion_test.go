@@ -0,0 +1,172 @@
+package hz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// completionSetup writes a config and serves the running hz's services from
+// it, one of them only known to the running hz
+func completionSetup(t *testing.T, running bool) {
+	t.Helper()
+	port := 1 // nothing listens there
+	if running {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/__hz/services" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"name":"web","target":"http://localhost:5173"},{"name":"worker","target":"http://localhost:9000","dynamic":true}]`)
+		}))
+		t.Cleanup(ts.Close)
+		_, p, _ := net.SplitHostPort(ts.Listener.Addr().String())
+		fmt.Sscan(p, &port)
+	}
+
+	path := filepath.Join(t.TempDir(), "hz.yaml")
+	cfg := fmt.Sprintf(`server:
+  host: 127.0.0.1
+  port: %d
+services:
+  - name: web
+    target: http://localhost:5173
+    health:
+      path: /health
+    routes:
+      - path: /app/*
+  - name: api
+    target: http://localhost:8080
+    routes:
+      - path: /api/v1/*
+      - path: /api/v2/*
+      - path: /:tenant/x
+      - path: "~^/legacy"
+  - name: admin
+    target: http://localhost:8081
+    disabled: true
+    routes:
+      - path: /admin
+`, port)
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := cfgFile
+	cfgFile = path
+	t.Cleanup(func() { cfgFile = old })
+}
+
+// names returns the completions without their descriptions
+func names(completions []string) []string {
+	out := make([]string, len(completions))
+	for i, c := range completions {
+		out[i], _, _ = strings.Cut(c, "\t")
+	}
+	return out
+}
+
+func TestCompleteServices(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+		keep    func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+		args    []string
+		prefix  string
+		want    []string
+	}{
+		{name: "hz remove", keep: completeServices(inConfig), want: []string{"web", "api", "admin"}},
+		{name: "hz remove, with hz running", running: true, keep: completeServices(inConfig), want: []string{"web", "api", "admin"}},
+		{name: "prefix", keep: completeServices(inConfig), prefix: "a", want: []string{"api", "admin"}},
+		{name: "hz enable", keep: completeServices(disabledService), want: []string{"admin"}},
+		{name: "hz disable", keep: completeServices(enabledService), want: []string{"web", "api"}},
+		{name: "hz health pause", running: true, keep: completeServices(healthChecked), want: []string{"web", "worker"}},
+		{name: "second argument", keep: completeServices(inConfig), args: []string{"web"}, want: nil},
+		{name: "--service", running: true, keep: completeServiceFlag, want: []string{"web", "api", "admin", "worker"}},
+		{name: "--service, hz not running", keep: completeServiceFlag, want: []string{"web", "api", "admin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completionSetup(t, tt.running)
+			got, directive := tt.keep(nil, tt.args, tt.prefix)
+			if !slices.Equal(names(got), tt.want) {
+				t.Errorf("completed %q, want %q", names(got), tt.want)
+			}
+			if directive&cobra.ShellCompDirectiveNoFileComp == 0 {
+				t.Error("file names are completed too")
+			}
+		})
+	}
+
+	t.Run("described by target", func(t *testing.T) {
+		completionSetup(t, true)
+		got, _ := completeServiceFlag(nil, nil, "wo")
+		if !slices.Equal(got, []string{"worker\thttp://localhost:9000"}) {
+			t.Errorf("completed %q", got)
+		}
+	})
+}
+
+func TestCompleteRoute(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"header:", "subdomain:", "host:", "query:", "method:", "/app/", "/api/", "/admin/"}},
+		{"h", []string{"header:", "host:"}},
+		{"/a", []string{"/app/", "/api/", "/admin/"}},
+		{"/api", []string{"/api/"}},
+		{"/x", nil},
+		{"method:", []string{"method:GET", "method:HEAD", "method:POST", "method:PUT", "method:PATCH", "method:DELETE", "method:OPTIONS"}},
+		{"method:p", []string{"method:POST", "method:PUT", "method:PATCH"}},
+		{"method:GET,h", []string{"method:GET,HEAD"}},
+	}
+	for _, tt := range tests {
+		completionSetup(t, false)
+		got, directive := completeRoute(nil, nil, tt.prefix)
+		if !slices.Equal(names(got), tt.want) {
+			t.Errorf("--route %q completed %q, want %q", tt.prefix, names(got), tt.want)
+		}
+		if directive&cobra.ShellCompDirectiveNoSpace == 0 {
+			t.Errorf("--route %q: a space follows the completion", tt.prefix)
+		}
+	}
+}
+
+// TestCompleteCommandLine completes through cobra, as the shell scripts do
+func TestCompleteCommandLine(t *testing.T) {
+	completionSetup(t, false)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"remove", "w"}, "web\thttp://localhost:5173"},
+		{[]string{"enable", ""}, "admin\thttp://localhost:8081"},
+		{[]string{"add", "docs", "http://localhost:4000", "--route", "/ap"}, "/app/\troutes to web"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs(append([]string{cobra.ShellCompRequestCmd, "--config", cfgFile}, tt.args...))
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), tt.want+"\n") {
+			t.Errorf("%q completed\n%s\nwant %q", tt.args, out.String(), tt.want)
+		}
+	}
+	rootCmd.SetOut(nil)
+	rootCmd.SetErr(nil)
+	rootCmd.SetArgs(nil)
+}
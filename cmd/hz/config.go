@@ -0,0 +1,339 @@
+package hz
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/schema"
+	"github.com/zymawy/hz/internal/tunnel"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configQuiet       bool
+	configEffective   bool
+	configFormat      string
+	configShowSecrets bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the hz configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration for errors",
+	Long: `Check hz.yaml (or --config) and its included files without starting hz.
+
+Every problem is listed with its file, line and column: syntax errors, unknown
+fields, invalid durations and URLs, duplicate service names and invalid or
+conflicting routes. Conflicting routes are warnings. The exit code is
+non-zero when there is an error.
+
+Examples:
+  hz config validate               # Check hz.yaml
+  hz config validate -c prod.yaml  # Check another file
+  hz config validate --quiet       # Only print errors, e.g. in a git hook`,
+	Args: cobra.NoArgs,
+	RunE: runConfigValidate,
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config format",
+	Long: `Print a JSON Schema (draft 2020-12) for hz.yaml, for editor completion
+and validation. A running hz also serves it at /__hz/schema.
+
+Examples:
+  hz config schema > hz.schema.json
+
+  # First line of hz.yaml, for editors using yaml-language-server:
+  # yaml-language-server: $schema=./hz.schema.json`,
+	Args: cobra.NoArgs,
+	RunE: runConfigSchema,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [path]",
+	Short: "Print a configuration value",
+	Long: `Print the value at a dotted path of the effective configuration: after
+environment expansion, includes and defaults. Without a path the whole
+configuration is printed as YAML. The tunnel auth token is masked.
+
+Lists take an index or a name: services[1].target and
+services[name=api].target both work.
+
+Examples:
+  hz config get                                   # Everything
+  hz config get server.port
+  hz config get services[name=api].health.interval
+  hz config get services[0]                       # A whole service, as YAML`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runConfigGet,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <path> <value>",
+	Short: "Change a configuration value",
+	Long: `Set the value at a dotted path in hz.yaml (or --config), keeping the
+file's comments and layout. The value is converted to the type of the
+setting (numbers, true/false, durations like 30s) and the resulting
+configuration is validated before it is saved; nothing is written if it has
+errors. Missing sections are added; list items must already exist.
+
+Examples:
+  hz config set server.port 8080
+  hz config set logging.level debug
+  hz config set services[name=api].target http://localhost:4000
+  hz config set services[1].health.interval 10s
+  hz config set tunnel.authtoken '${NGROK_AUTHTOKEN}'`,
+	Args: cobra.ExactArgs(2),
+	RunE: runConfigSet,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the configuration files or the effective configuration",
+	Long: `Print hz.yaml (or --config) and the files it includes as written.
+
+With --effective, print the configuration hz actually runs with instead:
+includes merged, the defaults block and built-in defaults applied and
+environment variables expanded. A header comment lists the files it came
+from. Secret-looking values, like the tunnel authtoken and basicAuth
+passwords or env and header entries named *TOKEN*, *SECRET*, *PASSWORD* or
+Authorization, are replaced with [redacted] unless --show-secrets is given.
+
+Examples:
+  hz config show                          # The files as written
+  hz config show --effective              # Why is hz using this port?
+  hz config show --effective --format json | jq .services`,
+	Args: cobra.NoArgs,
+	RunE: runConfigShow,
+}
+
+func init() {
+	configValidateCmd.Flags().BoolVarP(&configQuiet, "quiet", "q", false, "only print errors")
+	configShowCmd.Flags().BoolVar(&configEffective, "effective", false, "print the resolved configuration")
+	configShowCmd.Flags().StringVar(&configFormat, "format", config.FormatYAML, "output format with --effective: yaml, json or toml")
+	configShowCmd.Flags().BoolVar(&configShowSecrets, "show-secrets", false, "print secret values instead of [redacted]")
+
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	// Find config file
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	_, problems := config.Validate(configPath)
+	errs := problems.Errors()
+
+	for _, p := range errs {
+		fmt.Printf("❌ %s\n", p)
+	}
+	if !configQuiet {
+		for _, p := range problems.Warnings() {
+			fmt.Printf("⚠️  %s\n", p)
+		}
+	}
+
+	name := filepath.Base(configPath)
+	if len(errs) > 0 {
+		return fmt.Errorf("\n%s has %s", name, plural(len(errs), "error"))
+	}
+	if !configQuiet {
+		if n := len(problems.Warnings()); n > 0 {
+			fmt.Printf("\n✅ %s is valid (%s)\n", name, plural(n, "warning"))
+		} else {
+			fmt.Printf("✅ %s is valid\n", name)
+		}
+	}
+	return nil
+}
+
+func runConfigSchema(cmd *cobra.Command, args []string) error {
+	data, err := schema.JSON()
+	if err != nil {
+		return fmt.Errorf("failed to generate schema: %w", err)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	format, err := config.ParseFormat(configFormat)
+	if err != nil {
+		return err
+	}
+
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cmd.SilenceUsage = true
+	files := cfgManager.Files()
+	out := cmd.OutOrStdout()
+
+	if !configEffective {
+		for i, file := range files {
+			data, err := cfgManager.Contents(file)
+			if err != nil {
+				return fmt.Errorf("failed to read config file: %w", err)
+			}
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "# ==> %s <==\n", file)
+			out.Write(data)
+		}
+		return nil
+	}
+
+	var data []byte
+	if configShowSecrets {
+		data, err = config.Encode(format, cfgManager.Get())
+	} else {
+		data, err = config.EncodeRedacted(format, cfgManager.Get())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	// JSON has no comments, so it goes without the header
+	if format != config.FormatJSON {
+		fmt.Fprintln(out, "# Effective hz configuration: includes merged, defaults applied and")
+		fmt.Fprintln(out, "# environment variables expanded")
+		fmt.Fprintf(out, "# Source: %s\n", files[0])
+		for _, file := range files[1:] {
+			fmt.Fprintf(out, "# Included: %s\n", file)
+		}
+		if !configShowSecrets {
+			fmt.Fprintln(out, "# Secret values are redacted; --show-secrets prints them")
+		}
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	// Never print the token itself
+	cfg := *cfgManager.Get()
+	if cfg.Tunnel.AuthToken != "" {
+		cfg.Tunnel.AuthToken = tunnel.MaskToken(cfg.Tunnel.AuthToken)
+	}
+
+	if len(args) == 0 {
+		data, err := config.Encode(config.FormatYAML, &cfg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	value, err := config.Lookup(&cfg, args[0])
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return nil // not set
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Struct, reflect.Ptr, reflect.Map, reflect.Slice:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		return enc.Encode(value)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	file, err := config.OpenFile(configPath)
+	if err != nil {
+		return err
+	}
+	if err := file.Set(args[0], args[1]); err != nil {
+		return err
+	}
+
+	problems := file.Validate()
+	for _, p := range problems.Errors() {
+		fmt.Printf("❌ %s\n", p)
+	}
+	if errs := problems.Errors(); len(errs) > 0 {
+		return fmt.Errorf("\n%s not changed: the new value leaves it with %s", filepath.Base(configPath), plural(len(errs), "error"))
+	}
+	for _, p := range problems.Warnings() {
+		fmt.Printf("⚠️  %s\n", p)
+	}
+
+	if err := file.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Set %s to %s in %s\n", args[0], args[1], configPath)
+	return nil
+}
+
+// plural formats a count with a noun
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
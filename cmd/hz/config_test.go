@@ -0,0 +1,91 @@
+package hz
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestConfigShowEffective compares hz config show --effective with
+// testdata/config_show_effective.golden; go test -update rewrites it
+func TestConfigShowEffective(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"hz.yaml": `server:
+  port: ${HZ_TEST_PORT:-3000}
+include:
+  - services/*.yaml
+defaults:
+  headers:
+    X-Env: dev
+  health:
+    interval: 5s
+services:
+  - name: web
+    target: http://localhost:5173
+    routes:
+      - path: /*
+`,
+		"services/api.yaml": `services:
+  - name: api
+    target: http://localhost:${HZ_TEST_API_PORT}
+    command: npm run api
+    env:
+      API_TOKEN: ${HZ_TEST_TOKEN}
+      MODE: dev
+    routes:
+      - path: /api/*
+`,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HZ_TEST_API_PORT", "8080")
+	t.Setenv("HZ_TEST_TOKEN", "s3cret")
+
+	old := cfgFile
+	cfgFile = filepath.Join(dir, "hz.yaml")
+	configEffective, configFormat = true, "yaml"
+	t.Cleanup(func() {
+		cfgFile = old
+		configEffective, configFormat = false, "yaml"
+	})
+
+	var out bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&out)
+	if err := runConfigShow(cmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.ReplaceAll(out.String(), dir, "$DIR")
+	if strings.Contains(got, "s3cret") {
+		t.Error("the API token is printed")
+	}
+
+	golden := filepath.Join("testdata", "config_show_effective.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("hz config show --effective printed\n%s\nwant\n%s", got, want)
+	}
+}
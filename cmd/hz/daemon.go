@@ -0,0 +1,120 @@
+package hz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zymawy/hz/internal/daemon"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// daemonStartTimeout is how long hz start --daemon waits for the background
+// hz to answer
+const daemonStartTimeout = 15 * time.Second
+
+// errDaemonExited is returned when the background hz exits before it answers
+var errDaemonExited = errors.New("hz exited while starting")
+
+// startDaemon runs hz start again in the background, without --daemon, and
+// waits until it answers at the server's address
+func startDaemon(server types.ServerConfig) error {
+	p, err := daemon.Find(daemon.PIDFile)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		return fmt.Errorf("hz is already running in the background (PID %d); stop it with 'hz stop'", p.PID)
+	}
+
+	addr := localAddr(server)
+	client := &http.Client{Timeout: time.Second}
+	if resp, err := client.Get(addr + "/__hz/health"); err == nil {
+		resp.Body.Close()
+		return fmt.Errorf("%s is already in use, by another hz or another server", addr)
+	}
+
+	pid, err := launchDaemon(server, daemonArgs(os.Args[1:]))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🚀 hz is running in the background (PID %d)\n", pid)
+	fmt.Printf("   Local:  %s\n", addr)
+	fmt.Printf("   Logs:   %s (or 'hz logs -f')\n", daemon.LogFile)
+	fmt.Printf("   Stop it with 'hz stop'\n")
+	return nil
+}
+
+// launchDaemon starts hz with args in the background and keeps args for
+// hz restart. It waits until the new hz holds the pidfile and the server's
+// address answers, and returns its process ID.
+func launchDaemon(server types.ServerConfig, args []string) (int, error) {
+	if err := daemon.SaveState(daemon.StateFile, daemon.State{Args: args}); err != nil {
+		return 0, fmt.Errorf("failed to save %s: %w", daemon.StateFile, err)
+	}
+	cmd, err := daemon.Spawn(append(slices.Clip(args), "--pid-file", daemon.PIDFile), daemon.LogFile)
+	if err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	addr := localAddr(server)
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.After(daemonStartTimeout)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			_, _ = daemon.Find(daemon.PIDFile) // removes a pidfile it left
+			printLogTail(daemon.LogFile, 10)
+			return 0, fmt.Errorf("%w (%v); see %s", errDaemonExited, err, daemon.LogFile)
+		case <-deadline:
+			fmt.Printf("⏳ hz (PID %d) isn't answering at %s yet; see %s\n", pid, addr, daemon.LogFile)
+			return pid, nil
+		case <-ticker.C:
+		}
+
+		// The pidfile first: during a rolling restart, the old hz answers too
+		if p, err := daemon.Find(daemon.PIDFile); err != nil || p == nil || p.PID != pid {
+			continue
+		}
+		resp, err := client.Get(addr + "/__hz/health")
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		return pid, nil
+	}
+}
+
+// daemonArgs returns the command line without --daemon
+func daemonArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "--daemon" || strings.HasPrefix(arg, "--daemon=") {
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// printLogTail prints the last n lines of the log file at path
+func printLogTail(path string, n int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	for _, line := range lines[max(len(lines)-n, 0):] {
+		fmt.Fprintf(os.Stderr, "   %s\n", line)
+	}
+}
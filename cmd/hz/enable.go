@@ -0,0 +1,133 @@
+package hz
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/config"
+)
+
+var enableCmd = &cobra.Command{
+	Use:   "enable <name>",
+	Short: "Enable a disabled service",
+	Long: `Clear a service's disabled flag so hz registers and routes it again.
+
+A running hz picks the change up when it reloads the config.
+
+Examples:
+  hz enable legacy`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeServices(disabledService),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return setDisabled(args[0], false)
+	},
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable <name>",
+	Short: "Park a service without removing it",
+	Long: `Set a service's disabled flag: it stays in the config with its routes and
+comments, but hz doesn't register, health check or route it.
+
+A running hz picks the change up when it reloads the config.
+
+Examples:
+  hz disable legacy
+  hz enable legacy     # Bring it back`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeServices(enabledService),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return setDisabled(args[0], true)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(enableCmd)
+	rootCmd.AddCommand(disableCmd)
+}
+
+// setDisabled sets the disabled flag of a service in the file defining it
+func setDisabled(name string, disabled bool) error {
+	// Find config file
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	// Load config
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	svc := cfgManager.GetService(name)
+	if svc == nil {
+		return fmt.Errorf("service '%s' not found", name)
+	}
+
+	state := "enabled"
+	if disabled {
+		state = "disabled"
+	}
+	if svc.Disabled == disabled {
+		fmt.Printf("Service '%s' is already %s\n", name, state)
+		return nil
+	}
+
+	// Edit whichever file defines the service
+	path := configPath
+	if src := cfgManager.IncludedFrom(name); src != "" {
+		path = src
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(configPath), src)
+		}
+	}
+	file, err := config.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		err = file.SetServiceField(name, "disabled", true)
+	} else {
+		err = file.RemoveServiceField(name, "disabled")
+	}
+	if err != nil {
+		return err
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := file.Save(); err != nil {
+		return err
+	}
+
+	// The service may be in an included file, so check the whole config
+	_, problems := config.Validate(configPath)
+	for _, p := range problems.Errors() {
+		fmt.Printf("❌ %s\n", p)
+	}
+	if errs := problems.Errors(); len(errs) > 0 {
+		if err := os.WriteFile(path, original, 0644); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+		return fmt.Errorf("\n%s not changed: %s '%s' leaves the config with %s", filepath.Base(path), strings.TrimSuffix(state, "d"), name, plural(len(errs), "error"))
+	}
+	for _, p := range problems.Warnings() {
+		fmt.Printf("⚠️  %s\n", p)
+	}
+
+	fmt.Printf("✅ Service '%s' %s\n", name, state)
+	fmt.Println("   A running hz picks this up when it reloads the config")
+	return nil
+}
@@ -0,0 +1,160 @@
+package hz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/inspector"
+)
+
+var (
+	exportFormat  string
+	exportService string
+	exportSince   time.Duration
+	exportOutput  string
+	exportForce   bool
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Save the inspector's captured requests to a file",
+	Long: `Save the requests the running hz's inspector captured, as:
+  har      HTTP Archive 1.2, for browser dev tools and HAR viewers
+  ndjson   one request per line, as the inspector shows it
+  openapi  an OpenAPI 3.0 document of the paths, methods, query
+           parameters and responses seen; /users/42 becomes /users/{id}
+
+The inspector keeps the last 100 requests in memory, from when hz started
+with --inspect or hz tail turned it on. Without -o, the file is written to
+standard output. An existing file is only replaced with --force.
+
+Examples:
+  hz export -o session.har
+  hz export --format ndjson --service api --since 10m -o api.ndjson
+  hz export --format openapi -o openapi.json`,
+	Args: cobra.NoArgs,
+	RunE: runExport,
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", inspector.FormatHAR, "file format: "+strings.Join(inspector.ExportFormats, ", "))
+	exportCmd.Flags().StringVar(&exportService, "service", "", "only this service's requests")
+	exportCmd.Flags().DurationVar(&exportSince, "since", 0, "only requests this recent, like 1h")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "file to write (default: standard output)")
+	exportCmd.Flags().BoolVar(&exportForce, "force", false, "replace the output file if it exists")
+	_ = exportCmd.RegisterFlagCompletionFunc("service", completeServiceFlag)
+	_ = exportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(inspector.ExportFormats, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.AddCommand(exportCmd)
+}
+
+// runExport downloads an export from the running inspector into a file
+func runExport(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(inspector.ExportFormats, exportFormat) {
+		return fmt.Errorf("unknown format %q; use %s", exportFormat, strings.Join(inspector.ExportFormats, ", "))
+	}
+	if exportSince < 0 {
+		return fmt.Errorf("--since must not be negative")
+	}
+	cmd.SilenceUsage = true
+
+	toFile := exportOutput != "" && exportOutput != "-"
+	if toFile && !exportForce {
+		if _, err := os.Stat(exportOutput); err == nil {
+			return fmt.Errorf("%s exists; use --force to replace it", exportOutput)
+		}
+	}
+
+	cfg, _, err := statusConfig()
+	if err != nil {
+		return err
+	}
+	addr := localAddr(cfg.Server)
+
+	inspectorURL, err := enabledInspector(addr)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"format": {exportFormat}}
+	if exportService != "" {
+		query.Set("service", exportService)
+	}
+	if exportSince > 0 {
+		query.Set("since", exportSince.String())
+	}
+	resp, err := http.Get(inspectorURL + "/api/export?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("the running hz's inspector can't export; upgrade it to use hz export")
+		}
+		return fmt.Errorf("export failed: %s", strings.TrimSpace(string(body)))
+	}
+
+	// Stream into the file as the inspector writes
+	var out io.Writer = os.Stdout
+	summary := os.Stderr
+	if toFile {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if !exportForce {
+			flags |= os.O_EXCL
+		}
+		f, err := os.OpenFile(exportOutput, flags, 0o644)
+		if err != nil {
+			if errors.Is(err, os.ErrExist) {
+				return fmt.Errorf("%s exists; use --force to replace it", exportOutput)
+			}
+			return err
+		}
+		defer f.Close()
+		out, summary = f, os.Stdout
+	}
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+
+	entries, _ := strconv.Atoi(resp.Header.Get(inspector.ExportCountHeader))
+	line := fmt.Sprintf("📦 Exported %s", plural(entries, "request"))
+	from, errFrom := time.Parse(time.RFC3339, resp.Header.Get(inspector.ExportFromHeader))
+	to, errTo := time.Parse(time.RFC3339, resp.Header.Get(inspector.ExportToHeader))
+	if errFrom == nil && errTo == nil {
+		line += fmt.Sprintf(" from %s to %s", from.Local().Format("15:04:05"), to.Local().Format("15:04:05"))
+	}
+	if toFile {
+		line += " to " + exportOutput
+	}
+	fmt.Fprintf(summary, "%s (%s)\n", line, formatBytes(n))
+	return nil
+}
+
+// enabledInspector returns the URL of the running instance's inspector, or
+// an error saying how to have one
+func enabledInspector(addr string) (string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(addr + "/__hz/inspector")
+	if err != nil {
+		return "", fmt.Errorf("hz isn't running at %s, and captured requests are only kept in memory; there is nothing to export", addr)
+	}
+	info, err := inspectorResponse(resp)
+	if err != nil {
+		return "", err
+	}
+	if !info.Enabled {
+		return "", fmt.Errorf("hz's inspector is off, so no requests were captured. Start hz with --inspect, or run 'hz tail' to turn it on, then export")
+	}
+	return info.URL, nil
+}
@@ -0,0 +1,109 @@
+package hz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Control health checks of a running proxy",
+	Long: `Pause or resume health checks of services in a running hz proxy.
+
+A paused service keeps receiving traffic but is no longer checked, so a
+backend stopped on purpose doesn't flip to unhealthy or log failures. Pauses
+last until resumed or hz restarts. Resuming checks the service immediately.
+
+Examples:
+  hz health pause api     # Stop checking api
+  hz health resume api    # Check api again, starting now`,
+}
+
+var healthPauseCmd = &cobra.Command{
+	Use:               "pause <name>",
+	Short:             "Pause a service's health checks",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeServices(healthChecked),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHealthAction(args[0], "pause")
+	},
+}
+
+var healthResumeCmd = &cobra.Command{
+	Use:               "resume <name>",
+	Short:             "Resume a service's health checks",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeServices(healthChecked),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHealthAction(args[0], "resume")
+	},
+}
+
+func init() {
+	healthCmd.AddCommand(healthPauseCmd, healthResumeCmd)
+	rootCmd.AddCommand(healthCmd)
+}
+
+// runHealthAction sends a pause or resume request to the running proxy
+func runHealthAction(name, action string) error {
+	// Find config file
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/__hz/services/%s/%s", localAddr(cfgManager.Get().Server), name, action)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("hz is not running: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("%s %s: %s", action, name, body.Error)
+	}
+
+	var info admin.ServiceInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+
+	if info.Status == types.HealthStatusPaused {
+		fmt.Printf("⏸️  Paused health checks for '%s'\n", name)
+	} else {
+		fmt.Printf("▶️  Resumed health checks for '%s'\n", name)
+	}
+	return nil
+}
+
+// localAddr returns the base URL at which this machine reaches the proxy
+func localAddr(server types.ServerConfig) string {
+	host := server.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(server.Port))
+}
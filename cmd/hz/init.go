@@ -10,33 +10,60 @@ import (
 )
 
 var (
-	initForce bool
+	initForce    bool
+	initFormat   string
+	initCompose  string
+	initProcfile string
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a new hz configuration",
-	Long: `Create a new hz.yaml configuration file in the current directory.
+	Long: `Create a new hz configuration file in the current directory.
+
+The file is hz.yaml by default; use --format to write hz.json or hz.toml.
 
 The default configuration includes:
   - A backend service on port 3001
   - Basic tunnel configuration (disabled by default)
   - Standard logging settings
 
+With --from-compose, the services come from a docker-compose file: each
+compose service that publishes a host port becomes an hz service targeting
+it. The first one is the default; the others are routed by /<name>.
+
+With --from-procfile, each Procfile process becomes a service that hz runs
+as its command, targeting the port found in the command (-p 3000,
+--port=5173, PORT=4000). The web process is the default; processes without
+a port are left for you to complete.
+
 Examples:
-  hz init              # Create hz.yaml in current directory
-  hz init --force      # Overwrite existing config`,
+  hz init                # Create hz.yaml in current directory
+  hz init --format toml  # Create hz.toml instead
+  hz init --force        # Overwrite existing config
+  hz init --from-compose docker-compose.yml
+  hz init --from-procfile          # Read ./Procfile
+  hz init --from-procfile Procfile.dev`,
 	RunE: runInit,
 }
 
 func init() {
 	initCmd.Flags().BoolVarP(&initForce, "force", "f", false, "overwrite existing config file")
+	initCmd.Flags().StringVar(&initFormat, "format", "yaml", "config file format: yaml, json or toml")
+	initCmd.Flags().StringVar(&initCompose, "from-compose", "", "generate services from a docker-compose file")
+	initCmd.Flags().StringVar(&initProcfile, "from-procfile", "", "generate managed services from a Procfile (default ./Procfile)")
+	initCmd.Flags().Lookup("from-procfile").NoOptDefVal = "Procfile"
+	initCmd.MarkFlagsMutuallyExclusive("from-compose", "from-procfile")
 
 	rootCmd.AddCommand(initCmd)
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
-	configPath := "hz.yaml"
+	format, err := config.ParseFormat(initFormat)
+	if err != nil {
+		return err
+	}
+	configPath := "hz." + format
 
 	// Check if file exists
 	if _, err := os.Stat(configPath); err == nil && !initForce {
@@ -51,6 +78,12 @@ func runInit(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if initCompose != "" || initProcfile != "" {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return initFromImport(configPath)
+	}
+
 	// Create default config
 	if err := config.CreateDefaultConfig(configPath); err != nil {
 		return fmt.Errorf("failed to create config: %w", err)
@@ -60,7 +93,7 @@ func runInit(cmd *cobra.Command, args []string) error {
 	fmt.Printf("✅ Created %s\n\n", abs)
 
 	fmt.Printf("Next steps:\n")
-	fmt.Printf("  1. Edit hz.yaml to configure your services\n")
+	fmt.Printf("  1. Edit %s to configure your services\n", configPath)
 	fmt.Printf("  2. Run 'hz start' to start the proxy\n")
 	fmt.Printf("  3. Run 'hz tunnel --enable' to enable ngrok\n\n")
 
@@ -71,3 +104,60 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// initFromImport writes the config generated from a docker-compose file or
+// a Procfile
+func initFromImport(configPath string) error {
+	source := initCompose
+	importFile := config.ImportCompose
+	if initProcfile != "" {
+		source, importFile = initProcfile, config.ImportProcfile
+	}
+	imported, err := importFile(source)
+	if err != nil {
+		return err
+	}
+	if err := config.WriteConfig(configPath, imported.Data); err != nil {
+		return fmt.Errorf("failed to create config: %w", err)
+	}
+
+	abs, _ := filepath.Abs(configPath)
+	fmt.Printf("✅ Created %s from %s\n\n", abs, source)
+	fmt.Printf("📦 Services:\n")
+	cfg, problems := config.Validate(configPath)
+	if cfg != nil {
+		for _, svc := range cfg.Services {
+			target := svc.Target
+			if target == "" {
+				target = "(no target yet)"
+			}
+			fmt.Printf("   • %s → %s", svc.Name, target)
+			if svc.Default {
+				fmt.Printf(" [default]")
+			}
+			fmt.Println()
+		}
+	}
+	if len(imported.Notes) > 0 {
+		fmt.Println()
+		for _, note := range imported.Notes {
+			fmt.Printf("ℹ️  %s\n", note)
+		}
+	}
+	for _, p := range problems {
+		icon := "❌"
+		if p.Warning {
+			icon = "⚠️ "
+		}
+		fmt.Printf("%s %s\n", icon, p)
+	}
+
+	fmt.Printf("\nNext steps:\n")
+	fmt.Printf("  1. Check the routes in %s\n", configPath)
+	if initCompose != "" {
+		fmt.Printf("  2. Run 'docker compose up', then 'hz start'\n")
+	} else {
+		fmt.Printf("  2. Run 'hz start'; it runs the processes for you\n")
+	}
+	return nil
+}
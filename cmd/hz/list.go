@@ -0,0 +1,289 @@
+package hz
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	listOutput string
+	listSort   string
+)
+
+// listRow is one service in hz list. Status and the counts are only known
+// from a running instance.
+type listRow struct {
+	Name     string `json:"name" yaml:"name"`
+	Target   string `json:"target" yaml:"target"`
+	Default  bool   `json:"default,omitempty" yaml:"default,omitempty"`
+	Disabled bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Dynamic  bool   `json:"dynamic,omitempty" yaml:"dynamic,omitempty"` // added at runtime, not in the config
+	Routes   int    `json:"routes" yaml:"routes"`
+	Status   string `json:"status,omitempty" yaml:"status,omitempty"`
+	Requests *int64 `json:"requests,omitempty" yaml:"requests,omitempty"`
+	Errors   *int64 `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// serviceList is the output of hz list
+type serviceList struct {
+	Live     bool      `json:"live" yaml:"live"` // false: from the config only
+	Address  string    `json:"address" yaml:"address"`
+	Services []listRow `json:"services" yaml:"services"`
+}
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List services in a table",
+	Long: `List services one per row: target, default marker, routes, and, from a
+running hz, health status and request and error counts. When hz isn't
+running, the rows come from the config file alone and say so.
+
+Examples:
+  hz list                     # Table sized to the terminal
+  hz list --sort requests     # Busiest services first
+  hz list --output json       # For scripts`,
+	Args: cobra.NoArgs,
+	RunE: runList,
+}
+
+func init() {
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "table", "output format: table, json or yaml")
+	listCmd.Flags().StringVar(&listSort, "sort", "name", "sort by name, requests or errors")
+	rootCmd.AddCommand(listCmd)
+}
+
+// runList prints the services of the config, with live data when hz runs
+func runList(cmd *cobra.Command, args []string) error {
+	switch listOutput {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output %q; use table, json or yaml", listOutput)
+	}
+	switch listSort {
+	case "name", "requests", "errors":
+	default:
+		return fmt.Errorf("unknown sort %q; use name, requests or errors", listSort)
+	}
+	cmd.SilenceUsage = true
+
+	cfg, _, err := statusConfig()
+	if err != nil {
+		return err
+	}
+	list := serviceList{Address: localAddr(cfg.Server)}
+
+	live, err := liveServices(list.Address)
+	list.Live = err == nil
+
+	for _, svc := range cfg.Services {
+		row := listRow{
+			Name:     svc.Name,
+			Target:   svc.Target,
+			Default:  svc.Default && !svc.Disabled,
+			Disabled: svc.Disabled,
+			Routes:   len(svc.Routes),
+		}
+		if svc.Disabled {
+			row.Status = "disabled"
+		} else if info, ok := live[svc.Name]; ok {
+			row.setLive(info)
+			delete(live, svc.Name)
+		}
+		list.Services = append(list.Services, row)
+	}
+	// Services registered at runtime, like discovered containers
+	for _, info := range live {
+		row := listRow{Name: info.Name, Target: info.Target, Default: info.Default, Dynamic: true, Routes: info.Routes}
+		row.setLive(info)
+		list.Services = append(list.Services, row)
+	}
+	sortRows(list.Services, listSort)
+
+	switch listOutput {
+	case "json":
+		data, _ := json.MarshalIndent(list, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(list)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	if !list.Live {
+		fmt.Printf("⚪ hz isn't running at %s; showing the configuration only\n\n", list.Address)
+	}
+	width := 0
+	if isTerminal(os.Stdout) {
+		width, _, _ = term.GetSize(int(os.Stdout.Fd()))
+	}
+	printListTable(list, width)
+	return nil
+}
+
+// liveServices fetches the running instance's services by name
+func liveServices(addr string) (map[string]admin.ServiceInfo, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(addr + "/__hz/services")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	var infos []admin.ServiceInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+	live := make(map[string]admin.ServiceInfo, len(infos))
+	for _, info := range infos {
+		live[info.Name] = info
+	}
+	return live, nil
+}
+
+// setLive fills in a row's status and counts from the running instance
+func (r *listRow) setLive(info admin.ServiceInfo) {
+	switch {
+	case info.Maintenance != nil:
+		r.Status = "maintenance"
+	case info.Starting:
+		r.Status = "starting"
+	case info.Gated:
+		r.Status = "gated"
+	default:
+		r.Status = string(info.Status)
+	}
+	requests, errors := info.RequestCount, info.ErrorCount
+	r.Requests, r.Errors = &requests, &errors
+}
+
+// sortRows orders rows by name, or by a count, highest first
+func sortRows(rows []listRow, by string) {
+	count := func(n *int64) int64 {
+		if n == nil {
+			return 0
+		}
+		return *n
+	}
+	slices.SortStableFunc(rows, func(a, b listRow) int {
+		var c int
+		switch by {
+		case "requests":
+			c = cmp.Compare(count(b.Requests), count(a.Requests))
+		case "errors":
+			c = cmp.Compare(count(b.Errors), count(a.Errors))
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+}
+
+// printListTable prints the rows as a table. With a terminal width, long
+// targets are shortened so rows fit on one line.
+func printListTable(list serviceList, width int) {
+	headers := []string{"NAME", "TARGET", "DEFAULT", "ROUTES", "STATUS", "REQUESTS", "ERRORS"}
+	const target = 1
+
+	cells := make([][]string, 0, len(list.Services))
+	for _, r := range list.Services {
+		name := r.Name
+		if r.Dynamic {
+			name += " (dynamic)"
+		}
+		def := ""
+		if r.Default {
+			def = "*"
+		}
+		cells = append(cells, []string{name, r.Target, def, strconv.Itoa(r.Routes), orDash(r.Status), countCell(r.Requests), countCell(r.Errors)})
+	}
+
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = len(h)
+	}
+	for _, row := range cells {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	// Give the target what the other columns and the gaps leave
+	if width > 0 {
+		others := 2 * (len(headers) - 1)
+		for i, w := range widths {
+			if i != target {
+				others += w
+			}
+		}
+		widths[target] = max(min(widths[target], width-others), len(headers[target]))
+	}
+
+	printRow := func(row []string) {
+		var b strings.Builder
+		for i, cell := range row {
+			if i == target {
+				cell = truncate(cell, widths[i])
+			}
+			if i == len(row)-1 {
+				b.WriteString(cell)
+				break
+			}
+			b.WriteString(cell)
+			b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2))
+		}
+		fmt.Println(strings.TrimRight(b.String(), " "))
+	}
+	printRow(headers)
+	for _, row := range cells {
+		printRow(row)
+	}
+}
+
+// truncate shortens s to n runes, ending it with an ellipsis
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 1 {
+		return "…"
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// orDash shows an unknown value as a dash
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// countCell formats a live count, or a dash without one
+func countCell(n *int64) string {
+	if n == nil {
+		return "-"
+	}
+	return strconv.FormatInt(*n, 10)
+}
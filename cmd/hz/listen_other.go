@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package hz
+
+import "net"
+
+// listen listens on addr. There is no SO_REUSEPORT here, so reusePort is
+// ignored.
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// portShareable is false without SO_REUSEPORT, so hz restart --rolling
+// restarts one hz after the other
+func portShareable(addr string) bool {
+	return false
+}
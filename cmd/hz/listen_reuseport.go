@@ -0,0 +1,63 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package hz
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listen listens on addr. With reusePort, another process that sets
+// SO_REUSEPORT too can listen on the same port, as the new hz does during
+// hz restart --rolling.
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	if !reusePort {
+		return net.Listen("tcp", addr)
+	}
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) {
+				err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			}); cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// portShareable reports whether a new hz could listen on addr next to the
+// one holding it. It only binds a socket: a listening one would take a
+// share of the connections until closed.
+func portShareable(addr string) bool {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return false
+	}
+
+	family := unix.AF_INET6
+	var sa unix.Sockaddr
+	if ip4 := tcpAddr.IP.To4(); ip4 != nil {
+		family = unix.AF_INET
+		sa = &unix.SockaddrInet4{Port: tcpAddr.Port, Addr: [4]byte(ip4)}
+	} else {
+		sa6 := &unix.SockaddrInet6{Port: tcpAddr.Port}
+		copy(sa6.Addr[:], tcpAddr.IP.To16()) // nil: any address
+		sa = sa6
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+		return false
+	}
+	return unix.Bind(fd, sa) == nil
+}
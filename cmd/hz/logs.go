@@ -0,0 +1,199 @@
+package hz
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/logs"
+)
+
+var (
+	logsFollow  bool
+	logsLevel   string
+	logsService string
+	logsLines   int
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show the running proxy's recent logs",
+	Long: `Print the log lines a running hz kept, as 'hz start' printed them. hz
+keeps the last server.logBuffer lines (default 1000).
+
+Log lines have no level, so --level goes by their wording: errors mention
+an error or a failure, warnings things like lost tunnels, denied requests
+and exited processes. --service keeps a service's process output and the
+lines starting with its name.
+
+Examples:
+  hz logs                 # The last 100 lines
+  hz logs -f              # Keep printing new lines, across hz restarts
+  hz logs --level warn    # Warnings and errors only
+  hz logs --service api -n 20`,
+	Args: cobra.NoArgs,
+	RunE: runLogs,
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "keep printing new lines until interrupted")
+	logsCmd.Flags().StringVar(&logsLevel, "level", logs.LevelInfo, "least severe level to show ("+strings.Join(logs.Levels, ", ")+")")
+	logsCmd.Flags().StringVar(&logsService, "service", "", "only show lines about this service")
+	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 100, "show the last n lines kept (0: all)")
+	_ = logsCmd.RegisterFlagCompletionFunc("service", completeServiceFlag)
+	rootCmd.AddCommand(logsCmd)
+}
+
+// runLogs prints the running instance's recent log lines
+func runLogs(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(logs.Levels, logsLevel) {
+		return fmt.Errorf("unknown level %q; use %s", logsLevel, strings.Join(logs.Levels, ", "))
+	}
+	if logsLines < 0 {
+		return fmt.Errorf("--lines must not be negative")
+	}
+	cmd.SilenceUsage = true
+
+	// Find config file
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	endpoint := localAddr(cfgManager.Get().Server) + "/__hz/logs"
+	query := url.Values{"level": {logsLevel}}
+	if logsService != "" {
+		query.Set("service", logsService)
+	}
+	if logsLines > 0 {
+		query.Set("lines", strconv.Itoa(logsLines))
+	}
+	if logsFollow {
+		return followLogs(endpoint, query)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(endpoint + "?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("hz is not running: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := logsError(resp); err != nil {
+		return err
+	}
+
+	var entries []logs.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	for _, e := range entries {
+		fmt.Println(e.Line)
+	}
+	return nil
+}
+
+// followLogs prints new log lines until interrupted. When hz stops, it
+// waits for it to come back, then goes on where it left off, or from the
+// first line of a restarted hz.
+func followLogs(endpoint string, query url.Values) error {
+	query.Set("follow", "true")
+	var session string
+	var seq int64
+	waiting := false
+
+	for {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if session != "" {
+			// Everything since the last line seen, not just the last n
+			q.Del("lines")
+			q.Set("session", session)
+			q.Set("since", strconv.FormatInt(seq, 10))
+		}
+
+		resp, err := http.Get(endpoint + "?" + q.Encode())
+		if err != nil {
+			if session == "" {
+				return fmt.Errorf("hz is not running: %w", err)
+			}
+			if !waiting {
+				fmt.Fprintln(os.Stderr, "⏳ hz stopped; waiting for it to come back...")
+				waiting = true
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		if err := logsError(resp); err != nil {
+			resp.Body.Close()
+			return err
+		}
+
+		current := resp.Header.Get(admin.LogSessionHeader)
+		if session != "" && current != session {
+			fmt.Fprintln(os.Stderr, "🔄 hz restarted")
+			seq = 0
+		}
+		session, waiting = current, false
+
+		seq = printLogEvents(resp, seq)
+		resp.Body.Close()
+	}
+}
+
+// printLogEvents prints the lines of a log stream until it ends, and
+// returns the sequence number of the last one
+func printLogEvents(resp *http.Response, seq int64) int64 {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e logs.Entry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			continue
+		}
+		fmt.Println(e.Line)
+		seq = e.Seq
+	}
+	return seq
+}
+
+// logsError returns the error a failed /__hz/logs request reported
+func logsError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) != nil || body.Error == "" {
+		body.Error = resp.Status
+	}
+	if resp.StatusCode == http.StatusNotFound && body.Error == resp.Status {
+		return fmt.Errorf("this hz doesn't keep logs; upgrade it to use hz logs")
+	}
+	return fmt.Errorf("hz logs failed: %s", body.Error)
+}
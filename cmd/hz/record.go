@@ -0,0 +1,52 @@
+package hz
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	recordOut          string
+	recordMatchHeaders []string
+	recordIgnoreQuery  []string
+)
+
+var recordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Start the proxy and record traffic to a session file",
+	Long: `Start the hz proxy and record every proxied request and response to a
+session file that can later be replayed without any backend running.
+
+Requests are keyed on method, path, query string and the selected headers.
+To replay a session, point a service at it:
+
+  services:
+    - name: backend
+      target: "replay://session.hzr"
+      replay:
+        ignoreQuery: [_ts]
+
+Examples:
+  hz record --out session.hzr
+  hz record --out session.hzr --match-header Accept
+  hz record --out session.hzr --ignore-query _ts --ignore-query csrf`,
+	RunE: runRecord,
+}
+
+func init() {
+	recordCmd.Flags().StringVarP(&recordOut, "out", "o", "", "session file to write")
+	recordCmd.Flags().StringArrayVar(&recordMatchHeaders, "match-header", nil, "request header to include in the replay key")
+	recordCmd.Flags().StringArrayVar(&recordIgnoreQuery, "ignore-query", nil, "query parameter to ignore when replaying")
+	recordCmd.Flags().IntVarP(&port, "port", "p", 0, "override port from config")
+	recordCmd.Flags().BoolVar(&noTunnel, "no-tunnel", false, "disable ngrok tunnel")
+
+	rootCmd.AddCommand(recordCmd)
+}
+
+func runRecord(cmd *cobra.Command, args []string) error {
+	if recordOut == "" {
+		return fmt.Errorf("--out is required")
+	}
+	return runStart(cmd, args)
+}
@@ -2,12 +2,9 @@ package hz
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/zymawy/hz/internal/config"
-	"github.com/zymawy/hz/pkg/types"
-	"gopkg.in/yaml.v3"
 )
 
 var removeCmd = &cobra.Command{
@@ -19,8 +16,9 @@ var removeCmd = &cobra.Command{
 Examples:
   hz remove backend
   hz rm api`,
-	Args: cobra.ExactArgs(1),
-	RunE: runRemove,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeServices(inConfig),
+	RunE:              runRemove,
 }
 
 func init() {
@@ -46,33 +44,22 @@ func runRemove(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	cfg := cfgManager.Get()
-
-	// Find and remove service
-	found := false
-	newServices := make([]*types.Service, 0, len(cfg.Services))
-	for _, svc := range cfg.Services {
-		if svc.Name == name {
-			found = true
-			continue
-		}
-		newServices = append(newServices, svc)
-	}
-
-	if !found {
-		return fmt.Errorf("service '%s' not found", name)
+	if src := cfgManager.IncludedFrom(name); src != "" {
+		return fmt.Errorf("service '%s' is defined in %s, remove it there", name, src)
 	}
 
-	cfg.Services = newServices
-
-	// Save config
-	data, err := yaml.Marshal(cfg)
+	// Remove the service from the file, keeping everything else as written
+	file, err := config.OpenFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
+	}
+	if err := file.RemoveService(name); err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	// Save config
+	if err := file.Save(); err != nil {
+		return err
 	}
 
 	fmt.Printf("✅ Removed service '%s'\n", name)
@@ -0,0 +1,195 @@
+package hz
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/daemon"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// Exit statuses of hz restart besides 0 (restarted) and 1 (failed)
+const (
+	restartStartedFresh exitStatus = 3 // no hz was running; one was started
+	restartForeground   exitStatus = 4 // hz runs in a terminal; nothing was done
+)
+
+var (
+	restartRolling bool
+	restartTimeout time.Duration
+)
+
+var restartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart the hz running in the background",
+	Long: `Restart the hz that 'hz start --daemon' started in this directory, with
+the flags it was started with. Use it for changes a reload doesn't apply,
+like a new tunnel domain.
+
+With --rolling, the new hz listens on the port before the old one stops,
+and the old one finishes its requests while the new one takes new ones.
+That needs SO_REUSEPORT (Linux, macOS and the BSDs) and an old hz that
+allows sharing; with the tunnel or the inspector, which can't run twice,
+with services hz runs a command for, or without SO_REUSEPORT, hz restarts
+one after the other.
+
+With no hz in the background, hz restart starts one, with the flags of the
+last one started here. An hz running in a terminal is left alone.
+
+Exit status:
+  0  restarted
+  1  failed
+  3  wasn't running; started
+  4  running in a terminal; not restarted
+
+Examples:
+  hz restart              # Stop, then start with the same flags
+  hz restart --rolling    # Start the new hz before the old one stops`,
+	Args: cobra.NoArgs,
+	RunE: runRestart,
+}
+
+func init() {
+	restartCmd.Flags().BoolVar(&restartRolling, "rolling", false, "start the new hz before the old one stops, when the port can be shared")
+	restartCmd.Flags().DurationVar(&restartTimeout, "timeout", 15*time.Second, "how long to wait for the old hz to exit")
+	rootCmd.AddCommand(restartCmd)
+}
+
+// runRestart restarts the background hz, or starts one
+func runRestart(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	p, err := daemon.Find(daemon.PIDFile)
+	if err != nil {
+		return err
+	}
+	startArgs, err := restartArgs()
+	if err != nil {
+		return err
+	}
+	cfg, err := restartConfig(startArgs)
+	if err != nil {
+		return err
+	}
+	server := cfg.Server
+	addr := localAddr(server)
+
+	if p == nil {
+		client := &http.Client{Timeout: 2 * time.Second}
+		if resp, err := client.Get(addr + "/__hz/health"); err == nil {
+			resp.Body.Close()
+			fmt.Printf("🟡 hz is running at %s, but not in the background from here\n", addr)
+			fmt.Printf("   Restart it in its terminal: Ctrl+C, then start it again.\n")
+			fmt.Printf("   For config changes, reloading is enough: kill -HUP <pid> or POST /__hz/reload.\n")
+			fmt.Printf("   Start it with 'hz start --daemon' to use hz restart.\n")
+			cmd.SilenceErrors = true
+			return restartForeground
+		}
+
+		pid, err := launchDaemon(server, startArgs)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🚀 hz wasn't running; started it in the background (PID %d)\n", pid)
+		cmd.SilenceErrors = true
+		return restartStartedFresh
+	}
+
+	if restartRolling {
+		if reason := rollingBlocker(cfg); reason != "" {
+			fmt.Printf("↪️  Restarting one after the other: %s\n", reason)
+		} else {
+			fmt.Printf("🔄 Starting a new hz next to PID %d...\n", p.PID)
+			pid, err := launchDaemon(server, startArgs)
+			if err != nil {
+				return fmt.Errorf("%w; hz (PID %d) keeps running", err, p.PID)
+			}
+			fmt.Printf("🛑 Stopping the old hz (PID %d) once its requests finish...\n", p.PID)
+			if err := daemon.Stop(p, daemon.PIDFile, restartTimeout); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Restarted (PID %d → %d)\n", p.PID, pid)
+			return nil
+		}
+	}
+
+	fmt.Printf("🛑 Stopping hz (PID %d)...\n", p.PID)
+	if err := daemon.Stop(p, daemon.PIDFile, restartTimeout); err != nil {
+		return err
+	}
+	pid, err := launchDaemon(server, startArgs)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Restarted (PID %d → %d)\n", p.PID, pid)
+	return nil
+}
+
+// restartArgs returns the command line the background hz was started
+// with, or hz start with this command's config file if it isn't known
+func restartArgs() ([]string, error) {
+	state, err := daemon.LoadState(daemon.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && len(state.Args) > 0 {
+		return state.Args, nil
+	}
+	args := []string{"start"}
+	if cfgFile != "" {
+		args = append(args, "--config", cfgFile)
+	}
+	return args, nil
+}
+
+// restartConfig reads args as hz start would, and returns the
+// configuration the new hz will have. Config errors show up here, before
+// the old hz is stopped.
+func restartConfig(args []string) (*types.Config, error) {
+	c, flags, err := rootCmd.Find(args)
+	if err != nil || c != startCmd {
+		return nil, fmt.Errorf("can't restart %q: not an hz start command line", args)
+	}
+	if err := startCmd.ParseFlags(flags); err != nil {
+		return nil, fmt.Errorf("invalid flags in %s: %w", daemon.StateFile, err)
+	}
+
+	cfgManager, err := loadStartConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg := cfgManager.Get()
+	if port > 0 {
+		cfg.Server.Port = port
+	}
+	return cfg, nil
+}
+
+// rollingBlocker returns why the new hz can't start next to the old one, or
+// "" if it can
+func rollingBlocker(cfg *types.Config) string {
+	managed := managedService(cfg)
+	switch {
+	case cfg.Tunnel.Enabled && !noTunnel:
+		return "the tunnel can't run twice at once"
+	case inspect:
+		return "the inspector's port can't be shared"
+	case managed != "":
+		return fmt.Sprintf("service %s runs a command, which can't run twice at once", managed)
+	case !portShareable(fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)):
+		return "the port can't be shared (no SO_REUSEPORT, or the old hz predates it)"
+	}
+	return ""
+}
+
+// managedService returns the first service hz starts a process for, or ""
+func managedService(cfg *types.Config) string {
+	for _, svc := range cfg.Services {
+		if svc.Command != "" && !svc.Disabled {
+			return svc.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package hz
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/tunnel"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+var sessionsKill string
+
+var tunnelSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List or stop the ngrok account's agent sessions",
+	Long: `List the agent sessions open on the ngrok account, or stop one.
+
+Free ngrok accounts allow one agent session at a time, so a forgotten hz or
+ngrok in another terminal keeps the tunnel from starting (ERR_NGROK_108).
+This needs an ngrok API key (dashboard → API), which is not the auth token:
+set tunnel.apiKey or NGROK_API_KEY.
+
+Examples:
+  hz tunnel sessions                  # List sessions
+  hz tunnel sessions --kill ts_2abc   # Stop one`,
+	Args: cobra.NoArgs,
+	RunE: runTunnelSessions,
+}
+
+func init() {
+	tunnelSessionsCmd.Flags().StringVar(&sessionsKill, "kill", "", "stop the session with this ID")
+	tunnelCmd.AddCommand(tunnelSessionsCmd)
+}
+
+func runTunnelSessions(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	// Find config file
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	apiKey := tunnel.ResolveAPIKey(&cfgManager.Get().Tunnel)
+	if apiKey == "" {
+		return fmt.Errorf("no ngrok API key; set tunnel.apiKey or NGROK_API_KEY (the auth token can't be used for the API)")
+	}
+	api := tunnel.NewNgrokAPI(apiKey)
+
+	if sessionsKill != "" {
+		if err := api.StopSession(cmd.Context(), sessionsKill); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Stopped ngrok session %s\n", sessionsKill)
+		return nil
+	}
+
+	sessions, err := api.Sessions(cmd.Context())
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No ngrok agent sessions are open")
+		return nil
+	}
+	fmt.Printf("🌐 ngrok sessions:\n")
+	printNgrokSessions(sessions)
+	return nil
+}
+
+// printNgrokSessions lists sessions with where and when they started
+func printNgrokSessions(sessions []tunnel.NgrokSession) {
+	for _, s := range sessions {
+		fmt.Printf("   • %s  %s, started %s ago\n", s.ID, describeSession(s), time.Since(s.StartedAt).Round(time.Second))
+	}
+}
+
+// describeSession names the agent of a session: hz and its host, or the
+// agent's address and OS
+func describeSession(s tunnel.NgrokSession) string {
+	if host := s.Hostname(); host != "" {
+		return "hz on " + host
+	}
+	return fmt.Sprintf("agent %s at %s (%s)", s.AgentVersion, s.IP, s.OS)
+}
+
+// resolveSessionLimit explains a tunnel refused for the account's session
+// limit by listing the open sessions and, on a terminal, offers to stop
+// them. It reports whether any was stopped, so starting again may work.
+// Without an API key, or when the API fails, it only prints a hint.
+func resolveSessionLimit(ctx context.Context, cfg *types.TunnelConfig) bool {
+	apiKey := tunnel.ResolveAPIKey(cfg)
+	if apiKey == "" {
+		fmt.Printf("   Another ngrok agent holds the account's session. Stop it, or set\n")
+		fmt.Printf("   NGROK_API_KEY to have hz list the sessions and offer to stop them.\n")
+		return false
+	}
+
+	api := tunnel.NewNgrokAPI(apiKey)
+	sessions, err := api.Sessions(ctx)
+	if err != nil || len(sessions) == 0 {
+		if err != nil {
+			fmt.Printf("   ⚠️  %v\n", err)
+		}
+		return false
+	}
+
+	fmt.Printf("   Another ngrok agent holds the account's session:\n")
+	printNgrokSessions(sessions)
+	if !isTerminal(os.Stdin) {
+		fmt.Printf("   Stop one with: hz tunnel sessions --kill <id>\n")
+		return false
+	}
+	return promptStopSessions(ctx, api, sessions, os.Stdin)
+}
+
+// promptStopSessions asks whether to stop each session and reports whether
+// any was stopped. Nothing is stopped without a "y".
+func promptStopSessions(ctx context.Context, api *tunnel.NgrokAPI, sessions []tunnel.NgrokSession, in io.Reader) bool {
+	reader := bufio.NewReader(in)
+	stopped := false
+	for _, s := range sessions {
+		fmt.Printf("   Stop %s (%s) and retry? [y/N] ", s.ID, describeSession(s))
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			break
+		}
+		answer := strings.TrimSpace(line)
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			continue
+		}
+		if err := api.StopSession(ctx, s.ID); err != nil {
+			fmt.Printf("   ❌ %v\n", err)
+			continue
+		}
+		fmt.Printf("   ✅ Stopped %s\n", s.ID)
+		stopped = true
+	}
+	return stopped
+}
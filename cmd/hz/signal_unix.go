@@ -0,0 +1,14 @@
+//go:build !windows
+
+package hz
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReload relays SIGHUP, the signal asking hz to reload its config
+func notifyReload(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
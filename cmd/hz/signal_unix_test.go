@@ -0,0 +1,102 @@
+//go:build !windows
+
+package hz
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestReloadOnSIGHUP sends hz SIGHUP: each signal reloads the config
+// exactly once, and a broken config is reported instead of applied
+func TestReloadOnSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hz.yaml")
+	write := func(port string) {
+		data := "services:\n  - name: web\n    target: http://localhost:" + port + "\n    default: true\n"
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("5173")
+	m, err := config.NewManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	var reloads atomic.Int64
+	m.OnReload(func(*types.Config) { reloads.Add(1) })
+
+	var logs syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal, 1)
+	notifyReload(hup)
+	defer signal.Stop(hup)
+	go reloadOnSignal(ctx, hup, m, log.New(&logs, "", 0))
+
+	// sighup sends SIGHUP and waits for the reloads to reach want, and for no more to follow
+	sighup := func(want int64) {
+		t.Helper()
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for reloads.Load() < want && !strings.Contains(logs.String(), "reload failed") && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if got := reloads.Load(); got != want {
+			t.Fatalf("%d reloads, want %d; log:\n%s", got, want, logs.String())
+		}
+	}
+
+	write("5174")
+	sighup(1)
+	if target := m.GetService("web").Target; target != "http://localhost:5174" {
+		t.Errorf("target after SIGHUP = %s, want the new one", target)
+	}
+	sighup(2)
+
+	if err := os.WriteFile(path, []byte("services: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sighup(2)
+	if !strings.Contains(logs.String(), "[config] reload failed, keeping the current configuration") {
+		t.Errorf("the broken config wasn't reported:\n%s", logs.String())
+	}
+	if target := m.GetService("web").Target; target != "http://localhost:5174" {
+		t.Errorf("target after a failed reload = %s, want the previous one", target)
+	}
+}
+
+// syncBuffer collects log output written from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package hz
+
+import "os"
+
+// notifyReload does nothing: Windows has no SIGHUP, so use
+// POST /__hz/reload instead
+func notifyReload(c chan<- os.Signal) {}
@@ -3,21 +3,31 @@ package hz
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
 	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/daemon"
+	"github.com/zymawy/hz/internal/discovery"
 	"github.com/zymawy/hz/internal/inspector"
+	"github.com/zymawy/hz/internal/logs"
 	"github.com/zymawy/hz/internal/proxy"
+	"github.com/zymawy/hz/internal/recorder"
 	"github.com/zymawy/hz/internal/registry"
 	"github.com/zymawy/hz/internal/router"
 	"github.com/zymawy/hz/internal/tunnel"
 	"github.com/zymawy/hz/pkg/types"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
@@ -26,6 +36,18 @@ var (
 	watch       bool
 	inspect     bool
 	inspectPort int
+	debugRoutes bool
+	noScan      bool
+	pollEvery   time.Duration
+
+	// Zero-config mode: services from flags instead of a file
+	startServices []string
+	startDefault  string
+	startTunnel   bool
+
+	// Background mode: --daemon, and the pidfile the background hz keeps
+	startDaemonize bool
+	startPIDFile   string
 )
 
 var startCmd = &cobra.Command{
@@ -47,94 +69,225 @@ Examples:
   hz start --no-tunnel        # Start without ngrok
   hz start -w                 # Watch config for changes
   hz start --inspect          # Enable web inspector at localhost:4040
-  hz start --inspect-port 8888 # Use custom inspector port`,
+  hz start --inspect-port 8888 # Use custom inspector port
+  hz start --no-scan          # Don't suggest unrouted local dev servers
+  hz start --daemon           # Run in the background; stop with 'hz stop'
+  hz start -c https://git.example.com/raw/hz.yaml  # Remote config, polled every 30s
+
+Without a config file:
+  hz start --service backend=3001 --service 'api=8080:/api/*' --default backend
+  hz start --service web=5173 --tunnel   # A single service is the default`,
 	RunE: runStart,
 }
 
 func init() {
 	startCmd.Flags().IntVarP(&port, "port", "p", 0, "override port from config")
-	startCmd.Flags().BoolVar(&noTunnel, "no-tunnel", false, "disable ngrok tunnel")
+	startCmd.Flags().BoolVar(&noTunnel, "no-tunnel", false, "disable the tunnel")
 	startCmd.Flags().BoolVarP(&watch, "watch", "w", true, "watch config file for changes")
 	startCmd.Flags().BoolVar(&inspect, "inspect", false, "enable web request inspector")
 	startCmd.Flags().IntVar(&inspectPort, "inspect-port", 4040, "web inspector port")
+	startCmd.Flags().BoolVar(&debugRoutes, "debug-routes", false, "add X-Hz-Service/Route-Pattern/Target response headers")
+	startCmd.Flags().BoolVar(&noScan, "no-scan", false, "don't look for unrouted dev servers on local ports")
+	startCmd.Flags().DurationVar(&pollEvery, "poll-interval", config.DefaultPollInterval, "how often to check a remote (http/https) config for changes")
+	startCmd.Flags().StringArrayVar(&startServices, "service", nil, "run without a config file: name=port, name=url or name=port:/path (repeatable)")
+	startCmd.Flags().StringVar(&startDefault, "default", "", "default service, with --service")
+	startCmd.Flags().BoolVar(&startTunnel, "tunnel", false, "enable the tunnel, with --service")
+	startCmd.Flags().BoolVar(&startDaemonize, "daemon", false, "run in the background, logging to .hz/hz.log")
+	startCmd.Flags().StringVar(&startPIDFile, "pid-file", "", "file to keep the process ID in while running")
+	_ = startCmd.Flags().MarkHidden("pid-file") // set by --daemon
 
 	rootCmd.AddCommand(startCmd)
 }
 
 func runStart(cmd *cobra.Command, args []string) error {
-	// Find or use specified config file
-	configPath := cfgFile
-	if configPath == "" {
-		var err error
-		configPath, err = config.FindConfigFile()
-		if err != nil {
-			return fmt.Errorf("no config file found: %w\n\nRun 'hz init' to create one", err)
-		}
-	}
-
-	fmt.Printf("📁 Loading config: %s\n", configPath)
-
-	// Load configuration
-	cfgManager, err := config.NewManager(configPath)
+	cfgManager, err := loadStartConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
 	cfg := cfgManager.Get()
+	for _, w := range cfgManager.Warnings() {
+		fmt.Printf("⚠️  %s\n", w)
+	}
 
 	// Override port if specified
 	if port > 0 {
 		cfg.Server.Port = port
 	}
 
+	if startDaemonize {
+		cmd.SilenceUsage = true
+		return startDaemon(cfg.Server)
+	}
+
+	// Listen first, so a port in use fails before anything starts. A
+	// background hz shares its port with the hz replacing it during
+	// hz restart --rolling, and writes its pidfile once it holds the port.
+	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+	listener, err := listen(addr, startPIDFile != "")
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer listener.Close()
+	if startPIDFile != "" {
+		if err := daemon.WritePID(startPIDFile); err != nil {
+			return fmt.Errorf("failed to write pidfile: %w", err)
+		}
+		defer daemon.RemovePID(startPIDFile)
+	}
+
 	// Create registry
 	reg := registry.New()
-	if err := reg.RegisterAll(cfg.Services); err != nil {
-		return fmt.Errorf("failed to register services: %w", err)
-	}
 
 	// Create router
 	rtr := router.New()
-	if err := rtr.Build(cfg.Services); err != nil {
+	rtr.SetOptions(cfg.Routing)
+	rtr.SetTrailingSlash(cfg.Server.TrailingSlash)
+	if err := rtr.Build(cfg.ActiveServices()); err != nil {
 		return fmt.Errorf("failed to build routes: %w", err)
 	}
+	for _, w := range rtr.Warnings() {
+		fmt.Printf("⚠️  %s\n", w)
+	}
 
 	// Create proxy
 	prx := proxy.New(reg, rtr)
 
-	// Set up logger
-	logger := log.New(os.Stdout, "[hz] ", log.LstdFlags)
+	// Set up logger, keeping recent lines for 'hz logs'
+	logBuffer := logs.NewBuffer(cfg.Server.LogBuffer)
+	logger := log.New(io.MultiWriter(os.Stdout, logBuffer), "[hz] ", log.LstdFlags)
 	prx.SetLogger(logger)
+	rtr.SetLogger(logger)
+	reg.SetLogger(logger)
+	prx.SetDebugHeaders(cfg.Server.DebugHeaders || debugRoutes)
+	prx.SetStrictRouting(cfg.Server.StrictRouting, cfg.Server.StrictPrefixes)
+
+	// viaProxy health checks are routed like client requests, so register
+	// services (starting their health checks) once the proxy exists
+	reg.SetProxy(prx)
+	if err := reg.RegisterAll(cfg.ActiveServices()); err != nil {
+		return fmt.Errorf("failed to register services: %w", err)
+	}
+
+	// Serve the internal API under /__hz/
+	adminServer := admin.New(reg, prx)
+	adminServer.SetConfig(cfgManager)
+	adminServer.SetLogs(logBuffer)
+	prx.SetAdmin(adminServer)
+
+	// Record traffic to a session file when started via 'hz record'
+	if recordOut != "" {
+		rec, err := recorder.Create(recordOut, types.ReplayConfig{
+			MatchHeaders: recordMatchHeaders,
+			IgnoreQuery:  recordIgnoreQuery,
+		})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = rec.Close()
+			fmt.Printf("🎬 Recorded %d requests to %s\n", rec.Count(), recordOut)
+		}()
+		prx.SetRecorder(rec)
+	}
 
-	// Setup inspector if enabled
-	var insp *inspector.Inspector
+	// Setup inspector if enabled; hz tail can enable it later
+	insp := inspector.New(inspectPort)
+	insp.SetLogger(logger)
+	insp.SetVersion(version)
+	adminServer.SetInspector(insp)
 	if inspect {
-		insp = inspector.New(inspectPort)
-		insp.SetLogger(logger)
 		prx.SetInspector(insp)
 	}
 
-	// Start watching config if enabled
-	if watch {
-		cfgManager.OnReload(func(newCfg *types.Config) {
-			fmt.Println("🔄 Reloading configuration...")
-			// Re-register services
-			for _, svc := range newCfg.Services {
-				_ = reg.Register(svc)
-			}
-			// Rebuild routes
-			_ = rtr.Build(newCfg.Services)
+	// Discovered services join the configured ones whenever either changes
+	var (
+		applyMu  sync.Mutex
+		docker   *discovery.Docker
+		accepted []*types.Service // scan suggestions confirmed at the prompt
+		added    []*types.Service // services hz add registered until the config has them
+	)
+	services := func(c *types.Config) []*types.Service {
+		var dynamic []*types.Service
+		if docker != nil {
+			dynamic = docker.Services()
+		}
+		return mergeServices(c.ActiveServices(), dynamic, accepted, added)
+	}
+	apply := func(c *types.Config) {
+		applyMu.Lock()
+		defer applyMu.Unlock()
+
+		// Once the config file has an added service, it owns it: removing or
+		// disabling it there must stick
+		added = slices.DeleteFunc(added, func(svc *types.Service) bool {
+			return slices.ContainsFunc(c.Services, func(s *types.Service) bool { return s.Name == svc.Name })
 		})
-		_ = cfgManager.Watch()
+		applyServices(reg, rtr, c, services(c), logger)
+		prx.SetDebugHeaders(c.Server.DebugHeaders || debugRoutes)
+		prx.SetStrictRouting(c.Server.StrictRouting, c.Server.StrictPrefixes)
 	}
 
-	// Create HTTP server
-	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	server := &http.Server{
-		Addr:         addr,
-		Handler:      prx,
-		ReadTimeout:  cfg.Server.ReadTimeout,
-		WriteTimeout: cfg.Server.WriteTimeout,
+	// Register services from hz add without waiting for a reload
+	adminServer.SetAddService(func(svc *types.Service) error {
+		if err := cfgManager.PrepareService(svc); err != nil {
+			return err
+		}
+		c := cfgManager.Get()
+		if slices.ContainsFunc(c.Services, func(s *types.Service) bool { return s.Name == svc.Name }) {
+			return fmt.Errorf("service %s is in the running config already; reload it to apply changes", svc.Name)
+		}
+
+		applyMu.Lock()
+		// Try the routes first, so a bad service leaves the running ones alone
+		check := router.New()
+		check.SetOptions(c.Routing)
+		check.SetTrailingSlash(c.Server.TrailingSlash)
+		if err := check.Build(append(services(c), svc)); err != nil {
+			applyMu.Unlock()
+			return err
+		}
+		added = append(added, svc)
+		applyMu.Unlock()
+
+		apply(c)
+		if _, err := reg.Get(svc.Name); err != nil {
+			applyMu.Lock()
+			added = slices.DeleteFunc(added, func(s *types.Service) bool { return s == svc })
+			applyMu.Unlock()
+			return fmt.Errorf("service %s wasn't registered; see hz's log", svc.Name)
+		}
+		return nil
+	})
+
+	// Configure local port scanning; hz's own ports are never suggested
+	scan := registry.ScanOptions{
+		Disabled: noScan,
+		Exclude:  []int{cfg.Server.Port},
+	}
+	if sc := cfg.Discovery.Scan; sc != nil {
+		scan.Ports = sc.Ports
+		scan.Timeout = sc.Timeout.Duration()
+	}
+	if inspect {
+		scan.Exclude = append(scan.Exclude, inspectPort)
+	}
+	if fp := cfg.Server.ForwardProxy; fp != nil {
+		scan.Exclude = append(scan.Exclude, fp.Port)
+	}
+	reg.SetScanOptions(scan)
+
+	// Start Docker discovery if enabled
+	discoveryCtx, stopDiscovery := context.WithCancel(context.Background())
+	defer stopDiscovery()
+	if d := cfg.Discovery.Docker; d != nil && d.Enabled {
+		docker, err = discovery.NewDocker(d)
+		if err != nil {
+			return fmt.Errorf("docker discovery: %w", err)
+		}
+		docker.SetLogger(logger)
+		docker.OnChange(func() { apply(cfgManager.Get()) })
+		go docker.Run(discoveryCtx)
 	}
 
 	// Setup tunnel if enabled
@@ -142,12 +295,56 @@ func runStart(cmd *cobra.Command, args []string) error {
 	if cfg.Tunnel.Enabled && !noTunnel {
 		tunnelManager = tunnel.New(&cfg.Tunnel)
 		tunnelManager.SetLogger(logger)
+		tunnelManager.SetServerConfig(cfg.Server)
+		adminServer.SetTunnel(tunnelManager)
+	}
+
+	// Apply reloads, whether from the watcher, SIGHUP or POST /__hz/reload
+	cfgManager.OnReload(func(newCfg *types.Config) {
+		fmt.Println("🔄 Reloading configuration...")
+		for _, w := range cfgManager.Warnings() {
+			logger.Printf("[config] %s", w)
+		}
+		apply(newCfg)
+		logBuffer.Resize(newCfg.Server.LogBuffer)
+		if tunnelManager != nil {
+			tunnelManager.UpdateConfig(&newCfg.Tunnel)
+		}
+	})
+
+	// Start watching config if enabled
+	if watch {
+		_ = cfgManager.Watch()
+	}
+
+	// Create HTTP server
+	server := &http.Server{
+		Addr:    addr,
+		Handler: h2c.NewHandler(prx, &http2.Server{}), // accept cleartext HTTP/2 (gRPC) clients
+	}
+	cfg.Server.ApplyTimeouts(server)
+	server.RegisterOnShutdown(logBuffer.Close) // end 'hz logs -f' streams
+
+	// Create forward-proxy server if enabled
+	var forwardServer *http.Server
+	if fp := cfg.Server.ForwardProxy; fp != nil {
+		forwardServer = &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", fp.Host, fp.Port),
+			Handler: prx.ForwardHandler(),
+		}
+		cfg.Server.ApplyTimeouts(forwardServer)
 	}
 
 	// Graceful shutdown handling
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Reload the config on SIGHUP, without exiting when it has errors
+	hup := make(chan os.Signal, 1)
+	notifyReload(hup)
+	defer signal.Stop(hup)
+	go reloadOnSignal(ctx, hup, cfgManager, logger)
+
 	// Start server
 	go func() {
 		fmt.Printf("\n🚀 hz proxy starting...\n")
@@ -156,36 +353,96 @@ func runStart(cmd *cobra.Command, args []string) error {
 		// Print registered services
 		fmt.Printf("\n📦 Services:\n")
 		for _, svc := range cfg.Services {
+			if svc.Disabled {
+				fmt.Printf("   ◦ %s → %s (disabled)\n", svc.Name, svc.Target)
+				continue
+			}
 			defaultMark := ""
 			if svc.Default {
 				defaultMark = " (default)"
 			}
 			fmt.Printf("   • %s → %s%s\n", svc.Name, svc.Target, defaultMark)
+			if svc.Command != "" {
+				fmt.Printf("     ⚙️  %s\n", svc.Command)
+			}
 		}
 
-		// Start ngrok tunnel
+		// Start the tunnel
 		if tunnelManager != nil {
-			fmt.Printf("\n🌐 Starting ngrok tunnel...\n")
-			if err := tunnelManager.Start(prx); err != nil {
+			fmt.Printf("\n🌐 Starting %s tunnel...\n", cfg.Tunnel.Provider)
+			err := tunnelManager.Start(prx)
+			if tunnel.IsSessionLimit(err) {
+				fmt.Printf("   ❌ The ngrok account has no free agent session\n")
+				if resolveSessionLimit(ctx, &cfg.Tunnel) {
+					time.Sleep(time.Second) // ngrok frees the session as its agent stops
+					fmt.Printf("   Retrying...\n")
+					err = tunnelManager.Start(prx)
+				}
+			}
+			if err != nil {
 				logger.Printf("tunnel error: %v", err)
+			} else if endpoints := tunnelManager.Status().Endpoints; len(endpoints) > 0 {
+				for _, e := range endpoints {
+					target := "all services"
+					if e.Service != "" {
+						target = e.Service
+					}
+					if e.Active {
+						fmt.Printf("   Public: %s → %s\n", e.PublicURL, target)
+					} else {
+						fmt.Printf("   Failed: %s → %s: %s\n", e.Domain, target, e.Error)
+					}
+				}
 			} else {
 				fmt.Printf("   Public: %s\n", tunnelManager.GetPublicURL())
 			}
 		}
 
 		// Start inspector if enabled
-		if insp != nil {
+		if inspect {
 			fmt.Printf("\n🔍 Web Inspector:\n")
-			if err := insp.Start(); err != nil {
+			if err := adminServer.StartInspector(); err != nil {
 				logger.Printf("inspector error: %v", err)
 			} else {
 				fmt.Printf("   http://127.0.0.1:%d/inspect/http\n", inspectPort)
 			}
 		}
 
-		fmt.Printf("\n✨ Ready! Press Ctrl+C to stop\n\n")
+		if recordOut != "" {
+			fmt.Printf("\n🎬 Recording traffic to %s\n", recordOut)
+		}
+
+		// Start forward proxy if enabled
+		if forwardServer != nil {
+			fmt.Printf("\n🧭 Forward proxy: http://%s (CONNECT supported)\n", forwardServer.Addr)
+			go func() {
+				ln, err := listen(forwardServer.Addr, startPIDFile != "")
+				if err == nil {
+					err = forwardServer.Serve(ln)
+				}
+				if err != http.ErrServerClosed {
+					logger.Printf("forward proxy error: %v", err)
+				}
+			}()
+		}
+
+		if startPIDFile != "" {
+			fmt.Printf("\n✨ Ready! Stop with 'hz stop'\n\n")
+		} else {
+			fmt.Printf("\n✨ Ready! Press Ctrl+C to stop\n\n")
+		}
+
+		// Offer to route to dev servers nothing points at yet
+		if !noScan {
+			go offerSuggestions(ctx, reg, func(services []*types.Service) {
+				applyMu.Lock()
+				accepted = append(accepted, services...)
+				applyMu.Unlock()
+				apply(cfgManager.Get())
+			})
+		}
 
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
 			logger.Fatalf("server error: %v", err)
 		}
 	}()
@@ -200,16 +457,126 @@ func runStart(cmd *cobra.Command, args []string) error {
 	defer cancel()
 
 	// Stop components
-	if insp != nil {
-		insp.Stop()
-	}
+	insp.Stop()
 	if tunnelManager != nil {
 		_ = tunnelManager.Stop()
 	}
 	cfgManager.Stop()
 	reg.Stop()
+	if forwardServer != nil {
+		_ = forwardServer.Shutdown(shutdownCtx)
+	}
 	_ = server.Shutdown(shutdownCtx)
 
 	fmt.Println("👋 Goodbye!")
 	return nil
 }
+
+// reloadOnSignal reloads the config each time a signal arrives on hup until
+// ctx is done. A config with errors is reported and the current one stays.
+func reloadOnSignal(ctx context.Context, hup <-chan os.Signal, cfgManager *config.Manager, logger *log.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Printf("[config] SIGHUP received, reloading %s", cfgManager.Source())
+			if err := cfgManager.Reload(); err != nil {
+				logger.Printf("[config] reload failed, keeping the current configuration:\n%v", err)
+			}
+		}
+	}
+}
+
+// loadStartConfig loads the config file, or builds the configuration from
+// --service flags when there are any
+func loadStartConfig() (*config.Manager, error) {
+	if len(startServices) == 0 {
+		if startDefault != "" || startTunnel {
+			return nil, fmt.Errorf("--default and --tunnel only apply with --service; set them in the config file instead")
+		}
+
+		// Find or use specified config file
+		configPath := cfgFile
+		if configPath == "" {
+			var err error
+			configPath, err = config.FindConfigFile()
+			if err != nil {
+				return nil, fmt.Errorf("no config file found: %w\n\nRun 'hz init' to create one, or pass --service name=port", err)
+			}
+		}
+
+		fmt.Printf("📁 Loading config: %s\n", configPath)
+
+		cfgManager, err := config.NewManager(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		cfgManager.SetPollInterval(pollEvery)
+		return cfgManager, nil
+	}
+
+	if cfgFile != "" {
+		return nil, fmt.Errorf("--service can't be combined with --config: define services in the file or with flags, not both")
+	}
+
+	c, err := config.FlagConfig(startServices, startDefault, startTunnel)
+	if err != nil {
+		return nil, err
+	}
+	c.Server.Port = port // validated against the port hz will use
+	fmt.Printf("📁 Config: --service flags\n")
+
+	cfgManager, err := config.NewFlagManager(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfgManager, nil
+}
+
+// mergeServices combines configured services with discovered ones. On a name
+// conflict the configured service wins, then the earlier discovered list.
+func mergeServices(static []*types.Service, dynamic ...[]*types.Service) []*types.Service {
+	names := make(map[string]bool, len(static))
+	merged := make([]*types.Service, 0, len(static))
+	for _, svc := range static {
+		names[svc.Name] = true
+		merged = append(merged, svc)
+	}
+	for _, list := range dynamic {
+		for _, svc := range list {
+			if !names[svc.Name] {
+				names[svc.Name] = true
+				merged = append(merged, svc)
+			}
+		}
+	}
+	return merged
+}
+
+// applyServices reconciles the registry with services and rebuilds the routes
+// once, from the registered instances
+func applyServices(reg *registry.Registry, rtr *router.Router, cfg *types.Config, services []*types.Service, logger *log.Logger) {
+	result, err := reg.Reconcile(services)
+	if err != nil {
+		logger.Printf("[registry] %v", err)
+	}
+	for _, name := range result.Added {
+		logger.Printf("[registry] added %s", name)
+	}
+	for _, name := range result.Changed {
+		logger.Printf("[registry] updated %s", name)
+	}
+	for _, name := range result.Removed {
+		logger.Printf("[registry] removed %s", name)
+	}
+
+	rtr.SetOptions(cfg.Routing)
+	rtr.SetTrailingSlash(cfg.Server.TrailingSlash)
+	if err := rtr.Build(result.Services); err != nil {
+		logger.Printf("route rebuild failed: %v", err)
+	}
+	for _, w := range rtr.Warnings() {
+		logger.Printf("[router] %s", w)
+	}
+}
@@ -4,16 +4,80 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
 	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/daemon"
+	"github.com/zymawy/hz/internal/process"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/internal/router"
+	"github.com/zymawy/hz/pkg/types"
 )
 
 var (
 	statusJSON bool
 )
 
+// statusVersion is the version of the hz status --json shape. It goes up
+// when a field is renamed, removed or changes meaning, not when one is
+// added.
+const statusVersion = 1
+
+// serviceStatus is a single service row in the status output
+type serviceStatus struct {
+	Name          string `json:"name"`
+	Target        string `json:"target"`
+	Default       bool   `json:"default,omitempty"`
+	Disabled      bool   `json:"disabled,omitempty"`
+	Dynamic       bool   `json:"dynamic,omitempty"` // added by the running instance, not in the config
+	Status        string `json:"status"`
+	Routes        int    `json:"routes"`
+	Requests      int64  `json:"requests"`
+	Errors        int64  `json:"errors"`
+	InFlight      int64  `json:"inFlight"`
+	MaxConcurrent int    `json:"maxConcurrent,omitempty"`
+	Maintenance   bool   `json:"maintenance,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+	LastCode      int    `json:"lastStatusCode,omitempty"`
+	LastLatency   string `json:"lastLatency,omitempty"`
+	Backoff       string `json:"backoff,omitempty"`   // stretched check interval while failing
+	NextCheck     string `json:"nextCheck,omitempty"` // time until the next check, while backing off
+
+	Latency   *types.LatencyStats `json:"latency,omitempty"` // recent health checks
+	Failures  int                 `json:"consecutiveFailures,omitempty"`
+	Successes int                 `json:"consecutiveSuccesses,omitempty"`
+
+	Command  string         `json:"command,omitempty"`
+	Process  *process.State `json:"process,omitempty"` // managed backend process
+	Starting bool           `json:"starting,omitempty"`
+	Gated    bool           `json:"gated,omitempty"` // readiness gate holds requests
+
+	DependsOn  []string `json:"dependsOn,omitempty"`
+	WaitingFor []string `json:"waitingFor,omitempty"` // dependencies the first check waits for
+
+	RouteList []routeStatus `json:"routeList,omitempty"`
+}
+
+// daemonStatus is the background hz found through .hz/hz.pid
+type daemonStatus struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	Uptime  string    `json:"uptime"`
+}
+
+// routeStatus describes a route and the rewrite applied to its requests
+type routeStatus struct {
+	Match         string `json:"match"`
+	Rewrite       string `json:"rewrite"`
+	RouteOverride bool   `json:"routeOverride,omitempty"` // rewrite comes from the route, not the service
+}
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show proxy and service status",
@@ -27,6 +91,7 @@ Shows:
 
 Examples:
   hz status           # Show formatted status
+  hz status -v        # Include health check latency
   hz status --json    # Output as JSON`,
 	RunE: runStatus,
 }
@@ -38,102 +103,152 @@ func init() {
 }
 
 func runStatus(cmd *cobra.Command, args []string) error {
-	// Find config file
-	configPath := cfgFile
-	if configPath == "" {
-		var err error
-		configPath, err = config.FindConfigFile()
-		if err != nil {
-			return fmt.Errorf("no config file found. Run 'hz init' first")
-		}
-	}
-
-	// Load config to show services
-	cfgManager, err := config.NewManager(configPath)
+	cfg, configPath, err := statusConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	cfg := cfgManager.Get()
-
 	// Build status struct
 	status := struct {
-		Running  bool   `json:"running"`
-		Address  string `json:"address"`
-		Config   string `json:"config"`
-		Services []struct {
-			Name    string `json:"name"`
-			Target  string `json:"target"`
-			Default bool   `json:"default,omitempty"`
-			Status  string `json:"status"`
-			Routes  int    `json:"routes"`
-		} `json:"services"`
-		Tunnel struct {
-			Enabled   bool   `json:"enabled"`
-			PublicURL string `json:"publicUrl,omitempty"`
-			Domain    string `json:"domain,omitempty"`
+		Version  int               `json:"version"` // statusVersion
+		Running  bool              `json:"running"`
+		Address  string            `json:"address"`
+		Config   string            `json:"config"`
+		PID      int               `json:"pid,omitempty"`    // from the running instance
+		Uptime   string            `json:"uptime,omitempty"` // from the running instance
+		Services []serviceStatus   `json:"services"`
+		Warnings []string          `json:"routeWarnings,omitempty"`
+		Requests *types.ProxyStats `json:"requests,omitempty"` // from the running instance
+		Daemon   *daemonStatus     `json:"daemon,omitempty"`   // started with hz start --daemon
+		Tunnel   struct {
+			Enabled   bool              `json:"enabled"`
+			PublicURL string            `json:"publicUrl,omitempty"`
+			Domain    string            `json:"domain,omitempty"`
+			BasicAuth bool              `json:"basicAuth,omitempty"`
+			Live      *admin.TunnelInfo `json:"live,omitempty"` // from the running instance
 		} `json:"tunnel"`
 	}{
-		Config: configPath,
+		Version: statusVersion,
+		Config:  configPath,
 	}
 
-	// Check if proxy is running by trying to connect
-	addr := fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
-	status.Address = addr
+	// A background hz started from this directory
+	if p, err := daemon.Find(daemon.PIDFile); err == nil && p != nil {
+		status.Daemon = &daemonStatus{
+			PID:     p.PID,
+			Started: p.Started,
+			Uptime:  p.Uptime().Round(time.Second).String(),
+		}
+	}
 
-	client := &http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get(addr + "/__hz/health")
-	if err == nil {
-		resp.Body.Close()
-		status.Running = true
+	// Ask the running instance, whose registry knows each service's state;
+	// without one, the config is all there is
+	status.Address = localAddr(cfg.Server)
+	info, running := liveStatus(status.Address)
+	status.Running = running
+	live := make(map[string]admin.ServiceInfo)
+	var graph registry.DependencyGraph
+	if info != nil {
+		for _, svc := range info.Services {
+			live[svc.Name] = svc
+		}
+		graph = info.Dependencies
+		status.PID, status.Uptime = info.PID, info.Uptime
+		status.Requests = &info.Proxy
+		if t := info.Tunnel; t != nil {
+			status.Tunnel.Live = t
+			status.Tunnel.PublicURL = t.PublicURL
+		}
 	}
 
 	// Add services
 	for _, svc := range cfg.Services {
 		svcStatus := "configured"
-		if status.Running {
-			// Try health check
-			if svc.Health != nil && svc.Health.Path != "" {
-				healthResp, err := client.Get(svc.Target + svc.Health.Path)
-				if err == nil {
-					healthResp.Body.Close()
-					if healthResp.StatusCode >= 200 && healthResp.StatusCode < 300 {
-						svcStatus = "healthy"
-					} else {
-						svcStatus = "unhealthy"
-					}
-				} else {
-					svcStatus = "unreachable"
-				}
-			} else {
-				// No health check, try direct connection
-				_, err := client.Get(svc.Target)
-				if err == nil {
-					svcStatus = "reachable"
-				} else {
-					svcStatus = "unreachable"
-				}
+		info, isLive := live[svc.Name]
+		delete(live, svc.Name)
+		switch {
+		case svc.Disabled:
+			svcStatus = "disabled"
+		case !isLive:
+			// Not running, or not registered (yet)
+		case info.Starting:
+			// The managed process isn't up yet, so the proxy holds requests
+			svcStatus = "starting"
+		case len(graph.Services[svc.Name].WaitingFor) > 0:
+			// Not checked yet because its dependencies aren't up
+			svcStatus = "waiting"
+		case !svc.Health.Enabled() && info.Status == types.HealthStatusUnknown:
+			svcStatus = "unchecked"
+		default:
+			svcStatus = string(info.Status)
+		}
+
+		entry := serviceStatus{
+			Name:     svc.Name,
+			Target:   svc.Target,
+			Default:  svc.Default && !svc.Disabled,
+			Disabled: svc.Disabled,
+			Status:   svcStatus,
+			Routes:   len(svc.Routes),
+
+			Command:   svc.Command,
+			DependsOn: svc.DependsOn,
+		}
+		if node, ok := graph.Services[svc.Name]; ok {
+			entry.WaitingFor = node.WaitingFor
+		}
+		for _, route := range svc.Routes {
+			rs := routeStatus{
+				Match:   router.DescribeRoute(route),
+				Rewrite: router.DescribeRewrite(svc.Rewrite),
+			}
+			if route.Rewrite != nil {
+				rs.Rewrite = router.DescribeRewrite(route.Rewrite)
+				rs.RouteOverride = true
 			}
+			entry.RouteList = append(entry.RouteList, rs)
 		}
+		if isLive {
+			entry.setLive(info)
+		}
+		status.Services = append(status.Services, entry)
+	}
 
-		status.Services = append(status.Services, struct {
-			Name    string `json:"name"`
-			Target  string `json:"target"`
-			Default bool   `json:"default,omitempty"`
-			Status  string `json:"status"`
-			Routes  int    `json:"routes"`
-		}{
-			Name:    svc.Name,
-			Target:  svc.Target,
-			Default: svc.Default,
-			Status:  svcStatus,
-			Routes:  len(svc.Routes),
-		})
+	// Services the running instance added, like discovered containers
+	dynamic := make([]string, 0, len(live))
+	for name := range live {
+		dynamic = append(dynamic, name)
 	}
+	slices.Sort(dynamic)
+	for _, name := range dynamic {
+		info := live[name]
+		entry := serviceStatus{
+			Name:    info.Name,
+			Target:  info.Target,
+			Default: info.Default,
+			Dynamic: true,
+			Status:  string(info.Status),
+			Routes:  info.Routes,
+		}
+		if info.Starting {
+			entry.Status = "starting"
+		}
+		entry.setLive(info)
+		status.Services = append(status.Services, entry)
+	}
+
+	// Report routes that can never match
+	rtr := router.New()
+	rtr.SetOptions(cfg.Routing)
+	if err := rtr.Build(cfg.ActiveServices()); err != nil {
+		status.Warnings = append(status.Warnings, err.Error())
+	}
+	status.Warnings = append(status.Warnings, rtr.Warnings()...)
 
 	// Tunnel info
 	status.Tunnel.Enabled = cfg.Tunnel.Enabled
 	status.Tunnel.Domain = cfg.Tunnel.Domain
+	status.Tunnel.BasicAuth = len(cfg.Tunnel.BasicAuth) > 0
 
 	// Output
 	if statusJSON {
@@ -147,52 +262,367 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 
 	// Proxy status
-	if status.Running {
+	switch {
+	case status.Running && status.Uptime != "":
+		fmt.Printf("🟢 Proxy:    Running at %s (PID %d, up %s)\n", status.Address, status.PID, status.Uptime)
+	case status.Running:
 		fmt.Printf("🟢 Proxy:    Running at %s\n", status.Address)
+		fmt.Printf("            ⚠️  It predates /__hz/status; restart it for live service state\n")
+	case status.Daemon != nil:
+		fmt.Printf("🟡 Proxy:    Not answering at %s; showing the config file only\n", status.Address)
+	default:
+		fmt.Printf("🔴 Proxy:    Not running; showing the config file only\n")
+	}
+	if d := status.Daemon; d != nil {
+		fmt.Printf("👻 Daemon:   PID %d, up %s (logs: %s)\n", d.PID, d.Uptime, daemon.LogFile)
+	}
+	if r := status.Requests; r != nil {
+		fmt.Printf("📈 Requests: %d (%d through the tunnel, %d local)\n", r.TotalRequests, r.TunnelRequests, r.LocalRequests)
+	}
+	if status.Config == config.SourceFlags {
+		fmt.Printf("📁 Config:   --service flags (no config file)\n")
 	} else {
-		fmt.Printf("🔴 Proxy:    Not running\n")
+		fmt.Printf("📁 Config:   %s\n", status.Config)
 	}
-	fmt.Printf("📁 Config:   %s\n", status.Config)
 
 	// Services
+	statuses := make(map[string]string, len(status.Services))
+	for _, svc := range status.Services {
+		statuses[svc.Name] = svc.Status
+	}
+
 	fmt.Printf("\n📦 Services:\n")
 	for _, svc := range status.Services {
-		statusIcon := "⚪"
-		switch svc.Status {
-		case "healthy", "reachable":
-			statusIcon = "🟢"
-		case "unhealthy", "unreachable":
-			statusIcon = "🔴"
-		case "configured":
-			statusIcon = "⚪"
+		if svc.Disabled {
+			line := fmt.Sprintf("   %s %s → %s (disabled)", statusIcon(svc.Status), svc.Name, svc.Target)
+			if isTerminal(os.Stdout) {
+				line = "\033[2m" + line + "\033[0m" // dimmed
+			}
+			fmt.Println(line)
+			continue
 		}
 
 		defaultMark := ""
 		if svc.Default {
 			defaultMark = " [default]"
 		}
+		if svc.Dynamic {
+			defaultMark += " [dynamic]"
+		}
 
-		fmt.Printf("   %s %s → %s%s\n", statusIcon, svc.Name, svc.Target, defaultMark)
+		fmt.Printf("   %s %s → %s%s\n", statusIcon(svc.Status), svc.Name, svc.Target, defaultMark)
+		if len(svc.DependsOn) > 0 {
+			deps := make([]string, 0, len(svc.DependsOn))
+			for _, dep := range svc.DependsOn {
+				deps = append(deps, fmt.Sprintf("%s %s", statusIcon(statuses[dep]), dep))
+			}
+			fmt.Printf("      Depends on: %s\n", strings.Join(deps, ", "))
+		}
+		if len(svc.WaitingFor) > 0 {
+			fmt.Printf("      ⏳ First health check waits for %s\n", strings.Join(svc.WaitingFor, ", "))
+		}
+		if p := svc.Process; p != nil {
+			state := fmt.Sprintf("PID %d", p.PID)
+			if !p.Running {
+				state = "not running"
+				if p.LastExit != "" {
+					state += " (" + p.LastExit + ")"
+				}
+			}
+			fmt.Printf("      ⚙️  %s: %s, %d restarts\n", svc.Command, state, p.Restarts)
+		} else if svc.Command != "" {
+			fmt.Printf("      ⚙️  %s\n", svc.Command)
+		}
+		if svc.Starting {
+			fmt.Printf("      ⏳ Starting: requests get 503 until it is up\n")
+		} else if svc.Gated {
+			fmt.Printf("      ⏳ Not ready: requests get 503 until a health check passes\n")
+		}
+		if svc.Maintenance {
+			fmt.Printf("      🚧 In maintenance\n")
+		}
+		if svc.Status == string(types.HealthStatusDegraded) && svc.LastLatency != "" {
+			fmt.Printf("      🐢 Slow health checks (last took %s)\n", svc.LastLatency)
+		}
+		if svc.Status == string(types.HealthStatusPaused) {
+			fmt.Printf("      Health checks paused (hz health resume %s)\n", svc.Name)
+		}
+		if svc.LastError != "" {
+			fmt.Printf("      ❗ Last health check: %s%s\n", svc.LastError, checkDetail(svc))
+		}
+		if verbosity > 0 && svc.Latency != nil {
+			l := svc.Latency
+			fmt.Printf("      Check latency: min %s / avg %s / max %s (last %d)\n",
+				roundLatency(l.Min), roundLatency(l.Avg), roundLatency(l.Max), l.Samples)
+		}
+		if svc.Failures > 0 && svc.Backoff != "" {
+			fmt.Printf("      Checks: %d failed in a row, backing off to every %s (next in %s)\n", svc.Failures, svc.Backoff, svc.NextCheck)
+		} else if svc.Failures > 0 {
+			fmt.Printf("      Checks: %d failed in a row\n", svc.Failures)
+		} else if svc.Successes > 0 && svc.Status == string(types.HealthStatusUnhealthy) {
+			fmt.Printf("      Checks: %d passed in a row\n", svc.Successes)
+		}
 		if svc.Routes > 0 {
 			fmt.Printf("      Routes: %d\n", svc.Routes)
+			for _, route := range svc.RouteList {
+				source := ""
+				if route.RouteOverride {
+					source = " (route)"
+				}
+				fmt.Printf("        • %s → rewrite: %s%s\n", route.Match, route.Rewrite, source)
+			}
+		}
+		if status.Uptime != "" && svc.Requests > 0 {
+			fmt.Printf("      Requests: %d (%s)\n", svc.Requests, plural(int(svc.Errors), "error"))
+		}
+		if svc.MaxConcurrent > 0 {
+			fmt.Printf("      In-flight: %d/%d\n", svc.InFlight, svc.MaxConcurrent)
+		} else if svc.InFlight > 0 {
+			fmt.Printf("      In-flight: %d\n", svc.InFlight)
+		}
+	}
+
+	if len(status.Warnings) > 0 {
+		fmt.Printf("\n⚠️  Route warnings:\n")
+		for _, w := range status.Warnings {
+			fmt.Printf("   %s\n", w)
 		}
 	}
 
 	// Tunnel
 	fmt.Printf("\n🌐 Tunnel:\n")
-	if status.Tunnel.Enabled {
+	tunnel := status.Tunnel.Live
+	switch {
+	case tunnel == nil && status.Tunnel.Enabled:
 		fmt.Printf("   Status:   Enabled\n")
+	case tunnel == nil:
+		fmt.Printf("   Status:   Disabled\n")
+	case tunnel.State == types.TunnelStateActive:
+		fmt.Printf("   Status:   🟢 Active (%s)\n", tunnel.Provider)
+	case tunnel.State == types.TunnelStateReconnecting:
+		next := ""
+		if wait := time.Until(tunnel.NextAttempt); wait > 0 {
+			next = fmt.Sprintf(", next in %s", wait.Round(time.Second))
+		}
+		fmt.Printf("   Status:   🟡 Reconnecting (attempt %d%s)\n", tunnel.Attempts, next)
+	case tunnel.State == types.TunnelStatePartial:
+		active := 0
+		for _, e := range tunnel.Endpoints {
+			if e.Active {
+				active++
+			}
+		}
+		fmt.Printf("   Status:   🟠 Partial (%d of %d endpoints active)\n", active, len(tunnel.Endpoints))
+	default:
+		fmt.Printf("   Status:   🔴 %s\n", strings.ToUpper(string(tunnel.State[:1]))+string(tunnel.State[1:]))
+	}
+	if tunnel != nil && tunnel.Error != "" && tunnel.State != types.TunnelStateActive {
+		fmt.Printf("   Error:    %s\n", tunnel.Error)
+	}
+	if status.Tunnel.Enabled || tunnel != nil {
 		if status.Tunnel.PublicURL != "" {
 			fmt.Printf("   URL:      %s\n", status.Tunnel.PublicURL)
 		}
 		if status.Tunnel.Domain != "" {
 			fmt.Printf("   Domain:   %s\n", status.Tunnel.Domain)
 		}
-	} else {
-		fmt.Printf("   Status:   Disabled\n")
+		if status.Tunnel.BasicAuth {
+			fmt.Printf("   Auth:     basic auth enabled\n")
+		}
+	}
+	if tunnel != nil && tunnel.Traffic != nil {
+		t := tunnel.Traffic
+		fmt.Printf("   Traffic:  %s, %s (%d open) since hz started\n", plural(int(t.LifetimeRequests), "request"), plural(int(t.LifetimeConnections), "connection"), t.OpenConnections)
+		fmt.Printf("             %s in, %s out\n", formatBytes(t.LifetimeBytesIn), formatBytes(t.LifetimeBytesOut))
+	}
+	if tunnel != nil && tunnel.Watchdog != nil {
+		w := tunnel.Watchdog
+		fmt.Printf("   Watchdog: %s in a row, %s\n", plural(w.Failures, "failed check"), plural(w.Restarts, "restart"))
+		if w.Failures > 0 && w.LastError != "" {
+			fmt.Printf("             last error: %s\n", w.LastError)
+		}
+		if w.Restarts > 0 {
+			fmt.Printf("             last restart %s ago: %s\n", time.Since(w.LastRestart).Round(time.Second), w.RestartReason)
+		}
+	}
+	if tunnel != nil && len(tunnel.Endpoints) > 0 {
+		fmt.Printf("   Endpoints:\n")
+		for _, e := range tunnel.Endpoints {
+			printTunnelEndpoint(e)
+		}
 	}
 
 	fmt.Printf("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 
 	return nil
 }
+
+// setLive fills in what the running instance knows about a service
+func (e *serviceStatus) setLive(info admin.ServiceInfo) {
+	e.Requests = info.RequestCount
+	e.Errors = info.ErrorCount
+	e.InFlight = info.InFlight
+	e.MaxConcurrent = info.MaxConcurrent
+	e.Maintenance = info.Maintenance != nil
+	e.LastError = info.LastError
+	e.LastCode = info.LastCode
+	e.Latency = info.Latency
+	if info.LastLatency > 0 {
+		e.LastLatency = info.LastLatency.Round(time.Millisecond).String()
+	}
+	e.Failures = info.Failures
+	e.Successes = info.Successes
+	if info.Backoff > 0 {
+		e.Backoff = info.Backoff.String()
+		e.NextCheck = max(time.Until(info.NextCheck), 0).Round(time.Second).String()
+	}
+	e.Process = info.Process
+	e.Starting = info.Starting
+	e.Gated = info.Gated
+}
+
+// liveStatus asks the instance at addr for its status. An instance too old
+// for /__hz/status is running but has no status to give.
+func liveStatus(addr string) (*admin.StatusInfo, bool) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(addr + "/__hz/status")
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	var info admin.StatusInfo
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&info) != nil {
+		return nil, true
+	}
+	return &info, true
+}
+
+// statusConfig loads the config file to show services. Without one it asks
+// an instance running on the default port, which may have been started with
+// --service flags, for its configuration.
+func statusConfig() (*types.Config, string, error) {
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			if cfg, source, liveErr := liveConfig(fmt.Sprintf("http://localhost:%d", config.DefaultPort)); liveErr == nil {
+				return cfg, source, nil
+			}
+			return nil, "", fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfgManager.Get(), configPath, nil
+}
+
+// liveConfig fetches the configuration of the instance at addr
+func liveConfig(addr string) (*types.Config, string, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(addr + "/__hz/config")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s", resp.Status)
+	}
+
+	var info admin.ConfigInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, "", err
+	}
+	cfg := &types.Config{}
+	if err := config.Decode(config.FormatJSON, info.Config, cfg); err != nil {
+		return nil, "", err
+	}
+	return cfg, info.Source, nil
+}
+
+// statusIcon returns the icon shown for a service status
+func statusIcon(status string) string {
+	switch status {
+	case "healthy":
+		return "🟢"
+	case "unhealthy":
+		return "🔴"
+	case string(types.HealthStatusDegraded):
+		return "🟡"
+	case string(types.HealthStatusPaused):
+		return "⏸️ "
+	case "disabled":
+		return "⚫"
+	default:
+		return "⚪"
+	}
+}
+
+// checkDetail formats the status code and latency of the last health check
+func checkDetail(svc serviceStatus) string {
+	var parts []string
+	if svc.LastCode != 0 {
+		parts = append(parts, strconv.Itoa(svc.LastCode))
+	}
+	if svc.LastLatency != "" {
+		parts = append(parts, svc.LastLatency)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// roundLatency shortens a latency for display
+func roundLatency(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond / 10)
+}
+
+// printTunnelEndpoint prints one of tunnel.endpoints in hz status
+func printTunnelEndpoint(e types.TunnelEndpointStatus) {
+	icon := "🔴"
+	switch e.State {
+	case types.TunnelStateActive:
+		icon = "🟢"
+	case types.TunnelStateReconnecting:
+		icon = "🟡"
+	}
+	name := e.Domain
+	if name == "" {
+		name = "(random domain)"
+	}
+	target := "all services"
+	if e.Service != "" {
+		target = e.Service
+	}
+	fmt.Printf("     %s %s → %s (%s)\n", icon, name, target, e.State)
+	if e.PublicURL != "" && e.Active {
+		fmt.Printf("        URL:   %s\n", e.PublicURL)
+	}
+	if e.Error != "" && !e.Active {
+		fmt.Printf("        Error: %s\n", e.Error)
+	}
+}
+
+// formatBytes returns n bytes in the largest unit that keeps it above 1
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, suffix := float64(n)/unit, "KB"
+	for _, next := range []string{"MB", "GB", "TB"} {
+		if size < unit {
+			break
+		}
+		size, suffix = size/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", size, suffix)
+}
@@ -0,0 +1,52 @@
+package hz
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/daemon"
+)
+
+var stopTimeout time.Duration
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the hz running in the background",
+	Long: `Stop the hz that 'hz start --daemon' started in this directory. hz is
+sent SIGTERM and shuts down as on Ctrl+C; hz stop waits for it to exit and
+removes .hz/hz.pid. A pidfile left by an hz that is gone is removed.
+
+On Windows, hz is killed without a graceful shutdown.
+
+Examples:
+  hz stop                 # Stop and wait up to 15s
+  hz stop --timeout 1m    # Wait longer for a slow shutdown`,
+	Args: cobra.NoArgs,
+	RunE: runStop,
+}
+
+func init() {
+	stopCmd.Flags().DurationVar(&stopTimeout, "timeout", 15*time.Second, "how long to wait for hz to exit")
+	rootCmd.AddCommand(stopCmd)
+}
+
+// runStop stops the background hz named by the pidfile
+func runStop(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	p, err := daemon.Find(daemon.PIDFile)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		fmt.Println("⚪ hz isn't running in the background here")
+		return nil
+	}
+
+	fmt.Printf("🛑 Stopping hz (PID %d)...\n", p.PID)
+	if err := daemon.Stop(p, daemon.PIDFile, stopTimeout); err != nil {
+		return err
+	}
+	fmt.Println("👋 Stopped")
+	return nil
+}
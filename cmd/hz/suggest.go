@@ -0,0 +1,99 @@
+package hz
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/pkg/types"
+	"golang.org/x/term"
+)
+
+// offerSuggestions scans local ports and, on a terminal, asks whether to route
+// to each server found; accept receives the confirmed services
+func offerSuggestions(ctx context.Context, reg *registry.Registry, accept func([]*types.Service)) {
+	suggestions := reg.Discover(ctx)
+	if len(suggestions) == 0 {
+		return
+	}
+
+	printSuggestions(suggestions)
+	if !isTerminal(os.Stdin) {
+		fmt.Printf("   Add one with: hz add <name> <port> --route '/path/*'\n\n")
+		return
+	}
+	if services := promptSuggestions(suggestions, os.Stdin); len(services) > 0 {
+		accept(services)
+	}
+	fmt.Println()
+}
+
+// printSuggestions lists local servers hz found but doesn't route to
+func printSuggestions(suggestions []registry.Suggestion) {
+	fmt.Printf("\n🔎 Found local servers not routed by hz:\n")
+	for _, s := range suggestions {
+		framework := ""
+		if s.Framework != "" {
+			framework = " " + s.Framework
+		}
+		fmt.Printf("   • :%d%s (%s)\n", s.Port, framework, s.Target)
+	}
+}
+
+// promptSuggestions asks whether to route to each suggestion and returns the
+// services the user accepted. Nothing is added without a "y".
+func promptSuggestions(suggestions []registry.Suggestion, in io.Reader) []*types.Service {
+	reader := bufio.NewReader(in)
+	ask := func(question string) (string, bool) {
+		fmt.Print(question)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", false
+		}
+		return strings.TrimSpace(line), true
+	}
+
+	var accepted []*types.Service
+	for _, s := range suggestions {
+		answer, ok := ask(fmt.Sprintf("   Add %s → %s? [y/N] ", s.Name, s.Target))
+		if !ok {
+			break
+		}
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			continue
+		}
+
+		route := "/" + s.Name + "/*"
+		if answer, ok := ask(fmt.Sprintf("   Route for %s [%s]: ", s.Name, route)); ok && answer != "" {
+			route = answer
+		}
+
+		targetURL, err := url.Parse(s.Target)
+		if err != nil {
+			fmt.Printf("   ❌ %v\n", err)
+			continue
+		}
+		accepted = append(accepted, &types.Service{
+			Name:      s.Name,
+			Target:    s.Target,
+			TargetURL: targetURL,
+			Routes:    []types.RouteConfig{config.ParseRouteArg(route)},
+			Dynamic:   true,
+			Status:    types.HealthStatusUnknown,
+		})
+		fmt.Printf("   ✅ Routing %s → %s until hz stops\n", route, s.Name)
+		fmt.Printf("      Keep it with: hz add %s %d --route '%s'\n", s.Name, s.Port, route)
+	}
+	return accepted
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,394 @@
+package hz
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
+	"github.com/zymawy/hz/internal/inspector"
+	"golang.org/x/term"
+)
+
+var tailFilters []string
+
+// tailFilterKeys are the request fields --filter can match
+var tailFilterKeys = []string{"service", "status", "method", "path", "source"}
+
+var tailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Print requests as they go through the running hz",
+	Long: `Print one line per request the running hz proxies: time, method, status,
+duration, service and path. hz tail reads the inspector's live stream and
+starts the inspector if hz was started without --inspect.
+
+--filter keeps matching requests. Filters on different fields must all
+match; repeating a field matches any of its values. Fields:
+  service  the service name
+  status   a code like 404, or a class like 5xx (also requests that failed
+           without a response)
+  method   GET, POST...
+  path     a path prefix, like /api
+  source   tunnel or local
+
+With -v (--verbose), each request's headers and bodies follow its line.
+On a terminal, lines are colored and long paths shortened to fit; piped,
+they are plain and whole. When hz stops, hz tail waits for it to come back.
+
+Examples:
+  hz tail
+  hz tail --filter service=api
+  hz tail --filter status=5xx --filter status=4xx
+  hz tail --filter path=/webhooks -v   # With headers and bodies`,
+	Args: cobra.NoArgs,
+	RunE: runTail,
+}
+
+func init() {
+	tailCmd.Flags().StringArrayVar(&tailFilters, "filter", nil, "only show requests where field=value (repeatable): "+strings.Join(tailFilterKeys, ", "))
+	_ = tailCmd.RegisterFlagCompletionFunc("filter", completeTailFilter)
+	rootCmd.AddCommand(tailCmd)
+}
+
+// runTail streams the running instance's requests until interrupted
+func runTail(cmd *cobra.Command, args []string) error {
+	filter, err := parseTailFilters(tailFilters)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	cfg, _, err := statusConfig()
+	if err != nil {
+		return err
+	}
+	addr := localAddr(cfg.Server)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	out := tailOutput{filter: filter, verbose: verbosity > 0}
+	if isTerminal(os.Stdout) {
+		out.color = os.Getenv("NO_COLOR") == ""
+		out.fit = true
+	}
+
+	connected, waiting := false, false
+	for ctx.Err() == nil {
+		url, err := ensureInspector(addr)
+		if err == nil {
+			err = out.stream(ctx, url, func() {
+				if waiting {
+					fmt.Fprintln(os.Stderr, "🔄 Reconnected")
+				} else if !connected {
+					fmt.Fprintf(os.Stderr, "📡 Tailing requests through %s (Ctrl+C to stop)\n", addr)
+				}
+				connected, waiting = true, false
+			})
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if !connected {
+			return err
+		}
+		if !waiting {
+			fmt.Fprintln(os.Stderr, "⏳ The stream dropped; reconnecting...")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+	return nil
+}
+
+// errInspectorUnsupported means the running hz predates /__hz/inspector
+var errInspectorUnsupported = errors.New("the running hz doesn't say where its inspector is; upgrade it, or restart it with 'hz start --inspect'")
+
+// ensureInspector returns the URL of the running instance's inspector,
+// starting the inspector if it isn't enabled
+func ensureInspector(addr string) (string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(addr + "/__hz/inspector")
+	if err != nil {
+		return "", fmt.Errorf("hz is not running at %s: %w", addr, err)
+	}
+	info, err := inspectorResponse(resp)
+	if err != nil || info.Enabled {
+		return info.URL, err
+	}
+
+	resp, err = client.Post(addr+"/__hz/inspector", "application/json", nil)
+	if err != nil {
+		return "", err
+	}
+	if info, err = inspectorResponse(resp); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "🔍 Started the inspector at %s/inspect/http\n", info.URL)
+	return info.URL, nil
+}
+
+// inspectorResponse decodes a /__hz/inspector response, or its error
+func inspectorResponse(resp *http.Response) (admin.InspectorInfo, error) {
+	defer resp.Body.Close()
+	var body struct {
+		admin.InspectorInfo
+		Error string `json:"error"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return body.InspectorInfo, errInspectorUnsupported
+	case resp.StatusCode == http.StatusConflict:
+		return body.InspectorInfo, fmt.Errorf("can't start the inspector: %s. Restart hz with 'hz start --inspect --inspect-port <free port>'", body.Error)
+	case resp.StatusCode != http.StatusOK:
+		return body.InspectorInfo, fmt.Errorf("hz tail failed: %s", resp.Status)
+	case decodeErr != nil:
+		return body.InspectorInfo, fmt.Errorf("invalid response: %w", decodeErr)
+	}
+	return body.InspectorInfo, nil
+}
+
+// tailFilter holds the accepted values of each filtered field
+type tailFilter map[string][]string
+
+// parseTailFilters reads field=value filters
+func parseTailFilters(specs []string) (tailFilter, error) {
+	filter := make(tailFilter)
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid filter %q; use field=value", spec)
+		}
+		if !slices.Contains(tailFilterKeys, key) {
+			return nil, fmt.Errorf("unknown filter field %q; use %s", key, strings.Join(tailFilterKeys, ", "))
+		}
+		if key == "status" && !validStatusFilter(value) {
+			return nil, fmt.Errorf("invalid status %q; use a code like 404 or a class like 5xx", value)
+		}
+		filter[key] = append(filter[key], value)
+	}
+	return filter, nil
+}
+
+// validStatusFilter reports whether s is a status code or a class like 5xx
+func validStatusFilter(s string) bool {
+	if len(s) == 3 && s[0] >= '1' && s[0] <= '5' && strings.EqualFold(s[1:], "xx") {
+		return true
+	}
+	code, err := strconv.Atoi(s)
+	return err == nil && code >= 100 && code <= 599
+}
+
+// match reports whether req passes every filtered field
+func (f tailFilter) match(req inspector.Request) bool {
+	for key, values := range f {
+		if !slices.ContainsFunc(values, func(v string) bool { return matchTailField(req, key, v) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTailField reports whether one field of req matches value
+func matchTailField(req inspector.Request, key, value string) bool {
+	switch key {
+	case "service":
+		return req.Service == value
+	case "status":
+		if strings.HasSuffix(strings.ToLower(value), "xx") {
+			if req.StatusCode == 0 {
+				return value[0] == '5' && req.Error != ""
+			}
+			return strconv.Itoa(req.StatusCode)[0] == value[0]
+		}
+		return strconv.Itoa(req.StatusCode) == value
+	case "method":
+		return strings.EqualFold(req.Method, value)
+	case "path":
+		return strings.HasPrefix(req.Path, value)
+	case "source":
+		return req.Source == value
+	}
+	return false
+}
+
+// tailOutput prints requests, colored and fitted to a terminal's width when
+// printing to one
+type tailOutput struct {
+	filter  tailFilter
+	verbose bool
+	color   bool
+	fit     bool
+}
+
+// stream prints the requests of the inspector at url until the stream ends.
+// connected is called once the stream is open.
+func (o tailOutput) stream(ctx context.Context, url string, connected func()) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/requests/sse?history=false", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("inspector stream: %s", resp.Status)
+	}
+	connected()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var r inspector.Request
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			continue
+		}
+		if o.filter.match(r) {
+			o.print(r)
+		}
+	}
+	return scanner.Err()
+}
+
+// ANSI colors for tail lines
+const (
+	ansiReset  = "\033[0m"
+	ansiDim    = "\033[2m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiCyan   = "\033[36m"
+)
+
+// print prints one request, and its headers and bodies when verbose
+func (o tailOutput) print(r inspector.Request) {
+	status := strconv.Itoa(r.StatusCode)
+	if r.StatusCode == 0 {
+		status = "ERR"
+	}
+	path := r.Path
+	if r.Query != "" {
+		path += "?" + r.Query
+	}
+	if r.Label != "" {
+		path += " [" + r.Label + "]"
+	} else if r.Error != "" {
+		path += " [" + r.Error + "]"
+	}
+
+	cols := []string{
+		r.Timestamp.Local().Format("15:04:05"),
+		fmt.Sprintf("%-7s", r.Method),
+		status,
+		fmt.Sprintf("%8s", formatTailDuration(r.Duration)),
+		fmt.Sprintf("%-12s", orDash(r.Service)),
+	}
+	if o.fit {
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+			used := len(cols) // the spaces between columns
+			for _, c := range cols {
+				used += utf8.RuneCountInString(c)
+			}
+			path = truncate(path, max(width-used, 10))
+		}
+	}
+
+	if o.color {
+		cols[2] = statusColor(r.StatusCode) + cols[2] + ansiReset
+		cols[0] = ansiDim + cols[0] + ansiReset
+		cols[3] = ansiDim + cols[3] + ansiReset
+		cols[4] = ansiCyan + cols[4] + ansiReset
+	}
+	fmt.Println(strings.Join(cols, " ") + " " + path)
+
+	if o.verbose {
+		o.printDetail("> ", r.Headers, r.RequestBody)
+		o.printDetail("< ", r.ResponseHeaders, r.ResponseBody)
+	}
+}
+
+// printDetail prints headers and a body indented under a request line
+func (o tailOutput) printDetail(prefix string, headers map[string][]string, body string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, v := range headers[name] {
+			line := "    " + prefix + name + ": " + v
+			if o.color {
+				line = ansiDim + line + ansiReset
+			}
+			fmt.Println(line)
+		}
+	}
+	if body != "" {
+		for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+			fmt.Println("    " + prefix + line)
+		}
+	}
+}
+
+// statusColor picks a color by status class: errors red, client errors
+// yellow, redirects cyan, successes green
+func statusColor(code int) string {
+	switch {
+	case code == 0 || code >= 500:
+		return ansiRed
+	case code >= 400:
+		return ansiYellow
+	case code >= 300:
+		return ansiCyan
+	}
+	return ansiGreen
+}
+
+// formatTailDuration shows durations under a second in milliseconds
+func formatTailDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+	}
+	return d.Round(10 * time.Millisecond).String()
+}
+
+// completeTailFilter completes --filter with the fields, then service names
+// after service=
+func completeTailFilter(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if prefix, ok := strings.CutPrefix(toComplete, "service="); ok {
+		var out []string
+		for _, c := range serviceCompletions(nil, prefix) {
+			out = append(out, "service="+c)
+		}
+		return out, cobra.ShellCompDirectiveNoFileComp
+	}
+	var out []string
+	for _, key := range tailFilterKeys {
+		if strings.HasPrefix(key+"=", toComplete) {
+			out = append(out, key+"=")
+		}
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
@@ -0,0 +1,252 @@
+package hz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
+	"github.com/zymawy/hz/internal/proxy"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/internal/router"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// testUnrouted is hz test's exit status when no service would get the request
+const testUnrouted exitStatus = 2
+
+// errRouteUnsupported means the running hz can't answer route queries
+var errRouteUnsupported = errors.New("the running hz predates route queries")
+
+var (
+	testHeaders []string
+	testHost    string
+	testSend    bool
+	testJSON    bool
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test <method> <path>",
+	Short: "Show where a request would be routed",
+	Long: `Route a made-up request and show the service and route it matches, the
+path the target would get after rewriting, and the headers hz would add.
+The running hz answers with its live routes; when it isn't running, the
+routes are built from the config file.
+
+With --send, the request is also sent through the running hz, and its
+status and duration are shown.
+
+Exit status:
+  0  a service would get the request
+  1  failed
+  2  no route matched, or strict routing refuses the default service
+
+Examples:
+  hz test GET /api/v2/users
+  hz test GET /ws --header X-Service:ws
+  hz test POST /graphql --host admin.localhost
+  hz test GET /health --send`,
+	Args: cobra.ExactArgs(2),
+	RunE: runTest,
+}
+
+func init() {
+	testCmd.Flags().StringArrayVarP(&testHeaders, "header", "H", nil, "request header as key:value (repeatable)")
+	testCmd.Flags().StringVar(&testHost, "host", "", "request host, like api.localhost (default: localhost)")
+	testCmd.Flags().BoolVar(&testSend, "send", false, "also send the request through the running hz")
+	testCmd.Flags().BoolVar(&testJSON, "json", false, "print the match as JSON")
+	rootCmd.AddCommand(testCmd)
+}
+
+// runTest routes the request from the arguments and prints the match
+func runTest(cmd *cobra.Command, args []string) error {
+	q := admin.RouteQuery{Method: strings.ToUpper(args[0]), Path: args[1], Host: testHost, Headers: http.Header{}}
+	if !strings.HasPrefix(q.Path, "/") {
+		return fmt.Errorf("path %q must start with /", q.Path)
+	}
+	for _, h := range testHeaders {
+		key, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid header %q; use key:value", h)
+		}
+		q.Headers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	cmd.SilenceUsage = true
+
+	cfg, _, err := statusConfig()
+	if err != nil {
+		return err
+	}
+	addr := localAddr(cfg.Server)
+
+	source := "Routed by the running hz at " + addr
+	match, err := liveRoute(addr, q)
+	if err != nil {
+		if testSend && !errors.Is(err, errRouteUnsupported) {
+			return fmt.Errorf("--send needs a running hz at %s: %w", addr, err)
+		}
+		source = fmt.Sprintf("hz isn't running at %s; routed with the config file", addr)
+		if errors.Is(err, errRouteUnsupported) {
+			source = err.Error() + "; routed with the config file"
+		}
+		if match, err = localRoute(cfg, q); err != nil {
+			return err
+		}
+	}
+
+	if testJSON {
+		data, _ := json.MarshalIndent(match, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printRouteMatch(match, source)
+	}
+
+	if testSend {
+		if err := sendTest(addr, q); err != nil {
+			return err
+		}
+	}
+
+	if !match.Matched() {
+		cmd.SilenceErrors = true
+		return testUnrouted
+	}
+	return nil
+}
+
+// liveRoute asks the running hz at addr where q would go
+func liveRoute(addr string, q admin.RouteQuery) (*proxy.RouteMatch, error) {
+	body, _ := json.Marshal(q)
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Post(addr+"/__hz/route", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errRouteUnsupported
+	default:
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	var match proxy.RouteMatch
+	if err := json.NewDecoder(resp.Body).Decode(&match); err != nil {
+		return nil, err
+	}
+	return &match, nil
+}
+
+// localRoute routes q with routes built from cfg, as hz start would
+func localRoute(cfg *types.Config, q admin.RouteQuery) (*proxy.RouteMatch, error) {
+	rtr := router.New()
+	rtr.SetOptions(cfg.Routing)
+	rtr.SetTrailingSlash(cfg.Server.TrailingSlash)
+	if err := rtr.Build(cfg.ActiveServices()); err != nil {
+		return nil, fmt.Errorf("failed to build routes: %w", err)
+	}
+	prx := proxy.New(registry.New(), rtr)
+	prx.SetStrictRouting(cfg.Server.StrictRouting, cfg.Server.StrictPrefixes)
+
+	req, err := q.Request()
+	if err != nil {
+		return nil, err
+	}
+	return prx.Explain(req)
+}
+
+// printRouteMatch describes where the request goes, and what routed it
+func printRouteMatch(m *proxy.RouteMatch, source string) {
+	fmt.Printf("🧪 %s %s (host %s)\n", m.Method, m.Path, m.Host)
+	fmt.Printf("   %s\n\n", source)
+
+	if m.Redirect != "" {
+		fmt.Printf("↪️  Redirected first (308) to %s\n", m.Redirect)
+	}
+	switch {
+	case m.Service == "":
+		fmt.Println("❌ No route matches, and there is no default service")
+		return
+	case m.Rejected:
+		fmt.Printf("❌ No route matches; strict routing refuses the default service %s (404)\n", m.Service)
+		return
+	case m.Fallback:
+		fmt.Printf("⚪ No route matches; the default service gets it\n")
+	}
+
+	fmt.Printf("✅ Service:  %s → %s\n", m.Service, m.Target)
+	if !m.Fallback {
+		fmt.Printf("   Route:    %s\n", m.Pattern)
+	}
+	if len(m.Params) > 0 {
+		fmt.Printf("   Params:   %s\n", formatPairs(m.Params, "="))
+	}
+	fmt.Printf("   Upstream: %s", m.Upstream)
+	target := m.Path
+	if m.Redirect != "" {
+		target = m.Redirect
+	}
+	if m.Upstream != target {
+		fmt.Printf(" (rewritten from %s)", target)
+	}
+	fmt.Println()
+	if len(m.Headers) > 0 {
+		fmt.Printf("   Headers:  %s\n", formatPairs(m.Headers, ": "))
+	}
+}
+
+// formatPairs joins a map's entries sorted by key
+func formatPairs(m map[string]string, sep string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + sep + m[k]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// sendTest sends the request through the running hz and prints the
+// response status and how long it took
+func sendTest(addr string, q admin.RouteQuery) error {
+	req, err := http.NewRequest(q.Method, addr+q.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = q.Headers
+	if q.Host != "" {
+		req.Host = q.Host
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		// Show a redirect rather than follow it
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	icon := "📨"
+	if resp.StatusCode >= 500 {
+		icon = "🔴"
+	}
+	fmt.Printf("\n%s %s in %s (%s)\n", icon, resp.Status, elapsed.Round(10*time.Microsecond), formatBytes(n))
+	return nil
+}
@@ -1,44 +1,87 @@
 package hz
 
 import (
+	"encoding/json"
 	"fmt"
-	"os"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/zymawy/hz/internal/admin"
 	"github.com/zymawy/hz/internal/config"
-	"gopkg.in/yaml.v3"
+	"github.com/zymawy/hz/internal/tunnel"
 )
 
 var (
-	tunnelEnable  bool
-	tunnelDisable bool
-	tunnelDomain  string
-	tunnelToken   string
+	tunnelEnable   bool
+	tunnelDisable  bool
+	tunnelDomain   string
+	tunnelToken    string
+	tunnelKeyring  bool
+	tunnelProvider string
+
+	tunnelURLFormat string
+	tunnelURLVar    string
 )
 
 var tunnelCmd = &cobra.Command{
 	Use:   "tunnel",
-	Short: "Configure ngrok tunnel settings",
-	Long: `Configure the ngrok tunnel for external access.
+	Short: "Configure tunnel settings",
+	Long: `Configure the tunnel for external access.
 
 Examples:
   hz tunnel --enable              # Enable tunnel
   hz tunnel --disable             # Disable tunnel
   hz tunnel --domain myapp.ngrok.io   # Set custom domain
-  hz tunnel --token abc123        # Set auth token`,
+  hz tunnel --token abc123        # Set auth token
+  hz tunnel --token abc123 --save-keyring   # Keep it in the OS keyring instead
+  hz tunnel --provider localtunnel   # No account needed, random subdomain
+  hz tunnel --provider ssh        # Forward a port of tunnel.ssh.host, like ssh -R
+
+hz looks for the auth token in tunnel.authtoken, then the file named by
+tunnel.authtokenFile, then the OS keyring (with tunnel.keyring: true), then
+the ngrok agent's config. The localtunnel and ssh providers need no token.`,
 	RunE: runTunnel,
 }
 
+var tunnelURLCmd = &cobra.Command{
+	Use:   "url",
+	Short: "Print the running tunnel's public URL",
+	Long: `Print the public URL of the tunnel of the running hz, and nothing else, for
+use in scripts. Fails when hz isn't running or its tunnel isn't active.
+
+Examples:
+  curl -X POST "$(hz tunnel url)/webhooks/test"
+  hz tunnel url --format env --var VITE_API_URL >> .env.local
+
+Set tunnel.urlFile to have hz keep the URL in a file instead.`,
+	Args: cobra.NoArgs,
+	RunE: runTunnelURL,
+}
+
 func init() {
-	tunnelCmd.Flags().BoolVar(&tunnelEnable, "enable", false, "enable ngrok tunnel")
-	tunnelCmd.Flags().BoolVar(&tunnelDisable, "disable", false, "disable ngrok tunnel")
+	tunnelCmd.Flags().BoolVar(&tunnelEnable, "enable", false, "enable the tunnel")
+	tunnelCmd.Flags().BoolVar(&tunnelDisable, "disable", false, "disable the tunnel")
+	tunnelCmd.Flags().StringVar(&tunnelProvider, "provider", "", "set the tunnel provider ("+strings.Join(tunnel.Providers, ", ")+")")
 	tunnelCmd.Flags().StringVar(&tunnelDomain, "domain", "", "set custom ngrok domain")
 	tunnelCmd.Flags().StringVar(&tunnelToken, "token", "", "set ngrok auth token")
+	tunnelCmd.Flags().BoolVar(&tunnelKeyring, "save-keyring", false, "save --token in the OS keyring instead of the config file")
+
+	tunnelURLCmd.Flags().StringVar(&tunnelURLFormat, "format", "url", "output format (url, env)")
+	tunnelURLCmd.Flags().StringVar(&tunnelURLVar, "var", "HZ_TUNNEL_URL", "variable name for --format env")
 
+	tunnelCmd.AddCommand(tunnelURLCmd)
 	rootCmd.AddCommand(tunnelCmd)
 }
 
 func runTunnel(cmd *cobra.Command, args []string) error {
+	if tunnelKeyring && tunnelToken == "" {
+		return fmt.Errorf("--save-keyring needs --token")
+	}
+
 	// Find config file
 	configPath := cfgFile
 	if configPath == "" {
@@ -56,59 +99,195 @@ func runTunnel(cmd *cobra.Command, args []string) error {
 	}
 
 	cfg := cfgManager.Get()
-	modified := false
+	changes := make(map[string]interface{}) // saved to the main file only
 
 	// Apply changes
 	if tunnelEnable {
-		cfg.Tunnel.Enabled = true
-		modified = true
+		changes["enabled"] = true
 		fmt.Println("✅ Tunnel enabled")
 	}
 
 	if tunnelDisable {
-		cfg.Tunnel.Enabled = false
-		modified = true
+		changes["enabled"] = false
 		fmt.Println("✅ Tunnel disabled")
 	}
 
 	if tunnelDomain != "" {
-		cfg.Tunnel.Domain = tunnelDomain
-		modified = true
+		changes["domain"] = tunnelDomain
 		fmt.Printf("✅ Tunnel domain set to: %s\n", tunnelDomain)
 	}
 
-	if tunnelToken != "" {
-		cfg.Tunnel.AuthToken = tunnelToken
-		modified = true
+	if tunnelProvider != "" {
+		if !slices.Contains(tunnel.Providers, tunnelProvider) {
+			return fmt.Errorf("unknown tunnel provider %q; use %s", tunnelProvider, strings.Join(tunnel.Providers, " or "))
+		}
+		if tunnelProvider == tunnel.ProviderLocaltunnel && (tunnelDomain != "" || cfg.Tunnel.Domain != "") {
+			return fmt.Errorf("localtunnel assigns a random subdomain and can't use a custom domain; remove tunnel.domain from the config first")
+		}
+		if tunnelProvider == tunnel.ProviderSSH && (cfg.Tunnel.SSH == nil || cfg.Tunnel.SSH.Host == "") {
+			return fmt.Errorf("the ssh provider needs a host; add tunnel.ssh with host, user and remotePort to the config first")
+		}
+		changes["provider"] = tunnelProvider
+		fmt.Printf("✅ Tunnel provider set to: %s\n", tunnelProvider)
+	}
+
+	if tunnelToken != "" && tunnelKeyring {
+		if err := tunnel.SaveKeyringToken(tunnelToken); err != nil {
+			return err
+		}
+		changes["keyring"] = true
+		fmt.Println("✅ Tunnel auth token saved to the OS keyring")
+		if cfg.Tunnel.AuthToken != "" {
+			fmt.Println("⚠️  tunnel.authtoken is set in the config and takes precedence; remove it to use the keyring")
+		}
+	} else if tunnelToken != "" {
+		changes["authtoken"] = tunnelToken
 		fmt.Println("✅ Tunnel auth token updated")
 	}
 
 	// If no flags, show current status
-	if !modified {
+	if len(changes) == 0 {
 		fmt.Printf("🌐 Tunnel Configuration:\n")
 		fmt.Printf("   Enabled:  %v\n", cfg.Tunnel.Enabled)
 		fmt.Printf("   Provider: %s\n", cfg.Tunnel.Provider)
 		if cfg.Tunnel.Domain != "" {
 			fmt.Printf("   Domain:   %s\n", cfg.Tunnel.Domain)
 		}
-		if cfg.Tunnel.AuthToken != "" {
-			fmt.Printf("   Token:    %s***\n", cfg.Tunnel.AuthToken[:4])
+		if cfg.Tunnel.Server != "" {
+			fmt.Printf("   Server:   %s\n", cfg.Tunnel.Server)
+		}
+		if s := cfg.Tunnel.SSH; s != nil && cfg.Tunnel.Provider == tunnel.ProviderSSH {
+			host := s.Host
+			if s.User != "" {
+				host = s.User + "@" + host
+			}
+			fmt.Printf("   SSH:      %s, remote port %d\n", host, s.RemotePort)
+			if s.InsecureIgnoreHostKey {
+				fmt.Printf("             ⚠️  host key not verified\n")
+			}
+		}
+		if len(cfg.Tunnel.Endpoints) > 0 {
+			fmt.Printf("   Endpoints:\n")
+			for _, e := range cfg.Tunnel.Endpoints {
+				domain, target := e.Domain, "all services"
+				if domain == "" {
+					domain = "(random domain)"
+				}
+				if e.Service != "" {
+					target = e.Service
+				}
+				fmt.Printf("     • %s → %s\n", domain, target)
+			}
+		}
+		if cfg.Tunnel.URLFile != "" {
+			fmt.Printf("   URL file: %s\n", cfg.Tunnel.URLFile)
+		}
+		if cfg.Tunnel.Schemes != nil && cfg.Tunnel.Provider == tunnel.ProviderNgrok {
+			redirect := ""
+			if cfg.Tunnel.ForceHTTPSRedirect && len(cfg.Tunnel.Schemes) == 2 {
+				redirect = " (http redirects to https)"
+			}
+			fmt.Printf("   Schemes:  %s%s\n", strings.Join(cfg.Tunnel.Schemes, ", "), redirect)
+		}
+		if n := len(cfg.Tunnel.BasicAuth); n > 0 {
+			fmt.Printf("   Auth:     basic auth enabled (%s)\n", plural(n, "login"))
+		}
+		if w := cfg.Tunnel.Watchdog; w != nil && w.Enabled {
+			fmt.Printf("   Watchdog: every %s, restart after %s\n", time.Duration(w.Interval), plural(w.FailureThreshold, "failed check"))
+		}
+		var edge []string
+		if cfg.Tunnel.Compression {
+			edge = append(edge, "gzip compression")
+		}
+		if cfg.Tunnel.CircuitBreaker > 0 {
+			edge = append(edge, fmt.Sprintf("circuit breaker at %g%% 5xx responses", cfg.Tunnel.CircuitBreaker*100))
+		}
+		if len(edge) > 0 {
+			fmt.Printf("   Edge:     %s\n", strings.Join(edge, ", "))
+		}
+		if cfg.Tunnel.Provider == tunnel.ProviderLocaltunnel || cfg.Tunnel.Provider == tunnel.ProviderSSH {
+			fmt.Printf("   Token:    (not needed)\n")
+		} else if token, source, err := tunnel.ResolveAuthToken(&cfg.Tunnel); err == nil {
+			fmt.Printf("   Token:    %s (from %s)\n", tunnel.MaskToken(token), source)
 		} else {
-			fmt.Printf("   Token:    (not set)\n")
+			fmt.Printf("   Token:    (not set: %v)\n", err)
 		}
 		return nil
 	}
 
-	// Save config
-	data, err := yaml.Marshal(cfg)
+	// Save config, keeping its comments and layout
+	file, err := config.OpenFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
 	}
-
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	for _, key := range []string{"enabled", "provider", "domain", "authtoken", "keyring"} {
+		if value, ok := changes[key]; ok {
+			if err := file.SetTunnel(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	if err := file.Save(); err != nil {
+		return err
 	}
 
 	fmt.Printf("\nConfiguration saved to %s\n", configPath)
 	return nil
 }
+
+// envName matches names usable as environment variables
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// runTunnelURL prints the public URL of the running instance's tunnel
+func runTunnelURL(cmd *cobra.Command, args []string) error {
+	switch tunnelURLFormat {
+	case "url":
+	case "env":
+		if !envName.MatchString(tunnelURLVar) {
+			return fmt.Errorf("--var %q isn't a valid variable name", tunnelURLVar)
+		}
+	default:
+		return fmt.Errorf("unknown format %q; use url or env", tunnelURLFormat)
+	}
+	cmd.SilenceUsage = true
+
+	// Find config file
+	configPath := cfgFile
+	if configPath == "" {
+		var err error
+		configPath, err = config.FindConfigFile()
+		if err != nil {
+			return fmt.Errorf("no config file found. Run 'hz init' first")
+		}
+	}
+
+	cfgManager, err := config.NewManager(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(localAddr(cfgManager.Get().Server) + "/__hz/tunnel")
+	if err != nil {
+		return fmt.Errorf("hz is not running: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("the tunnel isn't enabled")
+	}
+
+	var info admin.TunnelInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if !info.Active || info.PublicURL == "" {
+		return fmt.Errorf("the tunnel isn't active (%s)", info.State)
+	}
+
+	if tunnelURLFormat == "env" {
+		fmt.Printf("%s=%s\n", tunnelURLVar, info.PublicURL)
+	} else {
+		fmt.Println(info.PublicURL)
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+// Package admin serves the running proxy's internal API under /__hz/
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/inspector"
+	"github.com/zymawy/hz/internal/logs"
+	"github.com/zymawy/hz/internal/process"
+	"github.com/zymawy/hz/internal/proxy"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/internal/schema"
+	"github.com/zymawy/hz/internal/tunnel"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// Server answers internal API requests for a running proxy
+type Server struct {
+	registry  *registry.Registry
+	proxy     *proxy.Proxy
+	mux       *http.ServeMux
+	startedAt time.Time
+
+	config *config.Manager // the running configuration, if set
+	tunnel *tunnel.Manager // the tunnel, if enabled
+	logs   *logs.Buffer    // recent log lines, if kept
+
+	addService func(*types.Service) error // registers services added while running, if set
+
+	inspector   *inspector.Inspector // the inspector, started on demand if not enabled
+	inspecting  bool                 // the inspector is serving
+	inspectorMu sync.Mutex
+}
+
+// ServiceInfo is the live view of a registered service
+type ServiceInfo struct {
+	Name          string              `json:"name"`
+	Target        string              `json:"target"`
+	Default       bool                `json:"default,omitempty"`
+	Dynamic       bool                `json:"dynamic,omitempty"`
+	Status        types.HealthStatus  `json:"status"`
+	LastCheck     time.Time           `json:"lastCheck,omitempty"`
+	LastError     string              `json:"lastError,omitempty"`
+	LastCode      int                 `json:"lastStatusCode,omitempty"`
+	LastLatency   time.Duration       `json:"lastLatency,omitempty"`
+	NextCheck     time.Time           `json:"nextCheck,omitempty"`
+	Backoff       time.Duration       `json:"backoff,omitempty"` // stretched check interval while failing
+	Latency       *types.LatencyStats `json:"latency,omitempty"` // recent health checks
+	Failures      int                 `json:"consecutiveFailures,omitempty"`
+	Successes     int                 `json:"consecutiveSuccesses,omitempty"`
+	Routes        int                 `json:"routes"`
+	RequestCount  int64               `json:"requestCount"`
+	ErrorCount    int64               `json:"errorCount"`
+	InFlight      int64               `json:"inFlight"`
+	MaxConcurrent int                 `json:"maxConcurrent,omitempty"`
+
+	Process  *process.State `json:"process,omitempty"`  // managed backend process
+	Starting bool           `json:"starting,omitempty"` // held back until the process is up
+	Gated    bool           `json:"gated,omitempty"`    // held back by the readiness gate
+
+	Maintenance *types.MaintenanceConfig `json:"maintenance,omitempty"`
+}
+
+// TunnelInfo is the live state of the tunnel
+type TunnelInfo struct {
+	Provider string `json:"provider"`
+	types.TunnelStatus
+}
+
+// New creates the admin API server
+func New(reg *registry.Registry, prx *proxy.Proxy) *Server {
+	s := &Server{
+		registry:  reg,
+		proxy:     prx,
+		mux:       http.NewServeMux(),
+		startedAt: time.Now(),
+	}
+
+	s.mux.HandleFunc(proxy.AdminPrefix+"health", s.handleHealth)
+	s.mux.HandleFunc(proxy.AdminPrefix+"services", s.handleServices)
+	s.mux.HandleFunc(proxy.AdminPrefix+"services/", s.handleService)
+	s.mux.HandleFunc(proxy.AdminPrefix+"stats", s.handleStats)
+	s.mux.HandleFunc(proxy.AdminPrefix+"status", s.handleStatus)
+	s.mux.HandleFunc(proxy.AdminPrefix+"route", s.handleRoute)
+	s.mux.HandleFunc(proxy.AdminPrefix+"discover", s.handleDiscover)
+	s.mux.HandleFunc(proxy.AdminPrefix+"dependencies", s.handleDependencies)
+	s.mux.HandleFunc(proxy.AdminPrefix+"schema", s.handleSchema)
+	s.mux.HandleFunc(proxy.AdminPrefix+"config", s.handleConfig)
+	s.mux.HandleFunc(proxy.AdminPrefix+"reload", s.handleReload)
+	s.mux.HandleFunc(proxy.AdminPrefix+"tunnel", s.handleTunnel)
+	s.mux.HandleFunc(tunnel.PingPath, handlePing)
+	s.mux.HandleFunc(proxy.AdminPrefix+"logs", s.handleLogs)
+	s.mux.HandleFunc(proxy.AdminPrefix+"inspector", s.handleInspector)
+
+	return s
+}
+
+// SetConfig makes the running configuration available under /__hz/config
+func (s *Server) SetConfig(m *config.Manager) {
+	s.config = m
+}
+
+// SetTunnel makes the tunnel's state available under /__hz/tunnel
+func (s *Server) SetTunnel(t *tunnel.Manager) {
+	s.tunnel = t
+}
+
+// ServeHTTP dispatches internal API requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleHealth reports that the proxy is up, with the recent health check
+// latency of each service
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]types.LatencyStats)
+	for _, svc := range s.registry.List() {
+		if l := svc.Latency(); l.Samples > 0 {
+			checks[svc.Name] = l
+		}
+	}
+
+	body := map[string]interface{}{
+		"status": "ok",
+		"uptime": time.Since(s.startedAt).Round(time.Second).String(),
+		"checks": checks,
+	}
+	if s.config != nil {
+		body["config"] = s.config.Source()
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// ConfigInfo is the running configuration with where it came from
+type ConfigInfo struct {
+	Source string          `json:"source"`          // the config file, or "flags"
+	Files  []string        `json:"files,omitempty"` // the config file and its includes
+	Config json.RawMessage `json:"config"`          // as a config file, decodes into types.Config
+}
+
+// handleConfig returns the effective configuration, with defaults applied
+// and environment variables expanded, and secret-looking values redacted.
+// Env values, headers and commands aren't, so it isn't served through the
+// tunnel. ?format=yaml returns it as a YAML file instead of JSON.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "the config isn't served through the tunnel"})
+		return
+	}
+	if s.config == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "configuration not available"})
+		return
+	}
+
+	if r.URL.Query().Get("format") == config.FormatYAML {
+		data, err := config.EncodeRedacted(config.FormatYAML, s.config.Get())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(data)
+		return
+	}
+
+	data, err := config.EncodeRedacted(config.FormatJSON, s.config.Get())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, ConfigInfo{Source: s.config.Source(), Files: s.config.Files(), Config: data})
+}
+
+// handleReload reloads the configuration like SIGHUP (POST only). Errors in
+// the files are returned and the running configuration stays.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	// Reloads restart managed processes; the public mustn't trigger them
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "the config can't be reloaded through the tunnel"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if s.config == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "configuration not available"})
+		return
+	}
+
+	if err := s.config.Reload(); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "reloaded",
+		"source":   s.config.Source(),
+		"warnings": len(s.config.Warnings()),
+	})
+}
+
+// handleTunnel reports the tunnel's state: active, reconnecting (with the
+// attempts so far), failed or stopped
+func (s *Server) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	if s.tunnel == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "tunnel not enabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, TunnelInfo{Provider: s.tunnel.Provider(), TunnelStatus: s.tunnel.Status()})
+}
+
+// handlePing answers the tunnel watchdog's checks, marked as hz's own
+func handlePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(tunnel.PingHeader, "pong")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte("pong\n"))
+}
+
+// handleServices lists registered services with live counters; POST
+// registers a new one
+func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, s.services())
+	case http.MethodPost:
+		s.handleAddService(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// handleService dispatches /__hz/services/{name}/... requests
+func (s *Server) handleService(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, proxy.AdminPrefix+"services/")
+	name, action, _ := strings.Cut(rest, "/")
+
+	svc, err := s.registry.Get(name)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	switch action {
+	case "maintenance":
+		s.handleMaintenance(w, r, svc)
+	case "pause", "resume":
+		s.handlePause(w, r, svc, action)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown endpoint"})
+	}
+}
+
+// handleMaintenance shows (GET) or replaces (POST) a service's maintenance
+// settings. A POST without a body enables maintenance with the defaults.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request, svc *types.Service) {
+	// The public could take every service down
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "maintenance can't be changed through the tunnel"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		m := &types.MaintenanceConfig{Enabled: true}
+		if err := json.NewDecoder(r.Body).Decode(m); err != nil && !errors.Is(err, io.EOF) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid maintenance settings: " + err.Error()})
+			return
+		}
+		if m.RetryAfter < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "retryAfter must not be negative"})
+			return
+		}
+		svc.SetMaintenance(m)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.serviceInfo(svc))
+}
+
+// handlePause pauses or resumes a service's health checks (POST only)
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request, svc *types.Service, action string) {
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "health checks can't be paused through the tunnel"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var err error
+	if action == "pause" {
+		err = s.registry.Pause(svc.Name)
+	} else {
+		err = s.registry.Resume(svc.Name)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.serviceInfo(svc))
+}
+
+// handleStats returns proxy and registry statistics
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"proxy":    s.proxy.Stats(),
+		"registry": s.registry.Stats(),
+		"services": s.services(),
+	})
+}
+
+// handleDiscover lists local HTTP servers that could be added as services.
+// Nothing is registered.
+func (s *Server) handleDiscover(w http.ResponseWriter, r *http.Request) {
+	// The scan would map this machine's ports for the public
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "discovery isn't served through the tunnel"})
+		return
+	}
+	if !s.registry.ScanEnabled() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "port scanning is disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.registry.Discover(r.Context()))
+}
+
+// handleDependencies returns the service dependency graph
+func (s *Server) handleDependencies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.registry.Dependencies())
+}
+
+// services builds the sorted live service list
+func (s *Server) services() []ServiceInfo {
+	list := s.registry.List()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	infos := make([]ServiceInfo, 0, len(list))
+	for _, svc := range list {
+		infos = append(infos, s.serviceInfo(svc))
+	}
+	return infos
+}
+
+// serviceInfo builds the live view of one service
+func (s *Server) serviceInfo(svc *types.Service) ServiceInfo {
+	requests, errors, inFlight := svc.Counters()
+	info := ServiceInfo{
+		Name:          svc.Name,
+		Target:        svc.Target,
+		Default:       svc.Default,
+		Dynamic:       svc.Dynamic,
+		Status:        svc.GetStatus(),
+		LastCheck:     svc.GetLastCheck(),
+		Routes:        len(svc.Routes),
+		RequestCount:  requests,
+		ErrorCount:    errors,
+		InFlight:      inFlight,
+		MaxConcurrent: svc.MaxConcurrent,
+	}
+	info.Failures, info.Successes = svc.Streaks()
+	last := svc.LastResult()
+	info.LastError, info.LastCode, info.LastLatency = last.Error, last.StatusCode, last.Latency
+	info.NextCheck, info.Backoff = svc.Schedule()
+	if l := svc.Latency(); l.Samples > 0 {
+		info.Latency = &l
+	}
+	if m := svc.GetMaintenance(); m != nil && m.Enabled {
+		info.Maintenance = m
+	}
+	info.Gated = svc.Gated()
+	if state, ok := s.registry.Process(svc.Name); ok {
+		info.Process = &state
+		info.Starting = s.registry.Starting(svc.Name)
+	}
+	return info
+}
+
+// handleSchema serves the config file JSON Schema, for editors pointed at the
+// running instance with a $schema comment
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	data, err := schema.JSON()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = w.Write(data)
+}
+
+// writeJSON encodes v as the response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/internal/proxy"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+func TestTunnelRefused(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "services/web/maintenance"},
+		{http.MethodPost, "services/web/maintenance"},
+		{http.MethodPost, "services/web/pause"},
+		{http.MethodPost, "services/web/resume"},
+		{http.MethodPost, "reload"},
+		{http.MethodGet, "discover"},
+		{http.MethodGet, "config"},
+		{http.MethodGet, "config?format=yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			reg := registry.New()
+			defer reg.Stop()
+			target, _ := url.Parse("http://127.0.0.1:1")
+			if err := reg.Register(&types.Service{Name: "web", Target: target.String(), TargetURL: target}); err != nil {
+				t.Fatal(err)
+			}
+			s := New(reg, nil)
+
+			req := httptest.NewRequest(tt.method, proxy.AdminPrefix+tt.path, nil)
+			req = req.WithContext(clientip.WithTunnel(req.Context()))
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("got %d through the tunnel, want 403: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
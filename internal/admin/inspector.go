@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/internal/inspector"
+)
+
+// InspectorInfo is the state of the request inspector
+type InspectorInfo struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url,omitempty"` // web interface and API, when enabled
+}
+
+// SetInspector makes the inspector available under /__hz/inspector, where
+// POST starts it if hz start didn't
+func (s *Server) SetInspector(insp *inspector.Inspector) {
+	s.inspector = insp
+}
+
+// StartInspector starts serving the inspector and capturing requests into
+// it. It does nothing if the inspector is serving already.
+func (s *Server) StartInspector() error {
+	s.inspectorMu.Lock()
+	defer s.inspectorMu.Unlock()
+
+	if s.inspector == nil {
+		return errors.New("inspector not available")
+	}
+	if s.inspecting {
+		return nil
+	}
+	if err := s.inspector.Start(); err != nil {
+		s.proxy.SetInspector(nil)
+		return err
+	}
+	s.proxy.SetInspector(s.inspector)
+	s.inspecting = true
+	return nil
+}
+
+// inspectorInfo reports whether the inspector is serving, and where
+func (s *Server) inspectorInfo() InspectorInfo {
+	s.inspectorMu.Lock()
+	defer s.inspectorMu.Unlock()
+
+	if !s.inspecting {
+		return InspectorInfo{}
+	}
+	return InspectorInfo{Enabled: true, URL: s.inspector.URL()}
+}
+
+// handleInspector reports the inspector's state; POST starts it first
+func (s *Server) handleInspector(w http.ResponseWriter, r *http.Request) {
+	// Captured requests hold headers and bodies; don't let the public turn it on
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "the inspector isn't served through the tunnel"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := s.StartInspector(); err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.inspectorInfo())
+}
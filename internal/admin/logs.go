@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/internal/logs"
+)
+
+// LogSessionHeader carries the log buffer's session, which changes when hz
+// restarts; a client passes it back as ?session= to resume after ?since=
+const LogSessionHeader = "X-Hz-Log-Session"
+
+// SetLogs serves the recent log lines under /__hz/logs
+func (s *Server) SetLogs(b *logs.Buffer) {
+	s.logs = b
+}
+
+// handleLogs returns the kept log lines as JSON or, with follow=true,
+// streams them as server-sent events until the client goes away. level
+// (default info) and service filter the lines, lines keeps the last n, and
+// since skips the lines up to a sequence number of the same session.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if s.logs == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "logs not kept"})
+		return
+	}
+	// Process output and request errors aren't for the public
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "logs aren't served through the tunnel"})
+		return
+	}
+
+	q := r.URL.Query()
+	level := q.Get("level")
+	if level == "" {
+		level = logs.LevelInfo
+	}
+	if !slices.Contains(logs.Levels, level) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown level %q", level)})
+		return
+	}
+	tail, err := strconv.Atoi(q.Get("lines"))
+	if q.Get("lines") != "" && (err != nil || tail < 0) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "lines must be a positive number"})
+		return
+	}
+	var since int64
+	if q.Get("session") == s.logs.Session() {
+		since, _ = strconv.ParseInt(q.Get("since"), 10, 64)
+	}
+	service := q.Get("service")
+	match := func(e logs.Entry) bool {
+		return e.AtLeast(level) && (service == "" || e.About(service))
+	}
+	filter := func(entries []logs.Entry) []logs.Entry {
+		out := make([]logs.Entry, 0, len(entries))
+		for _, e := range entries {
+			if match(e) {
+				out = append(out, e)
+			}
+		}
+		if tail > 0 && len(out) > tail {
+			out = out[len(out)-tail:]
+		}
+		return out
+	}
+
+	w.Header().Set(LogSessionHeader, s.logs.Session())
+	if q.Get("follow") != "true" {
+		writeJSON(w, http.StatusOK, filter(s.logs.Since(since)))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+	backlog, lines, stop := s.logs.Follow(since)
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(e logs.Entry) {
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data)
+	}
+	for _, e := range filter(backlog) {
+		send(e)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case e, ok := <-lines:
+			if !ok {
+				return // hz is shutting down
+			}
+			if match(e) {
+				send(e)
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// RouteQuery is a request to route without sending it
+type RouteQuery struct {
+	Method  string      `json:"method"`
+	Path    string      `json:"path"` // may carry a query
+	Host    string      `json:"host,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+}
+
+// Request builds the request q describes, as a client would send it
+func (q RouteQuery) Request() (*http.Request, error) {
+	host := q.Host
+	if host == "" {
+		host = "localhost"
+	}
+	method := strings.ToUpper(q.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, "http://"+host+q.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range q.Headers {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	return req, nil
+}
+
+// handleRoute answers where a RouteQuery would go with the live routes, as
+// a proxy.RouteMatch (POST only)
+func (s *Server) handleRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var q RouteQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if !strings.HasPrefix(q.Path, "/") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path must start with /"})
+		return
+	}
+	req, err := q.Request()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	match, err := s.proxy.Explain(req)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, match)
+}
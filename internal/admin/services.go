@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// SetAddService lets POST /__hz/services register a service while hz runs.
+// add validates the service, registers it and rebuilds the routes, or
+// returns why it couldn't.
+func (s *Server) SetAddService(add func(*types.Service) error) {
+	s.addService = add
+}
+
+// handleAddService registers the service in the request body, answering
+// 201 with its live view
+func (s *Server) handleAddService(w http.ResponseWriter, r *http.Request) {
+	// A service can point anywhere; only hz add on this machine may add one.
+	// Web pages can't either: they can send a text/plain POST without a
+	// preflight, but not application/json, and they always send an Origin.
+	if clientip.FromTunnel(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "services can't be added through the tunnel"})
+		return
+	}
+	if addr, ok := clientip.Resolve(r); !ok || !addr.IsLoopback() {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "services can only be added from this machine"})
+		return
+	}
+	if !sameOrigin(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "services can't be added from another origin"})
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "send the service as application/json"})
+		return
+	}
+	if s.addService == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "adding services not available"})
+		return
+	}
+
+	svc := &types.Service{}
+	if err := json.NewDecoder(r.Body).Decode(svc); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid service: " + err.Error()})
+		return
+	}
+	// Managed processes and exec checks run commands; they only come from
+	// the config file
+	if err := runsCommands(svc); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	if _, err := s.registry.Get(svc.Name); err == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("service %s is already registered", svc.Name)})
+		return
+	}
+	// Changing the default takes the other service's config with it
+	if svc.Default {
+		for _, other := range s.registry.List() {
+			if other.Default {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": fmt.Sprintf("%s is the default service; reload the config to change it", other.Name)})
+				return
+			}
+		}
+	}
+
+	if err := s.addService(svc); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	registered, err := s.registry.Get(svc.Name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.serviceInfo(registered))
+}
+
+// sameOrigin reports whether a request carries no Origin, as from hz add, or
+// hz's own
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
+
+// runsCommands returns an error if the service would run commands on this
+// machine
+func runsCommands(svc *types.Service) error {
+	switch {
+	case svc.Command != "" || svc.Cwd != "" || len(svc.Env) > 0:
+		return fmt.Errorf("service %s: command, cwd and env can only be set in the config file", svc.Name)
+	case svc.Health != nil && svc.Health.Type == types.HealthCheckExec:
+		return fmt.Errorf("service %s: exec health checks can only be set in the config file", svc.Name)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/internal/proxy"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+func TestAddServiceGuards(t *testing.T) {
+	const plain = `{"name":"web","target":"http://127.0.0.1:1"}`
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		origin      string
+		remoteAddr  string
+		tunnel      bool
+		want        int
+	}{
+		{name: "local json", body: plain, contentType: "application/json", want: http.StatusCreated},
+		{name: "charset", body: plain, contentType: "application/json; charset=utf-8", want: http.StatusCreated},
+		{name: "own origin", body: plain, contentType: "application/json", origin: "http://localhost:3000", want: http.StatusCreated},
+		{name: "text/plain", body: plain, contentType: "text/plain", want: http.StatusUnsupportedMediaType},
+		{name: "no content type", body: plain, want: http.StatusUnsupportedMediaType},
+		{name: "other origin", body: plain, contentType: "application/json", origin: "http://evil.example", want: http.StatusForbidden},
+		{name: "null origin", body: plain, contentType: "application/json", origin: "null", want: http.StatusForbidden},
+		{name: "lan client", body: plain, contentType: "application/json", remoteAddr: "192.168.1.20:5000", want: http.StatusForbidden},
+		{name: "tunnel", body: plain, contentType: "application/json", tunnel: true, want: http.StatusForbidden},
+		{name: "command", body: `{"name":"web","target":"http://127.0.0.1:1","command":"touch pwned"}`, contentType: "application/json", want: http.StatusUnprocessableEntity},
+		{name: "cwd", body: `{"name":"web","target":"http://127.0.0.1:1","cwd":"/tmp"}`, contentType: "application/json", want: http.StatusUnprocessableEntity},
+		{name: "env", body: `{"name":"web","target":"http://127.0.0.1:1","env":{"A":"b"}}`, contentType: "application/json", want: http.StatusUnprocessableEntity},
+		{name: "exec check", body: `{"name":"web","target":"http://127.0.0.1:1","health":{"type":"exec","command":["touch","pwned"]}}`, contentType: "application/json", want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added := false
+			reg := registry.New()
+			defer reg.Stop()
+			s := New(reg, nil)
+			s.SetAddService(func(svc *types.Service) error {
+				added = true
+				svc.TargetURL, _ = url.Parse(svc.Target)
+				return reg.Register(svc)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "http://localhost:3000"+proxy.AdminPrefix+"services", strings.NewReader(tt.body))
+			req.RemoteAddr = "127.0.0.1:40000"
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.tunnel {
+				req = req.WithContext(clientip.WithTunnel(req.Context()))
+			}
+
+			rec := httptest.NewRecorder()
+			s.handleAddService(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if added != (tt.want == http.StatusCreated) {
+				t.Errorf("service passed on: %v", added)
+			}
+		})
+	}
+}
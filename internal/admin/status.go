@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// StatusVersion is the version of the StatusInfo shape. It goes up when a
+// field is renamed, removed or changes meaning, not when one is added.
+const StatusVersion = 1
+
+// StatusInfo is everything hz status shows about a running instance, in one
+// response
+type StatusInfo struct {
+	Version      int                      `json:"version"`
+	PID          int                      `json:"pid"`
+	Started      time.Time                `json:"started"`
+	Uptime       string                   `json:"uptime"`
+	Config       string                   `json:"config,omitempty"` // the config file, or "flags"
+	Services     []ServiceInfo            `json:"services"`
+	Proxy        types.ProxyStats         `json:"proxy"`
+	Dependencies registry.DependencyGraph `json:"dependencies"`
+	Tunnel       *TunnelInfo              `json:"tunnel,omitempty"` // if enabled
+}
+
+// handleStatus reports the instance's state as StatusInfo
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	info := StatusInfo{
+		Version:      StatusVersion,
+		PID:          os.Getpid(),
+		Started:      s.startedAt,
+		Uptime:       time.Since(s.startedAt).Round(time.Second).String(),
+		Services:     s.services(),
+		Proxy:        s.proxy.Stats(),
+		Dependencies: s.registry.Dependencies(),
+	}
+	if s.config != nil {
+		info.Config = s.config.Source()
+	}
+	if s.tunnel != nil {
+		info.Tunnel = &TunnelInfo{Provider: s.tunnel.Provider(), TunnelStatus: s.tunnel.Status()}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
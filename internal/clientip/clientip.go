@@ -0,0 +1,154 @@
+// Package clientip resolves the effective client address of proxied requests
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	tunnelKey contextKey = iota
+	schemeKey
+	directKey
+)
+
+// WithTunnel marks a request context as having arrived through the tunnel
+func WithTunnel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tunnelKey, true)
+}
+
+// FromTunnel reports whether a request arrived through the tunnel
+func FromTunnel(r *http.Request) bool {
+	v, _ := r.Context().Value(tunnelKey).(bool)
+	return v
+}
+
+// WithDirect marks tunnel traffic whose connections come straight from the
+// clients, with no edge to forward their address: RemoteAddr is the client,
+// and X-Forwarded-For is whatever the client sent
+func WithDirect(ctx context.Context) context.Context {
+	return context.WithValue(ctx, directKey, true)
+}
+
+// direct reports whether a request came over a direct tunnel connection
+func direct(r *http.Request) bool {
+	v, _ := r.Context().Value(directKey).(bool)
+	return v
+}
+
+// WithScheme records the scheme a tunnel client used, which the request
+// itself doesn't show once the tunnel edge terminated TLS
+func WithScheme(ctx context.Context, scheme string) context.Context {
+	return context.WithValue(ctx, schemeKey, scheme)
+}
+
+// Scheme returns the scheme the client used: the tunnel's for tunnel
+// traffic, otherwise https or http depending on TLS
+func Scheme(r *http.Request) string {
+	if scheme, _ := r.Context().Value(schemeKey).(string); scheme != "" {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Resolve returns the effective client IP. Forwarded headers are only trusted
+// for tunnel traffic, where the tunnel edge appends the real client address;
+// local requests and direct tunnel connections always use RemoteAddr.
+// IPv4-mapped IPv6 addresses are unmapped.
+func Resolve(r *http.Request) (netip.Addr, bool) {
+	if FromTunnel(r) && !direct(r) {
+		if addr, ok := lastForwardedFor(r.Header.Get("X-Forwarded-For")); ok {
+			return addr, true
+		}
+	}
+	return remoteAddr(r)
+}
+
+// remoteAddr parses the address of the connection a request came over
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// Forwarded returns the client address the tunnel edge forwarded, for
+// tunnel traffic only; unlike Resolve it never falls back to RemoteAddr,
+// except for direct tunnel connections, where that is the client
+func Forwarded(r *http.Request) (netip.Addr, bool) {
+	if !FromTunnel(r) {
+		return netip.Addr{}, false
+	}
+	if direct(r) {
+		return remoteAddr(r)
+	}
+	return lastForwardedFor(r.Header.Get("X-Forwarded-For"))
+}
+
+// lastForwardedFor parses the right-most X-Forwarded-For entry, the one added
+// by the nearest trusted hop
+func lastForwardedFor(header string) (netip.Addr, bool) {
+	if header == "" {
+		return netip.Addr{}, false
+	}
+	entries := strings.Split(header, ",")
+	addr, err := netip.ParseAddr(strings.TrimSpace(entries[len(entries)-1]))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// ParsePrefixes parses CIDRs or bare IPs into prefixes, naming the first
+// invalid value in the error. IPv4-mapped IPv6 prefixes are unmapped.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		s := strings.TrimSpace(v)
+
+		var prefix netip.Prefix
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", v)
+			}
+			prefix = p.Masked()
+		} else {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", v)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// Contains reports whether addr falls within any of the prefixes
+func Contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
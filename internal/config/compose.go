@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeService is the part of a compose service hz reads
+type composeService struct {
+	Ports       []composePort `yaml:"ports"`
+	Healthcheck *struct {
+		Test interface{} `yaml:"test"`
+	} `yaml:"healthcheck"`
+}
+
+// composePort is a port mapping in short ("127.0.0.1:8080:80/tcp") or long
+// syntax. Published is 0 when Docker picks the host port; ranges publish
+// Published to Last.
+type composePort struct {
+	HostIP    string
+	Published int
+	Last      int
+	Target    string
+	Protocol  string
+}
+
+// UnmarshalYAML reads both port syntaxes
+func (p *composePort) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return p.parseShort(node.Value)
+	}
+
+	var long struct {
+		HostIP    string `yaml:"host_ip"`
+		Published string `yaml:"published"`
+		Target    string `yaml:"target"`
+		Protocol  string `yaml:"protocol"`
+	}
+	if err := node.Decode(&long); err != nil {
+		return err
+	}
+	p.HostIP, p.Target, p.Protocol = long.HostIP, long.Target, long.Protocol
+	var err error
+	if p.Published, p.Last, err = portRange(long.Published); err != nil {
+		return fmt.Errorf("line %d: invalid published port %q", node.Line, long.Published)
+	}
+	return nil
+}
+
+// parseShort parses [host_ip:][published:]target[/protocol]
+func (p *composePort) parseShort(s string) error {
+	spec, proto, _ := strings.Cut(s, "/")
+	p.Protocol = proto
+
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return fmt.Errorf("invalid port %q", s)
+		}
+		p.HostIP, spec = spec[1:end], spec[end+2:]
+	}
+	parts := strings.Split(spec, ":")
+	switch {
+	case len(parts) == 3 && p.HostIP == "":
+		p.HostIP, parts = parts[0], parts[1:]
+	case len(parts) > 2:
+		return fmt.Errorf("invalid port %q", s)
+	}
+	p.Target = parts[len(parts)-1]
+	if len(parts) == 2 {
+		var err error
+		if p.Published, p.Last, err = portRange(parts[0]); err != nil {
+			return fmt.Errorf("invalid port %q", s)
+		}
+	}
+	return nil
+}
+
+// portRange parses a port or a range like 8000-8005; 0 for ""
+func portRange(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	first, last, isRange := strings.Cut(s, "-")
+	if !isRange {
+		last = first
+	}
+	from, err1 := strconv.Atoi(first)
+	to, err2 := strconv.Atoi(last)
+	if err1 != nil || err2 != nil || from < 1 || to > 65535 || to < from {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	return from, to, nil
+}
+
+// host returns the address to reach a published port at
+func (p composePort) host() string {
+	switch p.HostIP {
+	case "", "0.0.0.0", "::", "127.0.0.1", "::1":
+		return "localhost"
+	}
+	if strings.Contains(p.HostIP, ":") {
+		return "[" + p.HostIP + "]"
+	}
+	return p.HostIP
+}
+
+// healthURL finds the URL a curl or wget health check requests
+var healthURL = regexp.MustCompile(`https?://[^\s"'|;&)]+`)
+
+// healthPath guesses the health check path from a compose healthcheck test,
+// when it is an HTTP request made with curl or wget
+func healthPath(test interface{}) string {
+	var cmd string
+	switch t := test.(type) {
+	case string:
+		cmd = t
+	case []interface{}:
+		var parts []string
+		for i, part := range t {
+			if i == 0 && (part == "CMD" || part == "CMD-SHELL") {
+				continue
+			}
+			parts = append(parts, fmt.Sprint(part))
+		}
+		cmd = strings.Join(parts, " ")
+	}
+	if !strings.Contains(cmd, "curl") && !strings.Contains(cmd, "wget") {
+		return ""
+	}
+	u, err := url.Parse(healthURL.FindString(cmd))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.RequestURI()
+}
+
+// ImportCompose generates an hz configuration from the services of a
+// docker-compose file that publish a port. Variables in the file are
+// expanded from the environment, then from a .env file next to it.
+func ImportCompose(path string) (*Import, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	dotenv, err := readDotEnv(filepath.Join(filepath.Dir(path), ".env"))
+	if err != nil {
+		return nil, err
+	}
+	text, envErrs := expandWith(string(data), func(name string) (string, bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		value, ok := dotenv[name]
+		return value, ok
+	})
+	if len(envErrs) > 0 {
+		line, col := offsetPosition(data, envErrs[0].offset)
+		return nil, fmt.Errorf("%s:%d:%d: %s", path, line, col, envErrs[0].message)
+	}
+
+	var doc struct {
+		Services yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if doc.Services.Kind != yaml.MappingNode || len(doc.Services.Content) == 0 {
+		return nil, fmt.Errorf("%s defines no services", path)
+	}
+
+	var services []importedService
+	var notes []string
+	used := map[int]bool{}
+	for i := 0; i+1 < len(doc.Services.Content); i += 2 {
+		name := doc.Services.Content[i].Value
+		var svc composeService
+		if err := doc.Services.Content[i+1].Decode(&svc); err != nil {
+			return nil, fmt.Errorf("service %s in %s: %w", name, path, err)
+		}
+
+		var published []composePort
+		for _, p := range svc.Ports {
+			if p.Published > 0 && (p.Protocol == "" || p.Protocol == "tcp") {
+				published = append(published, p)
+				for port := p.Published; port <= p.Last; port++ {
+					used[port] = true
+				}
+			}
+		}
+		if len(published) == 0 {
+			notes = append(notes, fmt.Sprintf("skipped %s: it publishes no fixed host port", name))
+			continue
+		}
+
+		// The first service gets unmatched requests; the others a path
+		imported := importedService{
+			name:      name,
+			comments:  []string{"From compose service " + name},
+			target:    fmt.Sprintf("http://%s:%d", published[0].host(), published[0].Published),
+			isDefault: len(services) == 0,
+			route:     len(services) > 0,
+		}
+		if len(published) > 1 {
+			var others []string
+			for _, p := range published[1:] {
+				others = append(others, strconv.Itoa(p.Published))
+			}
+			imported.comments[0] += fmt.Sprintf(" (also publishes %s)", strings.Join(others, ", "))
+			notes = append(notes, fmt.Sprintf("%s: used port %d; also publishes %s", name, published[0].Published, strings.Join(others, ", ")))
+		}
+		if svc.Healthcheck != nil {
+			imported.health = healthPath(svc.Healthcheck.Test)
+		}
+		services = append(services, imported)
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no service in %s publishes a host port", path)
+	}
+
+	// hz listens on the first port no compose service publishes
+	return renderImport(filepath.Base(path), "--from-compose", freePort(used), services, notes), nil
+}
+
+// readDotEnv reads KEY=VALUE lines from a .env file, if there is one
+func readDotEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+	return vars, scanner.Err()
+}
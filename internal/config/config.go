@@ -2,35 +2,72 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/internal/logs"
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/internal/tunnel"
 	"github.com/zymawy/hz/pkg/types"
-	"gopkg.in/yaml.v3"
 )
 
+// DefaultPort is the port hz listens on unless server.port says otherwise
+const DefaultPort = 3000
+
 // Manager handles configuration loading and hot-reload
 type Manager struct {
-	path      string
-	config    *types.Config
-	mu        sync.RWMutex
-	watcher   *fsnotify.Watcher
-	listeners []func(*types.Config)
-	stopCh    chan struct{}
+	path    string
+	flags   *types.Config // set instead of path for 'hz start --service'
+	data    []byte        // contents to use for the main file instead of reading it
+	config  *types.Config
+	mu      sync.RWMutex
+	watcher *fsnotify.Watcher
+	stopCh  chan struct{}
+
+	reloadMu sync.Mutex // one reload at a time, from the watcher or Reload
+
+	remote       *remoteSource // set when path is an http(s) URL
+	pollInterval time.Duration
+
+	listenersMu  sync.Mutex
+	listeners    []listener
+	nextListener int
+
+	main     *types.Config     // the main file on its own, without includes
+	sources  map[string]string // service name -> file it is defined in
+	includes []string          // include globs, resolved against the main file
+	files    []string          // the main file, then the included files read
+	warnings Problems          // found by the last successful Load
 }
 
 // NewManager creates a new configuration manager
 func NewManager(path string) (*Manager, error) {
 	m := &Manager{
-		path:      path,
-		listeners: make([]func(*types.Config), 0),
-		stopCh:    make(chan struct{}),
+		path:   path,
+		stopCh: make(chan struct{}),
+	}
+
+	// Remote configs are fetched, or read from the last good copy
+	if IsRemote(path) {
+		remote, err := newRemoteSource(path)
+		if err != nil {
+			return nil, err
+		}
+		m.remote = remote
+		if err := m.loadRemote(); err != nil {
+			return nil, err
+		}
+		return m, nil
 	}
 
 	// Load initial configuration
@@ -41,33 +78,28 @@ func NewManager(path string) (*Manager, error) {
 	return m, nil
 }
 
+// SetPollInterval sets how often Watch checks a remote config for changes
+// (default DefaultPollInterval). It has no effect on files.
+func (m *Manager) SetPollInterval(d time.Duration) {
+	m.pollInterval = d
+}
+
 // Load reads and parses the configuration file
 func (m *Manager) Load() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	data, err := os.ReadFile(m.path)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+	result, problems := m.parse()
+	if errs := problems.Errors(); len(errs) > 0 {
+		return errs
 	}
 
-	// Expand environment variables
-	expanded := os.ExpandEnv(string(data))
-
-	config := &types.Config{}
-	if err := yaml.Unmarshal([]byte(expanded), config); err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
-	}
-
-	// Apply defaults
-	m.applyDefaults(config)
-
-	// Validate and parse URLs
-	if err := m.validateAndParse(config); err != nil {
-		return fmt.Errorf("config validation failed: %w", err)
-	}
-
-	m.config = config
+	m.config = result.config
+	m.main = result.main
+	m.sources = result.sources
+	m.includes = result.includes
+	m.files = result.files
+	m.warnings = result.warnings
 	return nil
 }
 
@@ -79,16 +111,23 @@ func (m *Manager) applyDefaults(c *types.Config) {
 
 	// Server defaults
 	if c.Server.Port == 0 {
-		c.Server.Port = 3000
+		c.Server.Port = DefaultPort
 	}
 	if c.Server.Host == "" {
 		c.Server.Host = "0.0.0.0"
 	}
-	if c.Server.ReadTimeout == 0 {
-		c.Server.ReadTimeout = 30 * time.Second
+	// ReadTimeout and WriteTimeout stay 0: they would cut off streams
+	if c.Server.ReadHeaderTimeout == 0 {
+		c.Server.ReadHeaderTimeout = types.Duration(10 * time.Second)
+	}
+	if c.Server.IdleTimeout == 0 {
+		c.Server.IdleTimeout = types.Duration(2 * time.Minute)
+	}
+	if c.Server.LogBuffer == 0 {
+		c.Server.LogBuffer = logs.DefaultSize
 	}
-	if c.Server.WriteTimeout == 0 {
-		c.Server.WriteTimeout = 30 * time.Second
+	if c.Server.ForwardProxy != nil && c.Server.ForwardProxy.Host == "" {
+		c.Server.ForwardProxy.Host = c.Server.Host
 	}
 
 	// Tunnel defaults
@@ -98,6 +137,22 @@ func (m *Manager) applyDefaults(c *types.Config) {
 	if c.Tunnel.Region == "" {
 		c.Tunnel.Region = "us"
 	}
+	if w := c.Tunnel.Watchdog; w != nil {
+		if w.Interval == 0 {
+			w.Interval = types.Duration(30 * time.Second)
+		}
+		if w.Timeout == 0 {
+			w.Timeout = types.Duration(10 * time.Second)
+		}
+		if w.FailureThreshold == 0 {
+			w.FailureThreshold = 3
+		}
+	}
+
+	// Discovery defaults
+	if d := c.Discovery.Docker; d != nil && d.LabelPrefix == "" {
+		d.LabelPrefix = "hz"
+	}
 
 	// Logging defaults
 	if c.Logging.Level == "" {
@@ -109,64 +164,526 @@ func (m *Manager) applyDefaults(c *types.Config) {
 
 	// Service defaults
 	for _, svc := range c.Services {
-		if svc.Health != nil {
-			if svc.Health.Interval == 0 {
-				svc.Health.Interval = 30 * time.Second
+		applyServiceDefaults(svc)
+	}
+}
+
+// applyServiceDefaults sets default values for a service's missing settings
+func applyServiceDefaults(svc *types.Service) {
+	if svc.Health != nil {
+		if svc.Health.Interval == 0 {
+			svc.Health.Interval = types.Duration(30 * time.Second)
+		}
+		if svc.Health.Timeout == 0 {
+			svc.Health.Timeout = types.Duration(5 * time.Second)
+		}
+		if svc.Health.UnhealthyThreshold == 0 {
+			svc.Health.UnhealthyThreshold = 3
+		}
+		if svc.Health.HealthyThreshold == 0 {
+			svc.Health.HealthyThreshold = 1
+		}
+	}
+	if svc.Queue != nil && svc.Queue.Timeout == 0 {
+		svc.Queue.Timeout = types.Duration(2 * time.Second)
+	}
+	svc.Status = types.HealthStatusUnknown
+}
+
+// validateAndParse validates configuration and parses URLs. It returns every
+// problem found; errors about a particular setting carry its config path.
+func (m *Manager) validateAndParse(c *types.Config) []error {
+	var errs []error
+
+	if len(c.Services) == 0 && !c.Discovery.Enabled() {
+		errs = append(errs, fieldErrorf("services", "at least one service must be defined"))
+	}
+
+	if fp := c.Server.ForwardProxy; fp != nil {
+		if fp.Port <= 0 {
+			errs = append(errs, fieldErrorf("server.forwardProxy.port", "server.forwardProxy.port must be set"))
+		} else if fp.Port == c.Server.Port {
+			errs = append(errs, fieldErrorf("server.forwardProxy.port", "server.forwardProxy.port must differ from server.port (%d)", c.Server.Port))
+		}
+	}
+
+	for _, t := range []struct {
+		key string
+		d   types.Duration
+	}{
+		{"readHeaderTimeout", c.Server.ReadHeaderTimeout},
+		{"readTimeout", c.Server.ReadTimeout},
+		{"writeTimeout", c.Server.WriteTimeout},
+		{"idleTimeout", c.Server.IdleTimeout},
+	} {
+		if t.d < 0 {
+			errs = append(errs, fieldErrorf("server."+t.key, "server.%s must not be negative", t.key))
+		}
+	}
+
+	if c.Server.LogBuffer < 0 {
+		errs = append(errs, fieldErrorf("server.logBuffer", "server.logBuffer must not be negative"))
+	}
+
+	switch c.Server.TrailingSlash {
+	case "", types.TrailingSlashStrict, types.TrailingSlashIgnore, types.TrailingSlashRedirect:
+	default:
+		errs = append(errs, fieldErrorf("server.trailingSlash", "server.trailingSlash must be strict, ignore or redirect, got %q", c.Server.TrailingSlash))
+	}
+
+	for i, prefix := range c.Server.StrictPrefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, fieldErrorf(fmt.Sprintf("server.strictPrefixes[%d]", i), "server.strictPrefixes: %q must start with /", prefix))
+		}
+	}
+
+	errs = append(errs, validateProvider(&c.Tunnel)...)
+
+	// The token file is read when the tunnel starts, relative to the config file
+	if t := &c.Tunnel; t.AuthTokenFile != "" {
+		t.AuthTokenFile = tunnel.ExpandHome(t.AuthTokenFile)
+		if !filepath.IsAbs(t.AuthTokenFile) && m.path != "" {
+			t.AuthTokenFile = filepath.Join(filepath.Dir(m.path), t.AuthTokenFile)
+		}
+		if t.AuthToken != "" {
+			errs = append(errs, warningf("tunnel.authtokenFile", "tunnel.authtokenFile is ignored because tunnel.authtoken is set"))
+		}
+	}
+
+	// So are the ssh provider's key and known_hosts files
+	if s := c.Tunnel.SSH; s != nil {
+		for _, path := range []*string{&s.KeyFile, &s.KnownHostsFile} {
+			if *path == "" {
+				continue
 			}
-			if svc.Health.Timeout == 0 {
-				svc.Health.Timeout = 5 * time.Second
+			*path = tunnel.ExpandHome(*path)
+			if !filepath.IsAbs(*path) && m.path != "" {
+				*path = filepath.Join(filepath.Dir(m.path), *path)
 			}
 		}
-		svc.Status = types.HealthStatusUnknown
 	}
-}
 
-// validateAndParse validates configuration and parses URLs
-func (m *Manager) validateAndParse(c *types.Config) error {
-	if len(c.Services) == 0 {
-		return fmt.Errorf("at least one service must be defined")
+	// The URL file is written relative to the config file too
+	if t := &c.Tunnel; t.URLFile != "" {
+		t.URLFile = tunnel.ExpandHome(t.URLFile)
+		if !filepath.IsAbs(t.URLFile) && m.path != "" {
+			t.URLFile = filepath.Join(filepath.Dir(m.path), t.URLFile)
+		}
 	}
 
+	if sc := c.Discovery.Scan; sc != nil {
+		for i, p := range sc.Ports {
+			if p <= 0 || p > 65535 {
+				errs = append(errs, fieldErrorf(fmt.Sprintf("discovery.scan.ports[%d]", i), "discovery.scan.ports: invalid port %d", p))
+			}
+		}
+		if sc.Timeout < 0 {
+			errs = append(errs, fieldErrorf("discovery.scan.timeout", "discovery.scan.timeout must not be negative"))
+		}
+	}
+
+	// Duplicate names were reported and dropped while merging the files
 	hasDefault := false
-	serviceNames := make(map[string]bool)
 
 	for i, svc := range c.Services {
-		// Check for duplicate names
-		if serviceNames[svc.Name] {
-			return fmt.Errorf("duplicate service name: %s", svc.Name)
-		}
-		serviceNames[svc.Name] = true
-
 		// Validate name
 		if svc.Name == "" {
-			return fmt.Errorf("service at index %d has no name", i)
+			errs = append(errs, fieldErrorf(fmt.Sprintf("services[%d]", i), "service at index %d has no name", i))
+			continue
 		}
 
-		// Parse and validate target URL
-		if svc.Target == "" {
-			return fmt.Errorf("service %s has no target", svc.Name)
+		errs = append(errs, m.validateService(svc)...)
+
+		// Track default service; a disabled one can't be the fallback
+		if svc.Default && !svc.Disabled {
+			if hasDefault {
+				errs = append(errs, fieldErrorf(servicePath(svc.Name, "default"), "multiple default services defined"))
+			}
+			hasDefault = true
 		}
+	}
 
-		targetURL, err := url.Parse(svc.Target)
-		if err != nil {
-			return fmt.Errorf("invalid target URL for service %s: %w", svc.Name, err)
+	if err := registry.ValidateDependencies(c.Services); err != nil {
+		errs = append(errs, atField("services", err))
+	}
+	errs = append(errs, checkDisabled(c, hasDefault)...)
+	errs = append(errs, checkEndpoints(c)...)
+
+	errs = append(errs, validateSemantics(c)...)
+
+	// If no explicit default, use the first enabled service
+	if active := c.ActiveServices(); !hasDefault && len(active) > 0 {
+		active[0].Default = true
+	}
+
+	return errs
+}
+
+// checkDisabled reports enabled services that depend on disabled ones, and
+// warns about a disabled default service, naming the fallback instead
+func checkDisabled(c *types.Config, hasDefault bool) []error {
+	disabled := make(map[string]bool)
+	for _, svc := range c.Services {
+		if svc.Disabled {
+			disabled[svc.Name] = true
 		}
-		c.Services[i].TargetURL = targetURL
+	}
+	if len(disabled) == 0 {
+		return nil
+	}
 
-		// Track default service
-		if svc.Default {
-			if hasDefault {
-				return fmt.Errorf("multiple default services defined")
+	var errs []error
+	for _, svc := range c.ActiveServices() {
+		for i, dep := range svc.DependsOn {
+			if disabled[dep] {
+				errs = append(errs, fieldErrorf(servicePath(svc.Name, fmt.Sprintf("dependsOn[%d]", i)), "service %s depends on %s, which is disabled", svc.Name, dep))
 			}
-			hasDefault = true
 		}
 	}
 
-	// If no explicit default, use first service
-	if !hasDefault && len(c.Services) > 0 {
-		c.Services[0].Default = true
+	for _, svc := range c.Services {
+		if !svc.Disabled || !svc.Default || hasDefault {
+			continue
+		}
+		at := servicePath(svc.Name, "default")
+		if active := c.ActiveServices(); len(active) > 0 {
+			errs = append(errs, warningf(at, "service %s is the default but disabled; unmatched requests go to %s instead", svc.Name, active[0].Name))
+		} else {
+			errs = append(errs, warningf(at, "service %s is the default but disabled; no service receives unmatched requests", svc.Name))
+		}
+	}
+	return errs
+}
+
+// checkEndpoints validates tunnel.endpoints against the tunnel settings and
+// the services they are bound to
+func checkEndpoints(c *types.Config) []error {
+	t := &c.Tunnel
+	if len(t.Endpoints) == 0 {
+		return nil
+	}
+
+	var errs []error
+	if t.Domain != "" {
+		errs = append(errs, fieldErrorf("tunnel.domain", "tunnel.domain can't be used with tunnel.endpoints; give each endpoint its domain"))
+	}
+	services := make(map[string]*types.Service)
+	for _, svc := range c.Services {
+		services[svc.Name] = svc
+	}
+	domains := make(map[string]bool)
+	for i, ep := range t.Endpoints {
+		at := fmt.Sprintf("tunnel.endpoints[%d]", i)
+		if ep.Domain != "" {
+			if t.Provider == tunnel.ProviderLocaltunnel {
+				errs = append(errs, fieldErrorf(at+".domain", "%s.domain isn't supported by localtunnel, which assigns a random subdomain", at))
+			}
+			if domains[strings.ToLower(ep.Domain)] {
+				errs = append(errs, fieldErrorf(at+".domain", "%s: domain %s is used by another endpoint", at, ep.Domain))
+			}
+			domains[strings.ToLower(ep.Domain)] = true
+		}
+		if ep.Service == "" {
+			continue
+		}
+		switch svc := services[ep.Service]; {
+		case svc == nil:
+			errs = append(errs, fieldErrorf(at+".service", "%s: no service named %s", at, ep.Service))
+		case svc.Disabled:
+			errs = append(errs, warningf(at+".service", "%s: service %s is disabled; requests to this endpoint fail until it is enabled", at, ep.Service))
+		}
+	}
+	return errs
+}
+
+// validateWatchdog checks the tunnel watchdog's timing, and warns when
+// tunnel.ipPolicy could refuse its checks
+func validateWatchdog(t *types.TunnelConfig) []error {
+	w := t.Watchdog
+	if w == nil {
+		return nil
+	}
+	var errs []error
+	if w.Interval < 0 {
+		errs = append(errs, fieldErrorf("tunnel.watchdog.interval", "tunnel.watchdog.interval must not be negative"))
+	}
+	if w.Timeout < 0 {
+		errs = append(errs, fieldErrorf("tunnel.watchdog.timeout", "tunnel.watchdog.timeout must not be negative"))
+	}
+	if w.FailureThreshold < 0 {
+		errs = append(errs, fieldErrorf("tunnel.watchdog.failureThreshold", "tunnel.watchdog.failureThreshold must not be negative"))
+	}
+	if w.Enabled && t.IPPolicy != nil && len(t.IPPolicy.Allow) > 0 {
+		errs = append(errs, warningf("tunnel.watchdog", "tunnel.watchdog checks come from this machine's public address, which tunnel.ipPolicy must allow"))
+	}
+	return errs
+}
+
+// validateSchemes checks tunnel.schemes lists http and/or https once each,
+// and that forceHttpsRedirect has both to redirect between
+func validateSchemes(t *types.TunnelConfig) []error {
+	var errs []error
+	if t.Schemes != nil && len(t.Schemes) == 0 {
+		errs = append(errs, fieldErrorf("tunnel.schemes", "tunnel.schemes is empty; list http and/or https, or remove it for https only"))
+	}
+	seen := make(map[string]bool)
+	for i, scheme := range t.Schemes {
+		path := fmt.Sprintf("tunnel.schemes[%d]", i)
+		switch {
+		case scheme != "http" && scheme != "https":
+			errs = append(errs, fieldErrorf(path, "tunnel.schemes: unknown scheme %q; use http or https", scheme))
+		case seen[scheme]:
+			errs = append(errs, fieldErrorf(path, "tunnel.schemes: %s is listed twice", scheme))
+		}
+		seen[scheme] = true
+	}
+	if t.ForceHTTPSRedirect && !(seen["http"] && seen["https"]) {
+		errs = append(errs, warningf("tunnel.forceHttpsRedirect", "tunnel.forceHttpsRedirect only applies when tunnel.schemes has both http and https"))
+	}
+	return errs
+}
+
+// validateProvider checks the tunnel settings against what its provider
+// supports
+func validateProvider(t *types.TunnelConfig) []error {
+	var errs []error
+	switch t.Provider {
+	case tunnel.ProviderNgrok:
+		if t.Server != "" {
+			errs = append(errs, warningf("tunnel.server", "tunnel.server only applies to the localtunnel provider"))
+		}
+		if t.SSH != nil {
+			errs = append(errs, warningf("tunnel.ssh", "tunnel.ssh only applies to the ssh provider"))
+		}
+		errs = append(errs, validateBasicAuth(t.BasicAuth)...)
+		errs = append(errs, validateSchemes(t)...)
+		if t.CircuitBreaker < 0 || t.CircuitBreaker > 1 {
+			errs = append(errs, fieldErrorf("tunnel.circuitBreaker", "tunnel.circuitBreaker must be an error ratio between 0 and 1, got %g", t.CircuitBreaker))
+		}
+	case tunnel.ProviderLocaltunnel:
+		if t.Domain != "" {
+			errs = append(errs, fieldErrorf("tunnel.domain", "tunnel.domain isn't supported by localtunnel, which assigns a random subdomain; use provider ngrok for a fixed domain"))
+		}
+		if t.AuthTokenFile != "" || t.Keyring {
+			errs = append(errs, warningf("tunnel.provider", "localtunnel needs no auth token; tunnel.authtokenFile and tunnel.keyring are ignored"))
+		}
+		if len(t.BasicAuth) > 0 {
+			errs = append(errs, fieldErrorf("tunnel.basicAuth", "tunnel.basicAuth isn't supported by localtunnel; use provider ngrok to require a login"))
+		}
+		if t.Compression {
+			errs = append(errs, warningf("tunnel.compression", "localtunnel can't compress responses; tunnel.compression is ignored"))
+		}
+		if t.CircuitBreaker != 0 {
+			errs = append(errs, warningf("tunnel.circuitBreaker", "localtunnel has no circuit breaker; tunnel.circuitBreaker is ignored"))
+		}
+		if t.APIKey != "" {
+			errs = append(errs, warningf("tunnel.apiKey", "tunnel.apiKey is the ngrok API key; localtunnel ignores it"))
+		}
+		if t.Schemes != nil || t.ForceHTTPSRedirect {
+			errs = append(errs, warningf("tunnel.schemes", "localtunnel serves the schemes its server offers; tunnel.schemes and tunnel.forceHttpsRedirect are ignored"))
+		}
+		if t.Server != "" {
+			if u, err := url.Parse(t.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fieldErrorf("tunnel.server", "tunnel.server must be an http(s) URL, got %q", t.Server))
+			}
+		}
+		if t.SSH != nil {
+			errs = append(errs, warningf("tunnel.ssh", "tunnel.ssh only applies to the ssh provider"))
+		}
+	case tunnel.ProviderSSH:
+		errs = append(errs, validateSSH(t)...)
+	default:
+		errs = append(errs, fieldErrorf("tunnel.provider", "tunnel.provider must be %s, got %q", strings.Join(tunnel.Providers, " or "), t.Provider))
+	}
+
+	errs = append(errs, validateWatchdog(t)...)
+
+	// Providers without edge IP policies enforce them in hz instead
+	if p := t.IPPolicy; p != nil {
+		if _, err := clientip.ParsePrefixes(p.Allow); err != nil {
+			errs = append(errs, fieldErrorf("tunnel.ipPolicy.allow", "tunnel.ipPolicy.allow: %w", err))
+		}
+		if _, err := clientip.ParsePrefixes(p.Deny); err != nil {
+			errs = append(errs, fieldErrorf("tunnel.ipPolicy.deny", "tunnel.ipPolicy.deny: %w", err))
+		}
+	}
+	return errs
+}
+
+// validateSSH checks the ssh provider's settings. An SSH server forwards a
+// single port, so the ngrok features and endpoints don't apply.
+func validateSSH(t *types.TunnelConfig) []error {
+	var errs []error
+	s := t.SSH
+	switch {
+	case s == nil || s.Host == "":
+		errs = append(errs, fieldErrorf("tunnel.ssh.host", "tunnel.ssh.host is required with provider ssh"))
+	case strings.Contains(s.Host, "://"):
+		errs = append(errs, fieldErrorf("tunnel.ssh.host", "tunnel.ssh.host must be host or host:port, got %q", s.Host))
+	}
+	if s != nil {
+		if s.RemotePort < 0 || s.RemotePort > 65535 {
+			errs = append(errs, fieldErrorf("tunnel.ssh.remotePort", "tunnel.ssh.remotePort must be between 0 and 65535, got %d", s.RemotePort))
+		}
+		if s.InsecureIgnoreHostKey {
+			errs = append(errs, warningf("tunnel.ssh.insecureIgnoreHostKey", "tunnel.ssh.insecureIgnoreHostKey accepts any server key; anyone on the network path can impersonate %s", s.Host))
+		}
+	}
+	if t.Domain != "" {
+		errs = append(errs, fieldErrorf("tunnel.domain", "tunnel.domain isn't supported by ssh; the public URL is the SSH host and tunnel.ssh.remotePort"))
+	}
+	if len(t.Endpoints) > 0 {
+		errs = append(errs, fieldErrorf("tunnel.endpoints", "tunnel.endpoints isn't supported by ssh, which forwards one port"))
+	}
+	if len(t.BasicAuth) > 0 {
+		errs = append(errs, fieldErrorf("tunnel.basicAuth", "tunnel.basicAuth isn't supported by ssh; use provider ngrok to require a login"))
+	}
+	if t.AuthTokenFile != "" || t.Keyring || t.APIKey != "" {
+		errs = append(errs, warningf("tunnel.provider", "ssh logs in with tunnel.ssh.keyFile or ssh-agent; the ngrok tokens and keys are ignored"))
+	}
+	if t.Server != "" {
+		errs = append(errs, warningf("tunnel.server", "tunnel.server only applies to the localtunnel provider"))
+	}
+	if t.Compression || t.CircuitBreaker != 0 {
+		errs = append(errs, warningf("tunnel.compression", "ssh has no edge; tunnel.compression and tunnel.circuitBreaker are ignored"))
+	}
+	if t.Schemes != nil || t.ForceHTTPSRedirect {
+		errs = append(errs, warningf("tunnel.schemes", "ssh forwards plain http; tunnel.schemes and tunnel.forceHttpsRedirect are ignored"))
+	}
+	return errs
+}
+
+// validateBasicAuth checks the tunnel's "user:password" logins against
+// ngrok's rules, without repeating them in the messages
+func validateBasicAuth(logins []string) []error {
+	var errs []error
+	for i, login := range logins {
+		at := fmt.Sprintf("tunnel.basicAuth[%d]", i)
+		user, password, ok := strings.Cut(login, ":")
+		switch {
+		case !ok:
+			errs = append(errs, fieldErrorf(at, "%s must be \"user:password\"", at))
+		case user == "":
+			errs = append(errs, fieldErrorf(at, "%s has an empty user name", at))
+		case password == "":
+			errs = append(errs, fieldErrorf(at, "%s has an empty password", at))
+		case len(password) < 8 || len(password) > 128:
+			errs = append(errs, fieldErrorf(at, "%s: ngrok requires passwords of 8 to 128 characters", at))
+		}
 	}
+	return errs
+}
 
+// PrepareService readies a service added while hz runs, like one read from
+// the config file: missing settings get their defaults, then it is validated
+// and its target URL resolved. It returns every problem found.
+func (m *Manager) PrepareService(svc *types.Service) error {
+	if svc.Name == "" {
+		return fmt.Errorf("service has no name")
+	}
+	applyServiceDefaults(svc)
+	return errors.Join(m.validateService(svc)...)
+}
+
+// validateService validates one service and resolves its target URL and
+// the paths in it that are relative to the config file
+func (m *Manager) validateService(svc *types.Service) []error {
+	var errs []error
+	at := func(fields ...string) string { return servicePath(svc.Name, fields...) }
+
+	// Parse and validate target URL
+	if svc.Target == "" {
+		errs = append(errs, fieldErrorf(at(), "service %s has no target", svc.Name))
+	} else if targetURL, err := url.Parse(svc.Target); err != nil {
+		errs = append(errs, fieldErrorf(at("target"), "invalid target URL for service %s: %w", svc.Name, err))
+	} else if targetURL.Scheme == "replay" {
+		// Replay targets point at a session file relative to the config file
+		file := targetURL.Host + targetURL.Path
+		if file == "" {
+			errs = append(errs, fieldErrorf(at("target"), "replay target for service %s has no session file", svc.Name))
+		} else {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(m.path), file)
+			}
+			svc.TargetURL = &url.URL{Scheme: "replay", Path: file}
+		}
+	} else {
+		svc.TargetURL = targetURL
+	}
+
+	if err := compileRewrite(svc.Rewrite); err != nil {
+		errs = append(errs, fieldErrorf(at("rewrite"), "service %s: %w", svc.Name, err))
+	}
+
+	if h := svc.Health; h != nil {
+		if err := registry.ValidateHealth(h); err != nil {
+			errs = append(errs, fieldErrorf(at("health"), "service %s: health: %w", svc.Name, err))
+		}
+		// Exec checks run relative to the config file
+		if h.Type == types.HealthCheckExec && !filepath.IsAbs(h.Dir) {
+			h.Dir = filepath.Join(filepath.Dir(m.path), h.Dir)
+		}
+		if h.TLS != nil && h.TLS.CAFile != "" && !filepath.IsAbs(h.TLS.CAFile) {
+			h.TLS.CAFile = filepath.Join(filepath.Dir(m.path), h.TLS.CAFile)
+		}
+		if h.RequireDependencies && len(svc.DependsOn) == 0 {
+			errs = append(errs, fieldErrorf(at("health", "requireDependencies"), "service %s: health: requireDependencies needs dependsOn", svc.Name))
+		}
+	}
+
+	// Managed processes run relative to the config file
+	if svc.Command == "" && (svc.Cwd != "" || len(svc.Env) > 0) {
+		errs = append(errs, fieldErrorf(at(), "service %s: cwd and env require a command", svc.Name))
+	}
+	if svc.Command != "" && !filepath.IsAbs(svc.Cwd) {
+		svc.Cwd = filepath.Join(filepath.Dir(m.path), svc.Cwd)
+	}
+
+	if mt := svc.Maintenance; mt != nil && mt.RetryAfter < 0 {
+		errs = append(errs, fieldErrorf(at("maintenance", "retryAfter"), "service %s: maintenance retryAfter must not be negative", svc.Name))
+	}
+
+	for i, route := range svc.Routes {
+		routeAt := fmt.Sprintf("routes[%d]", i)
+		if mt := route.Maintenance; mt != nil && mt.RetryAfter < 0 {
+			errs = append(errs, fieldErrorf(at(routeAt, "maintenance", "retryAfter"), "service %s: route maintenance retryAfter must not be negative", svc.Name))
+		}
+		if _, err := clientip.ParsePrefixes(route.ClientCIDR); err != nil {
+			errs = append(errs, fieldErrorf(at(routeAt, "clientCidr"), "service %s: clientCidr: %w", svc.Name, err))
+		}
+		if err := compileRewrite(route.Rewrite); err != nil {
+			errs = append(errs, fieldErrorf(at(routeAt, "rewrite"), "service %s: route rewrite: %w", svc.Name, err))
+		}
+	}
+
+	if svc.MaxConcurrent < 0 {
+		errs = append(errs, fieldErrorf(at("maxConcurrent"), "service %s: maxConcurrent must not be negative", svc.Name))
+	}
+	if svc.Queue != nil && svc.MaxConcurrent == 0 {
+		errs = append(errs, fieldErrorf(at("queue"), "service %s: queue requires maxConcurrent to be set", svc.Name))
+	}
+
+	return errs
+}
+
+// compileRewrite validates rewrite rules and compiles their regex
+func compileRewrite(rw *types.RewriteConfig) error {
+	if rw == nil {
+		return nil
+	}
+	if rw.StripSegments < 0 {
+		return fmt.Errorf("rewrite stripSegments must not be negative")
+	}
+	if rw.Regex != "" {
+		re, err := regexp.Compile(rw.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid rewrite regex: %w", err)
+		}
+		if rw.Replacement == "" {
+			return fmt.Errorf("rewrite regex requires a replacement")
+		}
+		rw.RegexCompiled = re
+	}
 	return nil
 }
 
@@ -196,20 +713,143 @@ func (m *Manager) GetDefaultService() *types.Service {
 	defer m.mu.RUnlock()
 
 	for _, svc := range m.config.Services {
-		if svc.Default {
+		if svc.Default && !svc.Disabled {
 			return svc
 		}
 	}
 	return nil
 }
 
-// OnReload registers a callback for configuration changes
-func (m *Manager) OnReload(fn func(*types.Config)) {
-	m.listeners = append(m.listeners, fn)
+// Warnings returns the suspicious but legal settings found by the last Load
+func (m *Manager) Warnings() Problems {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.warnings
+}
+
+// Main returns the main config file on its own, without the services and
+// overrides of included files. The CLI edits and saves this view so that
+// included files are never merged into the main file.
+func (m *Manager) Main() *types.Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.main
+}
+
+// IncludedFrom returns the included file a service is defined in, relative
+// to the main config file, or "" for services of the main file
+func (m *Manager) IncludedFrom(name string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	src, ok := m.sources[name]
+	if !ok || src == m.path {
+		return ""
+	}
+	return displayPath(m.path, src)
+}
+
+// listener is a callback registered with OnReload
+type listener struct {
+	id int
+	fn func(*types.Config)
+}
+
+// OnReload registers a callback for configuration changes and returns a
+// function that unregisters it. Callbacks run in registration order on the
+// watcher goroutine; one that panics is logged and skipped.
+func (m *Manager) OnReload(fn func(*types.Config)) (unsubscribe func()) {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+
+	m.nextListener++
+	id := m.nextListener
+	m.listeners = append(m.listeners, listener{id: id, fn: fn})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { m.removeListener(id) })
+	}
+}
+
+// removeListener unregisters the callback with id. The slice is copied so
+// a notification already iterating the old one is unaffected.
+func (m *Manager) removeListener(id int) {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+
+	kept := make([]listener, 0, len(m.listeners))
+	for _, l := range m.listeners {
+		if l.id != id {
+			kept = append(kept, l)
+		}
+	}
+	m.listeners = kept
+}
+
+// notify calls every registered callback with config
+func (m *Manager) notify(config *types.Config) {
+	m.listenersMu.Lock()
+	listeners := m.listeners
+	m.listenersMu.Unlock()
+
+	for _, l := range listeners {
+		m.callListener(l.fn, config)
+	}
+}
+
+// callListener runs one callback, recovering from a panic so the watcher
+// and the remaining callbacks keep working
+func (m *Manager) callListener(fn func(*types.Config), config *types.Config) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[hz] config reload listener panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	fn(config)
+}
+
+// Source returns the config file path, or SourceFlags for a configuration
+// built from flags
+func (m *Manager) Source() string {
+	if m.flags != nil {
+		return SourceFlags
+	}
+	return m.path
+}
+
+// Files returns the files the configuration was loaded from: the config
+// file, then its included files in merge order. It is empty for flags.
+func (m *Manager) Files() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files
+}
+
+// Contents returns the text of one of the Files, as last fetched for a
+// remote config
+func (m *Manager) Contents(file string) ([]byte, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	if m.remote != nil && file == m.path {
+		return m.data, nil
+	}
+	return os.ReadFile(file)
 }
 
 // Watch starts watching the config file for changes
 func (m *Manager) Watch() error {
+	if m.flags != nil {
+		return nil // no file to watch
+	}
+	if m.remote != nil {
+		interval := m.pollInterval
+		if interval <= 0 {
+			interval = DefaultPollInterval
+		}
+		go m.pollLoop(interval)
+		return nil
+	}
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
@@ -221,13 +861,50 @@ func (m *Manager) Watch() error {
 	if err := watcher.Add(dir); err != nil {
 		return fmt.Errorf("failed to watch directory: %w", err)
 	}
+	m.watchIncludes()
 
 	go m.watchLoop()
 	return nil
 }
 
-// watchLoop handles file system events
+// watchIncludes adds the directories of the include patterns to the
+// watcher; it runs again after every reload in case the list changed
+func (m *Manager) watchIncludes() {
+	m.mu.RLock()
+	dirs := includeDirs(m.includes)
+	m.mu.RUnlock()
+
+	for _, dir := range dirs {
+		if err := m.watcher.Add(dir); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[hz] cannot watch %s: %v\n", dir, err)
+		}
+	}
+}
+
+// isConfigFile reports whether path is the main config file or an included one
+func (m *Manager) isConfigFile(path string) bool {
+	if filepath.Base(path) == filepath.Base(m.path) && filepath.Dir(path) == filepath.Dir(m.path) {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return matchesInclude(m.includes, path)
+}
+
+// Reload timing: events closer together than reloadDebounce trigger one
+// reload, and a file replaced by an atomic save may be missing for up to
+// missingWait before it is back
+const (
+	reloadDebounce = 100 * time.Millisecond
+	missingWait    = time.Second
+)
+
+// watchLoop handles file system events. The watcher is on the directories,
+// not the files, so a config file replaced by an editor's write-to-temp and
+// rename save (Create/Rename events, new inode) stays watched.
 func (m *Manager) watchLoop() {
+	var reload <-chan time.Time
+	var missingSince time.Time
 	for {
 		select {
 		case <-m.stopCh:
@@ -237,26 +914,35 @@ func (m *Manager) watchLoop() {
 				return
 			}
 
-			// Only react to writes on our config file
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				if filepath.Base(event.Name) == filepath.Base(m.path) {
-					// Small delay to ensure file write is complete
-					time.Sleep(100 * time.Millisecond)
-
-					if err := m.Load(); err != nil {
-						fmt.Printf("[hz] config reload failed: %v\n", err)
-						continue
-					}
-
-					fmt.Println("[hz] configuration reloaded")
+			// Only react to changes of our config file and its includes
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			if !m.isConfigFile(event.Name) {
+				continue
+			}
+			// A single save often produces several events; reload once
+			// they have settled
+			reload = time.After(reloadDebounce)
+		case <-reload:
+			reload = nil
 
-					// Notify listeners
-					config := m.Get()
-					for _, fn := range m.listeners {
-						fn(config)
-					}
+			// An atomic save may not have put the file back yet; retry
+			// for a while, folding in the events of its return
+			if _, err := os.Stat(m.path); os.IsNotExist(err) {
+				if missingSince.IsZero() {
+					missingSince = time.Now()
+				}
+				if time.Since(missingSince) < missingWait {
+					reload = time.After(reloadDebounce)
+				} else {
+					fmt.Printf("[hz] config file %s is missing, keeping the current configuration\n", m.path)
+					missingSince = time.Time{}
 				}
+				continue
 			}
+			missingSince = time.Time{}
+			m.reload()
 		case err, ok := <-m.watcher.Errors:
 			if !ok {
 				return
@@ -266,6 +952,42 @@ func (m *Manager) watchLoop() {
 	}
 }
 
+// reload loads the changed configuration and notifies the listeners
+func (m *Manager) reload() {
+	if err := m.Reload(); err != nil {
+		fmt.Printf("[hz] config reload failed: %v\n", err)
+	}
+}
+
+// Reload loads the configuration again and notifies the OnReload listeners,
+// as a change of the watched files does; 'hz start' calls it on SIGHUP. A
+// remote config is fetched first. When the files have errors it returns
+// them and the current configuration stays.
+func (m *Manager) Reload() error {
+	if m.flags != nil {
+		return fmt.Errorf("the configuration comes from flags; there is no file to reload")
+	}
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	if m.remote != nil {
+		if _, err := m.refreshRemote(); err != nil {
+			return err
+		}
+	}
+	if err := m.Load(); err != nil {
+		return err
+	}
+	if m.watcher != nil {
+		m.watchIncludes()
+	}
+
+	fmt.Println("[hz] configuration reloaded")
+
+	m.notify(m.Get())
+	return nil
+}
+
 // Stop stops the configuration watcher
 func (m *Manager) Stop() {
 	close(m.stopCh)
@@ -274,13 +996,15 @@ func (m *Manager) Stop() {
 	}
 }
 
-// FindConfigFile searches for hz.yaml in common locations
+// FindConfigFile searches for hz.yaml, hz.json or hz.toml in common locations
 func FindConfigFile() (string, error) {
 	searchPaths := []string{
 		"hz.yaml",
 		"hz.yml",
 		".hz.yaml",
 		".hz.yml",
+		"hz.json",
+		"hz.toml",
 		filepath.Join(os.Getenv("HOME"), ".hz", "config.yaml"),
 	}
 
@@ -294,7 +1018,8 @@ func FindConfigFile() (string, error) {
 	return "", fmt.Errorf("no config file found, searched: %s", strings.Join(searchPaths, ", "))
 }
 
-// CreateDefaultConfig creates a default configuration file
+// CreateDefaultConfig creates a default configuration file in the format of
+// its extension
 func CreateDefaultConfig(path string) error {
 	defaultConfig := `# hz - Development Proxy Configuration
 version: "1"
@@ -316,9 +1041,24 @@ services:
       path: /health
       interval: 30s
 
+routing:
+  strictPaths: true
+
 logging:
   level: info
   format: text
 `
-	return os.WriteFile(path, []byte(defaultConfig), 0644)
+	return WriteConfig(path, []byte(defaultConfig))
+}
+
+// WriteConfig writes hz.yaml text to path, converting it to the format of
+// the extension
+func WriteConfig(path string, data []byte) error {
+	if format := FormatOf(path); format != FormatYAML {
+		var err error
+		if data, err = convertYAML(format, data); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
 }
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// serviceConfig returns a config whose one service targets port
+func serviceConfig(port string) []byte {
+	return []byte("services:\n  - name: web\n    target: http://localhost:" + port + "\n    default: true\n")
+}
+
+// newTestManager writes serviceConfig(port) to hz.yaml in a temp dir and
+// loads it; the manager is stopped when the test ends
+func newTestManager(t *testing.T, port string) (*Manager, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hz.yaml")
+	if err := os.WriteFile(path, serviceConfig(port), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Stop)
+	return m, path
+}
+
+// waitReloads waits until reloads reaches want, then a while longer to
+// catch any extra reload, and fails unless exactly want happened
+func waitReloads(t *testing.T, reloads *atomic.Int64, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for reloads.Load() < want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(3 * reloadDebounce)
+	if got := reloads.Load(); got != want {
+		t.Fatalf("%d reloads, want %d", got, want)
+	}
+}
+
+// TestWatchSaves saves the config the ways editors do: each save reloads it
+// exactly once
+func TestWatchSaves(t *testing.T) {
+	m, path := newTestManager(t, "5000")
+	var reloads atomic.Int64
+	m.OnReload(func(*types.Config) { reloads.Add(1) })
+	if err := m.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(path)
+
+	saves := []struct {
+		name string
+		save func(data []byte) error
+	}{
+		{"in place", func(data []byte) error {
+			return os.WriteFile(path, data, 0o644)
+		}},
+		{"write to a temp file and rename", func(data []byte) error {
+			tmp := filepath.Join(dir, ".hz.yaml.swp")
+			if err := os.WriteFile(tmp, data, 0o644); err != nil {
+				return err
+			}
+			return os.Rename(tmp, path)
+		}},
+		{"remove and write back later", func(data []byte) error {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			// Between two of the watcher's checks for the missing file:
+			// one that found it back before its events came would reload
+			// it twice
+			time.Sleep(5 * reloadDebounce / 2)
+			return os.WriteFile(path, data, 0o644)
+		}},
+		{"rename away and write a new file", func(data []byte) error {
+			if err := os.Rename(path, path+"~"); err != nil {
+				return err
+			}
+			return os.WriteFile(path, data, 0o644)
+		}},
+	}
+	for i, save := range saves {
+		port := strconv.Itoa(5001 + i)
+		if err := save.save(serviceConfig(port)); err != nil {
+			t.Fatal(err)
+		}
+		waitReloads(t, &reloads, int64(i+1))
+		want := "http://localhost:" + port
+		if got := m.GetService("web").Target; got != want {
+			t.Errorf("%s: target %s, want %s", save.name, got, want)
+		}
+	}
+
+	// Other files in the directory don't count
+	if err := os.WriteFile(filepath.Join(dir, "notes.yaml"), []byte("x: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitReloads(t, &reloads, int64(len(saves)))
+}
+
+// TestOnReloadConcurrent registers and unregisters listeners while reloads
+// run: afterwards each remaining listener hears a reload exactly once
+func TestOnReloadConcurrent(t *testing.T) {
+	m, _ := newTestManager(t, "5000")
+
+	const n = 50
+	var calls [n]atomic.Int64
+	var kept [n]bool
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		kept[i] = i%3 != 0
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			unsubscribe := m.OnReload(func(*types.Config) { calls[i].Add(1) })
+			if !kept[i] {
+				unsubscribe()
+				unsubscribe() // more than once is fine
+			}
+		}(i)
+	}
+	for i := 0; i < 5; i++ {
+		if err := m.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	for i := range calls {
+		calls[i].Store(0)
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range calls {
+		want := int64(0)
+		if kept[i] {
+			want = 1
+		}
+		if got := calls[i].Load(); got != want {
+			t.Errorf("listener %d called %d times, want %d", i, got, want)
+		}
+	}
+}
+
+// TestOnReloadPanic checks that a panicking listener doesn't keep the ones
+// after it, or later reloads, from running
+func TestOnReloadPanic(t *testing.T) {
+	m, path := newTestManager(t, "5000")
+
+	// The recovered panic is reported on stdout with its stack
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	var order []string
+	m.OnReload(func(c *types.Config) { order = append(order, "first "+c.Services[0].Target) })
+	m.OnReload(func(*types.Config) { panic("listener bug") })
+	m.OnReload(func(c *types.Config) { order = append(order, "last "+c.Services[0].Target) })
+
+	for _, port := range []string{"5001", "5002"} {
+		if err := os.WriteFile(path, serviceConfig(port), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Reload(); err != nil {
+			t.Fatalf("Reload = %v", err)
+		}
+	}
+
+	want := []string{
+		"first http://localhost:5001", "last http://localhost:5001",
+		"first http://localhost:5002", "last http://localhost:5002",
+	}
+	if !slices.Equal(order, want) {
+		t.Errorf("listeners ran as %q, want %q", order, want)
+	}
+}
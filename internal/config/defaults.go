@@ -0,0 +1,135 @@
+package config
+
+import (
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// inheritDefaults merges the top-level defaults block into every service,
+// before the built-in defaults apply. The merge works on the YAML as written,
+// so a service overrides exactly the keys it sets, even with false or 0:
+// mappings like health and headers are merged key by key, and anything else
+// (scalars, lists) replaces the default. A service can drop an inherited
+// block by setting it to null. Bad values were already reported when the
+// files were decoded, so a service that fails to decode keeps its own values.
+func inheritDefaults(docs []*document, sources map[string]string, config *types.Config) {
+	var defaults *yaml.Node
+	for _, doc := range docs {
+		if d := topLevel(doc, "defaults"); d != nil {
+			defaults = mergeNodes(defaults, d)
+		}
+	}
+	if defaults == nil {
+		return
+	}
+
+	for i, svc := range config.Services {
+		doc := docs[0]
+		for _, d := range docs {
+			if d.path == sources[svc.Name] {
+				doc = d
+			}
+		}
+		_, list := mappingEntry(doc.root(), "services")
+		node := sequenceItem(list, svc.Name)
+		if node == nil {
+			continue
+		}
+
+		merged := &types.Service{}
+		if err := mergeNodes(defaults, node).Decode(merged); err != nil {
+			continue
+		}
+		config.Services[i] = merged
+	}
+}
+
+// topLevel returns the value of a top-level key in a document
+func topLevel(doc *document, key string) *yaml.Node {
+	root := doc.root()
+	if root == nil {
+		return nil
+	}
+	_, value := mappingEntry(root, key)
+	return value
+}
+
+// root returns the top-level mapping of the document, if any
+func (d *document) root() *yaml.Node {
+	if d.node == nil || d.node.Kind != yaml.DocumentNode || len(d.node.Content) == 0 {
+		return nil
+	}
+	return d.node.Content[0]
+}
+
+// mergeNodes returns base with override laid over it: mappings are merged
+// key by key, recursively, and any other override value replaces base. Nodes
+// are shared, not copied, so positions still point into their files.
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	if base == nil {
+		return override
+	}
+	if base.Kind == yaml.AliasNode {
+		base = base.Alias
+	}
+	if override.Kind == yaml.AliasNode {
+		override = override.Alias
+	}
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+	base, override = flattenMerges(base), flattenMerges(override)
+
+	merged := *override
+	merged.Content = append([]*yaml.Node(nil), override.Content...)
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		key, value := base.Content[i], base.Content[i+1]
+		j := mappingIndex(&merged, key.Value)
+		if j < 0 {
+			merged.Content = append(merged.Content, key, value)
+			continue
+		}
+		merged.Content[j+1] = mergeNodes(value, merged.Content[j+1])
+	}
+	return &merged
+}
+
+// flattenMerges resolves <<: *anchor merge keys in a mapping, so that keys
+// merged from an anchor count as set by the mapping itself
+func flattenMerges(node *yaml.Node) *yaml.Node {
+	var merges []*yaml.Node
+	explicit := *node
+	explicit.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag != "!!merge" {
+			explicit.Content = append(explicit.Content, key, value)
+			continue
+		}
+		if value.Kind == yaml.SequenceNode {
+			merges = append(merges, value.Content...)
+		} else {
+			merges = append(merges, value)
+		}
+	}
+	if len(merges) == 0 {
+		return node
+	}
+
+	// Earlier sources win over later ones, explicit keys over all of them
+	var merged *yaml.Node
+	for i := len(merges) - 1; i >= 0; i-- {
+		merged = mergeNodes(merged, merges[i])
+	}
+	return mergeNodes(merged, &explicit)
+}
+
+// mappingIndex returns the index of key in a mapping node's content, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestDefaultsHealth merges a nested defaults.health block into services
+// that set none, some or all of it
+func TestDefaultsHealth(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hz.yaml")
+	data := `x-ready: &ready
+  path: /ready
+  timeout: 1s
+
+defaults:
+  health:
+    path: /healthz
+    interval: 5s
+    timeout: 2s
+    unhealthyThreshold: 5
+    followRedirects: false
+    expectStatus: [2xx, "301"]
+    headers:
+      X-Probe: hz
+    tls:
+      insecureSkipVerify: true
+
+services:
+  - name: plain
+    target: http://localhost:5001
+  - name: override
+    target: http://localhost:5002
+    health:
+      interval: 30s
+      expectStatus: ["200"]
+      headers:
+        Authorization: Bearer t
+      tls:
+        caFile: ca.pem
+  - name: zero
+    target: http://localhost:5003
+    health:
+      unhealthyThreshold: 0
+      followRedirects: true
+      headers: {}
+  - name: anchored
+    target: http://localhost:5004
+    health:
+      <<: *ready
+      interval: 1m
+  - name: off
+    target: http://localhost:5005
+    health: null
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yes, no := true, false
+	want := map[string]*types.HealthConfig{
+		"plain": {
+			Path:               "/healthz",
+			Interval:           types.Duration(5 * time.Second),
+			Timeout:            types.Duration(2 * time.Second),
+			UnhealthyThreshold: 5,
+			HealthyThreshold:   1,
+			FollowRedirects:    &no,
+			ExpectStatus:       []string{"2xx", "301"},
+			Headers:            map[string]string{"X-Probe": "hz"},
+			TLS:                &types.HealthTLSConfig{InsecureSkipVerify: true},
+		},
+		"override": {
+			Path:               "/healthz",
+			Interval:           types.Duration(30 * time.Second),
+			Timeout:            types.Duration(2 * time.Second),
+			UnhealthyThreshold: 5,
+			HealthyThreshold:   1,
+			FollowRedirects:    &no,
+			ExpectStatus:       []string{"200"}, // lists replace the default
+			Headers:            map[string]string{"X-Probe": "hz", "Authorization": "Bearer t"},
+			TLS:                &types.HealthTLSConfig{InsecureSkipVerify: true, CAFile: filepath.Join(dir, "ca.pem")},
+		},
+		"zero": {
+			Path:               "/healthz",
+			Interval:           types.Duration(5 * time.Second),
+			Timeout:            types.Duration(2 * time.Second),
+			UnhealthyThreshold: 3, // 0 is the built-in default, not the inherited one
+			HealthyThreshold:   1,
+			FollowRedirects:    &yes,
+			ExpectStatus:       []string{"2xx", "301"},
+			Headers:            map[string]string{"X-Probe": "hz"},
+			TLS:                &types.HealthTLSConfig{InsecureSkipVerify: true},
+		},
+		"anchored": {
+			Path:               "/ready",
+			Interval:           types.Duration(time.Minute),
+			Timeout:            types.Duration(time.Second),
+			UnhealthyThreshold: 5,
+			HealthyThreshold:   1,
+			FollowRedirects:    &no,
+			ExpectStatus:       []string{"2xx", "301"},
+			Headers:            map[string]string{"X-Probe": "hz"},
+			TLS:                &types.HealthTLSConfig{InsecureSkipVerify: true},
+		},
+		"off": nil,
+	}
+	for name, health := range want {
+		got := m.GetService(name).Health
+		if !reflect.DeepEqual(got, health) {
+			t.Errorf("%s: health %+v, want %+v", name, got, health)
+		}
+	}
+}
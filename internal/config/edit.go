@@ -0,0 +1,627 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// File edits a config file in place for the CLI. It works on the file as
+// written, before environment expansion and defaults, and changes only the
+// parts an edit touches: in YAML files, comments, key order, anchors and
+// formatting elsewhere are kept byte for byte. JSON and TOML files are
+// rewritten in their format with the key order of the original.
+type File struct {
+	path   string
+	format string
+	mode   os.FileMode
+
+	doc   yaml.Node // the parsed file
+	lines []string  // YAML source, kept in sync with doc
+}
+
+// OpenFile reads a config file for editing
+func OpenFile(path string) (*File, error) {
+	if IsRemote(path) {
+		return nil, fmt.Errorf("%s is a remote config; edit it at its source", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	f := &File{path: path, format: FormatOf(path), mode: 0644}
+	if info, err := os.Stat(path); err == nil {
+		f.mode = info.Mode().Perm()
+	}
+
+	switch f.format {
+	case FormatTOML:
+		var v interface{}
+		md, err := toml.Decode(string(data), &v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if err := convertValue(v, &f.doc); err != nil {
+			return nil, err
+		}
+		// Decoding into a map sorted the keys; put them back in file order
+		order := make(map[string]int)
+		for i, key := range md.Keys() {
+			if _, ok := order[key.String()]; !ok {
+				order[key.String()] = i
+			}
+		}
+		sortKeys(&f.doc, "", order)
+	case FormatJSON:
+		if yaml.Unmarshal(data, &f.doc) != nil {
+			var v interface{}
+			if err := json.Unmarshal(data, &v); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			if err := convertValue(v, &f.doc); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if err := yaml.Unmarshal(data, &f.doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		f.lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if len(data) == 0 {
+			f.lines = nil
+		}
+	}
+	return f, nil
+}
+
+// AddService appends a service to the services list
+func (f *File) AddService(svc *types.Service) error {
+	root := f.root()
+	_, services := mappingEntry(root, "services")
+	if f.lines != nil && f.appendServiceText(root, services, svc) {
+		return f.reparse()
+	}
+
+	item := &yaml.Node{}
+	if err := item.Encode(svc); err != nil {
+		return err
+	}
+	switch {
+	case services == nil:
+		root.Content = append(root.Content, scalarNode("services"), &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item}})
+	case services.Kind == yaml.SequenceNode:
+		services.Style = 0
+		services.Content = append(services.Content, item)
+	default:
+		*services = yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item}}
+	}
+	return f.reencode()
+}
+
+// RemoveService deletes the service called name, along with the comment
+// directly above it
+func (f *File) RemoveService(name string) error {
+	_, services := mappingEntry(f.root(), "services")
+	i, item := findService(services, name)
+	if item == nil {
+		return fmt.Errorf("service '%s' not found", name)
+	}
+	if alias := usedAnchor(f.root(), item); alias != "" {
+		return fmt.Errorf("service '%s' defines the anchor &%s used elsewhere in %s; edit the file by hand", name, alias, f.path)
+	}
+
+	if f.lines != nil && services.Style&yaml.FlowStyle == 0 {
+		if start, end, ok := f.itemLines(item); ok {
+			// Take one blank line along when the item was set apart by blank
+			// lines, or came first or last
+			blank := func(i int) bool { return i >= 0 && i < len(f.lines) && strings.TrimSpace(f.lines[i]) == "" }
+			switch {
+			case blank(end+1) && (blank(start-1) || i == 0):
+				end++
+			case blank(start-1) && i == len(services.Content)-1:
+				start--
+			}
+			f.lines = append(f.lines[:start], f.lines[end+1:]...)
+			return f.reparse()
+		}
+	}
+
+	services.Content = append(services.Content[:i], services.Content[i+1:]...)
+	return f.reencode()
+}
+
+// HasService reports whether the file defines a service called name
+func (f *File) HasService(name string) bool {
+	_, services := mappingEntry(f.root(), "services")
+	_, item := findService(services, name)
+	return item != nil
+}
+
+// SetServiceField sets a scalar field of the service called name
+func (f *File) SetServiceField(name, key string, value interface{}) error {
+	_, services := mappingEntry(f.root(), "services")
+	_, item := findService(services, name)
+	if item == nil {
+		return fmt.Errorf("service '%s' not found", name)
+	}
+	return f.setScalar(item, key, value)
+}
+
+// RemoveServiceField deletes a field of the service called name, if set
+func (f *File) RemoveServiceField(name, key string) error {
+	_, services := mappingEntry(f.root(), "services")
+	_, item := findService(services, name)
+	if item == nil {
+		return fmt.Errorf("service '%s' not found", name)
+	}
+	if item.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		k := item.Content[i]
+		if k.Value != key {
+			continue
+		}
+		// A key on a line of its own goes with its block; the first key
+		// shares the "- " line, so the tree is re-encoded instead
+		if f.lines != nil && item.Style&yaml.FlowStyle == 0 && k.Line >= 1 && k.Line <= len(f.lines) &&
+			indentOf(f.lines[k.Line-1]) == k.Column-1 {
+			start := k.Line - 1
+			end := f.blockEnd(start, k.Column-1, true)
+			f.lines = append(f.lines[:start], f.lines[end+1:]...)
+			return f.reparse()
+		}
+		item.Content = append(item.Content[:i], item.Content[i+2:]...)
+		return f.reencode()
+	}
+	return nil
+}
+
+// SetTunnel sets a scalar field of the tunnel section, adding the section
+// if the file has none
+func (f *File) SetTunnel(key string, value interface{}) error {
+	root := f.root()
+	_, tunnel := mappingEntry(root, "tunnel")
+	if tunnel == nil || (tunnel.Kind == yaml.ScalarNode && tunnel.Tag == "!!null") {
+		if tunnel == nil && f.lines != nil && root.Style&yaml.FlowStyle == 0 {
+			f.lines = append(f.lines, "tunnel:", fmt.Sprintf("  %s: %s", key, renderScalar(value)))
+			return f.reparse()
+		}
+		mapping := &yaml.Node{Kind: yaml.MappingNode}
+		if tunnel == nil {
+			root.Content = append(root.Content, scalarNode("tunnel"), mapping)
+		} else {
+			*tunnel = *mapping
+		}
+		tunnel = mapping
+	}
+	if tunnel.Kind != yaml.MappingNode {
+		return fmt.Errorf("tunnel in %s is not a mapping", f.path)
+	}
+	return f.setScalar(tunnel, key, value)
+}
+
+// Save writes the file back
+func (f *File) Save() error {
+	data, err := f.bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.path, data, f.mode); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// Validate checks the file as Save would write it, together with its
+// includes, like Validate does for a file on disk
+func (f *File) Validate() Problems {
+	data, err := f.bytes()
+	if err != nil {
+		return Problems{{File: displayPath(f.path, f.path), Message: err.Error()}}
+	}
+	_, problems := validate(&Manager{path: f.path, data: data})
+	return problems
+}
+
+// bytes returns the file's contents in its format
+func (f *File) bytes() ([]byte, error) {
+	if f.format == FormatYAML {
+		return []byte(strings.Join(f.lines, "\n") + "\n"), nil
+	}
+	out, err := yaml.Marshal(&f.doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	data, err := convertYAML(f.format, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// root returns the top-level mapping, creating it for an empty file
+func (f *File) root() *yaml.Node {
+	if f.doc.Kind == 0 {
+		f.doc = yaml.Node{Kind: yaml.DocumentNode}
+	}
+	if len(f.doc.Content) == 0 {
+		f.doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	return f.doc.Content[0]
+}
+
+// setScalar sets key in mapping to value, editing the value's text in place
+// or adding a line after the mapping's last entry
+func (f *File) setScalar(mapping *yaml.Node, key string, value interface{}) error {
+	keyNode, valueNode := mappingEntry(mapping, key)
+	if valueNode != nil && valueNode.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%s in %s is not a single value", key, f.path)
+	}
+
+	if f.lines != nil && len(f.lines) > 0 {
+		flow := mapping.Style&yaml.FlowStyle != 0
+		if valueNode != nil && valueNode.Line == keyNode.Line {
+			if f.replaceScalar(valueNode, renderScalar(value), flow) {
+				return f.reparse()
+			}
+		} else if valueNode == nil && flow && f.appendFlowEntry(mapping, key, value) {
+			return f.reparse()
+		} else if valueNode == nil && !flow && len(mapping.Content) > 0 {
+			last := mapping.Content[len(mapping.Content)-2]
+			indent := last.Column - 1
+			end := f.blockEnd(last.Line-1, indent, true)
+			line := fmt.Sprintf("%s%s: %s", strings.Repeat(" ", indent), key, renderScalar(value))
+			f.insertLines(end+1, line)
+			return f.reparse()
+		}
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	if valueNode != nil {
+		node.HeadComment, node.LineComment, node.FootComment = valueNode.HeadComment, valueNode.LineComment, valueNode.FootComment
+		*valueNode = *node
+	} else {
+		mapping.Content = append(mapping.Content, scalarNode(key), node)
+	}
+	return f.reencode()
+}
+
+// appendFlowEntry adds key: value after the last entry of a flow mapping
+// whose last value is a scalar, like {path: /health, interval: 30s}
+func (f *File) appendFlowEntry(mapping *yaml.Node, key string, value interface{}) bool {
+	if len(mapping.Content) == 0 {
+		return false
+	}
+	last := mapping.Content[len(mapping.Content)-1]
+	if last.Kind != yaml.ScalarNode || last.Line < 1 || last.Line > len(f.lines) {
+		return false
+	}
+	line := f.lines[last.Line-1]
+	if last.Column-1 >= len(line) {
+		return false
+	}
+	end := scalarEnd(line, last.Column-1, true)
+	if end < 0 {
+		return false
+	}
+	f.lines[last.Line-1] = line[:end] + fmt.Sprintf(", %s: %s", key, renderScalar(value)) + line[end:]
+	return true
+}
+
+// appendServiceText adds svc as text after the last item of a block
+// sequence, reporting false when the layout needs re-encoding instead
+func (f *File) appendServiceText(root, services *yaml.Node, svc *types.Service) bool {
+	if root.Style&yaml.FlowStyle != 0 {
+		return false
+	}
+
+	var at, dash int
+	switch {
+	case services == nil:
+		if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+			f.lines = append(f.lines, "")
+		}
+		f.lines = append(f.lines, "services:")
+		at, dash = len(f.lines), 2
+	case services.Kind == yaml.SequenceNode && services.Style&yaml.FlowStyle == 0 && len(services.Content) > 0:
+		last := services.Content[len(services.Content)-1]
+		if !f.isDashLine(last) {
+			return false
+		}
+		dash = indentOf(f.lines[last.Line-1])
+		at = f.blockEnd(last.Line-1, dash, false) + 1
+	case isEmptyValue(services):
+		// services: or services: [] on the key's line
+		keyNode, _ := mappingEntry(root, "services")
+		i := keyNode.Line - 1
+		f.lines[i] = f.lines[i][:keyNode.Column-1] + "services:" + trailingComment(f.lines[i])
+		at, dash = i+1, keyNode.Column-1+2
+	default:
+		return false
+	}
+
+	rendered, err := renderBlock([]*types.Service{svc})
+	if err != nil {
+		return false
+	}
+	lines := make([]string, 0, len(rendered))
+	for _, l := range rendered {
+		lines = append(lines, strings.Repeat(" ", dash)+l)
+	}
+	f.insertLines(at, lines...)
+	return true
+}
+
+// itemLines returns the 0-based first and last line of a block sequence
+// item, including comment lines directly above it
+func (f *File) itemLines(item *yaml.Node) (int, int, bool) {
+	if !f.isDashLine(item) {
+		return 0, 0, false
+	}
+	start := item.Line - 1
+	dash := indentOf(f.lines[start])
+	end := f.blockEnd(start, dash, false)
+	for start > 0 && isComment(f.lines[start-1]) && indentOf(f.lines[start-1]) == dash {
+		start--
+	}
+	return start, end, true
+}
+
+// isDashLine reports whether a sequence item starts on its own "- " line
+func (f *File) isDashLine(item *yaml.Node) bool {
+	if item.Line < 1 || item.Line > len(f.lines) {
+		return false
+	}
+	line := strings.TrimSpace(f.lines[item.Line-1])
+	return strings.HasPrefix(line, "- ") && indentOf(f.lines[item.Line-1]) == item.Column-3
+}
+
+// blockEnd returns the last line (0-based) of the block starting at line
+// start whose first line is indented by indent: following lines belong to it
+// while they are indented deeper. With dashes set, "- " lines at the same
+// indent belong to it too, for sequences written flush with their key.
+// Trailing blank and comment lines are left to whatever follows.
+func (f *File) blockEnd(start, indent int, dashes bool) int {
+	end := start
+	for i := start + 1; i < len(f.lines); i++ {
+		line := f.lines[i]
+		if strings.TrimSpace(line) == "" || isComment(line) {
+			continue
+		}
+		n := indentOf(line)
+		if n > indent || (dashes && n == indent && strings.HasPrefix(strings.TrimSpace(line), "-")) {
+			end = i
+			continue
+		}
+		break
+	}
+	return end
+}
+
+// replaceScalar swaps the text of a single-line scalar for text
+func (f *File) replaceScalar(node *yaml.Node, text string, flow bool) bool {
+	if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 || node.Line < 1 || node.Line > len(f.lines) {
+		return false
+	}
+	line := f.lines[node.Line-1]
+	start := node.Column - 1
+	if start >= len(line) {
+		return false
+	}
+	end := scalarEnd(line, start, flow)
+	if end < 0 {
+		return false
+	}
+	f.lines[node.Line-1] = line[:start] + text + line[end:]
+	return true
+}
+
+// scalarEnd returns the index just past the scalar starting at start, or -1
+func scalarEnd(line string, start int, flow bool) int {
+	switch line[start] {
+	case '"':
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				return i + 1
+			}
+		}
+		return -1
+	case '\'':
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+		return -1
+	}
+	end := len(line)
+	for i := start; i < len(line); i++ {
+		if line[i] == '#' && i > start && line[i-1] == ' ' {
+			end = i
+			break
+		}
+		if flow && strings.IndexByte(",}]", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+	for end > start && line[end-1] == ' ' {
+		end--
+	}
+	return end
+}
+
+// insertLines inserts lines before index at
+func (f *File) insertLines(at int, lines ...string) {
+	out := make([]string, 0, len(f.lines)+len(lines))
+	out = append(out, f.lines[:at]...)
+	out = append(out, lines...)
+	f.lines = append(out, f.lines[at:]...)
+}
+
+// reparse refreshes the node tree after a text edit
+func (f *File) reparse() error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.Join(f.lines, "\n")+"\n"), &doc); err != nil {
+		return fmt.Errorf("editing %s produced invalid YAML: %w", f.path, err)
+	}
+	f.doc = doc
+	return nil
+}
+
+// reencode regenerates the YAML text from the node tree, for layouts the
+// text edits don't handle; comments survive but formatting may change
+func (f *File) reencode() error {
+	if f.format != FormatYAML {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&f.doc); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	f.lines = strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	return f.reparse()
+}
+
+// sortKeys orders the mappings under node by the position of their dotted
+// path in order; list items share their list's path
+func sortKeys(node *yaml.Node, path string, order map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range node.Content {
+			sortKeys(c, path, order)
+		}
+	case yaml.MappingNode:
+		pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+		key := func(k *yaml.Node) string {
+			return strings.TrimPrefix(path+"."+toml.Key{k.Value}.String(), ".")
+		}
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return order[key(pairs[i][0])] < order[key(pairs[j][0])]
+		})
+		node.Content = node.Content[:0]
+		for _, p := range pairs {
+			node.Content = append(node.Content, p[0], p[1])
+			sortKeys(p[1], key(p[0]), order)
+		}
+	}
+}
+
+// findService returns the index and node of the service called name
+func findService(services *yaml.Node, name string) (int, *yaml.Node) {
+	if services == nil || services.Kind != yaml.SequenceNode {
+		return -1, nil
+	}
+	for i, item := range services.Content {
+		if _, n := mappingEntry(item, "name"); n != nil && n.Value == name {
+			return i, item
+		}
+	}
+	return -1, nil
+}
+
+// usedAnchor returns an anchor defined inside node that an alias outside it
+// refers to
+func usedAnchor(root, node *yaml.Node) string {
+	anchors := make(map[*yaml.Node]string)
+	var collect func(n *yaml.Node)
+	collect = func(n *yaml.Node) {
+		if n.Anchor != "" {
+			anchors[n] = n.Anchor
+		}
+		for _, c := range n.Content {
+			collect(c)
+		}
+	}
+	collect(node)
+	if len(anchors) == 0 {
+		return ""
+	}
+
+	var used string
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n == node || used != "" {
+			return
+		}
+		if n.Kind == yaml.AliasNode {
+			if name, ok := anchors[n.Alias]; ok {
+				used = name
+			}
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(root)
+	return used
+}
+
+// renderBlock encodes v as block YAML lines with two-space indentation
+func renderBlock(v interface{}) ([]string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), nil
+}
+
+// renderScalar encodes a single value as YAML text
+func renderScalar(v interface{}) string {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// scalarNode returns a plain string node, used for mapping keys
+func scalarNode(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+// isEmptyValue reports whether node is null or an empty flow sequence
+func isEmptyValue(node *yaml.Node) bool {
+	return (node.Kind == yaml.ScalarNode && node.Tag == "!!null") ||
+		(node.Kind == yaml.SequenceNode && len(node.Content) == 0)
+}
+
+// trailingComment returns the " # ..." end of a key line, if any
+func trailingComment(line string) string {
+	if i := strings.Index(line, " #"); i >= 0 {
+		return line[i:]
+	}
+	return ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// editFixture has environment references, comments and anchors, which
+// edits must leave as written
+const editFixture = `# hz config for the shop
+server:
+  port: ${HZ_PORT:-3000} # overridable
+
+x-health: &health
+  path: /health
+  interval: 30s
+
+tunnel:
+  enabled: false
+  authtoken: "${NGROK_AUTHTOKEN}" # never the token itself
+
+services:
+  # the storefront
+  - name: web
+    target: http://localhost:${WEB_PORT:-5173}
+    health: *health
+    routes:
+      - path: /*
+
+  - name: api # REST API
+    target: http://localhost:8080
+    health:
+      <<: *health
+      interval: 10s
+    env:
+      DATABASE_URL: ${DATABASE_URL:?set it in .env}
+`
+
+// TestEditKeepsEnvReferences edits a config the way hz add, hz tunnel and
+// hz config set do, with the referenced variables set, and checks that only
+// the edited lines change
+func TestEditKeepsEnvReferences(t *testing.T) {
+	t.Setenv("NGROK_AUTHTOKEN", "tok_secret")
+	t.Setenv("WEB_PORT", "5174")
+	t.Setenv("DATABASE_URL", "postgres://user:pw@db/shop")
+
+	tests := []struct {
+		name    string
+		edit    func(f *File) error
+		removed []string
+		added   []string
+	}{
+		{
+			name: "hz add",
+			edit: func(f *File) error {
+				return f.AddService(&types.Service{Name: "docs", Target: "http://localhost:4000"})
+			},
+			added: []string{"  - name: docs", "    target: http://localhost:4000"},
+		},
+		{
+			name:  "hz add --default",
+			edit:  func(f *File) error { return f.SetServiceField("web", "default", true) },
+			added: []string{"    default: true"},
+		},
+		{
+			name:    "hz tunnel --enable",
+			edit:    func(f *File) error { return f.SetTunnel("enabled", true) },
+			removed: []string{"  enabled: false"},
+			added:   []string{"  enabled: true"},
+		},
+		{
+			name:  "hz tunnel --domain",
+			edit:  func(f *File) error { return f.SetTunnel("domain", "shop.ngrok.app") },
+			added: []string{"  domain: shop.ngrok.app"},
+		},
+		{
+			name:    "hz config set",
+			edit:    func(f *File) error { return f.Set("services[api].target", "http://localhost:${API_PORT}") },
+			removed: []string{"    target: http://localhost:8080"},
+			added:   []string{"    target: http://localhost:${API_PORT}"},
+		},
+		{
+			name:    "hz config set in a merged mapping",
+			edit:    func(f *File) error { return f.Set("services[api].health.interval", "15s") },
+			removed: []string{"      interval: 10s"},
+			added:   []string{"      interval: 15s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hz.yaml")
+			if err := os.WriteFile(path, []byte(editFixture), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := OpenFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.edit(f); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Save(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, secret := range []string{"tok_secret", "5174", "postgres://"} {
+				if strings.Contains(string(data), secret) {
+					t.Errorf("saved file has the expanded value %q:\n%s", secret, data)
+				}
+			}
+			removed, added := changedLines(editFixture, string(data))
+			if !slices.Equal(removed, tt.removed) || !slices.Equal(added, tt.added) {
+				t.Errorf("removed %q and added %q, want %q and %q:\n%s", removed, added, tt.removed, tt.added, data)
+			}
+		})
+	}
+}
+
+// changedLines returns the lines between the common start and end of two
+// texts: those only before has and those only after has
+func changedLines(before, after string) (removed, added []string) {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+	end := 0
+	for end < len(a)-start && end < len(b)-start && a[len(a)-1-end] == b[len(b)-1-end] {
+		end++
+	}
+	if len(a)-end > start {
+		removed = a[start : len(a)-end]
+	}
+	if len(b)-end > start {
+		added = b[start : len(b)-end]
+	}
+	return removed, added
+}
+
+func TestEditLayout(t *testing.T) {
+	web := &types.Service{Name: "web", Target: "http://localhost:5173"}
+	tests := []struct {
+		name string
+		file string
+		in   string
+		edit func(f *File) error
+		want string
+		err  string
+	}{
+		{
+			name: "remove with its comment",
+			file: "hz.yaml",
+			in:   "services:\n  # the storefront\n  - name: web\n    target: http://localhost:3000\n\n  - name: api # REST\n    target: http://localhost:8080\n",
+			edit: func(f *File) error { return f.RemoveService("web") },
+			want: "services:\n  - name: api # REST\n    target: http://localhost:8080\n",
+		},
+		{
+			name: "remove the last",
+			file: "hz.yaml",
+			in:   "services:\n  - name: api\n    target: http://localhost:8080\n\n  - name: web\n    target: http://localhost:3000\n",
+			edit: func(f *File) error { return f.RemoveService("web") },
+			want: "services:\n  - name: api\n    target: http://localhost:8080\n",
+		},
+		{
+			name: "remove between blank lines",
+			file: "hz.yaml",
+			in:   "services:\n  - name: a\n    target: http://localhost:1\n\n  - name: b\n    target: http://localhost:2\n\n  - name: c\n    target: http://localhost:3\n",
+			edit: func(f *File) error { return f.RemoveService("b") },
+			want: "services:\n  - name: a\n    target: http://localhost:1\n\n  - name: c\n    target: http://localhost:3\n",
+		},
+		{
+			name: "remove a used anchor",
+			file: "hz.yaml",
+			in:   "services:\n  - name: web\n    target: http://localhost:3000\n    health: &h {path: /health}\n  - name: api\n    target: http://localhost:8080\n    health: *h\n",
+			edit: func(f *File) error { return f.RemoveService("web") },
+			err:  "defines the anchor &h used elsewhere",
+		},
+		{
+			name: "remove a field",
+			file: "hz.yaml",
+			in:   "services:\n- name: web\n  target: http://localhost:3000\n  default: true # for now\n  # routes come later\n- name: api\n  target: http://localhost:8080\n",
+			edit: func(f *File) error { return f.RemoveServiceField("web", "default") },
+			want: "services:\n- name: web\n  target: http://localhost:3000\n  # routes come later\n- name: api\n  target: http://localhost:8080\n",
+		},
+		{
+			name: "set in a flow mapping",
+			file: "hz.yaml",
+			in:   "services:\n  - name: web\n    target: http://localhost:3000\n    health: {path: /health, interval: 30s} # quick\n",
+			edit: func(f *File) error { return f.Set("services[web].health.timeout", "5s") },
+			want: "services:\n  - name: web\n    target: http://localhost:3000\n    health: {path: /health, interval: 30s, timeout: 5s} # quick\n",
+		},
+		{
+			name: "replace a quoted value",
+			file: "hz.yaml",
+			in:   "services:\n  - name: web\n    target: 'http://localhost:3000' # vite\n",
+			edit: func(f *File) error { return f.SetServiceField("web", "target", "http://localhost:5173") },
+			want: "services:\n  - name: web\n    target: http://localhost:5173 # vite\n",
+		},
+		{
+			name: "add to an empty list",
+			file: "hz.yaml",
+			in:   "server:\n  port: 3000\nservices: [] # none yet\n",
+			edit: func(f *File) error { return f.AddService(web) },
+			want: "server:\n  port: 3000\nservices: # none yet\n  - name: web\n    target: http://localhost:5173\n",
+		},
+		{
+			name: "add to a list flush with its key",
+			file: "hz.yaml",
+			in:   "services:\n- name: api\n  target: http://localhost:8080\n# the end\n",
+			edit: func(f *File) error { return f.AddService(web) },
+			want: "services:\n- name: api\n  target: http://localhost:8080\n- name: web\n  target: http://localhost:5173\n# the end\n",
+		},
+		{
+			name: "add the first",
+			file: "hz.yaml",
+			in:   "# just the server\nserver:\n  port: 3000\n",
+			edit: func(f *File) error { return f.AddService(web) },
+			want: "# just the server\nserver:\n  port: 3000\n\nservices:\n  - name: web\n    target: http://localhost:5173\n",
+		},
+		{
+			name: "add the tunnel section",
+			file: "hz.yaml",
+			in:   "server:\n  port: 3000 # dev\n",
+			edit: func(f *File) error { return f.SetTunnel("enabled", true) },
+			want: "server:\n  port: 3000 # dev\ntunnel:\n  enabled: true\n",
+		},
+		{
+			name: "json key order",
+			file: "hz.json",
+			in:   "{\"tunnel\": {\"enabled\": false}, \"server\": {\"port\": 3000}, \"services\": []}\n",
+			edit: func(f *File) error { return f.AddService(web) },
+			want: "{\n  \"tunnel\": {\n    \"enabled\": false\n  },\n  \"server\": {\n    \"port\": 3000\n  },\n  \"services\": [\n    {\n      \"name\": \"web\",\n      \"target\": \"http://localhost:5173\"\n    }\n  ]\n}\n",
+		},
+		{
+			name: "toml key order",
+			file: "hz.toml",
+			in:   "[tunnel]\nenabled = false\nprovider = \"ngrok\"\n\n[server]\nport = 3000\n\n[[services]]\nname = \"web\"\ntarget = \"http://localhost:5173\"\n\n[[services.routes]]\npath = \"/*\"\n\n[services.health]\npath = \"/health\"\n",
+			edit: func(f *File) error { return f.SetTunnel("enabled", true) },
+			want: "[tunnel]\nenabled = true\nprovider = \"ngrok\"\n\n[server]\nport = 3000\n\n[[services]]\nname = \"web\"\ntarget = \"http://localhost:5173\"\n\n[[services.routes]]\npath = \"/*\"\n\n[services.health]\npath = \"/health\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.in), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := OpenFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.edit(f)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Save(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("saved\n%s\nwant\n%s", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envError is a variable reference that couldn't be expanded, at a byte
+// offset in the original text
+type envError struct {
+	offset  int
+	message string
+}
+
+// expandEnv expands environment variables in s before it is parsed:
+//
+//	$VAR, ${VAR}      the value, empty when unset
+//	${VAR:-default}   default when VAR is unset or empty (${VAR-default}: unset only)
+//	${VAR:?message}   an error when VAR is unset or empty (${VAR?message}: unset only)
+//
+// Defaults are expanded themselves and may contain colons; values taken from
+// the environment are used as is. $$ produces a literal dollar sign. $1-style
+// regex group references are never environment variables and are kept as is.
+func expandEnv(s string) (string, []envError) {
+	return expandWith(s, os.LookupEnv)
+}
+
+// expandWith expands variables like expandEnv, looking them up with lookup
+func expandWith(s string, lookup func(string) (string, bool)) (string, []envError) {
+	var b strings.Builder
+	var errs []envError
+	expandInto(&b, s, 0, lookup, &errs)
+	return b.String(), errs
+}
+
+// expandInto writes the expansion of s to b; base is the offset of s in the
+// original text, for error positions
+func expandInto(b *strings.Builder, s string, base int, lookup func(string) (string, bool), errs *[]envError) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		next := s[i+1]
+		switch {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				*errs = append(*errs, envError{offset: base + i, message: "unterminated ${ in environment variable reference"})
+				b.WriteString(s[i:])
+				return
+			}
+			expandBraced(b, s[i+2:end], base+i, base+i+2, lookup, errs)
+			i = end
+		case isNameStart(next):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			value, _ := lookup(s[i+1 : j])
+			b.WriteString(value)
+			i = j - 1
+		default:
+			// $1 group references and a lone $ stay as written
+			b.WriteByte('$')
+		}
+	}
+}
+
+// expandBraced expands the inside of ${...}. at is the offset of the $ and
+// base the offset of expr.
+func expandBraced(b *strings.Builder, expr string, at, base int, lookup func(string) (string, bool), errs *[]envError) {
+	n := 0
+	for n < len(expr) && isNameChar(expr[n]) {
+		n++
+	}
+	name, op := expr[:n], expr[n:]
+	if name == "" || !isNameStart(name[0]) {
+		*errs = append(*errs, envError{offset: at, message: fmt.Sprintf("invalid environment variable reference ${%s}", expr)})
+		return
+	}
+
+	value, set := lookup(name)
+	emptyCounts := strings.HasPrefix(op, ":")
+	if emptyCounts {
+		op = op[1:]
+	}
+	missing := !set || (emptyCounts && value == "")
+
+	switch {
+	case op == "" && !emptyCounts:
+		b.WriteString(value)
+	case strings.HasPrefix(op, "-"):
+		if missing {
+			expandInto(b, op[1:], base+len(expr)-len(op)+1, lookup, errs)
+		} else {
+			b.WriteString(value)
+		}
+	case strings.HasPrefix(op, "?"):
+		if !missing {
+			b.WriteString(value)
+			break
+		}
+		msg := fmt.Sprintf("required environment variable %s is not set", name)
+		if set {
+			msg = fmt.Sprintf("required environment variable %s is empty", name)
+		}
+		if reason := strings.TrimSpace(op[1:]); reason != "" {
+			msg += ": " + reason
+		}
+		*errs = append(*errs, envError{offset: at, message: msg})
+	default:
+		*errs = append(*errs, envError{offset: at, message: fmt.Sprintf("invalid environment variable reference ${%s} (use ${%s:-default} or ${%s:?message})", expr, name, name)})
+	}
+}
+
+// closingBrace returns the index of the } that closes a ${ whose contents
+// start at i, skipping nested ${...}
+func closingBrace(s string, i int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case s[i] == '\n':
+			return -1 // references never span lines
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{
+		"HOST":   "localhost",
+		"PORT":   "8080",
+		"EMPTY":  "",
+		"COLON":  "a:b",
+		"DOLLAR": "$HOST",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "$HOST:$PORT", want: "localhost:8080"},
+		{in: "${HOST}:${PORT}", want: "localhost:8080"},
+		{in: "${MISSING}", want: ""},
+		{in: "$MISSING/x", want: "/x"},
+		{in: "${DOLLAR}", want: "$HOST"}, // values aren't expanded again
+		{in: "$$HOST", want: "$HOST"},
+		{in: "$${HOST}", want: "${HOST}"},
+		{in: "price: 5$", want: "price: 5$"},
+		{in: "/users?id=$1", want: "/users?id=$1"},
+
+		{in: "${PORT:-3000}", want: "8080"},
+		{in: "${MISSING:-3000}", want: "3000"},
+		{in: "${EMPTY:-3000}", want: "3000"},
+		{in: "${EMPTY-3000}", want: ""},
+		{in: "${MISSING-3000}", want: "3000"},
+		{in: "${MISSING:-http://localhost:5173}", want: "http://localhost:5173"},
+		{in: "${MISSING:-${HOST}:${PORT}}", want: "localhost:8080"},
+		{in: "${MISSING:-}", want: ""},
+		{in: "${COLON:-x}", want: "a:b"},
+
+		{in: "${HOST:?needed}", want: "localhost"},
+		{in: "${EMPTY?needed}", want: ""},
+		{in: "${MISSING:?set it in .env}", err: "required environment variable MISSING is not set: set it in .env"},
+		{in: "${MISSING?}", err: "required environment variable MISSING is not set"},
+		{in: "${EMPTY:?needed}", err: "required environment variable EMPTY is empty: needed"},
+
+		{in: "${HOST", err: "unterminated ${"},
+		{in: "a: ${HOST\nb: 1", err: "unterminated ${"},
+		{in: "${}", err: "invalid environment variable reference ${}"},
+		{in: "${1X}", err: "invalid environment variable reference ${1X}"},
+		{in: "${HOST:+x}", err: "use ${HOST:-default} or ${HOST:?message}"},
+	}
+	for _, tt := range tests {
+		got, errs := expandWith(tt.in, lookup)
+		if tt.err == "" {
+			if len(errs) > 0 {
+				t.Errorf("expand(%q): unexpected error %q", tt.in, errs[0].message)
+			} else if got != tt.want {
+				t.Errorf("expand(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			continue
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].message, tt.err) {
+			t.Errorf("expand(%q) errors %v, want one containing %q", tt.in, errs, tt.err)
+		}
+	}
+}
+
+func TestExpandEnvErrorOffset(t *testing.T) {
+	s := "server:\n  port: ${PORT:?set the port}\n"
+	_, errs := expandWith(s, func(string) (string, bool) { return "", false })
+	if len(errs) != 1 {
+		t.Fatalf("got %v, want one error", errs)
+	}
+	if want := strings.Index(s, "${"); errs[0].offset != want {
+		t.Errorf("error at offset %d, want %d", errs[0].offset, want)
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceFlags is the Source of a configuration built from 'hz start
+// --service' flags instead of a file
+const SourceFlags = "flags"
+
+// TargetArg expands a bare port like 3001 to http://localhost:3001; other
+// values are used as the target URL as is
+func TargetArg(arg string) string {
+	if port, err := strconv.Atoi(arg); err == nil {
+		return fmt.Sprintf("http://localhost:%d", port)
+	}
+	return arg
+}
+
+// ParseServiceFlag parses a --service value: name=port or name=url, with an
+// optional :/path suffix that becomes a path route, as in api=8080:/api/*
+func ParseServiceFlag(spec string) (*types.Service, error) {
+	name, target, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || target == "" {
+		return nil, fmt.Errorf("invalid --service %q (use name=port, name=url or name=port:/path)", spec)
+	}
+
+	svc := &types.Service{Name: name}
+	if i := pathSuffix(target); i >= 0 {
+		svc.Routes = []types.RouteConfig{{Path: target[i+1:]}}
+		target = target[:i]
+	}
+	svc.Target = TargetArg(target)
+	return svc, nil
+}
+
+// pathSuffix returns the index of the colon starting a :/path suffix, or -1.
+// The :// of a URL scheme is not a suffix.
+func pathSuffix(target string) int {
+	for i := 0; i+1 < len(target); i++ {
+		if target[i] == ':' && target[i+1] == '/' && (i+2 == len(target) || target[i+2] != '/') {
+			return i
+		}
+	}
+	return -1
+}
+
+// FlagConfig builds a configuration from --service values. defaultName
+// marks the default service; a single service is the default anyway.
+// tunnel enables the tunnel, with the auth token from $NGROK_AUTHTOKEN, the
+// OS keyring or the ngrok config.
+func FlagConfig(specs []string, defaultName string, tunnel bool) (*types.Config, error) {
+	c := &types.Config{}
+	for _, spec := range specs {
+		svc, err := ParseServiceFlag(spec)
+		if err != nil {
+			return nil, err
+		}
+		c.Services = append(c.Services, svc)
+	}
+
+	if defaultName == "" && len(c.Services) == 1 {
+		defaultName = c.Services[0].Name
+	}
+	if defaultName != "" {
+		found := false
+		for _, svc := range c.Services {
+			if svc.Name == defaultName {
+				svc.Default = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("--default %s doesn't match any --service", defaultName)
+		}
+	}
+
+	if tunnel {
+		c.Tunnel.Enabled = true
+		c.Tunnel.AuthToken = os.Getenv("NGROK_AUTHTOKEN")
+		c.Tunnel.Keyring = true
+	}
+	return c, nil
+}
+
+// NewFlagManager creates a configuration manager for a configuration built
+// from flags. It is defaulted and validated exactly like a file; there is
+// nothing to watch.
+func NewFlagManager(config *types.Config) (*Manager, error) {
+	m := &Manager{
+		flags:  config,
+		stopCh: make(chan struct{}),
+	}
+	if err := m.Load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// flagDocument stands in for the file of a configuration built from flags
+func flagDocument(config *types.Config) (*document, Problems) {
+	doc := &document{name: "--service"}
+	var node yaml.Node
+	if err := node.Encode(config); err != nil {
+		return nil, Problems{{File: doc.name, Message: err.Error()}}
+	}
+	doc.node = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&node}}
+	return doc, nil
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported configuration file formats
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// FormatOf returns the configuration format of path, judged by its
+// extension. Anything that isn't .json or .toml is read as YAML.
+func FormatOf(path string) string {
+	if u, err := url.Parse(path); err == nil && IsRemote(path) {
+		path = u.Path
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// ParseFormat validates a format name given on the command line
+func ParseFormat(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "json":
+		return FormatJSON, nil
+	case "toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("unknown config format %q (expected yaml, json or toml)", name)
+	}
+}
+
+// Decode parses data in the given format into config. JSON and TOML
+// documents are converted to YAML first so every format shares the yaml
+// field names and duration strings such as "30s".
+func Decode(format string, data []byte, config *types.Config) error {
+	var doc interface{}
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+	case FormatTOML:
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return err
+		}
+	default:
+		return yaml.Unmarshal(data, config)
+	}
+
+	converted, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(converted, config)
+}
+
+// Encode serializes config in the given format
+func Encode(format string, config *types.Config) ([]byte, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil || format == FormatYAML {
+		return data, err
+	}
+	return convertYAML(format, data)
+}
+
+// Save writes config to path in the format of its extension. A config from
+// Load has its environment variables expanded, so saving it would write their
+// values out; edit the file through OpenFile to keep the references.
+func Save(path string, config *types.Config) error {
+	data, err := Encode(FormatOf(path), config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// convertYAML re-encodes a YAML document as JSON or TOML
+func convertYAML(format string, data []byte) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := writeJSON(&buf, &node); err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+			return nil, err
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	case FormatTOML:
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if len(node.Content) > 0 {
+			if err := writeTOMLTable(&buf, resolveAlias(node.Content[0]), nil); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	default:
+		return data, nil
+	}
+}
+
+// writeJSON writes a YAML node as compact JSON, keeping the key order of
+// mappings so the output reads like the YAML it came from
+func writeJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		return writeJSON(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(node.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+// writeTOMLTable writes a YAML mapping as the TOML table at path, keeping
+// its key order: values first, as TOML requires, then tables and arrays of
+// tables as they come
+func writeTOMLTable(buf *bytes.Buffer, node *yaml.Node, path []string) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("TOML needs a table at %s", strings.Join(path, "."))
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		value := resolveAlias(node.Content[i+1])
+		if isTOMLTable(value) || isTOMLTableArray(value) || value.Tag == "!!null" {
+			continue
+		}
+		text, err := tomlInline(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "%s = %s\n", tomlKey(node.Content[i].Value), text)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		value := resolveAlias(node.Content[i+1])
+		sub := append(append([]string(nil), path...), node.Content[i].Value)
+		switch {
+		case isTOMLTable(value):
+			writeTOMLHeader(buf, "["+tomlPath(sub)+"]")
+			if err := writeTOMLTable(buf, value, sub); err != nil {
+				return err
+			}
+		case isTOMLTableArray(value):
+			for _, item := range value.Content {
+				writeTOMLHeader(buf, "[["+tomlPath(sub)+"]]")
+				if err := writeTOMLTable(buf, resolveAlias(item), sub); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeTOMLHeader starts a table, after a blank line unless it comes first
+func writeTOMLHeader(buf *bytes.Buffer, header string) {
+	if buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(header + "\n")
+}
+
+// tomlInline writes a value on one line: scalars as TOML writes them,
+// sequences as arrays and mappings as inline tables
+func tomlInline(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			text, err := tomlInline(resolveAlias(item))
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case yaml.MappingNode:
+		entries := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := resolveAlias(node.Content[i+1])
+			if value.Tag == "!!null" {
+				continue
+			}
+			text, err := tomlInline(value)
+			if err != nil {
+				return "", err
+			}
+			entries = append(entries, tomlKey(node.Content[i].Value)+" = "+text)
+		}
+		return "{" + strings.Join(entries, ", ") + "}", nil
+	}
+
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]interface{}{"v": v}); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(buf.String(), "v = "), "\n"), nil
+}
+
+// isTOMLTable reports whether a value is written as a [table]
+func isTOMLTable(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode
+}
+
+// isTOMLTableArray reports whether a value is written as [[tables]]: a
+// non-empty list of mappings
+func isTOMLTableArray(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		if resolveAlias(item).Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey quotes a key unless it can be written bare
+func tomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	quoted, _ := json.Marshal(key)
+	return string(quoted)
+}
+
+// tomlPath writes a table path like services.health
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+// resolveAlias returns the node an alias refers to, or node itself
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestDurationsRoundTrip checks that durations are saved as strings like
+// 30s in every format and read back the same
+func TestDurationsRoundTrip(t *testing.T) {
+	const in = `server:
+  port: 3000
+  readHeaderTimeout: 10s
+  idleTimeout: 2m
+services:
+  - name: api
+    target: http://localhost:8080
+    health:
+      path: /health
+      interval: 30000000000
+      timeout: 1500ms
+`
+	var original types.Config
+	if err := Decode(FormatYAML, []byte(in), &original); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatYAML, []string{"interval: 30s", "timeout: 1.5s", "readHeaderTimeout: 10s", "idleTimeout: 2m0s"}},
+		{FormatJSON, []string{`"interval": "30s"`, `"timeout": "1.5s"`, `"readHeaderTimeout": "10s"`}},
+		{FormatTOML, []string{`interval = "30s"`, `timeout = "1.5s"`, `readHeaderTimeout = "10s"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := Encode(tt.format, &original)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("saved config lacks %s:\n%s", want, data)
+				}
+			}
+			if strings.Contains(string(data), "30000000000") {
+				t.Errorf("saved config has nanoseconds:\n%s", data)
+			}
+
+			var loaded types.Config
+			if err := Decode(tt.format, data, &loaded); err != nil {
+				t.Fatal(err)
+			}
+			if len(loaded.Services) != 1 || loaded.Services[0].Health == nil {
+				t.Fatalf("services not read back: %+v", loaded.Services)
+			}
+			health := loaded.Services[0].Health
+			if health.Interval.Duration() != 30*time.Second || health.Timeout.Duration() != 1500*time.Millisecond {
+				t.Errorf("read back interval %s and timeout %s", health.Interval, health.Timeout)
+			}
+			if loaded.Server.ReadHeaderTimeout != original.Server.ReadHeaderTimeout || loaded.Server.IdleTimeout != original.Server.IdleTimeout {
+				t.Errorf("read back server timeouts %s and %s", loaded.Server.ReadHeaderTimeout, loaded.Server.IdleTimeout)
+			}
+
+			again, err := Encode(tt.format, &loaded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != string(data) {
+				t.Errorf("saving again changed the config:\n%s\nthen\n%s", data, again)
+			}
+		})
+	}
+}
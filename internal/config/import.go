@@ -0,0 +1,82 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Import is an hz configuration generated by 'hz init' from another tool's
+// file, such as a docker-compose file or a Procfile
+type Import struct {
+	Data     []byte   // hz.yaml text, commented with the origin of each service
+	Services []string // hz services created, in file order
+	Notes    []string // entries skipped or simplified
+}
+
+// importedService is a service written into an Import
+type importedService struct {
+	name      string
+	comments  []string // written above the service
+	target    string   // "" leaves the service for the user to complete
+	command   string
+	health    string
+	isDefault bool
+	route     bool // routed by /<name>, stripping the prefix
+}
+
+// freePort returns the first port from DefaultPort that is not used
+func freePort(used map[int]bool) int {
+	port := DefaultPort
+	for used[port] {
+		port++
+	}
+	return port
+}
+
+// renderImport writes the hz.yaml text for services imported from source
+// with the given 'hz init' flag
+func renderImport(source, flag string, port int, services []importedService, notes []string) *Import {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# hz - Development Proxy Configuration\n")
+	fmt.Fprintf(&b, "# Generated from %s by 'hz init %s'\n", source, flag)
+	fmt.Fprintf(&b, "version: \"1\"\n\nserver:\n  port: %d\n  host: \"0.0.0.0\"\n\n", port)
+	fmt.Fprintf(&b, "tunnel:\n  enabled: false\n  provider: ngrok\n  authtoken: \"${NGROK_AUTHTOKEN}\"\n\n")
+	fmt.Fprintf(&b, "services:\n")
+
+	result := &Import{Notes: notes}
+	for _, svc := range services {
+		for _, c := range svc.comments {
+			fmt.Fprintf(&b, "  # %s\n", c)
+		}
+		fmt.Fprintf(&b, "  - name: %s\n", renderScalar(svc.name))
+		if svc.target != "" {
+			fmt.Fprintf(&b, "    target: %q\n", svc.target)
+		}
+		if svc.isDefault {
+			b.WriteString("    default: true\n")
+		}
+		if svc.command != "" {
+			fmt.Fprintf(&b, "    command: %s\n", renderScalar(svc.command))
+		}
+		if svc.route {
+			prefix := "/" + svc.name
+			fmt.Fprintf(&b, "    routes:\n      - path: %s\n        prefix: true\n", renderScalar(prefix))
+			fmt.Fprintf(&b, "    rewrite:\n      stripPrefix: %s\n", renderScalar(prefix))
+		}
+		if svc.health != "" {
+			fmt.Fprintf(&b, "    health:\n      path: %s\n", renderScalar(svc.health))
+		}
+		result.Services = append(result.Services, svc.name)
+	}
+	b.WriteString("\nrouting:\n  strictPaths: true\n\nlogging:\n  level: info\n  format: text\n")
+
+	result.Data = b.Bytes()
+	return result
+}
+
+// escapeDollars keeps $VAR in a command for the shell instead of having it
+// expanded when the config loads
+func escapeDollars(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
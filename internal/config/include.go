@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// includePatterns resolves the include globs of the main config file
+// relative to its directory
+func includePatterns(mainPath string, include []string) []string {
+	dir := filepath.Dir(mainPath)
+	patterns := make([]string, 0, len(include))
+	for _, p := range include {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		patterns = append(patterns, filepath.Clean(p))
+	}
+	return patterns
+}
+
+// includeFiles expands the include patterns into the files to merge, in
+// pattern order and sorted within each pattern. Patterns that match nothing
+// are skipped, so an optional hz.local.yaml may be missing.
+func includeFiles(mainPath string, patterns []string) ([]string, error) {
+	mainAbs, _ := filepath.Abs(mainPath)
+	seen := map[string]bool{mainAbs: true}
+
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			abs, _ := filepath.Abs(match)
+			if seen[abs] {
+				continue
+			}
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			seen[abs] = true
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+// mergeIncludes merges the included files into config in order: their
+// services are appended and any other keys they set override earlier values.
+// It returns the parsed files and the file each service was defined in.
+// Services whose name is already taken are reported and left out.
+func mergeIncludes(mainDoc *document, config *types.Config, files []string) ([]*document, map[string]string, Problems) {
+	mainPath := mainDoc.path
+	sources := make(map[string]string, len(config.Services))
+
+	var problems Problems
+	services := config.Services[:0]
+	for i, svc := range config.Services {
+		if _, ok := sources[svc.Name]; ok && svc.Name != "" {
+			problems = append(problems, mainDoc.problemAt(fmt.Sprintf("services[%d]", i), fmt.Sprintf("duplicate service name: %s", svc.Name)))
+			continue
+		}
+		sources[svc.Name] = mainPath
+		services = append(services, svc)
+	}
+	config.Services = services
+
+	var docs []*document
+	include := config.Include
+	for _, file := range files {
+		doc, parseProblems := parseDocument(mainPath, file)
+		problems = append(problems, parseProblems...)
+		if doc == nil {
+			continue
+		}
+		docs = append(docs, doc)
+
+		services := config.Services
+		config.Services = nil
+		config.Include = nil
+		problems = append(problems, doc.decode(config)...)
+		problems = append(problems, doc.unknownFields()...)
+
+		if len(config.Include) > 0 {
+			problems = append(problems, doc.problemAt("include", "included files cannot include other files"))
+		}
+
+		for i, svc := range config.Services {
+			if other, ok := sources[svc.Name]; ok && svc.Name != "" {
+				msg := fmt.Sprintf("duplicate service name %s: defined in %s and %s",
+					svc.Name, displayPath(mainPath, other), displayPath(mainPath, file))
+				if other == file {
+					msg = fmt.Sprintf("duplicate service name: %s", svc.Name)
+				}
+				problems = append(problems, doc.problemAt(fmt.Sprintf("services[%d]", i), msg))
+				continue
+			}
+			sources[svc.Name] = file
+			services = append(services, svc)
+		}
+		config.Services = services
+	}
+	config.Include = include
+
+	return docs, sources, problems
+}
+
+// displayPath shows path relative to the main config file's directory
+func displayPath(mainPath, path string) string {
+	if rel, err := filepath.Rel(filepath.Dir(mainPath), path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// includeDirs returns the directories to watch for the include patterns
+func includeDirs(patterns []string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, pattern := range patterns {
+		dir := filepath.Dir(pattern)
+		if !hasMeta(dir) {
+			add(dir)
+			continue
+		}
+		// A glob in the directory part: watch the directories that exist now
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			add(filepath.Dir(match))
+		}
+	}
+	return dirs
+}
+
+// matchesInclude reports whether path is matched by one of the patterns
+func matchesInclude(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMeta reports whether path contains glob metacharacters
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
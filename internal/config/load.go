@@ -0,0 +1,318 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zymawy/hz/internal/router"
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// document is one parsed configuration file
+type document struct {
+	path    string
+	name    string     // path as shown in problems
+	node    *yaml.Node // the file as YAML
+	located bool       // false when node positions don't match the file (TOML)
+}
+
+// parseDocument reads a configuration file, expanding environment variables,
+// and parses it by extension. It returns nil if the file can't be parsed.
+func parseDocument(mainPath, path string) (*document, Problems) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, Problems{{File: displayPath(mainPath, path), Message: fmt.Sprintf("failed to read config file: %v", err)}}
+	}
+	return parseData(mainPath, path, data)
+}
+
+// parseData parses the contents of a configuration file, like parseDocument
+func parseData(mainPath, path string, data []byte) (*document, Problems) {
+	doc := &document{path: path, name: displayPath(mainPath, path), located: true}
+
+	// Expand environment variables
+	text, envErrs := expandEnv(string(data))
+	if len(envErrs) > 0 {
+		problems := make(Problems, 0, len(envErrs))
+		for _, e := range envErrs {
+			p := Problem{File: doc.name, Message: e.message}
+			p.Line, p.Column = offsetPosition(data, e.offset)
+			problems = append(problems, p)
+		}
+		return nil, problems
+	}
+	expanded := []byte(text)
+
+	var node yaml.Node
+	switch FormatOf(path) {
+	case FormatJSON:
+		var v interface{}
+		if err := json.Unmarshal(expanded, &v); err != nil {
+			p := Problem{File: doc.name, Message: err.Error()}
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				p.Line, p.Column = offsetPosition(expanded, int(syntaxErr.Offset))
+			}
+			return nil, Problems{p}
+		}
+		// JSON is YAML, so positions usually survive; fall back to a
+		// converted document for JSON the YAML parser rejects
+		if yaml.Unmarshal(expanded, &node) != nil {
+			doc.located = false
+			if err := convertValue(v, &node); err != nil {
+				return nil, Problems{{File: doc.name, Message: err.Error()}}
+			}
+		}
+	case FormatTOML:
+		var v interface{}
+		if _, err := toml.Decode(string(expanded), &v); err != nil {
+			p := Problem{File: doc.name, Message: tomlLine.ReplaceAllString(err.Error(), "")}
+			var parseErr toml.ParseError
+			if errors.As(err, &parseErr) {
+				p.Line, p.Column = offsetPosition(expanded, parseErr.Position.Start)
+			}
+			return nil, Problems{p}
+		}
+		doc.located = false
+		if err := convertValue(v, &node); err != nil {
+			return nil, Problems{{File: doc.name, Message: err.Error()}}
+		}
+	default:
+		if err := yaml.Unmarshal(expanded, &node); err != nil {
+			return nil, decodeProblems(doc.name, err, true)
+		}
+	}
+
+	doc.node = &node
+	return doc, nil
+}
+
+// tomlLine matches the position prefix of TOML parse errors
+var tomlLine = regexp.MustCompile(`^toml: line \d+(?: \(last key "[^"]*"\))?: `)
+
+// convertValue re-encodes a decoded JSON or TOML value as a YAML node
+func convertValue(v interface{}, node *yaml.Node) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, node)
+}
+
+// offsetPosition converts a byte offset into a 1-based line and column
+func offsetPosition(data []byte, offset int) (int, int) {
+	line, col := 1, 1
+	for i := 0; i < offset && i < len(data); i++ {
+		if data[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// decode decodes the document into config. Keys present in the file
+// overwrite the matching fields of config; the services list is replaced.
+func (d *document) decode(config *types.Config) Problems {
+	if d.node.Kind == 0 {
+		return nil // empty file
+	}
+	if err := d.node.Decode(config); err != nil {
+		return decodeProblems(d.name, err, d.located)
+	}
+	return nil
+}
+
+// unknownFields reports keys in the document that hz doesn't know
+func (d *document) unknownFields() Problems {
+	return unknownFields(d.name, d.node, reflect.TypeOf(types.Config{}), "", d.located)
+}
+
+// has reports whether the document sets the value at path
+func (d *document) has(path string) bool {
+	seg := pathSegment.FindStringSubmatch(path)
+	if seg == nil || d.node.Kind != yaml.DocumentNode || len(d.node.Content) == 0 {
+		return false
+	}
+	_, value := mappingEntry(d.node.Content[0], seg[1])
+	return value != nil
+}
+
+// problemAt reports message at the node for path in the document
+func (d *document) problemAt(path, message string) Problem {
+	p := Problem{File: d.name, Message: message}
+	if node := locate(d.node, path); node != nil && d.located {
+		p.Line, p.Column = node.Line, node.Column
+	}
+	return p
+}
+
+// loaded is the result of parsing the config file and its includes
+type loaded struct {
+	docs     []*document // the main file first
+	config   *types.Config
+	main     *types.Config
+	sources  map[string]string
+	includes []string
+	files    []string
+	warnings Problems
+}
+
+// parse reads the config file and its includes, applies defaults and
+// validates the result, returning every problem found, including keys hz
+// doesn't know
+func (m *Manager) parse() (*loaded, Problems) {
+	var mainDoc *document
+	var problems Problems
+	if m.flags != nil {
+		mainDoc, problems = flagDocument(m.flags)
+	} else if m.data != nil {
+		mainDoc, problems = parseData(m.path, m.path, m.data)
+	} else {
+		mainDoc, problems = parseDocument(m.path, m.path)
+	}
+	if mainDoc == nil {
+		return nil, problems
+	}
+
+	config := &types.Config{}
+	problems = append(problems, mainDoc.decode(config)...)
+	problems = append(problems, mainDoc.unknownFields()...)
+	main := &types.Config{}
+	mainDoc.decode(main)
+
+	// Merge included files
+	var files []string
+	includes := includePatterns(m.path, config.Include)
+	switch {
+	case m.remote != nil:
+		if len(includes) > 0 {
+			problems = append(problems, mainDoc.problemAt("include", "include isn't supported in a remote config"))
+		}
+	case m.flags == nil:
+		var err error
+		if files, err = includeFiles(m.path, includes); err != nil {
+			problems = append(problems, mainDoc.problemAt("include", err.Error()))
+		}
+	}
+	docs, sources, includeProblems := mergeIncludes(mainDoc, config, files)
+	problems = append(problems, includeProblems...)
+	docs = append([]*document{mainDoc}, docs...)
+
+	// Services inherit the defaults block before the built-in defaults
+	inheritDefaults(docs, sources, config)
+
+	// Apply defaults
+	m.applyDefaults(config)
+	m.applyDefaults(main)
+
+	// Validate and parse URLs
+	for _, err := range m.validateAndParse(config) {
+		p := locateError(docs, sources, err)
+		p.Warning = isWarning(err)
+		problems = append(problems, p)
+	}
+
+	var paths []string
+	for _, doc := range docs {
+		if doc.path != "" {
+			paths = append(paths, doc.path)
+		}
+	}
+
+	return &loaded{docs: docs, config: config, main: main, sources: sources, includes: includes, files: paths, warnings: problems.Warnings()}, problems
+}
+
+// locateError turns a validation error into a problem at the place in the
+// config files it is about: the file defining the service, or else the last
+// file that sets the setting
+func locateError(docs []*document, sources map[string]string, err error) Problem {
+	path := pathOf(err)
+	doc := docs[0]
+	if name, ok := serviceOfPath(path); ok {
+		for _, d := range docs {
+			if d.path == sources[name] {
+				doc = d
+			}
+		}
+	} else if path != "" {
+		for _, d := range docs {
+			if d.has(path) {
+				doc = d
+			}
+		}
+	}
+	return doc.problemAt(path, err.Error())
+}
+
+// routeService extracts the service name from router errors
+var routeService = regexp.MustCompile(`^service ([^:\s]+):`)
+
+// Validate checks the config file at path and its includes the way 'hz
+// start' loads them, and also reports route problems. It returns the loaded
+// configuration unless the file can't be parsed.
+func Validate(path string) (*types.Config, Problems) {
+	m := &Manager{path: path}
+	if IsRemote(path) {
+		remote, err := newRemoteSource(path)
+		if err != nil {
+			return nil, Problems{{File: path, Message: err.Error()}}
+		}
+		if m.data, _, _, err = remote.fetch(); err != nil {
+			return nil, Problems{{File: path, Message: err.Error()}}
+		}
+		m.remote = remote
+	}
+	return validate(m)
+}
+
+// validate parses and checks the configuration of m
+func validate(m *Manager) (*types.Config, Problems) {
+	result, problems := m.parse()
+	if result == nil {
+		return nil, problems
+	}
+
+	if len(problems.Errors()) == 0 {
+		// Build the routes as hz start does, so the same conflicts show
+		rtr := router.New()
+		rtr.SetOptions(result.config.Routing)
+		rtr.SetTrailingSlash(result.config.Server.TrailingSlash)
+		if err := rtr.Build(result.config.ActiveServices()); err != nil {
+			if match := routeService.FindStringSubmatch(err.Error()); match != nil {
+				err = atField(servicePath(match[1]), err)
+			}
+			p := locateError(result.docs, result.sources, err)
+			// Splits may name services that discovery registers at runtime
+			p.Warning = result.config.Discovery.Enabled()
+			problems = append(problems, p)
+		}
+		for _, w := range rtr.Warnings() {
+			problems = append(problems, Problem{File: result.docs[0].name, Message: w, Warning: true})
+		}
+	}
+
+	// List problems file by file, top to bottom
+	order := make(map[string]int, len(result.docs))
+	for i, doc := range result.docs {
+		order[doc.name] = i
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if order[a.File] != order[b.File] {
+			return order[a.File] < order[b.File]
+		}
+		return a.Line < b.Line
+	})
+
+	return result.config, problems
+}
@@ -0,0 +1,372 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// pathStep is one key of a dotted config path, optionally selecting a list
+// item by index (services[1]) or by name (services[name=api] or services[api])
+type pathStep struct {
+	key      string
+	selector string // "" when the step selects no item
+}
+
+// parsePath splits a path like services[name=api].health.interval
+func parsePath(path string) ([]pathStep, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, fmt.Errorf("empty config path")
+	}
+	var steps []pathStep
+	for rest := path; rest != ""; {
+		m := pathSegment.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("invalid config path %q", path)
+		}
+		rest = rest[len(m[0]):]
+		if rest != "" && !strings.HasPrefix(rest, ".") {
+			return nil, fmt.Errorf("invalid config path %q", path)
+		}
+		rest = strings.TrimPrefix(rest, ".")
+
+		step := pathStep{key: m[1]}
+		if strings.Contains(m[0], "[") {
+			step.selector = strings.TrimPrefix(m[2], "name=")
+			if step.selector == "" {
+				return nil, fmt.Errorf("invalid config path %q: empty [] selector", path)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// String writes the step back as path syntax
+func (s pathStep) String() string {
+	if s.selector == "" {
+		return s.key
+	}
+	if _, err := strconv.Atoi(s.selector); err == nil {
+		return fmt.Sprintf("%s[%s]", s.key, s.selector)
+	}
+	return fmt.Sprintf("%s[name=%s]", s.key, s.selector)
+}
+
+// joinSteps writes steps back as a path
+func joinSteps(steps []pathStep) string {
+	parts := make([]string, len(steps))
+	for i, s := range steps {
+		parts[i] = s.String()
+	}
+	return strings.Join(parts, ".")
+}
+
+// typeAt returns the Go type of the config value at path, reporting keys
+// hz doesn't know the way validation does
+func typeAt(steps []pathStep) (reflect.Type, error) {
+	t := reflect.TypeOf(types.Config{})
+	for i, step := range steps {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := yamlFields(t)
+			field, ok := fields[step.key]
+			if !ok {
+				msg := fmt.Sprintf("unknown field %q in %s", step.key, describePath(joinSteps(steps[:i])))
+				if s := suggestField(step.key, fields); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", s)
+				}
+				return nil, fmt.Errorf("%s", msg)
+			}
+			t = field
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("%s has no field %q", joinSteps(steps[:i]), step.key)
+		}
+
+		if step.selector != "" {
+			if t.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("%s is not a list", joinSteps(steps[:i+1]))
+			}
+			t = t.Elem()
+		}
+	}
+	return t, nil
+}
+
+// Lookup returns the value at a dotted path in a configuration, such as
+// server.port, services[1].target or services[name=api].health.interval.
+// Unset values are nil.
+func Lookup(c *types.Config, path string) (interface{}, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := typeAt(steps); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(c)
+	for i, step := range steps {
+		v = reflect.Indirect(v)
+		switch v.Kind() {
+		case reflect.Struct:
+			v = fieldByYAML(v, step.key)
+		case reflect.Map:
+			v = v.MapIndex(reflect.ValueOf(step.key))
+		}
+		if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+			return nil, nil
+		}
+
+		if step.selector != "" {
+			item, ok := selectItem(v, step.selector)
+			if !ok {
+				return nil, fmt.Errorf("no %s in the config", joinSteps(steps[:i+1]))
+			}
+			v = item
+		}
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+	return v.Interface(), nil
+}
+
+// fieldByYAML returns the struct field with the yaml key name, looking into
+// inline fields
+func fieldByYAML(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if strings.Contains(opts, "inline") {
+			if inner := fieldByYAML(v.Field(i), name); inner.IsValid() {
+				return inner
+			}
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		if key == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// selectItem picks a list item by index, or by the value of its name field
+func selectItem(list reflect.Value, selector string) (reflect.Value, bool) {
+	if i, err := strconv.Atoi(selector); err == nil {
+		if i < 0 || i >= list.Len() {
+			return reflect.Value{}, false
+		}
+		return list.Index(i), true
+	}
+	for i := 0; i < list.Len(); i++ {
+		item := reflect.Indirect(list.Index(i))
+		if item.Kind() != reflect.Struct {
+			continue
+		}
+		if name := fieldByYAML(item, "name"); name.IsValid() && name.Kind() == reflect.String && name.String() == selector {
+			return list.Index(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// coerce converts a command-line value to the type of the field it is set
+// on. Environment references like ${PORT} are kept as they are.
+func coerce(path string, t reflect.Type, value string) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	switch t {
+	case reflect.TypeOf(types.Duration(0)), reflect.TypeOf(types.ByteSize(0)):
+		node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, yamlLine.ReplaceAllString(strings.TrimPrefix(err.Error(), "yaml: unmarshal errors:\n  "), ""))
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && t == reflect.TypeOf(types.ByteSize(0)) {
+			return n, nil
+		}
+		return value, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes true or false, got %q", path, value)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("%s takes a whole number, got %q", path, value)
+		}
+		return n, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("%s takes a positive whole number, got %q", path, value)
+		}
+		return n, nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("%s takes a number, got %q", path, value)
+		}
+		return f, nil
+	case reflect.Interface:
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+			return value, nil
+		}
+		return v, nil
+	case reflect.Slice:
+		return nil, fmt.Errorf("%s is a list; set one item, like %s[0]", path, path)
+	default:
+		return nil, fmt.Errorf("%s has several settings; set one of them, like %s.<key>", path, path)
+	}
+}
+
+// Set sets the value at a dotted path, like Lookup's, converting value to the
+// type of the field: numbers, true/false, durations like 30s. Lists items are
+// selected by index or name; missing mappings on the way are added.
+func (f *File) Set(path, value string) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	t, err := typeAt(steps)
+	if err != nil {
+		return err
+	}
+	if steps[len(steps)-1].selector != "" && t.Kind() != reflect.String {
+		return fmt.Errorf("%s has several settings; set one of them, like %s.<key>", path, path)
+	}
+	v, err := coerce(path, t, value)
+	if err != nil {
+		return err
+	}
+
+	mapping := f.root()
+	for i, step := range steps {
+		last := i == len(steps)-1
+		_, child := mappingEntry(mapping, step.key)
+		if child != nil && child.Kind == yaml.AliasNode {
+			return fmt.Errorf("%s in %s refers to an anchor; edit the file by hand", joinSteps(steps[:i+1]), f.path)
+		}
+
+		if step.selector == "" {
+			if last {
+				return f.setScalar(mapping, step.key, v)
+			}
+			if child == nil || isEmptyValue(child) {
+				return f.setNested(mapping, steps[i:], v)
+			}
+			if child.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s in %s is not a mapping", joinSteps(steps[:i+1]), f.path)
+			}
+			mapping = child
+			continue
+		}
+
+		var item *yaml.Node
+		if child != nil {
+			item = sequenceItem(child, step.selector)
+		}
+		if item == nil {
+			return fmt.Errorf("%s is not in %s", joinSteps(steps[:i+1]), f.path)
+		}
+		if item.Kind == yaml.AliasNode {
+			return fmt.Errorf("%s in %s refers to an anchor; edit the file by hand", joinSteps(steps[:i+1]), f.path)
+		}
+		if last {
+			return f.setItem(item, v, child.Style&yaml.FlowStyle != 0)
+		}
+		if item.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s in %s is not a mapping", joinSteps(steps[:i+1]), f.path)
+		}
+		mapping = item
+	}
+	return nil
+}
+
+// setNested sets a value under keys that don't exist yet in mapping, adding
+// them as nested block mappings
+func (f *File) setNested(mapping *yaml.Node, steps []pathStep, value interface{}) error {
+	for _, step := range steps[1:] {
+		if step.selector != "" {
+			return fmt.Errorf("%s is not in %s", joinSteps(steps), f.path)
+		}
+	}
+	var nested interface{} = value
+	for i := len(steps) - 1; i >= 1; i-- {
+		nested = map[string]interface{}{steps[i].key: nested}
+	}
+
+	key := steps[0].key
+	_, valueNode := mappingEntry(mapping, key)
+	if f.lines != nil && valueNode == nil && mapping.Style&yaml.FlowStyle == 0 && len(mapping.Content) > 0 {
+		if rendered, err := renderBlock(map[string]interface{}{key: nested}); err == nil {
+			last := mapping.Content[len(mapping.Content)-2]
+			indent := last.Column - 1
+			end := f.blockEnd(last.Line-1, indent, true)
+			lines := make([]string, len(rendered))
+			for i, l := range rendered {
+				lines[i] = strings.Repeat(" ", indent) + l
+			}
+			f.insertLines(end+1, lines...)
+			return f.reparse()
+		}
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(nested); err != nil {
+		return err
+	}
+	if valueNode != nil {
+		node.HeadComment, node.LineComment = valueNode.HeadComment, valueNode.LineComment
+		*valueNode = *node
+	} else {
+		mapping.Content = append(mapping.Content, scalarNode(key), node)
+	}
+	return f.reencode()
+}
+
+// setItem replaces a scalar list item
+func (f *File) setItem(item *yaml.Node, value interface{}, flow bool) error {
+	if item.Kind != yaml.ScalarNode {
+		return fmt.Errorf("list item at line %d of %s is not a single value", item.Line, f.path)
+	}
+	if f.lines != nil && f.replaceScalar(item, renderScalar(value), flow) {
+		return f.reparse()
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	node.LineComment = item.LineComment
+	*item = *node
+	return f.reencode()
+}
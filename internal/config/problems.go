@@ -0,0 +1,394 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is one error or warning found in a configuration file
+type Problem struct {
+	File    string // relative to the main config file's directory
+	Line    int    // 0 when the position is unknown
+	Column  int
+	Message string
+	Warning bool
+}
+
+// String formats the problem as file:line:column: message
+func (p Problem) String() string {
+	var b strings.Builder
+	b.WriteString(p.File)
+	if p.Line > 0 {
+		fmt.Fprintf(&b, ":%d", p.Line)
+		if p.Column > 0 {
+			fmt.Fprintf(&b, ":%d", p.Column)
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteString(": ")
+	}
+	if p.Warning {
+		b.WriteString("warning: ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// Problems is every problem found in a configuration. As an error it lists
+// the errors, one per line.
+type Problems []Problem
+
+// Errors returns the problems that are not warnings
+func (ps Problems) Errors() Problems {
+	var errs Problems
+	for _, p := range ps {
+		if !p.Warning {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// Warnings returns the problems that are warnings
+func (ps Problems) Warnings() Problems {
+	var warnings Problems
+	for _, p := range ps {
+		if p.Warning {
+			warnings = append(warnings, p)
+		}
+	}
+	return warnings
+}
+
+// Error implements error
+func (ps Problems) Error() string {
+	lines := make([]string, 0, len(ps))
+	for _, p := range ps.Errors() {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fieldError is a validation error for the config value at path, written
+// like services[api].health.path or server.forwardProxy.port
+type fieldError struct {
+	path    string
+	err     error
+	warning bool // legal but probably a mistake
+}
+
+func (e *fieldError) Error() string { return e.err.Error() }
+func (e *fieldError) Unwrap() error { return e.err }
+
+// atField attaches the config path err is about
+func atField(path string, err error) error {
+	return &fieldError{path: path, err: err}
+}
+
+// fieldErrorf formats a validation error for the config value at path
+func fieldErrorf(path, format string, args ...interface{}) error {
+	return atField(path, fmt.Errorf(format, args...))
+}
+
+// warningf formats a warning about the config value at path
+func warningf(path, format string, args ...interface{}) error {
+	return &fieldError{path: path, err: fmt.Errorf(format, args...), warning: true}
+}
+
+// isWarning reports whether err is a warning rather than an error
+func isWarning(err error) bool {
+	var fe *fieldError
+	return errors.As(err, &fe) && fe.warning
+}
+
+// pathOf returns the config path of err, if it has one
+func pathOf(err error) string {
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		return fe.path
+	}
+	return ""
+}
+
+// servicePath returns the config path of a service, or of a field in it
+func servicePath(name string, fields ...string) string {
+	return strings.Join(append([]string{"services[" + name + "]"}, fields...), ".")
+}
+
+// serviceOfPath returns the service a config path points into
+func serviceOfPath(path string) (string, bool) {
+	if !strings.HasPrefix(path, "services[") {
+		return "", false
+	}
+	end := strings.IndexByte(path, ']')
+	if end < 0 {
+		return "", false
+	}
+	return path[len("services["):end], true
+}
+
+// pathSegment matches one step of a config path: a key with an optional
+// [index] or [name] selector
+var pathSegment = regexp.MustCompile(`^([^.\[]+)(?:\[([^\]]*)\])?`)
+
+// locate finds the node at path in a document, or the deepest node on the
+// way there when the value itself isn't set
+func locate(doc *yaml.Node, path string) *yaml.Node {
+	node := doc
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for rest := path; rest != ""; rest = strings.TrimPrefix(rest, ".") {
+		m := pathSegment.FindStringSubmatch(rest)
+		if m == nil {
+			break
+		}
+		rest = rest[len(m[0]):]
+
+		key, value := mappingEntry(node, m[1])
+		if value == nil {
+			return node
+		}
+		node = value
+		if m[2] == "" {
+			continue
+		}
+
+		item := sequenceItem(node, m[2])
+		if item == nil {
+			return key
+		}
+		node = item
+	}
+	return node
+}
+
+// mappingEntry returns the key and value nodes of key in a mapping node
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// sequenceItem selects an item of a sequence node by index, or by the value
+// of its name key
+func sequenceItem(node *yaml.Node, selector string) *yaml.Node {
+	if node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	if i, err := strconv.Atoi(selector); err == nil {
+		if i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+		return nil
+	}
+	for _, item := range node.Content {
+		if _, name := mappingEntry(item, "name"); name != nil && name.Value == selector {
+			return item
+		}
+	}
+	return nil
+}
+
+// yamlLine matches the line prefix of yaml.v3 error messages
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// decodeProblems turns a yaml decoding error into problems, keeping the line
+// of each message when positions are meaningful
+func decodeProblems(file string, err error, located bool) Problems {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	problems := make(Problems, 0, len(messages))
+	for _, msg := range messages {
+		p := Problem{File: file, Message: strings.TrimPrefix(msg, "yaml: ")}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			p.Message = msg[len(m[0]):]
+			if located {
+				p.Line, _ = strconv.Atoi(m[1])
+			}
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// unknownFields reports mapping keys in node that don't match a yaml field of t
+func unknownFields(file string, node *yaml.Node, t reflect.Type, path string, located bool) Problems {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		node = node.Content[0]
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	var problems Problems
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// x- keys are free-form annotations
+			if strings.HasPrefix(key.Value, "x-") {
+				continue
+			}
+			// <<: *anchor merges the keys of another mapping
+			if key.Tag == "!!merge" {
+				merged := []*yaml.Node{value}
+				if value.Kind == yaml.SequenceNode {
+					merged = value.Content
+				}
+				for _, m := range merged {
+					problems = append(problems, unknownFields(file, m, t, path, located)...)
+				}
+				continue
+			}
+			field, ok := fields[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown field %q in %s", key.Value, describePath(path))
+				if s := suggestField(key.Value, fields); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", s)
+				}
+				p := Problem{File: file, Message: msg}
+				if located {
+					p.Line, p.Column = key.Line, key.Column
+				}
+				problems = append(problems, p)
+				continue
+			}
+			problems = append(problems, unknownFields(file, value, field, joinPath(path, key.Value), located)...)
+		}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			problems = append(problems, unknownFields(file, item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), located)...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			problems = append(problems, unknownFields(file, node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value), located)...)
+		}
+	}
+	return problems
+}
+
+// yamlFields maps the yaml keys of a struct to their field types
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// suggestField returns the known field closest to an unknown key, or ""
+// when none is close. Keys that only differ in case, dashes or underscores
+// (strip_prefix for stripPrefix) always match.
+func suggestField(key string, fields map[string]reflect.Type) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+
+	best, bestDist := "", -1
+	for name := range fields {
+		if normalize(name) == normalize(key) {
+			return name
+		}
+		d := editDistance(strings.ToLower(key), strings.ToLower(name))
+		if bestDist < 0 || d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	if bestDist < 0 || bestDist > max(1, len(key)/3) {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the edit distance between a and b, counting insertions,
+// deletions, substitutions and swaps of adjacent letters
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// joinPath appends a key to a config path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// describePath names a config path in messages
+func describePath(path string) string {
+	if path == "" {
+		return "the top level"
+	}
+	return path
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// procfileEntry matches a "name: command" line of a Procfile
+var procfileEntry = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// procfilePorts find the port a command listens on, in order of preference:
+// PORT=4000, -p 3000, --port=5173, -b 0.0.0.0:8000, runserver 8000
+var procfilePorts = []*regexp.Regexp{
+	regexp.MustCompile(`(?:^|[\s;&])PORT=["']?(\d+)`),
+	regexp.MustCompile(`(?:^|\s)(?:-p|--port|--http-port)(?:=|\s*)["']?(\d+)\b`),
+	regexp.MustCompile(`(?:^|\s)(?:-b|--bind|--listen|-l|--host)(?:=|\s+)["']?[\w.\[\]:/]*:(\d+)\b`),
+	regexp.MustCompile(`\brunserver\s+(?:[\w.\[\]:]*:)?(\d+)\b`),
+}
+
+// procfilePort returns the port a Procfile command listens on, or 0 if it
+// can't be told from the command
+func procfilePort(command string) int {
+	for _, re := range procfilePorts {
+		if m := re.FindStringSubmatch(command); m != nil {
+			if port, err := strconv.Atoi(m[1]); err == nil && port > 0 && port <= 65535 {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// ImportProcfile generates an hz configuration with a managed service per
+// Procfile process. The web process is the default; processes whose port
+// can't be told from their command get no target, so validation points at
+// them.
+func ImportProcfile(path string) (*Import, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Procfile: %w", err)
+	}
+	defer f.Close()
+
+	var services []importedService
+	var notes []string
+	used := map[int]bool{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := procfileEntry.FindStringSubmatch(line)
+		if m == nil {
+			notes = append(notes, fmt.Sprintf("skipped line %d: not a \"name: command\" entry", n))
+			continue
+		}
+		name, command := m[1], strings.TrimSpace(m[2])
+		if seen[name] {
+			notes = append(notes, fmt.Sprintf("skipped line %d: process %s is defined twice", n, name))
+			continue
+		}
+		seen[name] = true
+
+		svc := importedService{
+			name:      name,
+			comments:  []string{"From Procfile process " + name},
+			command:   escapeDollars(command),
+			isDefault: name == "web",
+			route:     name != "web",
+		}
+		if port := procfilePort(command); port > 0 {
+			svc.target = fmt.Sprintf("http://localhost:%d", port)
+			used[port] = true
+		} else {
+			svc.comments = append(svc.comments, fmt.Sprintf("TODO: set target to the port %s listens on, or remove it if it serves no HTTP", name))
+			notes = append(notes, fmt.Sprintf("%s: no port in its command; set its target in the config", name))
+		}
+		services = append(services, svc)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Procfile: %w", err)
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("%s defines no processes", path)
+	}
+
+	return renderImport(filepath.Base(path), "--from-procfile", freePort(used), services, notes), nil
+}
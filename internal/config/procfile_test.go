@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProcfilePort(t *testing.T) {
+	tests := []struct {
+		command string
+		want    int
+	}{
+		{"PORT=4000 node server.js", 4000},
+		{"env PORT='4001' npm start", 4001},
+		{"cd web && PORT=4002 npm run dev", 4002},
+		{"rails server -p 3000", 3000},
+		{"rails server -p3001", 3001},
+		{"vite --port=5173", 5173},
+		{"vite --port 5174 --host", 5174},
+		{"hugo server --http-port 1313", 1313},
+		{"gunicorn -b 0.0.0.0:8000 app:app", 8000},
+		{"gunicorn --bind=[::]:8001 app:app", 8001},
+		{"uvicorn main:app --host 127.0.0.1:8002", 8002},
+		{"python manage.py runserver 8003", 8003},
+		{"python manage.py runserver 0.0.0.0:8004", 8004},
+		{"PORT=4000 vite --port 5175", 4000}, // PORT= wins
+		{"bundle exec puma -p $PORT", 0},
+		{"bundle exec sidekiq", 0},
+		{"node server.js -p 70000", 0},
+		{"APP_PORT=4000 node server.js", 0},
+	}
+	for _, tt := range tests {
+		if got := procfilePort(tt.command); got != tt.want {
+			t.Errorf("procfilePort(%q) = %d, want %d", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestImportProcfile(t *testing.T) {
+	procfile := "# processes for foreman\r\n" +
+		"web: PORT=3000 bundle exec rails server\r\n" +
+		"\r\n" +
+		"api:\tgunicorn -b 0.0.0.0:8000 app:app\n" +
+		"admin_ui :  python manage.py runserver 8001\n" + // no space may precede the colon
+		"worker: bundle exec sidekiq -c $CONCURRENCY\n" +
+		"release-phase: rake db:migrate\n" +
+		"api: gunicorn -b 0.0.0.0:9000 other:app\n" +
+		"web.2: node other.js\n" +
+		"just a comment without a colon\n" +
+		"  clock:   ruby clock.rb -p 9100   \n"
+	path := filepath.Join(t.TempDir(), "Procfile")
+	if err := os.WriteFile(path, []byte(procfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := ImportProcfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"web", "api", "worker", "release-phase", "clock"}; !slices.Equal(imp.Services, want) {
+		t.Errorf("services %v, want %v", imp.Services, want)
+	}
+	wantNotes := []string{
+		"skipped line 5: not a \"name: command\" entry",
+		"worker: no port in its command; set its target in the config",
+		"release-phase: no port in its command; set its target in the config",
+		"skipped line 8: process api is defined twice",
+		"skipped line 9: not a \"name: command\" entry",
+		"skipped line 10: not a \"name: command\" entry",
+	}
+	if !slices.Equal(imp.Notes, wantNotes) {
+		t.Errorf("notes\n%s\nwant\n%s", strings.Join(imp.Notes, "\n"), strings.Join(wantNotes, "\n"))
+	}
+
+	data := string(imp.Data)
+	for _, want := range []string{
+		"# Generated from Procfile by 'hz init --from-procfile'\n",
+		"server:\n  port: 3001\n", // 3000 is taken by web
+		"  # From Procfile process web\n  - name: web\n    target: \"http://localhost:3000\"\n    default: true\n    command: PORT=3000 bundle exec rails server\n",
+		"  - name: api\n    target: \"http://localhost:8000\"\n    command: gunicorn -b 0.0.0.0:8000 app:app\n    routes:\n      - path: /api\n",
+		"    command: bundle exec sidekiq -c $$CONCURRENCY\n", // left for the shell
+		"  - name: clock\n    target: \"http://localhost:9100\"\n    command: ruby clock.rb -p 9100\n",
+		"  # TODO: set target to the port worker listens on, or remove it if it serves no HTTP\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("generated config is missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestImportProcfileErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "Procfile")
+	if err := os.WriteFile(empty, []byte("# nothing yet\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportProcfile(empty); err == nil || err.Error() != empty+" defines no processes" {
+		t.Errorf("empty Procfile: %v", err)
+	}
+	if _, err := ImportProcfile(filepath.Join(dir, "missing")); err == nil || !strings.HasPrefix(err.Error(), "failed to read Procfile: ") {
+		t.Errorf("missing Procfile: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secret values in EncodeRedacted output
+const Redacted = "[redacted]"
+
+// secretKey matches keys whose values look like secrets: the tunnel
+// authtoken, and env or header entries like DB_PASSWORD or Authorization
+var secretKey = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|api[-_]?key|authorization|credential|private[-_]?key)`)
+
+// EncodeRedacted serializes config like Encode, with the values of
+// secret-looking keys replaced by Redacted
+func EncodeRedacted(format string, config *types.Config) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(config); err != nil {
+		return nil, err
+	}
+	redactNode(&node)
+
+	data, err := yaml.Marshal(&node)
+	if err != nil || format == FormatYAML {
+		return data, err
+	}
+	return convertYAML(format, data)
+}
+
+// redactNode replaces the scalar values of secret-looking mapping keys
+func redactNode(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.Value != "" && secretKey.MatchString(key.Value) {
+				*value = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: Redacted}
+			}
+			// "user:password" logins keep their user
+			if key.Value == "basicAuth" && value.Kind == yaml.SequenceNode {
+				for _, login := range value.Content {
+					user, _, _ := strings.Cut(login.Value, ":")
+					*login = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: user + ":" + Redacted}
+				}
+			}
+		}
+	}
+	for _, child := range node.Content {
+		redactNode(child)
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RemoteTokenEnv names the environment variable whose value is sent as a
+// bearer token when fetching a remote config
+const RemoteTokenEnv = "HZ_CONFIG_TOKEN"
+
+// DefaultPollInterval is how often a remote config is checked for changes
+const DefaultPollInterval = 30 * time.Second
+
+// maxRemoteSize limits the size of a remote config
+const maxRemoteSize = 5 << 20
+
+// IsRemote reports whether path is an http(s) URL rather than a file
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// remoteSource fetches a config from a URL, keeping the last good copy on
+// disk so hz starts offline
+type remoteSource struct {
+	url    string
+	client *http.Client
+	cache  string // cached copy; its metadata is next to it in cache+".json"
+
+	etag         string
+	lastModified string
+	fetchError   string // reported failures, so each is logged once
+	configError  string
+}
+
+// remoteMeta is the metadata of a cached remote config
+type remoteMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// newRemoteSource prepares fetching rawURL, with the cache under ~/.hz/cache
+func newRemoteSource(rawURL string) (*remoteSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid config URL %q", rawURL)
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	name := hex.EncodeToString(sum[:8]) + filepath.Ext(u.Path)
+	return &remoteSource{
+		url:    rawURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+		cache:  filepath.Join(os.Getenv("HOME"), ".hz", "cache", name),
+	}, nil
+}
+
+// cached returns the last good copy and when it was fetched, and remembers
+// its validators for conditional requests
+func (r *remoteSource) cached() ([]byte, time.Time, error) {
+	data, err := os.ReadFile(r.cache)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var meta remoteMeta
+	if raw, err := os.ReadFile(r.cache + ".json"); err == nil && json.Unmarshal(raw, &meta) == nil && meta.URL == r.url {
+		r.etag, r.lastModified = meta.ETag, meta.LastModified
+	}
+	return data, meta.Fetched, nil
+}
+
+// fetch downloads the config. It returns nil data when the server answers
+// 304 Not Modified to the validators of the current copy.
+func (r *remoteSource) fetch() ([]byte, string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	req.Header.Set("User-Agent", "hz")
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	if r.lastModified != "" {
+		req.Header.Set("If-Modified-Since", r.lastModified)
+	}
+	if token := os.Getenv(RemoteTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to fetch config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, "", "", nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		hint := "set " + RemoteTokenEnv
+		if os.Getenv(RemoteTokenEnv) != "" {
+			hint = "check " + RemoteTokenEnv
+		}
+		return nil, "", "", fmt.Errorf("failed to fetch config: %s (%s)", resp.Status, hint)
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", "", fmt.Errorf("failed to fetch config: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to fetch config: %w", err)
+	}
+	if len(data) > maxRemoteSize {
+		return nil, "", "", fmt.Errorf("config at %s is larger than %d MB", r.url, maxRemoteSize>>20)
+	}
+	return data, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+}
+
+// save stores a copy that loaded successfully as the last good one, with the
+// validators it came with. Configs may hold secrets, so only the user can
+// read it.
+func (r *remoteSource) save(data []byte, etag, lastModified string) error {
+	r.etag, r.lastModified = etag, lastModified
+	if err := os.MkdirAll(filepath.Dir(r.cache), 0700); err != nil {
+		return err
+	}
+	meta, err := json.MarshalIndent(remoteMeta{URL: r.url, ETag: etag, LastModified: lastModified, Fetched: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.cache, data, 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(r.cache+".json", meta, 0600)
+}
+
+// report logs a failure to fetch or load the config unless it is the one
+// reported last, so a failure lasting many polls is logged once
+func (r *remoteSource) report(err error) {
+	last := &r.configError
+	if isFetchError(err) {
+		last = &r.fetchError
+	} else {
+		err = fmt.Errorf("config at %s has errors:\n%w", r.url, err)
+	}
+	if msg := err.Error(); msg != *last {
+		*last = msg
+		fmt.Printf("[hz] %v; keeping the current configuration\n", err)
+	}
+}
+
+// fetched notes a successful fetch, reporting it after failures
+func (r *remoteSource) fetched() {
+	if r.fetchError != "" {
+		r.fetchError = ""
+		fmt.Printf("[hz] fetching %s works again\n", r.url)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadRemote fetches the remote config for the first load, falling back to
+// the cached copy when the server can't be reached
+func (m *Manager) loadRemote() error {
+	cached, fetched, cacheErr := m.remote.cached()
+	data, etag, lastModified, err := m.remote.fetch()
+	switch {
+	case err != nil && cacheErr != nil:
+		return fmt.Errorf("%w (and no cached copy)", err)
+	case err != nil:
+		fmt.Printf("[hz] %v; using the copy cached %s\n", err, fetched.Local().Format(time.DateTime))
+		m.remote.fetchError = err.Error()
+		m.data = cached
+		return m.Load()
+	case data == nil:
+		m.data = cached // not modified
+		return m.Load()
+	}
+
+	m.data = data
+	if err := m.Load(); err != nil {
+		return err
+	}
+	if err := m.remote.save(data, etag, lastModified); err != nil {
+		fmt.Printf("[hz] cannot cache the config: %v\n", err)
+	}
+	return nil
+}
+
+// refreshRemote fetches the remote config again and loads it if it changed.
+// It reports whether the configuration changed; on errors the current one
+// stays.
+func (m *Manager) refreshRemote() (bool, error) {
+	data, etag, lastModified, err := m.remote.fetch()
+	if err != nil {
+		return false, err
+	}
+	m.remote.fetched()
+	if data == nil {
+		return false, nil
+	}
+	if bytes.Equal(data, m.data) {
+		m.remote.configError = "" // back to the running config
+		if err := m.remote.save(data, etag, lastModified); err != nil {
+			fmt.Printf("[hz] cannot cache the config: %v\n", err)
+		}
+		return false, nil
+	}
+
+	previous := m.data
+	m.data = data
+	if err := m.Load(); err != nil {
+		m.data = previous
+		return false, err
+	}
+	m.remote.configError = ""
+	if err := m.remote.save(data, etag, lastModified); err != nil {
+		fmt.Printf("[hz] cannot cache the config: %v\n", err)
+	}
+	return true, nil
+}
+
+// pollLoop checks the remote config for changes every interval and
+// notifies the listeners of new configurations
+func (m *Manager) pollLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			m.poll()
+		}
+	}
+}
+
+// poll fetches the remote config once, reporting each failure once however
+// many polls it lasts
+func (m *Manager) poll() {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	changed, err := m.refreshRemote()
+	switch {
+	case err != nil:
+		m.remote.report(err)
+	case changed:
+		fmt.Println("[hz] configuration reloaded")
+		m.notify(m.Get())
+	}
+}
+
+// isFetchError reports whether err is about getting the remote config
+// rather than its contents
+func isFetchError(err error) bool {
+	_, problems := err.(Problems)
+	return !problems
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// ParseRouteArg parses a route argument like "path:/api/*", "header:x-service=api" or "host:app.test"
+func ParseRouteArg(arg string) types.RouteConfig {
+	route := types.RouteConfig{}
+
+	// Check for prefixed formats
+	if len(arg) > 7 && arg[:7] == "header:" {
+		route.Header = arg[7:]
+	} else if len(arg) > 10 && arg[:10] == "subdomain:" {
+		route.Subdomain = arg[10:]
+	} else if len(arg) > 5 && arg[:5] == "host:" {
+		route.Host = arg[5:]
+	} else if len(arg) > 6 && arg[:6] == "query:" {
+		route.Query = arg[6:]
+	} else if len(arg) > 7 && arg[:7] == "method:" {
+		for _, m := range strings.Split(arg[7:], ",") {
+			route.Methods = append(route.Methods, strings.ToUpper(strings.TrimSpace(m)))
+		}
+	} else if len(arg) > 5 && arg[:5] == "path:" {
+		route.Path = arg[5:]
+	} else {
+		// Default to path
+		route.Path = arg
+	}
+
+	return route
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zymawy/hz/internal/router"
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultInspectorPort is the port 'hz start --inspect' serves the web
+// inspector on unless --inspect-port says otherwise
+const DefaultInspectorPort = 4040
+
+// validateSemantics catches settings that parse fine but can't work: targets
+// that loop back into hz and routes that two services claim. Setups that are
+// legal but usually a mistake are returned as warnings.
+func validateSemantics(c *types.Config) []error {
+	// Disabled services are neither proxied to nor routed
+	active := c.ActiveServices()
+	var errs []error
+	for _, svc := range active {
+		errs = append(errs, checkTarget(c, svc)...)
+	}
+	return append(errs, checkDuplicateRoutes(active)...)
+}
+
+// checkTarget reports a service whose target is hz itself or a port hz uses
+func checkTarget(c *types.Config, svc *types.Service) []error {
+	u := svc.TargetURL
+	if u == nil || u.Host == "" {
+		return nil // replay and unparsed targets
+	}
+	port := targetPort(u)
+	if port == 0 {
+		return nil
+	}
+	local := isLocalHost(u.Hostname(), c.Server.Host)
+	at := servicePath(svc.Name, "target")
+
+	var errs []error
+	switch {
+	case port == c.Server.Port && local:
+		errs = append(errs, fieldErrorf(at, "service %s targets hz itself (%s), which would loop forever", svc.Name, u.Host))
+	case port == c.Server.Port:
+		errs = append(errs, warningf(at, "service %s uses hz's port %d on %s; if that is this machine, requests will loop", svc.Name, port, u.Hostname()))
+	}
+	if fp := c.Server.ForwardProxy; fp != nil && port == fp.Port && local {
+		errs = append(errs, fieldErrorf(at, "service %s targets hz's forward proxy (%s)", svc.Name, u.Host))
+	}
+	if port == DefaultInspectorPort && local {
+		errs = append(errs, warningf(at, "service %s targets port %d, where 'hz start --inspect' serves the web inspector", svc.Name, port))
+	}
+	return errs
+}
+
+// targetPort returns the explicit port of u or its scheme's default
+func targetPort(u *url.URL) int {
+	if p := u.Port(); p != "" {
+		n, _ := strconv.Atoi(p)
+		return n
+	}
+	switch u.Scheme {
+	case "http", "ws", "h2c":
+		return 80
+	case "https", "wss":
+		return 443
+	}
+	return 0
+}
+
+// isLocalHost reports whether host reaches the machine hz listens on
+func isLocalHost(host, listenHost string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	if listenHost != "" && !isUnspecified(listenHost) && strings.EqualFold(host, listenHost) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// isUnspecified reports whether host is a wildcard listen address
+func isUnspecified(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// checkDuplicateRoutes reports routes with identical matchers. Two services
+// claiming the same requests is an error since one of them can never get
+// them; a service repeating its own route is only a warning.
+func checkDuplicateRoutes(services []*types.Service) []error {
+	seen := make(map[string]string) // matchers -> first service
+
+	var errs []error
+	for _, svc := range services {
+		for i, route := range svc.Routes {
+			key := matcherKey(route)
+			if key == "" {
+				continue
+			}
+			at := servicePath(svc.Name, fmt.Sprintf("routes[%d]", i))
+			first, ok := seen[key]
+			switch {
+			case !ok:
+				seen[key] = svc.Name
+			case first == svc.Name:
+				errs = append(errs, warningf(at, "service %s lists route %s twice", svc.Name, router.DescribeRoute(route)))
+			default:
+				errs = append(errs, fieldErrorf(at, "route %s of service %s has the same matchers as a route of service %s; only %s would ever receive those requests",
+					router.DescribeRoute(route), svc.Name, first, first))
+			}
+		}
+	}
+	return errs
+}
+
+// matcherKey identifies what a route matches, ignoring what it does with the
+// request, or "" for a route that matches nothing on its own
+func matcherKey(route types.RouteConfig) string {
+	m := route
+	m.Priority = 0
+	m.Split = nil
+	m.StickyHeader = ""
+	m.Rewrite = nil
+	m.Maintenance = nil
+	if m.Method != "" {
+		m.Methods = append(append([]string(nil), m.Methods...), m.Method)
+		m.Method = ""
+	}
+	m.Methods = normalizeMethods(m.Methods)
+	m.ExcludeMethods = normalizeMethods(m.ExcludeMethods)
+
+	data, err := yaml.Marshal(m)
+	if err != nil || strings.TrimSpace(string(data)) == "{}" {
+		return ""
+	}
+	return string(data)
+}
+
+// normalizeMethods sorts and upper-cases methods so their order doesn't matter
+func normalizeMethods(methods []string) []string {
+	if len(methods) == 0 {
+		return nil
+	}
+	out := make([]string, len(methods))
+	for i, m := range methods {
+		out[i] = strings.ToUpper(strings.TrimSpace(m))
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestValidate asserts the message of each check hz config validate and
+// hz start run, errors and warnings alike
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string // every problem, as printed
+	}{
+		{
+			name: "valid",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:5173
+`,
+		},
+		{
+			name: "unknown field",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    targt: http://localhost:5173
+`,
+			want: []string{
+				"hz.yaml:3:5: service web has no target",
+				"hz.yaml:4:5: unknown field \"targt\" in services[0] (did you mean \"target\"?)",
+			},
+		},
+		{
+			name: "bad target URL",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: "http://local host:x"
+`,
+			want: []string{
+				"hz.yaml:4:13: invalid target URL for service web: parse \"http://local host:x\": invalid port \":x\" after host",
+			},
+		},
+		{
+			name: "duplicate names",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:5173
+  - name: web
+    target: http://localhost:5174
+`,
+			want: []string{
+				"hz.yaml:5:5: duplicate service name: web",
+			},
+		},
+		{
+			name: "invalid duration",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:5173
+    health:
+      interval: soon
+`,
+			want: []string{
+				"hz.yaml:6: invalid duration \"soon\" (use a value like 500ms, 30s or 5m)",
+			},
+		},
+		{
+			name: "targets hz itself",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://127.0.0.1:3000
+`,
+			want: []string{
+				"hz.yaml:4:13: service web targets hz itself (127.0.0.1:3000), which would loop forever",
+			},
+		},
+		{
+			name: "targets hz's port elsewhere",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://10.0.0.5:3000
+`,
+			want: []string{
+				"hz.yaml:4:13: warning: service web uses hz's port 3000 on 10.0.0.5; if that is this machine, requests will loop",
+			},
+		},
+		{
+			name: "targets the forward proxy",
+			config: `server:
+  port: 3000
+  forwardProxy: {port: 3128}
+services:
+  - name: web
+    target: http://localhost:3128
+`,
+			want: []string{
+				"hz.yaml:6:13: service web targets hz's forward proxy (localhost:3128)",
+			},
+		},
+		{
+			name: "targets the inspector",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:4040
+`,
+			want: []string{
+				"hz.yaml:4:13: warning: service web targets port 4040, where 'hz start --inspect' serves the web inspector",
+			},
+		},
+		{
+			name: "two services, same route",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:5173
+    routes:
+      - path: /app/*
+        methods: [get, post]
+  - name: api
+    target: http://localhost:8080
+    routes:
+      - path: /app/*
+        methods: [POST, GET]
+`,
+			want: []string{
+				"hz.yaml:11:9: route \"/app/*\" POST,GET of service api has the same matchers as a route of service web; only web would ever receive those requests",
+			},
+		},
+		{
+			name: "route listed twice",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:5173
+    routes:
+      - path: /app/*
+      - path: /app/*
+        priority: 5
+`,
+			want: []string{
+				"hz.yaml: warning: route \"/app/*\" on web is defined more than once",
+				"hz.yaml:7:9: warning: service web lists route \"/app/*\" twice",
+			},
+		},
+		{
+			name: "shadowed route",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:5173
+    routes:
+      - path: /app/*
+        priority: 10
+  - name: api
+    target: http://localhost:8080
+    routes:
+      - path: /app/api
+`,
+			want: []string{
+				"hz.yaml: warning: route \"/app/api\" on api is unreachable: shadowed by \"/app/*\" on web",
+			},
+		},
+		{
+			name: "trailing slashes with the strict policy",
+			config: `server: {port: 3000}
+services:
+  - name: web
+    target: http://localhost:5173
+    routes:
+      - path: /docs
+  - name: api
+    target: http://localhost:8080
+    routes:
+      - path: /docs/
+`,
+		},
+		{
+			name: "trailing slashes with the ignore policy",
+			config: `server:
+  port: 3000
+  trailingSlash: ignore
+services:
+  - name: web
+    target: http://localhost:5173
+    routes:
+      - path: /docs
+  - name: api
+    target: http://localhost:8080
+    routes:
+      - path: /docs/
+`,
+			want: []string{
+				"hz.yaml: warning: routes \"/docs/\" on web and api conflict; web always wins",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hz.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, problems := Validate(path)
+			got := make([]string, len(problems))
+			for i, p := range problems {
+				got[i] = p.String()
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
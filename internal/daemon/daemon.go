@@ -0,0 +1,209 @@
+// Package daemon runs hz in the background and finds it again through its
+// pidfile
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files of a background hz, relative to the directory it was started in
+var (
+	Dir       = ".hz"
+	PIDFile   = filepath.Join(Dir, "hz.pid")
+	LogFile   = filepath.Join(Dir, "hz.log")
+	StateFile = filepath.Join(Dir, "state.json")
+)
+
+// State is how the background hz was started, kept for hz restart
+type State struct {
+	Args []string `json:"args"` // the command line, without --daemon
+}
+
+// SaveState writes the state file at path
+func SaveState(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// LoadState reads the state file at path, or returns nil if there is none
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// Process is a running background hz
+type Process struct {
+	PID     int
+	Started time.Time // when the pidfile was written
+	token   string    // the process's start time, "" if the pidfile has none
+}
+
+// Uptime returns how long the process has been running
+func (p *Process) Uptime() time.Duration {
+	return time.Since(p.Started)
+}
+
+// running reports whether the process is still the one the pidfile named.
+// After hz exits its PID can be reused by an unrelated process, which has
+// a different start time.
+func (p *Process) running() bool {
+	if !alive(p.PID) {
+		return false
+	}
+	if p.token == "" {
+		return true
+	}
+	token, ok := startToken(p.PID)
+	return !ok || token == p.token
+}
+
+// Find returns the process the pidfile at path names, or nil if there is
+// no pidfile. A pidfile left behind by a process that is gone, or whose PID
+// now belongs to another process, is removed and counts as none.
+func Find(path string) (*Process, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := parsePID(data)
+	if !ok || !p.running() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale pidfile: %w", err)
+		}
+		return nil, nil
+	}
+	p.Started = info.ModTime()
+	return p, nil
+}
+
+// parsePID reads a pidfile: the PID, then the process's start time on a
+// second line. Pidfiles from earlier versions have only the PID.
+func parsePID(data []byte) (*Process, bool) {
+	first, token, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil || pid <= 0 {
+		return nil, false
+	}
+	return &Process{PID: pid, token: strings.TrimSpace(token)}, true
+}
+
+// WritePID records the current process in the pidfile at path. It replaces
+// the file in one step, so Find never reads half of it.
+func WritePID(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	content := strconv.Itoa(os.Getpid()) + "\n"
+	if token, ok := startToken(os.Getpid()); ok {
+		content += token + "\n"
+	}
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// RemovePID removes the pidfile at path if it still names the current
+// process, and not an hz that replaced it
+func RemovePID(path string) {
+	removePID(path, os.Getpid())
+}
+
+// removePID removes the pidfile at path if it names pid
+func removePID(path string, pid int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if p, ok := parsePID(data); ok && p.PID == pid {
+		_ = os.Remove(path)
+	}
+}
+
+// Spawn starts the hz executable with args, detached from the terminal,
+// with its output appended to logPath
+func Spawn(args []string, logPath string) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the hz executable: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close() // the child has its own copy
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start hz: %w", err)
+	}
+	return cmd, nil
+}
+
+// Stop asks the process to shut down and waits up to timeout for it to
+// exit. The pidfile at path is removed once it has, unless it names
+// another process by then.
+func Stop(p *Process, path string, timeout time.Duration) error {
+	// Never signal a process that took over the PID after hz exited
+	if !p.running() {
+		removePID(path, p.PID)
+		return nil
+	}
+	if err := terminate(p.PID); err != nil {
+		return fmt.Errorf("failed to stop hz (PID %d): %w", p.PID, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for p.running() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("hz (PID %d) didn't stop within %s", p.PID, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	removePID(path, p.PID)
+	return nil
+}
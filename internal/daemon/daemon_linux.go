@@ -0,0 +1,29 @@
+//go:build linux
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// startToken returns when the process with pid started, in clock ticks
+// since boot, from /proc/<pid>/stat
+func startToken(pid int) (string, bool) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", false
+	}
+	// The command name in parentheses may contain spaces; the fields after
+	// it start with the state, the third field, so starttime is at 22-3
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return "", false
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return "", false
+	}
+	return fields[19], true
+}
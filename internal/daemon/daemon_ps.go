@@ -0,0 +1,19 @@
+//go:build !linux && !windows
+
+package daemon
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// startToken returns when the process with pid started, as ps reports it
+func startToken(pid int) (string, bool) {
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", false
+	}
+	token := strings.Join(strings.Fields(string(out)), " ")
+	return token, token != ""
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	token, ok := startToken(os.Getpid())
+	if !ok {
+		t.Skip("process start times aren't available here")
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		found   bool
+	}{
+		{"pid and start time", self + "\n" + token + "\n", true},
+		{"pid only, from an earlier version", self + "\n", true},
+		{"pid reused by another process", self + "\n" + token + "0\n", false},
+		{"garbage", "hz\n", false},
+		{"no process", "999999999\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hz.pid")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			p, err := Find(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (p != nil) != tt.found {
+				t.Fatalf("Find = %+v, want found %v", p, tt.found)
+			}
+			_, err = os.Stat(path)
+			if kept := err == nil; kept != tt.found {
+				t.Errorf("pidfile kept %v, want %v", kept, tt.found)
+			}
+		})
+	}
+}
+
+func TestWritePID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hz.pid")
+	if err := WritePID(path); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Find(path)
+	if err != nil || p == nil || p.PID != os.Getpid() {
+		t.Fatalf("Find = %+v, %v; want this process", p, err)
+	}
+	if _, ok := startToken(os.Getpid()); ok && p.token == "" {
+		t.Error("pidfile has no start time")
+	}
+
+	RemovePID(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("RemovePID left the pidfile: %v", err)
+	}
+}
+
+// TestStopReusedPID checks that Stop doesn't signal a process that took
+// over the PID, here this test itself
+func TestStopReusedPID(t *testing.T) {
+	if _, ok := startToken(os.Getpid()); !ok {
+		t.Skip("process start times aren't available here")
+	}
+	path := filepath.Join(t.TempDir(), "hz.pid")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Process{PID: os.Getpid(), token: "not this process"}
+	if err := Stop(p, path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("stale pidfile kept: %v", err)
+	}
+}
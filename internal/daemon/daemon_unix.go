@@ -0,0 +1,26 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the process in a new session, away from the terminal's
+// signals
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// alive reports whether a process with pid exists
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// terminate sends SIGTERM, which hz answers with a graceful shutdown
+func terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
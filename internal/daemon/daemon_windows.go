@@ -0,0 +1,56 @@
+//go:build windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// Process creation and access flags from the Windows API
+const (
+	createNewProcessGroup          = 0x00000200
+	detachedProcess                = 0x00000008
+	processQueryLimitedInformation = 0x00001000
+)
+
+// detach starts the process without a console, in its own process group
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: createNewProcessGroup | detachedProcess}
+}
+
+// alive reports whether a process with pid exists
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// terminate kills the process: Windows can't deliver SIGTERM, so there is
+// no graceful shutdown
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+// startToken returns when the process with pid was created
+func startToken(pid int) (string, bool) {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return "", false
+	}
+	defer syscall.CloseHandle(h)
+	var created, exited, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return "", false
+	}
+	return strconv.FormatInt(created.Nanoseconds(), 10), true
+}
@@ -0,0 +1,253 @@
+// Package discovery registers services found at runtime, such as labelled
+// Docker containers
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// defaultDockerHost is used when neither the config nor DOCKER_HOST name one
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// retryInterval is how long to wait before reconnecting to Docker
+const retryInterval = 10 * time.Second
+
+// dockerEvents are the container events that can change the service list
+var dockerEvents = []string{"start", "die", "destroy", "pause", "unpause", "rename"}
+
+// container is the subset of the Docker container list entry hz reads
+type container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []struct {
+		IP          string `json:"IP"`
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+}
+
+// Docker discovers services from running containers labelled with
+// <prefix>.name, <prefix>.port and <prefix>.route
+type Docker struct {
+	prefix  string
+	client  *http.Client
+	baseURL string
+	logger  *log.Logger
+
+	mu        sync.Mutex
+	services  []*types.Service
+	signature string
+	onChange  func()
+	offline   bool            // a connection failure has been reported
+	skipped   map[string]bool // containers already reported as unusable
+}
+
+// NewDocker creates a Docker discoverer for the given config
+func NewDocker(cfg *types.DockerDiscoveryConfig) (*Docker, error) {
+	host := cfg.Host
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	d := &Docker{
+		prefix:  cfg.LabelPrefix,
+		logger:  log.Default(),
+		skipped: make(map[string]bool),
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		d.baseURL = "http://docker"
+		d.client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}}
+	case "tcp", "http":
+		d.baseURL = "http://" + u.Host
+		d.client = &http.Client{}
+	case "https":
+		d.baseURL = "https://" + u.Host
+		d.client = &http.Client{}
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q (use unix://, tcp:// or https://)", host)
+	}
+
+	return d, nil
+}
+
+// SetLogger sets the logger for discovery messages
+func (d *Docker) SetLogger(logger *log.Logger) {
+	d.logger = logger
+}
+
+// OnChange registers a callback invoked whenever the discovered services change
+func (d *Docker) OnChange(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onChange = fn
+}
+
+// Services returns the services currently discovered
+func (d *Docker) Services() []*types.Service {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.services
+}
+
+// Run watches Docker until ctx is cancelled, reconnecting when the daemon is
+// unreachable. Discovered services are kept while Docker is away.
+func (d *Docker) Run(ctx context.Context) {
+	for {
+		err := d.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		d.mu.Lock()
+		if !d.offline {
+			d.logger.Printf("[discovery] docker unavailable, retrying every %s: %v", retryInterval, err)
+			d.offline = true
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// watch subscribes to container events, syncs, and re-syncs on every event
+// until the stream ends
+func (d *Docker) watch(ctx context.Context) error {
+	filters, _ := json.Marshal(map[string][]string{
+		"type":  {"container"},
+		"event": dockerEvents,
+	})
+	resp, err := d.get(ctx, "/events?filters="+url.QueryEscape(string(filters)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Subscribe before listing so no container start is missed in between
+	if err := d.sync(ctx); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if d.offline {
+		d.logger.Printf("[discovery] connected to docker")
+		d.offline = false
+	}
+	d.mu.Unlock()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event json.RawMessage
+		if err := dec.Decode(&event); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("event stream closed")
+			}
+			return err
+		}
+		if err := d.sync(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// get performs a GET against the Docker API and checks the status
+func (d *Docker) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// Report "dial unix ...: no such file" rather than the whole request URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("docker API %s: status %d", path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// sync lists running containers and publishes the services they describe if
+// anything changed
+func (d *Docker) sync(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := d.get(ctx, "/containers/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var containers []container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return fmt.Errorf("decode container list: %w", err)
+	}
+
+	services := d.fromContainers(containers)
+
+	var sig strings.Builder
+	names := make([]string, 0, len(services))
+	for _, svc := range services {
+		fmt.Fprintf(&sig, "%s %s %v\n", svc.Name, svc.Target, svc.Routes)
+		names = append(names, svc.Name)
+	}
+
+	d.mu.Lock()
+	if sig.String() == d.signature {
+		d.mu.Unlock()
+		return nil
+	}
+	d.services = services
+	d.signature = sig.String()
+	onChange := d.onChange
+	d.mu.Unlock()
+
+	d.logger.Printf("[discovery] docker services: [%s]", strings.Join(names, ", "))
+
+	if onChange != nil {
+		onChange()
+	}
+	return nil
+}
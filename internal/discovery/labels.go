@@ -0,0 +1,157 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// fromContainers builds services from the labelled, running containers.
+// Containers that can't be turned into a service are reported once and skipped.
+func (d *Docker) fromContainers(containers []container) []*types.Service {
+	// Stable order, so the first container keeps a contested name
+	sort.Slice(containers, func(i, j int) bool { return containers[i].ID < containers[j].ID })
+
+	var services []*types.Service
+	names := make(map[string]bool)
+	for _, c := range containers {
+		if c.State != "" && c.State != "running" {
+			continue
+		}
+		svc, err := d.service(c)
+		if err == nil && svc == nil {
+			continue // not labelled for hz
+		}
+		if err == nil && names[svc.Name] {
+			err = fmt.Errorf("service name %q is already used by another container", svc.Name)
+		}
+		if err != nil {
+			d.mu.Lock()
+			if !d.skipped[c.ID] {
+				d.logger.Printf("[discovery] skipping container %s: %v", containerName(c), err)
+				d.skipped[c.ID] = true
+			}
+			d.mu.Unlock()
+			continue
+		}
+		names[svc.Name] = true
+		services = append(services, svc)
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+// service maps a container's labels to a service, or returns nil if the
+// container has no labels with the discovery prefix
+func (d *Docker) service(c container) (*types.Service, error) {
+	prefix := d.prefix + "."
+	var routeKeys []string
+	labelled := false
+	for key := range c.Labels {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		labelled = true
+		if key == prefix+"route" || strings.HasPrefix(key, prefix+"route.") {
+			routeKeys = append(routeKeys, key)
+		}
+	}
+	if !labelled {
+		return nil, nil
+	}
+
+	name := c.Labels[prefix+"name"]
+	if name == "" {
+		name = containerName(c)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no %sname label and no container name", prefix)
+	}
+
+	hostPort, err := d.publishedPort(c)
+	if err != nil {
+		return nil, err
+	}
+
+	target := "http://" + hostPort
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// hz.route comes first, then hz.route.<anything> in key order
+	sort.Strings(routeKeys)
+	var routes []types.RouteConfig
+	for _, key := range routeKeys {
+		if spec := strings.TrimSpace(c.Labels[key]); spec != "" {
+			routes = append(routes, config.ParseRouteArg(spec))
+		}
+	}
+
+	return &types.Service{
+		Name:      name,
+		Target:    target,
+		TargetURL: targetURL,
+		Routes:    routes,
+		Dynamic:   true,
+		Status:    types.HealthStatusUnknown,
+	}, nil
+}
+
+// publishedPort returns the host address that reaches the container port
+// named by the port label, or the only published TCP port if there is no label
+func (d *Docker) publishedPort(c container) (string, error) {
+	label := d.prefix + ".port"
+	want := 0
+	if v := c.Labels[label]; v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p <= 0 {
+			return "", fmt.Errorf("invalid %s label %q", label, v)
+		}
+		want = p
+	}
+
+	var found []string
+	for _, p := range c.Ports {
+		if p.Type != "tcp" || p.PublicPort == 0 {
+			continue
+		}
+		if want != 0 && p.PrivatePort != want {
+			continue
+		}
+		ip := p.IP
+		if ip == "" || ip == "0.0.0.0" || ip == "::" {
+			ip = "127.0.0.1"
+		}
+		addr := net.JoinHostPort(ip, strconv.Itoa(p.PublicPort))
+		// IPv4 and IPv6 bindings of the same port count once
+		if len(found) == 0 || found[len(found)-1] != addr {
+			found = append(found, addr)
+		}
+	}
+
+	switch {
+	case len(found) == 0 && want != 0:
+		return "", fmt.Errorf("container port %d is not published", want)
+	case len(found) == 0:
+		return "", fmt.Errorf("no published TCP port")
+	case len(found) > 1 && want == 0:
+		return "", fmt.Errorf("several published ports; set %s to choose one", label)
+	}
+	return found[0], nil
+}
+
+// containerName returns the container's name without Docker's leading slash
+func containerName(c container) string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
@@ -0,0 +1,450 @@
+package inspector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatHAR     = "har"
+	FormatNDJSON  = "ndjson"
+	FormatOpenAPI = "openapi"
+)
+
+// ExportFormats lists the formats /api/export writes
+var ExportFormats = []string{FormatHAR, FormatNDJSON, FormatOpenAPI}
+
+// Headers describing an export, sent before its body
+const (
+	ExportCountHeader = "X-Hz-Export-Entries"
+	ExportFromHeader  = "X-Hz-Export-From" // RFC 3339, the first entry's time
+	ExportToHeader    = "X-Hz-Export-To"   // RFC 3339, the last entry's time
+)
+
+// ExportFilter selects the captured requests to export
+type ExportFilter struct {
+	Service string    // only this service's requests, if set
+	Since   time.Time // only requests from then on, if set
+}
+
+// Snapshot returns the captured requests f selects, oldest first
+func (i *Inspector) Snapshot(f ExportFilter) []Request {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var out []Request
+	for n := len(i.requests) - 1; n >= 0; n-- {
+		req := i.requests[n]
+		if f.Service != "" && req.Service != f.Service {
+			continue
+		}
+		if !f.Since.IsZero() && req.Timestamp.Before(f.Since) {
+			continue
+		}
+		out = append(out, req)
+	}
+	return out
+}
+
+// SetVersion sets the hz version exports name as their creator
+func (i *Inspector) SetVersion(v string) {
+	i.version = v
+}
+
+// handleExport writes the captured requests as a file:
+// ?format=har|ndjson|openapi, with ?service=name and ?since=1h to select
+// them. The entry count and time range come in headers first.
+func (i *Inspector) handleExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = FormatHAR
+	}
+	if !slices.Contains(ExportFormats, format) {
+		http.Error(w, fmt.Sprintf("unknown format %q; use %s", format, strings.Join(ExportFormats, ", ")), http.StatusBadRequest)
+		return
+	}
+	f := ExportFilter{Service: q.Get("service")}
+	if since := q.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid since %q; use a duration like 1h", since), http.StatusBadRequest)
+			return
+		}
+		f.Since = time.Now().Add(-d)
+	}
+
+	reqs := i.Snapshot(f)
+	w.Header().Set(ExportCountHeader, strconv.Itoa(len(reqs)))
+	if len(reqs) > 0 {
+		w.Header().Set(ExportFromHeader, reqs[0].Timestamp.Format(time.RFC3339))
+		w.Header().Set(ExportToHeader, reqs[len(reqs)-1].Timestamp.Format(time.RFC3339))
+	}
+
+	switch format {
+	case FormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_ = WriteNDJSON(w, reqs)
+	case FormatOpenAPI:
+		w.Header().Set("Content-Type", "application/json")
+		_ = WriteOpenAPI(w, reqs)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = WriteHAR(w, reqs, i.version)
+	}
+}
+
+// WriteNDJSON writes one request per line, flushing each to a streaming
+// writer as it goes
+func WriteNDJSON(w io.Writer, reqs []Request) error {
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for _, req := range reqs {
+		if err := enc.Encode(req); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return nil
+}
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/), the fields hz
+// knows
+type (
+	harLog struct {
+		Log harContent `json:"log"`
+	}
+	harContent struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	harEntry struct {
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Service         string      `json:"_service,omitempty"`
+		Source          string      `json:"_source,omitempty"`
+		Error           string      `json:"_error,omitempty"`
+	}
+	harRequest struct {
+		Method      string       `json:"method"`
+		URL         string       `json:"url"`
+		HTTPVersion string       `json:"httpVersion"`
+		Cookies     []harPair    `json:"cookies"`
+		Headers     []harPair    `json:"headers"`
+		QueryString []harPair    `json:"queryString"`
+		PostData    *harPostData `json:"postData,omitempty"`
+		HeadersSize int          `json:"headersSize"`
+		BodySize    int64        `json:"bodySize"`
+	}
+	harResponse struct {
+		Status      int       `json:"status"`
+		StatusText  string    `json:"statusText"`
+		HTTPVersion string    `json:"httpVersion"`
+		Cookies     []harPair `json:"cookies"`
+		Headers     []harPair `json:"headers"`
+		Content     harBody   `json:"content"`
+		RedirectURL string    `json:"redirectURL"`
+		HeadersSize int       `json:"headersSize"`
+		BodySize    int       `json:"bodySize"`
+	}
+	harPair struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	harBody struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+	}
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+)
+
+// WriteHAR writes the requests as a HAR 1.2 log, created by hz version
+func WriteHAR(w io.Writer, reqs []Request, version string) error {
+	if version == "" {
+		version = "dev"
+	}
+	doc := harLog{Log: harContent{
+		Version: "1.2",
+		Creator: harCreator{Name: "hz", Version: version},
+		Entries: make([]harEntry, 0, len(reqs)),
+	}}
+
+	for _, req := range reqs {
+		scheme := req.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		u := url.URL{Scheme: scheme, Host: req.Host, Path: req.Path, RawQuery: req.Query}
+		ms := float64(req.Duration.Microseconds()) / 1000
+
+		entry := harEntry{
+			StartedDateTime: req.Timestamp.Add(-req.Duration).Format(time.RFC3339Nano),
+			Time:            ms,
+			Request: harRequest{
+				Method:      req.Method,
+				URL:         u.String(),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harPair{},
+				Headers:     harHeaders(req.Headers),
+				QueryString: harQuery(req.Query),
+				HeadersSize: -1,
+				BodySize:    req.ContentLength,
+			},
+			Response: harResponse{
+				Status:      req.StatusCode,
+				StatusText:  http.StatusText(req.StatusCode),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harPair{},
+				Headers:     harHeaders(req.ResponseHeaders),
+				Content: harBody{
+					Size:     len(req.ResponseBody),
+					MimeType: firstHeader(req.ResponseHeaders, "Content-Type"),
+					Text:     req.ResponseBody,
+				},
+				RedirectURL: firstHeader(req.ResponseHeaders, "Location"),
+				HeadersSize: -1,
+				BodySize:    len(req.ResponseBody),
+			},
+			Timings: harTimings{Wait: ms},
+			Service: req.Service,
+			Source:  req.Source,
+			Error:   req.Error,
+		}
+		if req.RequestBody != "" {
+			entry.Request.PostData = &harPostData{MimeType: req.ContentType, Text: req.RequestBody}
+		}
+		doc.Log.Entries = append(doc.Log.Entries, entry)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// harHeaders lists headers sorted by name
+func harHeaders(h map[string][]string) []harPair {
+	pairs := []harPair{}
+	for _, name := range sortedKeys(h) {
+		for _, v := range h[name] {
+			pairs = append(pairs, harPair{Name: name, Value: v})
+		}
+	}
+	return pairs
+}
+
+// harQuery lists a query's parameters in order
+func harQuery(rawQuery string) []harPair {
+	pairs := []harPair{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		name, _ = url.QueryUnescape(name)
+		value, _ = url.QueryUnescape(value)
+		pairs = append(pairs, harPair{Name: name, Value: value})
+	}
+	return pairs
+}
+
+// firstHeader returns the first value of a header, by its canonical name
+func firstHeader(h map[string][]string, name string) string {
+	if v := h[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// sortedKeys returns a map's keys in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// OpenAPI 3.0 (https://spec.openapis.org/oas/v3.0.3), as much as traffic
+// shows
+type (
+	openAPIDoc struct {
+		OpenAPI string                                  `json:"openapi"`
+		Info    openAPIInfo                             `json:"info"`
+		Paths   map[string]map[string]*openAPIOperation `json:"paths"`
+	}
+	openAPIInfo struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	}
+	openAPIOperation struct {
+		Tags        []string                    `json:"tags,omitempty"`
+		Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+		RequestBody *openAPIBody                `json:"requestBody,omitempty"`
+		Responses   map[string]*openAPIResponse `json:"responses"`
+	}
+	openAPIParameter struct {
+		Name     string        `json:"name"`
+		In       string        `json:"in"`
+		Required bool          `json:"required,omitempty"`
+		Schema   openAPISchema `json:"schema"`
+	}
+	openAPIBody struct {
+		Content map[string]openAPIMedia `json:"content"`
+	}
+	openAPIResponse struct {
+		Description string                  `json:"description"`
+		Content     map[string]openAPIMedia `json:"content,omitempty"`
+	}
+	openAPIMedia struct {
+		Schema openAPISchema `json:"schema"`
+	}
+	openAPISchema struct {
+		Type string `json:"type,omitempty"`
+	}
+)
+
+// idSegment matches path segments that are identifiers rather than names:
+// numbers, UUIDs and long hex strings
+var idSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{24,})$`)
+
+// WriteOpenAPI writes an OpenAPI 3.0 document of the paths, methods, query
+// parameters and responses seen in the requests. Identifier segments, like
+// /users/42, become parameters: /users/{id}.
+func WriteOpenAPI(w io.Writer, reqs []Request) error {
+	doc := openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "Captured API",
+			Version:     "1.0.0",
+			Description: "Generated by hz from captured traffic",
+		},
+		Paths: make(map[string]map[string]*openAPIOperation),
+	}
+
+	for _, req := range reqs {
+		if req.StatusCode == 0 || req.Label != "" {
+			continue // answered by hz itself, not the API
+		}
+		path, params := templatePath(req.Path)
+		ops := doc.Paths[path]
+		if ops == nil {
+			ops = make(map[string]*openAPIOperation)
+			doc.Paths[path] = ops
+		}
+		method := strings.ToLower(req.Method)
+		op := ops[method]
+		if op == nil {
+			op = &openAPIOperation{Responses: make(map[string]*openAPIResponse)}
+			if req.Service != "" {
+				op.Tags = []string{req.Service}
+			}
+			for _, name := range params {
+				op.Parameters = append(op.Parameters, openAPIParameter{Name: name, In: "path", Required: true, Schema: openAPISchema{Type: "string"}})
+			}
+			ops[method] = op
+		}
+
+		for _, q := range harQuery(req.Query) {
+			if !slices.ContainsFunc(op.Parameters, func(p openAPIParameter) bool { return p.In == "query" && p.Name == q.Name }) {
+				op.Parameters = append(op.Parameters, openAPIParameter{Name: q.Name, In: "query", Schema: openAPISchema{Type: "string"}})
+			}
+		}
+		if req.ContentType != "" && req.RequestBody != "" {
+			if op.RequestBody == nil {
+				op.RequestBody = &openAPIBody{Content: make(map[string]openAPIMedia)}
+			}
+			op.RequestBody.Content[mediaType(req.ContentType)] = openAPIMedia{Schema: bodySchema(req.RequestBody)}
+		}
+
+		code := strconv.Itoa(req.StatusCode)
+		resp := op.Responses[code]
+		if resp == nil {
+			resp = &openAPIResponse{Description: http.StatusText(req.StatusCode)}
+			op.Responses[code] = resp
+		}
+		if ct := firstHeader(req.ResponseHeaders, "Content-Type"); ct != "" && req.ResponseBody != "" {
+			if resp.Content == nil {
+				resp.Content = make(map[string]openAPIMedia)
+			}
+			resp.Content[mediaType(ct)] = openAPIMedia{Schema: bodySchema(req.ResponseBody)}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// templatePath replaces identifier segments with {id}, {id2}... and
+// returns the parameter names
+func templatePath(p string) (string, []string) {
+	segments := strings.Split(p, "/")
+	var params []string
+	for i, s := range segments {
+		if idSegment.MatchString(s) {
+			name := "id"
+			if len(params) > 0 {
+				name += strconv.Itoa(len(params) + 1)
+			}
+			segments[i] = "{" + name + "}"
+			params = append(params, name)
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// mediaType strips parameters like charset from a content type
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.TrimSpace(mt)
+}
+
+// bodySchema gives a body's JSON type, or string for other bodies
+func bodySchema(body string) openAPISchema {
+	var v any
+	if json.Unmarshal([]byte(body), &v) != nil {
+		return openAPISchema{Type: "string"}
+	}
+	switch v.(type) {
+	case map[string]any:
+		return openAPISchema{Type: "object"}
+	case []any:
+		return openAPISchema{Type: "array"}
+	case float64:
+		return openAPISchema{Type: "number"}
+	case bool:
+		return openAPISchema{Type: "boolean"}
+	}
+	return openAPISchema{Type: "string"}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -35,8 +36,25 @@ type Request struct {
 	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
 	ContentType     string              `json:"content_type,omitempty"`
 	Scheme          string              `json:"scheme,omitempty"`
+	RewrittenURL    string              `json:"rewritten_url,omitempty"` // upstream path and query after rewrites
+	Label           string              `json:"label,omitempty"`         // why hz answered the request itself
+	Source          string              `json:"source,omitempty"`        // SourceTunnel or SourceLocal
 }
 
+// Sources of requests: through the tunnel, or from a local client
+const (
+	SourceTunnel = "tunnel"
+	SourceLocal  = "local"
+)
+
+// Labels for requests answered by hz itself
+const (
+	LabelNoRoute     = "no_route"    // no route matched
+	LabelMaintenance = "maintenance" // the route or service is under maintenance
+	LabelStarting    = "starting"    // the managed backend process is not up yet
+	LabelNotReady    = "not_ready"   // the readiness gate holds requests until the first healthy check
+)
+
 // Inspector captures and displays HTTP requests
 type Inspector struct {
 	requests   []Request
@@ -48,6 +66,7 @@ type Inspector struct {
 	clients    map[chan Request]bool
 	clientsMu  sync.RWMutex
 	requestSeq int
+	version    string // hz's, for exports
 }
 
 // New creates a new inspector
@@ -107,6 +126,7 @@ func (i *Inspector) Start() error {
 	mux.HandleFunc("/api/requests/sse", i.handleSSE)
 	mux.HandleFunc("/api/requests/clear", i.handleClear)
 	mux.HandleFunc("/api/request/", i.handleRequestDetail)
+	mux.HandleFunc("/api/export", i.handleExport)
 
 	addr := fmt.Sprintf("127.0.0.1:%d", i.port)
 	i.server = &http.Server{
@@ -114,10 +134,16 @@ func (i *Inspector) Start() error {
 		Handler: mux,
 	}
 
+	// Listen first so a port in use is reported to the caller
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("inspector: %w", err)
+	}
+
 	i.logger.Printf("[inspector] Web inspector available at http://%s", addr)
 
 	go func() {
-		if err := i.server.ListenAndServe(); err != http.ErrServerClosed {
+		if err := i.server.Serve(ln); err != http.ErrServerClosed {
 			i.logger.Printf("[inspector] server error: %v", err)
 		}
 	}()
@@ -125,6 +151,11 @@ func (i *Inspector) Start() error {
 	return nil
 }
 
+// URL returns the address of the inspector's web interface and API
+func (i *Inspector) URL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d", i.port)
+}
+
 // Stop stops the inspector server
 func (i *Inspector) Stop() {
 	if i.server != nil {
@@ -142,16 +173,28 @@ func (i *Inspector) handleUI(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleRequests returns captured requests as JSON
+// handleRequests returns captured requests as JSON, only those from one
+// source with ?source=tunnel or ?source=local
 func (i *Inspector) handleRequests(w http.ResponseWriter, r *http.Request) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
+	requests := i.requests
+	if source := r.URL.Query().Get("source"); source != "" {
+		requests = make([]Request, 0, len(i.requests))
+		for _, req := range i.requests {
+			if req.Source == source {
+				requests = append(requests, req)
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(i.requests)
+	_ = json.NewEncoder(w).Encode(requests)
 }
 
-// handleSSE provides server-sent events for live updates
+// handleSSE provides server-sent events for live updates: the captured
+// requests, then each new one. ?history=false sends only new ones.
 func (i *Inspector) handleSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -178,12 +221,14 @@ func (i *Inspector) handleSSE(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// Send initial data
-	i.mu.RLock()
-	for _, req := range i.requests {
-		data, _ := json.Marshal(req)
-		fmt.Fprintf(w, "data: %s\n\n", data)
+	if r.URL.Query().Get("history") != "false" {
+		i.mu.RLock()
+		for _, req := range i.requests {
+			data, _ := json.Marshal(req)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		i.mu.RUnlock()
 	}
-	i.mu.RUnlock()
 	flusher.Flush()
 
 	// Stream new requests
@@ -304,6 +349,11 @@ const inspectorHTML = `<!DOCTYPE html>
             </div>
         </div>
         <div class="flex-none gap-3">
+            <select class="select select-bordered select-sm" id="source-filter" onchange="renderRequests()">
+                <option value="">All sources</option>
+                <option value="tunnel">Tunnel</option>
+                <option value="local">Local</option>
+            </select>
             <div class="flex items-center gap-2 text-success text-sm font-medium">
                 <span class="w-2 h-2 rounded-full bg-success animate-pulse-live"></span>
                 Live
@@ -346,13 +396,14 @@ const inspectorHTML = `<!DOCTYPE html>
                                     <th>Method</th>
                                     <th>Path</th>
                                     <th>Service</th>
+                                    <th>Source</th>
                                     <th>Status</th>
                                     <th>Duration</th>
                                 </tr>
                             </thead>
                             <tbody id="requests-body">
                                 <tr>
-                                    <td colspan="6" class="text-center py-16 text-base-content/50">
+                                    <td colspan="7" class="text-center py-16 text-base-content/50">
                                         <svg class="w-12 h-12 mx-auto mb-4 opacity-50" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="1.5"><path d="M12 6v6l4 2"/><circle cx="12" cy="12" r="10"/></svg>
                                         <div class="text-lg">Waiting for requests...</div>
                                         <div class="text-sm mt-2">Make HTTP requests through the proxy to see them here</div>
@@ -416,10 +467,18 @@ const inspectorHTML = `<!DOCTYPE html>
                         <div class="text-xs text-base-content/50 uppercase tracking-wider font-semibold mb-1">Target</div>
                         <div class="font-mono text-sm break-all" id="info-target">-</div>
                     </div>
+                    <div class="bg-base-200 p-4 rounded-lg border border-base-300">
+                        <div class="text-xs text-base-content/50 uppercase tracking-wider font-semibold mb-1">Rewritten To</div>
+                        <div class="font-mono text-sm break-all" id="info-rewritten">-</div>
+                    </div>
                     <div class="bg-base-200 p-4 rounded-lg border border-base-300">
                         <div class="text-xs text-base-content/50 uppercase tracking-wider font-semibold mb-1">Remote Address</div>
                         <div class="font-mono text-sm" id="info-remote">-</div>
                     </div>
+                    <div class="bg-base-200 p-4 rounded-lg border border-base-300">
+                        <div class="text-xs text-base-content/50 uppercase tracking-wider font-semibold mb-1">Source</div>
+                        <div class="font-mono text-sm" id="info-source">-</div>
+                    </div>
                     <div class="bg-base-200 p-4 rounded-lg border border-base-300">
                         <div class="text-xs text-base-content/50 uppercase tracking-wider font-semibold mb-1">Content Type</div>
                         <div class="font-mono text-sm" id="info-content-type">-</div>
@@ -625,34 +684,37 @@ const inspectorHTML = `<!DOCTYPE html>
 
         function renderRequests() {
             const tbody = document.getElementById('requests-body');
+            const source = document.getElementById('source-filter').value;
+            const shown = requests.filter(r => !source || r.source === source);
+
+            // Update stats
+            document.getElementById('total-count').textContent = shown.length;
+
+            const durations = shown.filter(r => r.duration_ms).map(r => r.duration_ms);
+            const avgDuration = durations.length > 0
+                ? (durations.reduce((a, b) => a + b, 0) / durations.length).toFixed(1)
+                : 0;
+            document.getElementById('avg-duration').textContent = avgDuration + 'ms';
+
+            const errors = shown.filter(r => r.status_code >= 400).length;
+            document.getElementById('error-count').textContent = errors;
 
-            if (requests.length === 0) {
-                tbody.innerHTML = '<tr><td colspan="6" class="text-center text-base-content/50 py-8">Waiting for requests...</td></tr>';
+            if (shown.length === 0) {
+                tbody.innerHTML = '<tr><td colspan="7" class="text-center text-base-content/50 py-8">Waiting for requests...</td></tr>';
                 return;
             }
 
-            tbody.innerHTML = requests.map(req => ` + "`" + `
+            tbody.innerHTML = shown.map(req => ` + "`" + `
                 <tr onclick="selectRequest('${req.id}')" class="hover cursor-pointer ${selectedRequest && selectedRequest.id === req.id ? 'bg-primary/10' : ''}">
                     <td class="font-mono text-sm opacity-70">${formatTime(req.timestamp)}</td>
                     <td><span class="badge badge-sm ${getMethodClass(req.method)}">${req.method}</span></td>
                     <td class="font-mono text-sm max-w-xs truncate" title="${req.path}${req.query ? '?' + req.query : ''}">${req.path}${req.query ? '?' + req.query : ''}</td>
-                    <td><span class="badge badge-sm badge-outline">${req.service || 'unknown'}</span></td>
+                    <td><span class="badge badge-sm badge-outline ${req.label ? 'badge-warning' : ''}">${req.service ? req.service + (req.label ? ' · ' + req.label : '') : (req.label || 'unknown')}</span></td>
+                    <td><span class="badge badge-sm ${req.source === 'tunnel' ? 'badge-accent' : 'badge-ghost'}">${req.source || '-'}</span></td>
                     <td><span class="badge badge-sm ${getStatusClass(req.status_code)}">${req.status_code || '-'}</span></td>
                     <td class="font-mono text-sm">${req.duration_ms ? req.duration_ms.toFixed(1) + 'ms' : '-'}</td>
                 </tr>
             ` + "`" + `).join('');
-
-            // Update stats
-            document.getElementById('total-count').textContent = requests.length;
-
-            const durations = requests.filter(r => r.duration_ms).map(r => r.duration_ms);
-            const avgDuration = durations.length > 0
-                ? (durations.reduce((a, b) => a + b, 0) / durations.length).toFixed(1)
-                : 0;
-            document.getElementById('avg-duration').textContent = avgDuration + 'ms';
-
-            const errors = requests.filter(r => r.status_code >= 400).length;
-            document.getElementById('error-count').textContent = errors;
         }
 
         function selectRequest(id) {
@@ -679,9 +741,11 @@ const inspectorHTML = `<!DOCTYPE html>
             document.getElementById('info-url').textContent = scheme + '://' + req.host + req.path + (req.query ? '?' + req.query : '');
             document.getElementById('info-status').innerHTML = '<span class="badge ' + getStatusClass(req.status_code) + '">' + (req.status_code || '-') + '</span>';
             document.getElementById('info-duration').textContent = req.duration_ms ? req.duration_ms.toFixed(2) + 'ms' : '-';
-            document.getElementById('info-service').textContent = req.service || '-';
+            document.getElementById('info-service').textContent = [req.service, req.label].filter(Boolean).join(' · ') || '-';
             document.getElementById('info-target').textContent = req.target || '-';
+            document.getElementById('info-rewritten').textContent = req.rewritten_url || '-';
             document.getElementById('info-remote').textContent = req.remote_addr || '-';
+            document.getElementById('info-source').textContent = req.source || '-';
             document.getElementById('info-content-type').textContent = req.content_type || '-';
             document.getElementById('info-timestamp').textContent = formatFullTime(req.timestamp);
 
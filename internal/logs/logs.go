@@ -0,0 +1,235 @@
+// Package logs keeps the recent log lines of a running hz for hz logs
+package logs
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of lines a Buffer keeps unless configured
+const DefaultSize = 1000
+
+// Log levels. hz logs plain lines, so a line's level is guessed from its
+// tag and wording.
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Levels lists the levels from least to most severe
+var Levels = []string{LevelInfo, LevelWarn, LevelError}
+
+// Entry is one log line
+type Entry struct {
+	Seq     int64     `json:"seq"` // counts up from 1 in each Buffer
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Tag     string    `json:"tag,omitempty"` // "tunnel" in "[tunnel] ...", or a service name for its output
+	Message string    `json:"message"`       // the text after the tag
+	Line    string    `json:"line"`          // as printed
+}
+
+// About reports whether an entry is about a service: its process output,
+// tagged with the service name, or a message that starts with the name,
+// like "[process] api exited"
+func (e Entry) About(service string) bool {
+	return e.Tag == service || e.Message == service || strings.HasPrefix(e.Message, service+" ")
+}
+
+// AtLeast reports whether an entry's level is level or more severe
+func (e Entry) AtLeast(level string) bool {
+	return rank(e.Level) >= rank(level)
+}
+
+// rank orders levels; unknown ones count as info
+func rank(level string) int {
+	return max(slices.Index(Levels, level), 0)
+}
+
+// Buffer is an io.Writer for a log.Logger that keeps the last lines written
+// and passes new ones to followers
+type Buffer struct {
+	mu        sync.Mutex
+	entries   []Entry // ring of up to size entries, oldest at start
+	start     int
+	size      int
+	seq       int64
+	partial   []byte // a line not yet ended
+	followers map[chan Entry]struct{}
+	closed    bool
+	started   time.Time
+}
+
+// NewBuffer returns a Buffer keeping size lines, or DefaultSize if size < 1
+func NewBuffer(size int) *Buffer {
+	if size < 1 {
+		size = DefaultSize
+	}
+	return &Buffer{size: size, followers: make(map[chan Entry]struct{}), started: time.Now()}
+}
+
+// Session identifies the Buffer, so a client following one can tell that
+// hz restarted and the sequence numbers started over
+func (b *Buffer) Session() string {
+	return b.started.UTC().Format("20060102T150405.000000000")
+}
+
+// Write records each complete line of p
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.add(string(bytes.TrimRight(data[:i], "\r")))
+		data = data[i+1:]
+	}
+	b.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// add records a line and sends it to the followers; b.mu is held
+func (b *Buffer) add(line string) {
+	b.seq++
+	e := parse(line)
+	e.Seq, e.Time = b.seq, time.Now()
+
+	if len(b.entries) < b.size {
+		b.entries = append(b.entries, e)
+	} else {
+		b.entries[b.start] = e
+		b.start = (b.start + 1) % b.size
+	}
+
+	for ch := range b.followers {
+		select {
+		case ch <- e:
+		default: // a follower too slow to keep up misses lines
+		}
+	}
+}
+
+// Resize keeps size lines from now on, dropping the oldest if there are
+// more
+func (b *Buffer) Resize(size int) {
+	if size < 1 {
+		size = DefaultSize
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := b.ordered()
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	b.entries, b.start, b.size = entries, 0, size
+}
+
+// Since returns the kept entries after seq, oldest first
+func (b *Buffer) Since(seq int64) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.after(seq)
+}
+
+// after returns the kept entries after seq, oldest first; b.mu is held
+func (b *Buffer) after(seq int64) []Entry {
+	var out []Entry
+	for _, e := range b.ordered() {
+		if e.Seq > seq {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// ordered returns the entries oldest first; b.mu is held
+func (b *Buffer) ordered() []Entry {
+	out := make([]Entry, 0, len(b.entries))
+	out = append(out, b.entries[b.start:]...)
+	return append(out, b.entries[:b.start]...)
+}
+
+// Follow returns the kept entries after seq, and a channel that receives
+// the lines written from then on until stop or Close is called. Close
+// closes the channel.
+func (b *Buffer) Follow(seq int64) (backlog []Entry, lines <-chan Entry, stop func()) {
+	ch := make(chan Entry, 256)
+	b.mu.Lock()
+	backlog = b.after(seq)
+	if b.closed {
+		close(ch)
+	} else {
+		b.followers[ch] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	return backlog, ch, func() {
+		b.mu.Lock()
+		delete(b.followers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Close ends following, so streams don't hold up a server's shutdown.
+// Lines are still kept.
+func (b *Buffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.followers {
+		close(ch)
+		delete(b.followers, ch)
+	}
+}
+
+// header matches log.LstdFlags output with an optional "[hz] " prefix
+var header = regexp.MustCompile(`^(?:\[[^\]]*\] )?\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+
+// parse splits a line into its tag and message and guesses its level
+func parse(line string) Entry {
+	msg := header.ReplaceAllString(line, "")
+	var tag string
+	if strings.HasPrefix(msg, "[") {
+		if end := strings.Index(msg, "] "); end > 0 {
+			tag, msg = msg[1:end], msg[end+2:]
+		}
+	}
+	return Entry{Level: level(tag, msg), Tag: tag, Message: msg, Line: line}
+}
+
+// Words that make a line a warning or an error
+var (
+	errorWords = []string{"error", "failed", "panic", "fatal"}
+	warnWords  = []string{"warning", "deprecated", "denied", "rejecting", "refused", "lost", "unavailable", "not registered", "no route", "exited", "unhealthy"}
+)
+
+// level guesses a line's level from its tag and wording
+func level(tag, msg string) string {
+	lower := strings.ToLower(msg)
+	if tag == "error" || containsAny(lower, errorWords) {
+		return LevelError
+	}
+	if containsAny(lower, warnWords) {
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// containsAny reports whether s contains any of words
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
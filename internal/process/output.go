@@ -0,0 +1,57 @@
+package process
+
+import (
+	"bytes"
+	"log"
+	"sync"
+)
+
+// maxLine is how much output is buffered before an unterminated line is
+// logged anyway
+const maxLine = 64 * 1024
+
+// lineWriter logs process output line by line, prefixed with the service name
+type lineWriter struct {
+	logger *log.Logger
+	name   string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write logs every complete line in b and keeps the rest for later
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLine {
+		w.log(w.buf)
+		w.buf = nil
+	}
+	return len(b), nil
+}
+
+// Flush logs a trailing line without a newline
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.log(w.buf)
+		w.buf = nil
+	}
+}
+
+// log writes one line of output
+func (w *lineWriter) log(line []byte) {
+	w.logger.Printf("[%s] %s", w.name, bytes.TrimRight(line, "\r"))
+}
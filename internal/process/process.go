@@ -0,0 +1,302 @@
+// Package process runs the backend commands of managed services, restarting
+// them when they exit
+package process
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Restart backoff: the delay doubles after each crash up to maxBackoff and
+// resets once a process stayed up for resetAfter
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+	resetAfter = 30 * time.Second
+)
+
+// DefaultStopTimeout is how long a process may take to exit after SIGTERM
+// before it is killed
+const DefaultStopTimeout = 10 * time.Second
+
+// Spec describes the command run for a service
+type Spec struct {
+	Command string            // run through the shell
+	Dir     string            // working directory
+	Env     map[string]string // added to hz's own environment
+}
+
+// State is a snapshot of a managed process
+type State struct {
+	PID       int       `json:"pid,omitempty"`
+	Running   bool      `json:"running"`
+	Restarts  int       `json:"restarts"`
+	StartedAt time.Time `json:"startedAt,omitempty"`
+	LastExit  string    `json:"lastExit,omitempty"` // e.g. "exit status 1"
+}
+
+// Manager runs one process per service name
+type Manager struct {
+	mu          sync.Mutex
+	procs       map[string]*proc
+	logger      *log.Logger
+	onStart     func(name string)
+	stopTimeout time.Duration
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+// proc is one managed process and its restart loop
+type proc struct {
+	name     string
+	spec     Spec
+	stop     chan struct{} // closed to stop the process for good
+	stopOnce sync.Once
+	done     chan struct{} // closed once the process has exited for good
+
+	mu    sync.Mutex
+	state State
+}
+
+// NewManager creates a process manager
+func NewManager() *Manager {
+	return &Manager{
+		procs:       make(map[string]*proc),
+		logger:      log.Default(),
+		stopTimeout: DefaultStopTimeout,
+	}
+}
+
+// SetLogger sets the logger that receives process output and lifecycle messages
+func (m *Manager) SetLogger(logger *log.Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logger = logger
+}
+
+// OnStart registers a callback invoked each time a process is spawned
+func (m *Manager) OnStart(fn func(name string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onStart = fn
+}
+
+// Start runs spec for name. A process already running for name with the
+// same spec is left alone; one with a different spec is stopped first and
+// the new one starts once it has exited. Start does not block.
+func (m *Manager) Start(name string, spec Spec) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	old := m.procs[name]
+	if old != nil && reflect.DeepEqual(old.spec, spec) {
+		return
+	}
+
+	var prev <-chan struct{}
+	if old != nil {
+		old.halt()
+		prev = old.done
+	}
+
+	p := &proc{
+		name: name,
+		spec: spec,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	m.procs[name] = p
+	m.wg.Add(1)
+	go m.run(p, prev)
+}
+
+// Stop terminates the process for name, if any, without waiting for it
+func (m *Manager) Stop(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, ok := m.procs[name]; ok {
+		p.halt()
+		delete(m.procs, name)
+	}
+}
+
+// StopAll terminates every process and waits until they have exited. Later
+// calls to Start are ignored.
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	m.closed = true
+	for name, p := range m.procs {
+		p.halt()
+		delete(m.procs, name)
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+// State returns the state of the process for name
+func (m *Manager) State(name string) (State, bool) {
+	m.mu.Lock()
+	p, ok := m.procs[name]
+	m.mu.Unlock()
+
+	if !ok {
+		return State{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, true
+}
+
+// run starts the process and restarts it with backoff until it is stopped.
+// A replaced process (prev) must exit first so the two never share a port.
+func (m *Manager) run(p *proc, prev <-chan struct{}) {
+	defer m.wg.Done()
+	defer close(p.done)
+
+	if prev != nil {
+		<-prev
+	}
+
+	m.mu.Lock()
+	logger, onStart := m.logger, m.onStart
+	m.mu.Unlock()
+
+	backoff := minBackoff
+	for restarts := 0; ; restarts++ {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		started := time.Now()
+		stdout := &lineWriter{logger: logger, name: p.name}
+		stderr := &lineWriter{logger: logger, name: p.name}
+		cmd := p.command(stdout, stderr)
+
+		if err := cmd.Start(); err != nil {
+			logger.Printf("[process] %s failed to start: %v", p.name, err)
+			p.exited(restarts, err.Error())
+		} else {
+			p.started(cmd.Process.Pid, restarts, started)
+			logger.Printf("[process] %s started (pid %d): %s", p.name, cmd.Process.Pid, p.spec.Command)
+			if onStart != nil {
+				onStart(p.name)
+			}
+
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+
+			select {
+			case err := <-exited:
+				stdout.Flush()
+				stderr.Flush()
+				p.exited(restarts, exitReason(err))
+			case <-p.stop:
+				m.terminate(cmd, exited)
+				stdout.Flush()
+				stderr.Flush()
+				p.exited(restarts, "stopped")
+				logger.Printf("[process] %s stopped", p.name)
+				return
+			}
+		}
+
+		if time.Since(started) >= resetAfter {
+			backoff = minBackoff
+		}
+		p.mu.Lock()
+		reason := p.state.LastExit
+		p.mu.Unlock()
+		logger.Printf("[process] %s exited (%s), restarting in %s", p.name, reason, backoff)
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// terminate asks the process group to exit and kills it after the stop timeout
+func (m *Manager) terminate(cmd *exec.Cmd, exited <-chan error) {
+	if err := interrupt(cmd); err == nil {
+		select {
+		case <-exited:
+			return
+		case <-time.After(m.stopTimeout):
+		}
+	}
+	_ = kill(cmd)
+	<-exited
+}
+
+// command builds the shell command for the process
+func (p *proc) command(stdout, stderr *lineWriter) *exec.Cmd {
+	cmd := shellCommand(p.spec.Command)
+	cmd.Dir = p.spec.Dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Don't wait forever on pipes held open by orphaned children
+	cmd.WaitDelay = time.Second
+	setProcessGroup(cmd)
+
+	if len(p.spec.Env) > 0 {
+		keys := make([]string, 0, len(p.spec.Env))
+		for k := range p.spec.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		cmd.Env = os.Environ()
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, p.spec.Env[k]))
+		}
+	}
+	return cmd
+}
+
+// halt stops the process for good; it is safe to call more than once
+func (p *proc) halt() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// started records a running process
+func (p *proc) started(pid, restarts int, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.PID = pid
+	p.state.Running = true
+	p.state.Restarts = restarts
+	p.state.StartedAt = at
+}
+
+// exited records why the process is no longer running
+func (p *proc) exited(restarts int, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.PID = 0
+	p.state.Running = false
+	p.state.Restarts = restarts
+	p.state.LastExit = reason
+}
+
+// exitReason describes how a process ended
+func exitReason(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
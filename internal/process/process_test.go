@@ -0,0 +1,181 @@
+package process
+
+import (
+	"bytes"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer collects log output written from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// starts records when each process was spawned
+type starts struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (s *starts) add(string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.times = append(s.times, time.Now())
+}
+
+func (s *starts) get() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.times...)
+}
+
+// newTestManager returns a manager logging to the returned buffer and
+// recording process starts; it is stopped when the test ends
+func newTestManager(t *testing.T) (*Manager, *syncBuffer, *starts) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("process tests use sh")
+	}
+	m := NewManager()
+	logs := &syncBuffer{}
+	m.SetLogger(log.New(logs, "", 0))
+	s := &starts{}
+	m.OnStart(s.add)
+	t.Cleanup(m.StopAll)
+	return m, logs, s
+}
+
+// eventually fails the test unless cond becomes true within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestRestartBackoff runs a command that exits at once: it is restarted
+// after 1s, then 2s, with the restarts counted
+func TestRestartBackoff(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for two restarts")
+	}
+	m, logs, s := newTestManager(t)
+	m.Start("web", Spec{Command: "echo crashing; exit 3"})
+
+	eventually(t, "web started three times", func() bool { return len(s.get()) == 3 })
+	times := s.get()
+	for i, want := range []time.Duration{minBackoff, 2 * minBackoff} {
+		if gap := times[i+1].Sub(times[i]); gap < want || gap > want+time.Second {
+			t.Errorf("restart %d after %v, want %v", i+1, gap, want)
+		}
+	}
+
+	out := logs.String()
+	for _, want := range []string{
+		"[web] crashing\n",
+		"[process] web exited (exit status 3), restarting in 1s\n",
+		"[process] web exited (exit status 3), restarting in 2s\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log is missing %q:\n%s", want, out)
+		}
+	}
+	state, _ := m.State("web")
+	if state.Restarts < 2 || state.LastExit != "exit status 3" {
+		t.Errorf("state = %+v, want at least 2 restarts after exit status 3", state)
+	}
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		timeout time.Duration
+		min     time.Duration
+		max     time.Duration
+	}{
+		// The whole group gets SIGTERM, so the shell's sleep ends at once
+		{"exits on SIGTERM", "echo ready; sleep 30", 10 * time.Second, 0, 5 * time.Second},
+		// Ignored signals are inherited, so only SIGKILL ends it
+		{"killed after the timeout", "trap '' TERM; echo ready; sleep 30", 500 * time.Millisecond, 500 * time.Millisecond, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, logs, _ := newTestManager(t)
+			m.stopTimeout = tt.timeout
+			m.Start("web", Spec{Command: tt.command})
+			eventually(t, "web is ready", func() bool { return strings.Contains(logs.String(), "[web] ready") })
+
+			start := time.Now()
+			m.StopAll()
+			if took := time.Since(start); took < tt.min || took > tt.max {
+				t.Errorf("stopping took %v, want between %v and %v", took, tt.min, tt.max)
+			}
+			if !strings.Contains(logs.String(), "[process] web stopped\n") {
+				t.Errorf("log doesn't report the stop:\n%s", logs)
+			}
+			if _, ok := m.State("web"); ok {
+				t.Error("web still has a state after StopAll")
+			}
+		})
+	}
+}
+
+// TestStartChangedSpec starts a service again, as a config reload does: the
+// same spec keeps the process, a new one replaces it once the old one exited
+func TestStartChangedSpec(t *testing.T) {
+	m, logs, s := newTestManager(t)
+	spec := Spec{Command: `echo "v$VERSION"; exec sleep 30`, Env: map[string]string{"VERSION": "1"}}
+	m.Start("web", spec)
+	eventually(t, "v1 is running", func() bool { return strings.Contains(logs.String(), "[web] v1\n") })
+	first, _ := m.State("web")
+
+	m.Start("web", Spec{Command: spec.Command, Env: map[string]string{"VERSION": "1"}})
+	time.Sleep(100 * time.Millisecond)
+	if state, _ := m.State("web"); len(s.get()) != 1 || state.PID != first.PID {
+		t.Fatalf("the same spec restarted the process: %d starts, pid %d then %d", len(s.get()), first.PID, state.PID)
+	}
+
+	m.Start("web", Spec{Command: spec.Command, Env: map[string]string{"VERSION": "2"}})
+	eventually(t, "v2 is running", func() bool { return strings.Contains(logs.String(), "[web] v2\n") })
+
+	out := logs.String()
+	if stopped, started := strings.Index(out, "[process] web stopped"), strings.Index(out, "[web] v2"); stopped < 0 || stopped > started {
+		t.Errorf("v2 started before v1 stopped:\n%s", out)
+	}
+	state, _ := m.State("web")
+	if !state.Running || state.PID == first.PID || state.Restarts != 0 {
+		t.Errorf("state = %+v, want a new process without restarts", state)
+	}
+}
+
+// TestStartAfterStopAll checks that StopAll keeps processes from coming back
+func TestStartAfterStopAll(t *testing.T) {
+	m, _, s := newTestManager(t)
+	m.StopAll()
+	m.Start("web", Spec{Command: "sleep 30"})
+	if _, ok := m.State("web"); ok || len(s.get()) != 0 {
+		t.Error("Start ran a process after StopAll")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package process
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// shellCommand runs command through cmd.exe
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// interrupt is unsupported on Windows, so processes are killed right away
+func interrupt(cmd *exec.Cmd) error {
+	return errors.New("not supported on windows")
+}
+
+// kill terminates the process
+func kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
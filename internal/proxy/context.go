@@ -8,7 +8,10 @@ import (
 
 type contextKey string
 
-const routeKey contextKey = "hz-route"
+const (
+	routeKey         contextKey = "hz-route"
+	forcedServiceKey contextKey = "hz-forced-service"
+)
 
 // withRoute stores route in request context
 func withRoute(ctx context.Context, route *types.Route) context.Context {
@@ -22,3 +25,16 @@ func routeFromContext(ctx context.Context) *types.Route {
 	}
 	return nil
 }
+
+// withForcedService pins the request to a service, bypassing the router
+func withForcedService(ctx context.Context, svc *types.Service) context.Context {
+	return context.WithValue(ctx, forcedServiceKey, svc)
+}
+
+// forcedServiceFromContext retrieves a pinned service from request context
+func forcedServiceFromContext(ctx context.Context) *types.Service {
+	if svc, ok := ctx.Value(forcedServiceKey).(*types.Service); ok {
+		return svc
+	}
+	return nil
+}
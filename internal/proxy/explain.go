@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/zymawy/hz/internal/router"
+)
+
+// RouteMatch is where the proxy would send a request, without sending it
+type RouteMatch struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"` // as requested, with the query
+	Host     string `json:"host"`
+	Redirect string `json:"redirect,omitempty"` // the trailing-slash redirect, routed in Path's place
+
+	Service  string            `json:"service,omitempty"` // empty when nothing matched
+	Target   string            `json:"target,omitempty"`
+	Pattern  string            `json:"pattern,omitempty"`
+	Fallback bool              `json:"fallback,omitempty"` // only the default service matched
+	Rejected bool              `json:"rejected,omitempty"` // strict routing refuses the fallback
+	Params   map[string]string `json:"params,omitempty"`   // named path captures
+	Upstream string            `json:"upstream,omitempty"` // path and query sent to the target
+	Headers  map[string]string `json:"headers,omitempty"`  // set from the service's headers
+}
+
+// Matched reports whether the request would reach a service
+func (m *RouteMatch) Matched() bool {
+	return m.Service != "" && !m.Rejected
+}
+
+// Explain routes r like ServeHTTP and reports the service, route, rewrite
+// and headers it would get. Nothing is sent and no stats are counted.
+func (p *Proxy) Explain(r *http.Request) (*RouteMatch, error) {
+	m := &RouteMatch{Method: r.Method, Path: r.URL.RequestURI(), Host: r.Host}
+
+	// The client follows the redirect, so route where it leads
+	if target, ok := p.router.RedirectTarget(r); ok {
+		m.Redirect = target
+		r = r.Clone(r.Context())
+		u, err := r.URL.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		r.URL = u
+	}
+
+	route, err := p.match(r)
+	if err != nil || route == nil {
+		return m, err
+	}
+	m.Service = route.Service.Name
+	m.Target = route.Service.Target
+	m.Pattern = route.Pattern
+	m.Fallback = route.Fallback
+	if p.rejectsFallback(route, r) {
+		m.Rejected = true
+		return m, nil
+	}
+
+	r = router.WithRouteParams(r.Clone(r.Context()), route)
+	params := router.ParamsFromContext(r.Context())
+	if len(params) > 0 {
+		m.Params = params
+	}
+	for key, value := range route.Service.Headers {
+		if m.Headers == nil {
+			m.Headers = make(map[string]string)
+		}
+		m.Headers[http.CanonicalHeaderKey(key)] = router.ExpandParams(value, params)
+	}
+
+	router.RewriteURL(r, route.EffectiveRewrite())
+	m.Upstream = r.URL.RequestURI()
+	return m, nil
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// ForwardHandler returns a handler for the forward-proxy listener. It accepts
+// absolute-form requests and CONNECT tunnels, but only to hosts of configured
+// services (or <service>.localhost names), so hz never acts as an open proxy.
+func (p *Proxy) ForwardHandler() http.Handler {
+	return http.HandlerFunc(p.serveForward)
+}
+
+// serveForward handles a single forward-proxy request
+func (p *Proxy) serveForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "Forward proxy expects absolute-form requests", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := p.forwardDestination(r.URL.Host, r.URL.Scheme); !ok {
+		p.logger.Printf("[forward] denied %s %s", r.Method, r.URL.String())
+		http.Error(w, "Forbidden: destination is not a configured service", http.StatusForbidden)
+		return
+	}
+
+	// <service>.localhost always reaches that service, bypassing the router
+	if svc := p.localhostService(r.URL.Hostname()); svc != nil {
+		r = r.WithContext(withForcedService(r.Context(), svc))
+	}
+
+	// Turn it into an origin-form request and run the normal pipeline
+	r.Host = r.URL.Host
+	r.URL.Scheme = ""
+	r.URL.Host = ""
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	r.Header.Del("Proxy-Authorization")
+
+	p.ServeHTTP(w, r)
+}
+
+// handleConnect tunnels raw bytes to an allowed destination
+func (p *Proxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	dest, ok := p.forwardDestination(r.Host, "")
+	if !ok {
+		p.logger.Printf("[forward] denied CONNECT %s", r.Host)
+		http.Error(w, "Forbidden: destination is not a configured service", http.StatusForbidden)
+		return
+	}
+
+	backend, err := net.DialTimeout("tcp", dest, 10*time.Second)
+	if err != nil {
+		p.logger.Printf("[forward] CONNECT %s failed: %v", dest, err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer backend.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		p.logger.Printf("[forward] hijack failed: %v", err)
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	atomic.AddInt64(&p.stats.ForwardConns, 1)
+	defer atomic.AddInt64(&p.stats.ForwardConns, -1)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Client -> Backend, including anything already buffered by the server
+	go func() {
+		defer wg.Done()
+		n, _ := io.Copy(backend, io.MultiReader(buf.Reader, client))
+		atomic.AddInt64(&p.stats.BytesIn, n)
+		closeWrite(backend)
+	}()
+
+	// Backend -> Client
+	go func() {
+		defer wg.Done()
+		n, _ := io.Copy(client, backend)
+		atomic.AddInt64(&p.stats.BytesOut, n)
+		closeWrite(client)
+	}()
+
+	wg.Wait()
+}
+
+// forwardDestination resolves the dial address for a requested host if it is
+// allowed. <service>.localhost names map to that service's target.
+func (p *Proxy) forwardDestination(hostport, scheme string) (string, bool) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+		port = defaultPort(scheme)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, svc := range p.registry.List() {
+		target := svc.TargetURL
+		if target == nil || target.Host == "" {
+			continue
+		}
+
+		targetAddr := target.Host
+		if target.Port() == "" {
+			targetAddr = net.JoinHostPort(target.Hostname(), defaultPort(target.Scheme))
+		}
+
+		if host == strings.ToLower(svc.Name)+".localhost" {
+			return targetAddr, true
+		}
+		if host == strings.ToLower(target.Hostname()) && port == portOf(targetAddr) {
+			return targetAddr, true
+		}
+	}
+
+	return "", false
+}
+
+// localhostService returns the service addressed by a <service>.localhost name
+func (p *Proxy) localhostService(host string) *types.Service {
+	name, ok := strings.CutSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), ".localhost")
+	if !ok {
+		return nil
+	}
+	for _, svc := range p.registry.List() {
+		if strings.EqualFold(svc.Name, name) {
+			return svc
+		}
+	}
+	return nil
+}
+
+// defaultPort returns the well-known port for a scheme
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "https", "wss":
+		return "443"
+	default:
+		return "80"
+	}
+}
+
+// portOf extracts the port from a host:port address
+func portOf(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// closeWrite half-closes a connection so the peer sees EOF
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// namedBackend answers every request with its name and the path it got
+func namedBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// forwardSetup serves web (the default) and api through a forward proxy
+func forwardSetup(t *testing.T) (web, api *httptest.Server, forward *httptest.Server) {
+	web, api = namedBackend(t, "web"), namedBackend(t, "api")
+	p := newTestProxy(t,
+		&types.Service{Name: "web", Target: web.URL, Default: true},
+		&types.Service{Name: "api", Target: api.URL, Routes: []types.RouteConfig{{Path: "/api/*"}}},
+	)
+	forward = httptest.NewServer(p.ForwardHandler())
+	t.Cleanup(forward.Close)
+	return web, api, forward
+}
+
+// TestForwardProxy uses hz as the HTTP proxy, like an emulator set up with
+// it as the system proxy
+func TestForwardProxy(t *testing.T) {
+	web, _, forward := forwardSetup(t)
+	proxyURL, _ := url.Parse(forward.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	tests := []struct {
+		name string
+		url  string
+		code int
+		body string
+	}{
+		{"not a service", "http://example.com/", http.StatusForbidden, "Forbidden: destination is not a configured service\n"},
+		{"other port of a service host", "http://127.0.0.1:1/", http.StatusForbidden, "Forbidden: destination is not a configured service\n"},
+		{"service host is routed", web.URL + "/api/users", http.StatusOK, "api /api/users"},
+		{"default service", web.URL + "/home", http.StatusOK, "web /home"},
+		{"<name>.localhost forces the service", "http://api.localhost/home", http.StatusOK, "api /home"},
+		{"any case, trailing dot", "http://WEB.localhost./api/users", http.StatusOK, "web /api/users"},
+		{"unknown .localhost name", "http://docs.localhost/", http.StatusForbidden, "Forbidden: destination is not a configured service\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.code || string(body) != tt.body {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.url, resp.StatusCode, body, tt.code, tt.body)
+			}
+		})
+	}
+
+	t.Run("origin-form", func(t *testing.T) {
+		resp, err := http.Get(forward.URL + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got %d, want 400", resp.StatusCode)
+		}
+	})
+}
+
+// connect opens a CONNECT tunnel to dest through the forward proxy and
+// returns the connection and the proxy's status line
+func connect(t *testing.T, forward *httptest.Server, dest string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", forward.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", dest, dest)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp.Status
+}
+
+func TestForwardConnect(t *testing.T) {
+	_, api, forward := forwardSetup(t)
+	apiHost := strings.TrimPrefix(api.URL, "http://")
+
+	for _, dest := range []string{apiHost, "api.localhost:443"} {
+		conn, br, status := connect(t, forward, dest)
+		if status != "200 Connection Established" {
+			t.Fatalf("CONNECT %s: %s", dest, status)
+		}
+		// Bytes go to the backend as they are, past the router
+		fmt.Fprintf(conn, "GET /home HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", apiHost)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "api /home" {
+			t.Errorf("CONNECT %s reached %q", dest, body)
+		}
+	}
+
+	for _, dest := range []string{"example.com:443", "127.0.0.1:22"} {
+		if _, _, status := connect(t, forward, dest); status != "403 Forbidden" {
+			t.Errorf("CONNECT %s: %s, want 403", dest, status)
+		}
+	}
+}
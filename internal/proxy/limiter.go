@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// limiter bounds in-flight requests to a service with an optional wait queue
+type limiter struct {
+	slots     chan struct{}
+	waiting   int64
+	queueSize int
+	timeout   time.Duration
+}
+
+// newLimiter creates a limiter for the service's concurrency settings
+func newLimiter(svc *types.Service) *limiter {
+	l := &limiter{
+		slots: make(chan struct{}, svc.MaxConcurrent),
+	}
+	if svc.Queue != nil {
+		l.queueSize = svc.Queue.Size
+		l.timeout = svc.Queue.Timeout.Duration()
+	}
+	return l
+}
+
+// matches reports whether the limiter was built from the same settings
+func (l *limiter) matches(svc *types.Service) bool {
+	queueSize, timeout := 0, time.Duration(0)
+	if svc.Queue != nil {
+		queueSize, timeout = svc.Queue.Size, svc.Queue.Timeout.Duration()
+	}
+	return cap(l.slots) == svc.MaxConcurrent && l.queueSize == queueSize && l.timeout == timeout
+}
+
+// acquire takes a slot, waiting in the queue up to the timeout if one is configured
+func (l *limiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.queueSize <= 0 {
+		return false
+	}
+
+	if atomic.AddInt64(&l.waiting, 1) > int64(l.queueSize) {
+		atomic.AddInt64(&l.waiting, -1)
+		return false
+	}
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees a slot
+func (l *limiter) release() {
+	<-l.slots
+}
+
+// retryAfter returns the Retry-After value in seconds for rejected requests
+func (l *limiter) retryAfter() int {
+	secs := int(l.timeout.Round(time.Second) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// limiterFor returns the service's limiter, or nil when no limit is configured
+func (p *Proxy) limiterFor(svc *types.Service) *limiter {
+	if svc.MaxConcurrent <= 0 {
+		return nil
+	}
+
+	p.limitersMu.Lock()
+	defer p.limitersMu.Unlock()
+
+	// Rebuild on config changes; in-flight requests release into the old limiter
+	l, ok := p.limiters[svc.Name]
+	if !ok || !l.matches(svc) {
+		l = newLimiter(svc)
+		p.limiters[svc.Name] = l
+	}
+	return l
+}
+
+// acquireSlot reserves capacity on the service, returning a release func.
+// ok is false when the request must be rejected because the service is saturated.
+func (p *Proxy) acquireSlot(ctx context.Context, svc *types.Service) (release func(), retryAfter int, ok bool) {
+	l := p.limiterFor(svc)
+	if l != nil && !l.acquire(ctx) {
+		return nil, l.retryAfter(), false
+	}
+
+	svc.IncrementInFlight()
+	return func() {
+		svc.DecrementInFlight()
+		if l != nil {
+			l.release()
+		}
+	}, 0, true
+}
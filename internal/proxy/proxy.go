@@ -3,18 +3,23 @@ package proxy
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/zymawy/hz/internal/clientip"
 	"github.com/zymawy/hz/internal/inspector"
+	"github.com/zymawy/hz/internal/recorder"
 	"github.com/zymawy/hz/internal/registry"
 	"github.com/zymawy/hz/internal/router"
 	"github.com/zymawy/hz/pkg/types"
@@ -23,12 +28,25 @@ import (
 // Maximum body size to capture (64KB)
 const maxBodyCapture = 64 * 1024
 
+// AdminPrefix is the path prefix for endpoints answered by hz itself
+const AdminPrefix = "/__hz/"
+
+// Default WebSocket buffer sizes when a service doesn't configure them
+const (
+	defaultWSReadBufferSize  = 1024
+	defaultWSWriteBufferSize = 1024
+)
+
 // responseCapture wraps ResponseWriter to capture status code, headers, and body
 type responseCapture struct {
 	http.ResponseWriter
 	statusCode int
 	body       bytes.Buffer
 	headers    http.Header
+	fullBody   *bytes.Buffer // body up to recorder.MaxBody, only kept while recording
+	truncated  bool          // the body outgrew fullBody
+	label      string        // set when hz answered instead of a backend
+	upstream   string        // request URI sent upstream, set when a rewrite changed it
 }
 
 func (rc *responseCapture) WriteHeader(code int) {
@@ -38,6 +56,20 @@ func (rc *responseCapture) WriteHeader(code int) {
 	rc.ResponseWriter.WriteHeader(code)
 }
 
+// Flush sends buffered data to the client, needed for streaming (e.g. gRPC)
+func (rc *responseCapture) Flush() {
+	if rc.statusCode == 0 {
+		rc.statusCode = http.StatusOK
+		rc.headers = rc.ResponseWriter.Header().Clone()
+	}
+	_ = http.NewResponseController(rc.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rc *responseCapture) Unwrap() http.ResponseWriter {
+	return rc.ResponseWriter
+}
+
 func (rc *responseCapture) Write(b []byte) (int, error) {
 	if rc.statusCode == 0 {
 		rc.statusCode = http.StatusOK
@@ -52,6 +84,14 @@ func (rc *responseCapture) Write(b []byte) (int, error) {
 			rc.body.Write(b[:remaining])
 		}
 	}
+	if rc.fullBody != nil && !rc.truncated {
+		if remaining := recorder.MaxBody - rc.fullBody.Len(); len(b) <= remaining {
+			rc.fullBody.Write(b)
+		} else {
+			rc.fullBody.Write(b[:remaining])
+			rc.truncated = true
+		}
+	}
 	return rc.ResponseWriter.Write(b)
 }
 
@@ -67,7 +107,21 @@ type Proxy struct {
 	errorHandler ErrorHandler
 	stats        *types.ProxyStats
 	logger       *log.Logger
-	inspector    *inspector.Inspector
+	inspector    atomic.Pointer[inspector.Inspector] // nil when disabled; hz tail enables it while serving
+	recorder     *recorder.Writer
+	replayers    map[string]*recorder.Replayer
+	replayersMu  sync.Mutex
+	limiters     map[string]*limiter
+	limitersMu   sync.Mutex
+	admin        http.Handler
+
+	// Settings reloads change while requests are served
+	settingsMu   sync.RWMutex
+	debugHeaders bool
+
+	// Strict routing: 404 instead of the default service
+	strictRouting  bool
+	strictPrefixes []string
 }
 
 // New creates a new proxy instance
@@ -79,11 +133,13 @@ func New(reg *registry.Registry, rtr *router.Router) *Proxy {
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for development
 			},
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
+			ReadBufferSize:  defaultWSReadBufferSize,
+			WriteBufferSize: defaultWSWriteBufferSize,
 		},
-		stats:  &types.ProxyStats{},
-		logger: log.Default(),
+		stats:     &types.ProxyStats{},
+		logger:    log.Default(),
+		replayers: make(map[string]*recorder.Replayer),
+		limiters:  make(map[string]*limiter),
 	}
 
 	// Create reverse proxy with director
@@ -91,18 +147,7 @@ func New(reg *registry.Registry, rtr *router.Router) *Proxy {
 		Director:       p.director,
 		ModifyResponse: p.modifyResponse,
 		ErrorHandler:   p.handleProxyError,
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
+		Transport:      newBackendTransport(),
 	}
 
 	p.errorHandler = p.defaultErrorHandler
@@ -112,8 +157,19 @@ func New(reg *registry.Registry, rtr *router.Router) *Proxy {
 
 // ServeHTTP handles incoming HTTP requests
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Internal endpoints are answered by hz itself
+	if p.admin != nil && strings.HasPrefix(r.URL.Path, AdminPrefix) {
+		p.admin.ServeHTTP(w, r)
+		return
+	}
+
 	start := time.Now()
 	atomic.AddInt64(&p.stats.TotalRequests, 1)
+	if clientip.FromTunnel(r) {
+		atomic.AddInt64(&p.stats.TunnelRequests, 1)
+	} else {
+		atomic.AddInt64(&p.stats.LocalRequests, 1)
+	}
 	atomic.AddInt64(&p.stats.ActiveRequests, 1)
 	defer atomic.AddInt64(&p.stats.ActiveRequests, -1)
 
@@ -123,9 +179,15 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Canonicalize trailing slashes before routing; 308 keeps the method and body
+	if target, ok := p.router.RedirectTarget(r); ok {
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+		return
+	}
+
 	// Capture request body if inspector is enabled (read and replace)
 	var requestBody string
-	if p.inspector != nil && r.Body != nil && r.ContentLength > 0 && r.ContentLength <= maxBodyCapture {
+	if p.inspector.Load() != nil && r.Body != nil && r.ContentLength > 0 && r.ContentLength <= maxBodyCapture {
 		bodyBytes, err := io.ReadAll(io.LimitReader(r.Body, maxBodyCapture))
 		if err == nil {
 			requestBody = string(bodyBytes)
@@ -135,41 +197,183 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Route the request
-	route, err := p.router.Match(r)
+	route, err := p.match(r)
 	if err != nil {
 		p.captureRequest(r, nil, nil, requestBody, time.Since(start), err)
 		p.errorHandler(w, r, err)
 		return
 	}
 
-	if route == nil {
-		p.captureRequest(r, nil, nil, requestBody, time.Since(start), fmt.Errorf("no matching route found"))
-		p.errorHandler(w, r, fmt.Errorf("no matching route found"))
+	if route == nil || p.rejectsFallback(route, r) {
+		rc := &responseCapture{ResponseWriter: w}
+		p.rejectUnrouted(rc, r)
+		p.captureRequest(r, nil, rc, requestBody, time.Since(start), nil)
 		return
 	}
 
-	// Store route info in context for director
+	// Let viaProxy health checks see which service they reached
+	if check := registry.ProxyCheckFrom(r.Context()); check != nil {
+		check.RoutedTo = route.Service.Name
+	}
+
+	// Tell the client which route won, including on hz-generated errors
+	for name, values := range p.routeHeaders(route) {
+		w.Header()[name] = values
+	}
+
+	// Store route info and captured path parameters in context for director
 	r = r.WithContext(withRoute(r.Context(), route))
+	r = router.WithRouteParams(r, route)
 
 	// Update service stats
 	route.Service.IncrementRequests()
 
-	// Apply URL rewriting if configured
-	router.RewriteURL(r, route.Service.Rewrite)
-
 	// Wrap response writer to capture status code, headers, and body
 	rc := &responseCapture{ResponseWriter: w}
 
+	// Answer routes under maintenance without touching the backend
+	if m := route.ActiveMaintenance(); m != nil {
+		p.rejectMaintenance(rc, r, m)
+		p.captureRequest(r, route, rc, requestBody, time.Since(start), nil)
+		return
+	}
+
+	// Hold requests until a managed backend process is up
+	if p.starting(r, route.Service) {
+		p.rejectStarting(rc, r, route.Service)
+		p.captureRequest(r, route, rc, requestBody, time.Since(start), nil)
+		return
+	}
+
+	// Hold requests until the service's first healthy check
+	if p.gated(r, route.Service) {
+		p.rejectNotReady(rc, r, route.Service)
+		p.captureRequest(r, route, rc, requestBody, time.Since(start), nil)
+		return
+	}
+
+	// Enforce the service's concurrency limit
+	release, retryAfter, ok := p.acquireSlot(r.Context(), route.Service)
+	if !ok {
+		p.rejectSaturated(rc, r, route.Service, retryAfter)
+		p.captureRequest(r, route, rc, requestBody, time.Since(start), nil)
+		return
+	}
+	defer release()
+
+	// Serve recorded responses for replay services without touching a backend
+	if route.Service.TargetURL.Scheme == "replay" {
+		p.serveReplay(rc, r, route.Service)
+		p.captureRequest(r, route, rc, requestBody, time.Since(start), nil)
+		return
+	}
+
+	// Keep the client-facing URL for the inspector and recording key
+	origURL := *r.URL
+	if p.recorder != nil {
+		rc.fullBody = &bytes.Buffer{}
+	}
+
+	// Apply URL rewriting if configured
+	router.RewriteURL(r, route.EffectiveRewrite())
+	if uri := r.URL.RequestURI(); uri != origURL.RequestURI() {
+		rc.upstream = uri
+	}
+
 	// Proxy the request
 	p.reverseProxy.ServeHTTP(rc, r)
 
-	// Capture the request for inspector
+	if p.recorder != nil && registry.ProxyCheckFrom(r.Context()) == nil {
+		p.record(r, route, rc, origURL.Path, origURL.RawQuery)
+	}
+
+	// Capture the request for inspector as the client sent it
+	r.URL = &origURL
 	p.captureRequest(r, route, rc, requestBody, time.Since(start), nil)
 }
 
+// serveReplay answers the request from the service's recorded session file
+func (p *Proxy) serveReplay(w http.ResponseWriter, r *http.Request, svc *types.Service) {
+	file := svc.TargetURL.Path
+
+	p.replayersMu.Lock()
+	rp, ok := p.replayers[file]
+	if !ok {
+		var err error
+		rp, err = recorder.Load(file, svc.Replay)
+		if err != nil {
+			p.replayersMu.Unlock()
+			p.logger.Printf("[replay] %v", err)
+			http.Error(w, "Replay session unavailable", http.StatusNotImplemented)
+			return
+		}
+		p.replayers[file] = rp
+		p.logger.Printf("[replay] loaded %d recorded requests from %s", rp.Len(), file)
+	}
+	p.replayersMu.Unlock()
+
+	rp.ServeHTTP(w, r)
+}
+
+// record stores a completed exchange in the session file
+func (p *Proxy) record(r *http.Request, route *types.Route, rc *responseCapture, path, query string) {
+	status := rc.statusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	entry := recorder.Entry{
+		RecordedAt:      time.Now(),
+		Service:         route.Service.Name,
+		Method:          r.Method,
+		Path:            path,
+		Query:           query,
+		RequestHeaders:  r.Header.Clone(),
+		StatusCode:      status,
+		ResponseHeaders: rc.headers,
+		Body:            rc.fullBody.Bytes(),
+		Truncated:       rc.truncated,
+	}
+
+	if err := p.recorder.Record(entry); err != nil {
+		p.logger.Printf("[record] failed to write entry: %v", err)
+	}
+}
+
+// ServiceHandler returns a handler that sends every request to the named
+// service, bypassing the router, like tunnel endpoints bound to a service.
+// The service is looked up per request, so it follows reloads.
+func (p *Proxy) ServiceHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc, err := p.registry.Get(name)
+		if err != nil {
+			p.logger.Printf("[route] %s %s%s: service %s is not registered", r.Method, r.Host, r.URL.Path, name)
+			writeError(w, r, http.StatusServiceUnavailable, "Service "+name+" is not available")
+			return
+		}
+		p.ServeHTTP(w, r.WithContext(withForcedService(r.Context(), svc)))
+	})
+}
+
+// match resolves the route for a request, honouring services pinned in context
+func (p *Proxy) match(r *http.Request) (*types.Route, error) {
+	if svc := forcedServiceFromContext(r.Context()); svc != nil {
+		return &types.Route{
+			Pattern: "*",
+			Service: svc,
+			MatchFunc: func(req *http.Request) bool {
+				return true
+			},
+		}, nil
+	}
+	return p.router.Match(r)
+}
+
 // captureRequest sends request info to the inspector if enabled
 func (p *Proxy) captureRequest(r *http.Request, route *types.Route, rc *responseCapture, requestBody string, duration time.Duration, err error) {
-	if p.inspector == nil {
+	// Health checks sent through the proxy would drown out real traffic
+	insp := p.inspector.Load()
+	if insp == nil || registry.ProxyCheckFrom(r.Context()) != nil {
 		return
 	}
 
@@ -185,16 +389,13 @@ func (p *Proxy) captureRequest(r *http.Request, route *types.Route, rc *response
 		Duration:      duration,
 		RequestBody:   requestBody,
 		Scheme:        r.URL.Scheme,
+		Source:        requestSource(r),
 		ContentType:   r.Header.Get("Content-Type"),
 	}
 
-	// Set scheme if empty
+	// Set scheme if empty: the one the client used, through the tunnel too
 	if req.Scheme == "" {
-		if r.TLS != nil {
-			req.Scheme = "https"
-		} else {
-			req.Scheme = "http"
-		}
+		req.Scheme = clientip.Scheme(r)
 	}
 
 	// Capture response data if available
@@ -202,6 +403,8 @@ func (p *Proxy) captureRequest(r *http.Request, route *types.Route, rc *response
 		req.StatusCode = rc.statusCode
 		req.ResponseBody = rc.body.String()
 		req.ResponseHeaders = rc.headers
+		req.RewrittenURL = rc.upstream
+		req.Label = rc.label
 	}
 
 	if route != nil {
@@ -213,7 +416,7 @@ func (p *Proxy) captureRequest(r *http.Request, route *types.Route, rc *response
 		req.Error = err.Error()
 	}
 
-	p.inspector.Capture(req)
+	insp.Capture(req)
 }
 
 // HandleWebSocket handles WebSocket upgrade requests
@@ -222,30 +425,66 @@ func (p *Proxy) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	defer atomic.AddInt64(&p.stats.WebSocketConns, -1)
 
 	// Route the request
-	route, err := p.router.Match(r)
+	route, err := p.match(r)
 	if err != nil {
 		p.errorHandler(w, r, err)
 		return
 	}
 
-	if route == nil {
-		p.errorHandler(w, r, fmt.Errorf("no matching route for WebSocket"))
+	if route == nil || p.rejectsFallback(route, r) {
+		p.rejectUnrouted(w, r)
 		return
 	}
 
-	// Build target WebSocket URL
-	targetURL := *route.Service.TargetURL
-	if targetURL.Scheme == "http" {
-		targetURL.Scheme = "ws"
-	} else if targetURL.Scheme == "https" {
-		targetURL.Scheme = "wss"
+	debug := p.routeHeaders(route)
+	for name, values := range debug {
+		w.Header()[name] = values
+	}
+
+	if m := route.ActiveMaintenance(); m != nil {
+		p.rejectMaintenance(w, r, m)
+		return
+	}
+
+	if p.starting(r, route.Service) {
+		p.rejectStarting(w, r, route.Service)
+		return
+	}
+
+	if p.gated(r, route.Service) {
+		p.rejectNotReady(w, r, route.Service)
+		return
+	}
+
+	if route.Service.TargetURL.Scheme == "replay" {
+		http.Error(w, "WebSocket is not supported in replay mode", http.StatusNotImplemented)
+		return
 	}
+
+	// WebSocket connections hold a concurrency slot for their whole lifetime
+	if route.Service.WebSocket == nil || !route.Service.WebSocket.ExcludeFromLimit {
+		release, retryAfter, ok := p.acquireSlot(r.Context(), route.Service)
+		if !ok {
+			p.rejectSaturated(w, r, route.Service, retryAfter)
+			return
+		}
+		defer release()
+	}
+
+	// Build target WebSocket URL
+	targetURL := types.WebSocketURL(*route.Service.TargetURL)
 	targetURL.Path = r.URL.Path
 	targetURL.RawQuery = r.URL.RawQuery
 
-	// Connect to backend
+	wsCfg := route.Service.WebSocket
+	upgrader := p.upgraderFor(wsCfg)
+
+	// Connect to backend, only negotiating compression if the client asked for it
 	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		ReadBufferSize:    upgrader.ReadBufferSize,
+		WriteBufferSize:   upgrader.WriteBufferSize,
+		EnableCompression: upgrader.EnableCompression && clientWantsCompression(r),
 	}
 
 	backendConn, resp, err := dialer.Dial(targetURL.String(), nil)
@@ -261,13 +500,19 @@ func (p *Proxy) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	defer backendConn.Close()
 
 	// Upgrade client connection
-	clientConn, err := p.wsUpgrader.Upgrade(w, r, nil)
+	clientConn, err := upgrader.Upgrade(w, r, debug)
 	if err != nil {
 		p.logger.Printf("[ws] client upgrade failed: %v", err)
 		return
 	}
 	defer clientConn.Close()
 
+	// Enforce message size limit on both sides
+	if wsCfg != nil && wsCfg.MaxMessageSize > 0 {
+		clientConn.SetReadLimit(int64(wsCfg.MaxMessageSize))
+		backendConn.SetReadLimit(int64(wsCfg.MaxMessageSize))
+	}
+
 	// Bidirectional proxy
 	errChan := make(chan error, 2)
 
@@ -285,11 +530,30 @@ func (p *Proxy) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	<-errChan
 }
 
+// upgraderFor returns a client upgrader configured for the service's WebSocket settings
+func (p *Proxy) upgraderFor(cfg *types.WebSocketConfig) websocket.Upgrader {
+	upgrader := p.wsUpgrader
+	if cfg == nil {
+		return upgrader
+	}
+
+	if cfg.ReadBufferSize > 0 {
+		upgrader.ReadBufferSize = int(cfg.ReadBufferSize)
+	}
+	if cfg.WriteBufferSize > 0 {
+		upgrader.WriteBufferSize = int(cfg.WriteBufferSize)
+	}
+	upgrader.EnableCompression = cfg.EnableCompression
+
+	return upgrader
+}
+
 // copyWebSocket copies messages between WebSocket connections
 func (p *Proxy) copyWebSocket(dst, src *websocket.Conn, direction string) error {
 	for {
 		msgType, msg, err := src.ReadMessage()
 		if err != nil {
+			forwardClose(dst, err)
 			return err
 		}
 
@@ -299,6 +563,41 @@ func (p *Proxy) copyWebSocket(dst, src *websocket.Conn, direction string) error
 	}
 }
 
+// forwardClose relays the reason one side closed to the other side
+func forwardClose(dst *websocket.Conn, err error) {
+	code := websocket.CloseGoingAway
+	text := ""
+
+	var closeErr *websocket.CloseError
+	switch {
+	case errors.As(err, &closeErr):
+		code = closeErr.Code
+		text = closeErr.Text
+	case errors.Is(err, websocket.ErrReadLimit):
+		// The oversized sender already received 1009 from gorilla
+		code = websocket.CloseMessageTooBig
+		text = "message too big"
+	}
+
+	// Reserved codes must never be sent on the wire
+	if code == websocket.CloseAbnormalClosure || code == websocket.CloseTLSHandshake {
+		code = websocket.CloseGoingAway
+	}
+
+	msg := websocket.FormatCloseMessage(code, text)
+	_ = dst.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// clientWantsCompression checks if the client offered permessage-deflate
+func clientWantsCompression(r *http.Request) bool {
+	for _, ext := range r.Header.Values("Sec-WebSocket-Extensions") {
+		if strings.Contains(strings.ToLower(ext), "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
 // isWebSocketRequest checks if request is a WebSocket upgrade
 func (p *Proxy) isWebSocketRequest(r *http.Request) bool {
 	return strings.ToLower(r.Header.Get("Upgrade")) == "websocket" &&
@@ -315,6 +614,10 @@ func (p *Proxy) director(req *http.Request) {
 	target := route.Service.TargetURL
 
 	req.URL.Scheme = target.Scheme
+	if target.Scheme == "h2c" {
+		// Cleartext HTTP/2 is still http on the wire
+		req.URL.Scheme = "http"
+	}
 	req.URL.Host = target.Host
 	req.Host = target.Host
 
@@ -327,11 +630,12 @@ func (p *Proxy) director(req *http.Request) {
 	}
 
 	req.Header.Set("X-Forwarded-Host", req.Host)
-	req.Header.Set("X-Forwarded-Proto", "http")
+	req.Header.Set("X-Forwarded-Proto", clientip.Scheme(req))
 
-	// Add custom headers from service config
+	// Add custom headers from service config, filling {name} placeholders
+	params := router.ParamsFromContext(req.Context())
 	for key, value := range route.Service.Headers {
-		req.Header.Set(key, value)
+		req.Header.Set(key, router.ExpandParams(value, params))
 	}
 }
 
@@ -358,16 +662,136 @@ func (p *Proxy) defaultErrorHandler(w http.ResponseWriter, r *http.Request, err
 	p.logger.Printf("[error] %s %s: %v", r.Method, r.URL.Path, err)
 
 	if err == io.EOF {
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		writeError(w, r, http.StatusBadGateway, "Bad Gateway")
 		return
 	}
 
 	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-		http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+		writeError(w, r, http.StatusGatewayTimeout, "Gateway Timeout")
 		return
 	}
 
-	http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	writeError(w, r, http.StatusBadGateway, "Bad Gateway")
+}
+
+// rejectUnrouted answers a request that no explicit route matched
+func (p *Proxy) rejectUnrouted(w http.ResponseWriter, r *http.Request) {
+	if rc, ok := w.(*responseCapture); ok {
+		rc.label = inspector.LabelNoRoute
+	}
+	p.logger.Printf("[route] no route for %s %s%s", r.Method, r.Host, r.URL.Path)
+	writeError(w, r, http.StatusNotFound, "No route matches "+r.URL.Path)
+}
+
+// rejectMaintenance answers a request for a route or service under maintenance
+func (p *Proxy) rejectMaintenance(w http.ResponseWriter, r *http.Request, m *types.MaintenanceConfig) {
+	if rc, ok := w.(*responseCapture); ok {
+		rc.label = inspector.LabelMaintenance
+	}
+	if m.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+	}
+	msg := m.Message
+	if msg == "" {
+		msg = "Service is under maintenance"
+	}
+	writeError(w, r, http.StatusServiceUnavailable, msg)
+}
+
+// starting reports whether the service's managed process can't take the
+// request yet. Health checks sent through the proxy are let through, since
+// they decide when it is up.
+func (p *Proxy) starting(r *http.Request, svc *types.Service) bool {
+	return registry.ProxyCheckFrom(r.Context()) == nil && p.registry.Starting(svc.Name)
+}
+
+// rejectStarting answers a request for a managed service that is still
+// starting or restarting
+func (p *Proxy) rejectStarting(w http.ResponseWriter, r *http.Request, svc *types.Service) {
+	if rc, ok := w.(*responseCapture); ok {
+		rc.label = inspector.LabelStarting
+	}
+	w.Header().Set("Retry-After", "1")
+	writeError(w, r, http.StatusServiceUnavailable, "Service "+svc.Name+" is starting")
+}
+
+// gated reports whether the service's readiness gate holds the request.
+// viaProxy health checks pass, as they are what opens the gate.
+func (p *Proxy) gated(r *http.Request, svc *types.Service) bool {
+	return registry.ProxyCheckFrom(r.Context()) == nil && svc.Gated()
+}
+
+// rejectNotReady answers a request for a service that hasn't been healthy
+// yet, suggesting a retry after the next health check
+func (p *Proxy) rejectNotReady(w http.ResponseWriter, r *http.Request, svc *types.Service) {
+	if rc, ok := w.(*responseCapture); ok {
+		rc.label = inspector.LabelNotReady
+	}
+	retryAfter := int(math.Ceil(svc.Health.Interval.Duration().Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, r, http.StatusServiceUnavailable, "Service "+svc.Name+" is not ready")
+}
+
+// rejectsFallback reports whether strict routing refuses to send the request
+// to the default service
+func (p *Proxy) rejectsFallback(route *types.Route, r *http.Request) bool {
+	if !route.Fallback {
+		return false
+	}
+	p.settingsMu.RLock()
+	defer p.settingsMu.RUnlock()
+	if p.strictRouting {
+		return true
+	}
+	for _, prefix := range p.strictPrefixes {
+		base := strings.TrimSuffix(prefix, "/")
+		if r.URL.Path == base || strings.HasPrefix(r.URL.Path, base+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectSaturated responds with 503 when a service is at its concurrency limit
+func (p *Proxy) rejectSaturated(w http.ResponseWriter, r *http.Request, svc *types.Service, retryAfter int) {
+	p.logger.Printf("[limit] %s at max concurrency (%d), rejecting request", svc.Name, svc.MaxConcurrent)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, r, http.StatusServiceUnavailable, "Service Unavailable")
+}
+
+// SetDebugHeaders enables X-Hz-Service, X-Hz-Route-Pattern and X-Hz-Target
+// response headers. They are off by default so nothing leaks over a shared tunnel.
+func (p *Proxy) SetDebugHeaders(enabled bool) {
+	p.settingsMu.Lock()
+	defer p.settingsMu.Unlock()
+	p.debugHeaders = enabled
+}
+
+// routeHeaders returns the route debugging headers, or nil when disabled
+func (p *Proxy) routeHeaders(route *types.Route) http.Header {
+	p.settingsMu.RLock()
+	enabled := p.debugHeaders
+	p.settingsMu.RUnlock()
+	if !enabled {
+		return nil
+	}
+	h := http.Header{}
+	h.Set("X-Hz-Service", route.Service.Name)
+	h.Set("X-Hz-Route-Pattern", route.Pattern)
+	h.Set("X-Hz-Target", route.Service.Target)
+	return h
+}
+
+// SetStrictRouting makes requests that only match the default service fail
+// with 404: all of them, or those under one of prefixes
+func (p *Proxy) SetStrictRouting(all bool, prefixes []string) {
+	p.settingsMu.Lock()
+	defer p.settingsMu.Unlock()
+	p.strictRouting = all
+	p.strictPrefixes = prefixes
 }
 
 // SetErrorHandler sets a custom error handler
@@ -380,17 +804,46 @@ func (p *Proxy) SetLogger(logger *log.Logger) {
 	p.logger = logger
 }
 
-// SetInspector sets the request inspector
+// SetInspector sets the request inspector. It may be set while serving.
 func (p *Proxy) SetInspector(insp *inspector.Inspector) {
-	p.inspector = insp
+	p.inspector.Store(insp)
+}
+
+// Inspector returns the request inspector, or nil if it isn't enabled
+func (p *Proxy) Inspector() *inspector.Inspector {
+	return p.inspector.Load()
+}
+
+// SetAdmin sets the handler for internal endpoints under AdminPrefix
+func (p *Proxy) SetAdmin(handler http.Handler) {
+	p.admin = handler
+}
+
+// SetRecorder enables recording of proxied traffic to a session file
+func (p *Proxy) SetRecorder(rec *recorder.Writer) {
+	p.recorder = rec
+}
+
+// requestSource tells whether a request came through the tunnel or from a
+// local client, for the inspector
+func requestSource(r *http.Request) string {
+	if clientip.FromTunnel(r) {
+		return inspector.SourceTunnel
+	}
+	return inspector.SourceLocal
 }
 
 // Stats returns current proxy statistics
 func (p *Proxy) Stats() types.ProxyStats {
 	return types.ProxyStats{
 		TotalRequests:  atomic.LoadInt64(&p.stats.TotalRequests),
+		TunnelRequests: atomic.LoadInt64(&p.stats.TunnelRequests),
+		LocalRequests:  atomic.LoadInt64(&p.stats.LocalRequests),
 		ActiveRequests: atomic.LoadInt64(&p.stats.ActiveRequests),
 		TotalErrors:    atomic.LoadInt64(&p.stats.TotalErrors),
 		WebSocketConns: atomic.LoadInt64(&p.stats.WebSocketConns),
+		ForwardConns:   atomic.LoadInt64(&p.stats.ForwardConns),
+		BytesIn:        atomic.LoadInt64(&p.stats.BytesIn),
+		BytesOut:       atomic.LoadInt64(&p.stats.BytesOut),
 	}
 }
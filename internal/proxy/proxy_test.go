@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zymawy/hz/internal/registry"
+	"github.com/zymawy/hz/internal/router"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// newTestProxy registers services, builds their routes and returns a proxy
+// for them that logs nowhere
+func newTestProxy(t *testing.T, services ...*types.Service) *Proxy {
+	t.Helper()
+	reg := registry.New()
+	t.Cleanup(reg.Stop)
+	for _, svc := range services {
+		u, err := url.Parse(svc.Target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		svc.TargetURL = u
+		if err := reg.Register(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rtr := router.New()
+	rtr.SetLogger(log.New(io.Discard, "", 0))
+	if err := rtr.Build(services); err != nil {
+		t.Fatal(err)
+	}
+	p := New(reg, rtr)
+	p.SetLogger(log.New(io.Discard, "", 0))
+	return p
+}
+
+// TestStrictRoutingChanges applies strict routing settings while requests
+// are served, as config reloads do
+func TestStrictRoutingChanges(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	p := newTestProxy(t,
+		&types.Service{Name: "web", Target: backend.URL, Default: true},
+		&types.Service{Name: "api", Target: backend.URL, Routes: []types.RouteConfig{{Path: "/api/*"}}},
+	)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			get("/elsewhere")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		p.SetStrictRouting(i%2 == 0, []string{"/api"})
+		p.SetDebugHeaders(i%2 == 0)
+	}
+	wg.Wait()
+
+	tests := []struct {
+		strict   bool
+		prefixes []string
+		path     string
+		want     int
+	}{
+		{false, nil, "/elsewhere", http.StatusOK},
+		{true, nil, "/elsewhere", http.StatusNotFound},
+		{false, []string{"/admin/"}, "/admin", http.StatusNotFound},
+		{false, []string{"/admin/"}, "/admin/users", http.StatusNotFound},
+		{false, []string{"/admin/"}, "/administrator", http.StatusOK},
+		{true, nil, "/api/v1", http.StatusOK},
+		{false, nil, "/api/v1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		p.SetStrictRouting(tt.strict, tt.prefixes)
+		if got := get(tt.path); got != tt.want {
+			t.Errorf("strict %v, prefixes %q: %s answered %d, want %d", tt.strict, tt.prefixes, tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestRouteHeaders reports the route that won, including the default
+// service's fallback, and only when debug headers are enabled
+func TestRouteHeaders(t *testing.T) {
+	web, api := namedBackend(t, "web"), namedBackend(t, "api")
+	p := newTestProxy(t,
+		&types.Service{Name: "web", Target: web.URL, Default: true},
+		&types.Service{Name: "api", Target: api.URL, Routes: []types.RouteConfig{{Path: "/api/*"}}},
+	)
+
+	tests := []struct {
+		path    string
+		service string
+		pattern string
+		target  string
+	}{
+		{"/api/users", "api", "/api/*", api.URL},
+		{"/home", "web", "*", web.URL},
+	}
+	for _, debug := range []bool{true, false} {
+		p.SetDebugHeaders(debug)
+		for _, tt := range tests {
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: %d", tt.path, rec.Code)
+			}
+			h := rec.Header()
+			if !debug {
+				for name := range h {
+					if strings.HasPrefix(name, "X-Hz-") {
+						t.Errorf("%s: %s sent with debug headers disabled", tt.path, name)
+					}
+				}
+				continue
+			}
+			if h.Get("X-Hz-Service") != tt.service || h.Get("X-Hz-Route-Pattern") != tt.pattern || h.Get("X-Hz-Target") != tt.target {
+				t.Errorf("%s: X-Hz-Service %q, X-Hz-Route-Pattern %q, X-Hz-Target %q; want %q, %q, %q", tt.path,
+					h.Get("X-Hz-Service"), h.Get("X-Hz-Route-Pattern"), h.Get("X-Hz-Target"), tt.service, tt.pattern, tt.target)
+			}
+		}
+	}
+}
+
+// TestTrailingSlashRedirect checks that the redirect policy answers with a
+// 308, so clients repeat POSTs with their body, before the backend is called
+func TestTrailingSlashRedirect(t *testing.T) {
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.RequestURI(), body)
+	}))
+	defer backend.Close()
+	p := newTestProxy(t, &types.Service{Name: "api", Target: backend.URL, Default: true})
+	p.router.SetTrailingSlash(types.TrailingSlashRedirect)
+	front := httptest.NewServer(p)
+	defer front.Close()
+
+	resp, err := http.Post(front.URL+"/api/users/?page=2", "text/plain", strings.NewReader("name=ann"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got, want := string(body), "POST /api/users?page=2 name=ann"; got != want || calls.Load() != 1 {
+		t.Errorf("after the redirect the backend got %q in %d calls, want %q once", got, calls.Load(), want)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		req, _ := http.NewRequest(method, front.URL+"/api/users/?page=2", strings.NewReader("x"))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != "/api/users?page=2" {
+			t.Errorf("%s: %d to %q, want 308 to /api/users?page=2", method, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+
+	resp, err = client.Get(front.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/: %d, want 200 without a redirect", resp.StatusCode)
+	}
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/internal/config"
+	"github.com/zymawy/hz/internal/tunnel"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestStreamSSE streams server-sent events for two minutes through the
+// local listener and a tunnel, both with the default listener timeouts:
+// neither cuts the stream off, and every event arrives before the backend
+// sends the next one
+func TestStreamSSE(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams for two minutes")
+	}
+	const (
+		streamFor = 2 * time.Minute
+		every     = 2 * time.Second
+	)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for i := 0; i < int(streamFor/every); i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			flusher.Flush()
+			time.Sleep(every)
+		}
+		fmt.Fprint(w, "data: done\n\n")
+	}))
+	t.Cleanup(backend.Close)
+	p := newTestProxy(t, &types.Service{Name: "events", Target: backend.URL, Default: true})
+	server := defaultServerConfig(t)
+
+	local := httptest.NewUnstartedServer(p)
+	server.ApplyTimeouts(local.Config)
+	local.Start()
+	t.Cleanup(local.Close)
+
+	listeners := []struct{ name, url string }{
+		{"local", local.URL},
+		{"tunnel", stubTunnel(t, p, server)},
+	}
+	// Both at once: a pooled tunnel connection left idle meanwhile would
+	// reach the idle timeout
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(name, url string) {
+			defer wg.Done()
+			if err := readEvents(url+"/events", int(streamFor/every), every); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}(l.name, l.url)
+	}
+	wg.Wait()
+}
+
+// readEvents reads a stream of n numbered events, one per every, then a
+// final "done" one. Event i is sent (i*every) after the backend got the
+// request: it must arrive before event i+1 could have been sent.
+func readEvents(url string, n int, every time.Duration) error {
+	start := time.Now()
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	received := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if line == "data: done" {
+			break
+		}
+		if want := fmt.Sprintf("data: %d", received); line != want {
+			return fmt.Errorf("got %q, want %q", line, want)
+		}
+		if elapsed := time.Since(start); elapsed >= time.Duration(received+1)*every {
+			return fmt.Errorf("event %d arrived after %s: the response was buffered", received, elapsed.Round(time.Millisecond))
+		}
+		received++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("stream broke after %s: %w", time.Since(start).Round(time.Second), err)
+	}
+	if received != n {
+		return fmt.Errorf("stream ended after %s and %d events", time.Since(start).Round(time.Second), received)
+	}
+	return nil
+}
+
+// defaultServerConfig returns the server settings of a config that sets
+// none, with their defaults applied
+func defaultServerConfig(t *testing.T) types.ServerConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hz.yaml")
+	data := "services:\n  - name: events\n    target: http://localhost:5000\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := config.NewManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+	return m.Get().Server
+}
+
+// stubTunnel opens a localtunnel tunnel to handler through an in-process
+// server and returns the URL that reaches handler through it. Like a
+// localtunnel server, it relays each public connection over one of the
+// connections the client pooled.
+func stubTunnel(t *testing.T, handler http.Handler, server types.ServerConfig) string {
+	t.Helper()
+	pool, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	public, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { public.Close() })
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":             "stub",
+			"port":           pool.Addr().(*net.TCPAddr).Port,
+			"max_conn_count": 2,
+			"url":            "http://" + public.Addr().String(),
+		})
+	}))
+	t.Cleanup(api.Close)
+
+	go func() {
+		for {
+			client, err := public.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				pooled, err := pool.Accept()
+				if err != nil {
+					client.Close()
+					return
+				}
+				go func() {
+					_, _ = io.Copy(pooled, client)
+					pooled.Close()
+				}()
+				_, _ = io.Copy(client, pooled)
+				client.Close()
+			}()
+		}
+	}()
+
+	m := tunnel.New(&types.TunnelConfig{Enabled: true, Provider: tunnel.ProviderLocaltunnel, Server: api.URL})
+	m.SetLogger(log.New(io.Discard, "", 0))
+	m.SetServerConfig(server)
+	if err := m.Start(handler); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = m.Stop() })
+	return m.GetPublicURL()
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// backendTransport sends requests for h2c:// services over cleartext HTTP/2
+// (as gRPC servers without TLS expect) and everything else over HTTP/1.1,
+// or HTTP/2 when the backend negotiates it over TLS
+type backendTransport struct {
+	http *http.Transport
+	h2c  *http2.Transport
+}
+
+// newBackendTransport creates the transport used for all proxied requests
+func newBackendTransport() *backendTransport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &backendTransport{
+		http: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// RoundTrip dispatches on the matched service's target scheme
+func (t *backendTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if route := routeFromContext(req.Context()); route != nil && route.Service.TargetURL.Scheme == "h2c" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.http.RoundTrip(req)
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// wsBackend is an echo server that reports how its connection ended
+type wsBackend struct {
+	*httptest.Server
+	closed     chan error  // the error ReadMessage ended with
+	extensions chan string // Sec-WebSocket-Extensions hz offered
+}
+
+func newWSBackend(t *testing.T, compression bool) *wsBackend {
+	t.Helper()
+	b := &wsBackend{closed: make(chan error, 1), extensions: make(chan string, 1)}
+	upgrader := websocket.Upgrader{EnableCompression: compression}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.extensions <- r.Header.Get("Sec-WebSocket-Extensions")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			msgType, msg, err := conn.ReadMessage()
+			if err != nil {
+				b.closed <- err
+				return
+			}
+			if err := conn.WriteMessage(msgType, msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// dialProxy serves a single websocket service through hz and connects to it
+func dialProxy(t *testing.T, backend *wsBackend, cfg *types.WebSocketConfig, compression bool) (*websocket.Conn, *http.Response) {
+	t.Helper()
+	p := newTestProxy(t, &types.Service{Name: "ws", Target: backend.URL, Default: true, WebSocket: cfg})
+	front := httptest.NewServer(p)
+	t.Cleanup(front.Close)
+
+	dialer := websocket.Dialer{EnableCompression: compression}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(front.URL, "http")+"/socket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, resp
+}
+
+// TestWebSocketMessageTooBig sends a message over maxMessageSize: both the
+// client and the backend are told 1009
+func TestWebSocketMessageTooBig(t *testing.T) {
+	backend := newWSBackend(t, false)
+	client, _ := dialProxy(t, backend, &types.WebSocketConfig{MaxMessageSize: 16}, false)
+
+	if err := client.WriteMessage(websocket.TextMessage, []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := client.ReadMessage(); err != nil || string(msg) != "small" {
+		t.Fatalf("echo %q, %v", msg, err)
+	}
+
+	if err := client.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 100))); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("client read %v, want close 1009", err)
+	}
+
+	select {
+	case err := <-backend.closed:
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Errorf("backend read %v, want close 1009", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the backend wasn't closed")
+	}
+}
+
+// TestWebSocketCompression echoes through hz with permessage-deflate
+// negotiated on both sides, and only offers it to the backend when the
+// client asked for it
+func TestWebSocketCompression(t *testing.T) {
+	for _, clientWants := range []bool{true, false} {
+		backend := newWSBackend(t, true)
+		client, resp := dialProxy(t, backend, &types.WebSocketConfig{EnableCompression: true}, clientWants)
+
+		offered := strings.Contains(<-backend.extensions, "permessage-deflate")
+		accepted := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		if offered != clientWants || accepted != clientWants {
+			t.Errorf("client asked for compression: %v; offered to the backend: %v, accepted: %v", clientWants, offered, accepted)
+		}
+
+		msg := strings.Repeat("compress me ", 200)
+		if err := client.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if _, got, err := client.ReadMessage(); err != nil || string(got) != msg {
+			t.Fatalf("echo of %d bytes: %d bytes, %v", len(msg), len(got), err)
+		}
+
+		client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+		var closeErr *websocket.CloseError
+		if err := <-backend.closed; !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure || closeErr.Text != "bye" {
+			t.Errorf("backend closed with %v, want 1000 bye", err)
+		}
+	}
+}
+
+func TestUpgraderFor(t *testing.T) {
+	p := New(nil, nil)
+	if u := p.upgraderFor(nil); u.ReadBufferSize != defaultWSReadBufferSize || u.WriteBufferSize != defaultWSWriteBufferSize || u.EnableCompression {
+		t.Errorf("default upgrader: %+v", u)
+	}
+	u := p.upgraderFor(&types.WebSocketConfig{ReadBufferSize: 8192, EnableCompression: true})
+	if u.ReadBufferSize != 8192 || u.WriteBufferSize != defaultWSWriteBufferSize || !u.EnableCompression {
+		t.Errorf("configured upgrader: %+v", u)
+	}
+}
+
+func TestForwardClose(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantText string
+	}{
+		{"close frame", &websocket.CloseError{Code: 4001, Text: "kicked"}, 4001, "kicked"},
+		{"read limit", websocket.ErrReadLimit, websocket.CloseMessageTooBig, "message too big"},
+		{"abnormal", &websocket.CloseError{Code: websocket.CloseAbnormalClosure}, websocket.CloseGoingAway, ""},
+		{"connection lost", errors.New("read: connection reset"), websocket.CloseGoingAway, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newWSBackend(t, false)
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(backend.URL, "http"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			forwardClose(conn, tt.err)
+			var closeErr *websocket.CloseError
+			if err := <-backend.closed; !errors.As(err, &closeErr) || closeErr.Code != tt.wantCode || closeErr.Text != tt.wantText {
+				t.Errorf("backend closed with %v, want %d %q", err, tt.wantCode, tt.wantText)
+			}
+		})
+	}
+}
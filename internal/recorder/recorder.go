@@ -0,0 +1,326 @@
+// Package recorder records proxied traffic to session files and replays it
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// FormatVersion is the session file format version written by this build
+const FormatVersion = 1
+
+// MaxBody is the most of a response body kept per entry; longer bodies,
+// like event streams, are cut off there and the entry marked truncated
+const MaxBody = 1 << 20
+
+// Redacted replaces the values of credential headers in session files
+const Redacted = "[redacted]"
+
+// credentialHeaders are request headers whose values aren't written to
+// session files, which get shared, unless the session matches on them
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// Header is the first line of a session file
+type Header struct {
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Match     types.ReplayConfig `json:"match"`
+}
+
+// Entry is a single recorded request/response exchange
+type Entry struct {
+	RecordedAt      time.Time           `json:"recordedAt"`
+	Service         string              `json:"service,omitempty"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	Query           string              `json:"query,omitempty"`
+	RequestHeaders  map[string][]string `json:"requestHeaders,omitempty"`
+	StatusCode      int                 `json:"statusCode"`
+	ResponseHeaders map[string][]string `json:"responseHeaders,omitempty"`
+	Body            []byte              `json:"body,omitempty"`      // base64 encoded by encoding/json
+	Truncated       bool                `json:"truncated,omitempty"` // Body is the first MaxBody bytes
+}
+
+// Writer appends recorded exchanges to an NDJSON session file
+type Writer struct {
+	match types.ReplayConfig
+	file  *os.File
+	buf   *bufio.Writer
+	enc   *json.Encoder
+	mu    sync.Mutex
+	count int
+}
+
+// Create creates a session file and writes its header
+func Create(path string, match types.ReplayConfig) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session file: %w", err)
+	}
+
+	buf := bufio.NewWriter(file)
+	w := &Writer{
+		match: match,
+		file:  file,
+		buf:   buf,
+		enc:   json.NewEncoder(buf),
+	}
+
+	header := Header{
+		Version:   FormatVersion,
+		CreatedAt: time.Now(),
+		Match:     match,
+	}
+	if err := w.enc.Encode(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write session header: %w", err)
+	}
+
+	return w, nil
+}
+
+// Record appends an entry to the session file, with credential headers
+// redacted
+func (w *Writer) Record(entry Entry) error {
+	entry.RequestHeaders = w.redact(entry.RequestHeaders)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.enc.Encode(entry); err != nil {
+		return err
+	}
+	w.count++
+	return w.buf.Flush()
+}
+
+// redact returns headers with the values of credential headers replaced by
+// Redacted, keeping those the session's requests are matched on
+func (w *Writer) redact(headers map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		out[name] = values
+	}
+	for _, name := range credentialHeaders {
+		values, ok := out[name]
+		if !ok || w.matches(name) {
+			continue
+		}
+		redacted := make([]string, len(values))
+		for i := range redacted {
+			redacted[i] = Redacted
+		}
+		out[name] = redacted
+	}
+	return out
+}
+
+// matches reports whether the session's requests are matched on a header
+func (w *Writer) matches(name string) bool {
+	for _, h := range w.match.MatchHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of recorded entries
+func (w *Writer) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+// Close flushes and closes the session file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Replayer serves recorded responses for matching requests
+type Replayer struct {
+	match   types.ReplayConfig
+	entries map[string][]Entry
+	served  map[string]int
+	mu      sync.Mutex
+}
+
+// Load reads a session file, merging its match rules with the service overrides
+func Load(path string, override *types.ReplayConfig) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("session file %s is empty", path)
+	}
+
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("invalid session header: %w", err)
+	}
+	if header.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported session format version %d (expected %d)", header.Version, FormatVersion)
+	}
+
+	rp := &Replayer{
+		match:   mergeMatch(header.Match, override),
+		entries: make(map[string][]Entry),
+		served:  make(map[string]int),
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid session entry on line %d: %w", line, err)
+		}
+
+		key := rp.key(entry.Method, entry.Path, entry.Query, entry.RequestHeaders)
+		rp.entries[key] = append(rp.entries[key], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+
+	return rp, nil
+}
+
+// ServeHTTP writes the recorded response for the request, or 501 if none matches.
+// Repeated requests replay recorded responses in order, repeating the last one.
+func (rp *Replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := rp.key(r.Method, r.URL.Path, r.URL.RawQuery, r.Header)
+
+	rp.mu.Lock()
+	entries := rp.entries[key]
+	if len(entries) == 0 {
+		rp.mu.Unlock()
+		http.Error(w, fmt.Sprintf("No recorded response for %s %s", r.Method, r.URL.Path), http.StatusNotImplemented)
+		return
+	}
+	idx := rp.served[key]
+	if idx >= len(entries) {
+		idx = len(entries) - 1
+	}
+	rp.served[key] = idx + 1
+	entry := entries[idx]
+	rp.mu.Unlock()
+
+	for name, values := range entry.ResponseHeaders {
+		// Length is recomputed from the recorded body
+		if strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.Header().Set("X-Hz-Replay", "true")
+	if entry.Truncated {
+		w.Header().Set("X-Hz-Replay-Truncated", "true")
+	}
+	w.WriteHeader(entry.StatusCode)
+	_, _ = w.Write(entry.Body)
+}
+
+// Len returns the number of distinct request keys in the session
+func (rp *Replayer) Len() int {
+	return len(rp.entries)
+}
+
+// key builds the lookup key from method, path, filtered query and selected headers
+func (rp *Replayer) key(method, path, rawQuery string, headers map[string][]string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToUpper(method))
+	sb.WriteString(" ")
+	sb.WriteString(path)
+
+	if q := normalizeQuery(rawQuery, rp.match.IgnoreQuery); q != "" {
+		sb.WriteString("?")
+		sb.WriteString(q)
+	}
+
+	h := http.Header(headers)
+	for _, name := range rp.match.MatchHeaders {
+		sb.WriteString("\n")
+		sb.WriteString(strings.ToLower(name))
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(h.Values(name), ", "))
+	}
+
+	return sb.String()
+}
+
+// normalizeQuery sorts query parameters and drops ignored ones
+func normalizeQuery(rawQuery string, ignore []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	for _, name := range ignore {
+		values.Del(name)
+	}
+	for _, v := range values {
+		sort.Strings(v)
+	}
+
+	// Encode sorts by key
+	return values.Encode()
+}
+
+// mergeMatch combines the session's recorded rules with service-level overrides
+func mergeMatch(base types.ReplayConfig, override *types.ReplayConfig) types.ReplayConfig {
+	if override == nil {
+		return base
+	}
+
+	ignoredHeaders := make(map[string]bool)
+	for _, h := range override.IgnoreHeaders {
+		ignoredHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+
+	merged := types.ReplayConfig{}
+	seen := make(map[string]bool)
+	for _, h := range append(append([]string{}, base.MatchHeaders...), override.MatchHeaders...) {
+		h = http.CanonicalHeaderKey(h)
+		if seen[h] || ignoredHeaders[h] {
+			continue
+		}
+		seen[h] = true
+		merged.MatchHeaders = append(merged.MatchHeaders, h)
+	}
+
+	merged.IgnoreQuery = append(append([]string{}, base.IgnoreQuery...), override.IgnoreQuery...)
+	return merged
+}
@@ -0,0 +1,192 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// writeSession records entries to a new session file and returns its path
+func writeSession(t *testing.T, match types.ReplayConfig, entries ...Entry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "session.hzr")
+	w, err := Create(path, match)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := w.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Count() != len(entries) {
+		t.Errorf("Count() = %d, want %d", w.Count(), len(entries))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// replay serves a request from the replayer and returns the response
+func replay(rp *Replayer, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	rp.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestReplay(t *testing.T) {
+	path := writeSession(t, types.ReplayConfig{IgnoreQuery: []string{"_ts"}},
+		Entry{Method: "GET", Path: "/api/users", Query: "page=1&_ts=1", StatusCode: 200,
+			ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}, "Content-Length": {"99"}},
+			Body:            []byte(`["ann"]`)},
+		Entry{Method: "GET", Path: "/api/users", Query: "page=1&_ts=2", StatusCode: 200, Body: []byte(`["ann","bob"]`)},
+		Entry{Method: "POST", Path: "/api/users", StatusCode: 201, Body: []byte("created")},
+		Entry{Method: "GET", Path: "/events", StatusCode: 200, Body: []byte("data: 1\n"), Truncated: true},
+	)
+	rp, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", rp.Len())
+	}
+
+	tests := []struct {
+		method, target string
+		code           int
+		body           string
+	}{
+		// Recorded in order, then the last one again
+		{"GET", "/api/users?_ts=9&page=1", 200, `["ann"]`},
+		{"GET", "/api/users?page=1", 200, `["ann","bob"]`},
+		{"GET", "/api/users?page=1&_ts=3", 200, `["ann","bob"]`},
+		{"POST", "/api/users", 201, "created"},
+		{"GET", "/api/users?page=2", 501, "No recorded response for GET /api/users\n"},
+		{"DELETE", "/api/users", 501, "No recorded response for DELETE /api/users\n"},
+	}
+	for _, tt := range tests {
+		rec := replay(rp, tt.method, tt.target, nil)
+		if rec.Code != tt.code || rec.Body.String() != tt.body {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.target, rec.Code, rec.Body, tt.code, tt.body)
+		}
+		if tt.code != 501 && rec.Header().Get("X-Hz-Replay") != "true" {
+			t.Errorf("%s %s: no X-Hz-Replay header", tt.method, tt.target)
+		}
+	}
+
+	rec := replay(rp, "GET", "/api/users?page=1", nil)
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Errorf("recorded Content-Length %q replayed", got)
+	}
+	rec = replay(rp, "GET", "/events", nil)
+	if rec.Header().Get("X-Hz-Replay-Truncated") != "true" {
+		t.Error("truncated body replayed without X-Hz-Replay-Truncated")
+	}
+	rec = replay(rp, "GET", "/api/users?page=1&_ts=0", nil)
+	if rec.Header().Get("X-Hz-Replay-Truncated") != "" {
+		t.Error("whole body replayed with X-Hz-Replay-Truncated")
+	}
+}
+
+func TestReplayMatchHeaders(t *testing.T) {
+	path := writeSession(t, types.ReplayConfig{MatchHeaders: []string{"Accept"}},
+		Entry{Method: "GET", Path: "/", RequestHeaders: map[string][]string{"Accept": {"text/html"}}, StatusCode: 200, Body: []byte("html")},
+		Entry{Method: "GET", Path: "/", RequestHeaders: map[string][]string{"Accept": {"application/json"}}, StatusCode: 200, Body: []byte("json")},
+	)
+
+	rp, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for accept, want := range map[string]string{"text/html": "html", "application/json": "json"} {
+		if got := replay(rp, "GET", "/", http.Header{"Accept": {accept}}).Body.String(); got != want {
+			t.Errorf("Accept %s replayed %q, want %q", accept, got, want)
+		}
+	}
+
+	// The service can stop matching on a header the session recorded
+	rp, err = Load(path, &types.ReplayConfig{IgnoreHeaders: []string{"accept"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := replay(rp, "GET", "/", http.Header{"Accept": {"image/png"}}); rec.Code != 200 {
+		t.Errorf("ignored header still matched: %d", rec.Code)
+	}
+}
+
+// TestRecordRedactsCredentials keeps cookies and credentials out of
+// session files unless requests are matched on them
+func TestRecordRedactsCredentials(t *testing.T) {
+	headers := http.Header{
+		"Authorization":       {"Bearer s3cret"},
+		"Proxy-Authorization": {"Basic czNjcmV0"},
+		"Cookie":              {"session=s3cret", "theme=dark"},
+		"Accept":              {"text/html"},
+	}
+	path := writeSession(t, types.ReplayConfig{MatchHeaders: []string{"cookie"}},
+		Entry{Method: "GET", Path: "/", RequestHeaders: headers, StatusCode: 200})
+	if headers.Get("Authorization") != "Bearer s3cret" {
+		t.Error("the caller's headers were changed")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	scanner.Scan()
+	var entry Entry
+	if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"Authorization":       {Redacted},
+		"Proxy-Authorization": {Redacted},
+		"Cookie":              {"session=s3cret", "theme=dark"}, // matched on
+		"Accept":              {"text/html"},
+	}
+	for name, values := range want {
+		got := entry.RequestHeaders[name]
+		if len(got) != len(values) || (len(got) > 0 && got[0] != values[0]) {
+			t.Errorf("%s recorded as %q, want %q", name, got, values)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"empty", "", "is empty"},
+		{"bad header", "nope\n", "invalid session header"},
+		{"version", `{"version":2}` + "\n", "unsupported session format version 2 (expected 1)"},
+		{"bad entry", `{"version":1}` + "\n\n{\n", "invalid session entry on line 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.hzr")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
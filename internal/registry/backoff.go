@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// defaultMaxInterval caps the health check backoff unless maxInterval is set
+const defaultMaxInterval = 5 * time.Minute
+
+// maxInterval returns the configured backoff cap or its default
+func maxInterval(h *types.HealthConfig) time.Duration {
+	if h.MaxInterval > 0 {
+		return h.MaxInterval.Duration()
+	}
+	return defaultMaxInterval
+}
+
+// backoffInterval returns the check interval after the given number of
+// consecutive failures: the normal interval below the unhealthy threshold,
+// then doubling with each failure from the threshold on, up to max
+func backoffInterval(interval, max time.Duration, failures, threshold int) time.Duration {
+	if failures < threshold || interval <= 0 || max <= interval {
+		return interval
+	}
+	d := interval
+	for i := threshold; i <= failures && d < max; i++ {
+		d *= 2
+	}
+	return min(d, max)
+}
+
+// nextInterval returns the gap before a service's next check and the backoff
+// in effect, if any. A managed service whose process is starting is checked
+// at least every startingInterval instead.
+func (r *Registry) nextInterval(service *types.Service, health *types.HealthConfig) (interval, backoff time.Duration) {
+	if r.isStarting(service.Name) {
+		return min(health.Interval.Duration(), startingInterval), 0
+	}
+
+	failures, _ := service.Streaks()
+	_, unhealthy := thresholds(health)
+	interval = backoffInterval(health.Interval.Duration(), maxInterval(health), failures, unhealthy)
+	if interval > health.Interval.Duration() {
+		backoff = interval
+	}
+	return interval, backoff
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// fakeClock stands in for the registry's sleep, so health loops run one
+// check per tick instead of waiting for real
+type fakeClock struct {
+	sleeps chan time.Duration // each wait a loop asks for
+	ticks  chan struct{}      // ends the pending wait
+}
+
+// newFakeClock installs a fake clock in r, which must not have any health
+// loops yet
+func newFakeClock(r *Registry) *fakeClock {
+	c := &fakeClock{sleeps: make(chan time.Duration), ticks: make(chan struct{})}
+	r.sleep = func(ctx context.Context, d time.Duration) bool {
+		select {
+		case c.sleeps <- d:
+		case <-ctx.Done():
+			return false
+		}
+		select {
+		case <-c.ticks:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return c
+}
+
+// next returns the wait a health loop asks for next
+func (c *fakeClock) next(t *testing.T) time.Duration {
+	t.Helper()
+	select {
+	case d := <-c.sleeps:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the health loop to sleep")
+		return 0
+	}
+}
+
+// tick ends the pending wait, running the next check
+func (c *fakeClock) tick() {
+	c.ticks <- struct{}{}
+}
+
+func TestBackoffInterval(t *testing.T) {
+	tests := []struct {
+		interval, max       time.Duration
+		failures, threshold int
+		want                time.Duration
+	}{
+		{10 * time.Second, time.Minute, 0, 3, 10 * time.Second},
+		{10 * time.Second, time.Minute, 2, 3, 10 * time.Second},
+		{10 * time.Second, time.Minute, 3, 3, 20 * time.Second},
+		{10 * time.Second, time.Minute, 4, 3, 40 * time.Second},
+		{10 * time.Second, time.Minute, 5, 3, time.Minute},
+		{10 * time.Second, time.Minute, 1000, 3, time.Minute},
+		{10 * time.Second, 5 * time.Second, 5, 3, 10 * time.Second}, // cap below the interval
+		{0, time.Minute, 5, 3, 0},
+	}
+	for _, tt := range tests {
+		got := backoffInterval(tt.interval, tt.max, tt.failures, tt.threshold)
+		if got != tt.want {
+			t.Errorf("backoffInterval(%v, %v, %d, %d) = %v, want %v",
+				tt.interval, tt.max, tt.failures, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+// TestHealthBackoff fails a service's checks for a while: the loop waits
+// longer after each failure from the unhealthy threshold on, up to
+// maxInterval, and goes back to the interval after the first pass
+func TestHealthBackoff(t *testing.T) {
+	var failing atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	r := New()
+	defer r.Stop()
+	r.random = func() float64 { return 0.5 } // no jitter
+	clock := newFakeClock(r)
+
+	svc := testService("api", backend.URL, 10*time.Second)
+	svc.Health.InitialDelay = types.Duration(time.Second)
+	svc.Health.UnhealthyThreshold = 2
+	svc.Health.MaxInterval = types.Duration(time.Minute)
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	if d := clock.next(t); d != time.Second {
+		t.Fatalf("first wait = %v, want the initial delay", d)
+	}
+
+	steps := []struct {
+		fail    bool
+		wait    time.Duration
+		backoff time.Duration
+	}{
+		{false, 10 * time.Second, 0},
+		{true, 10 * time.Second, 0},
+		{true, 20 * time.Second, 20 * time.Second},
+		{true, 40 * time.Second, 40 * time.Second},
+		{true, time.Minute, time.Minute},
+		{true, time.Minute, time.Minute},
+		{false, 10 * time.Second, 0},
+		{true, 10 * time.Second, 0},
+	}
+	for i, step := range steps {
+		failing.Store(step.fail)
+		start := time.Now()
+		clock.tick()
+		wait := clock.next(t)
+
+		failures, _ := svc.Streaks()
+		next, backoff := svc.Schedule()
+		if wait != step.wait || backoff != step.backoff {
+			t.Errorf("check %d (%d failures): waits %v with backoff %v, want %v with %v",
+				i+1, failures, wait, backoff, step.wait, step.backoff)
+		}
+		if next.Before(start.Add(wait)) || next.After(time.Now().Add(wait)) {
+			t.Errorf("check %d: next check at %v, want %v from now", i+1, next, wait)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// healthMethods lists the HTTP methods a health check may use
+var healthMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// statusRange is an inclusive range of HTTP status codes
+type statusRange struct {
+	lo, hi int
+}
+
+// defaultExpectStatus accepts any 2xx response
+var defaultExpectStatus = []statusRange{{200, 299}}
+
+// Default consecutive results needed to change health status
+const (
+	defaultHealthyThreshold   = 1
+	defaultUnhealthyThreshold = 3
+)
+
+// thresholds returns the healthy and unhealthy thresholds, applying defaults
+func thresholds(h *types.HealthConfig) (healthy, unhealthy int) {
+	healthy, unhealthy = h.HealthyThreshold, h.UnhealthyThreshold
+	if healthy <= 0 {
+		healthy = defaultHealthyThreshold
+	}
+	if unhealthy <= 0 {
+		unhealthy = defaultUnhealthyThreshold
+	}
+	return healthy, unhealthy
+}
+
+// HealthURL returns the URL an HTTP health check requests. The health path is
+// joined to the target's base path, so target http://host/app with path
+// /health checks http://host/app/health. A query on the health path is kept,
+// and h2c targets are checked over plain HTTP.
+func HealthURL(service *types.Service) (string, error) {
+	target := service.TargetURL
+	if target == nil {
+		var err error
+		if target, err = url.Parse(service.Target); err != nil {
+			return "", fmt.Errorf("invalid target: %w", err)
+		}
+	}
+
+	ref, err := url.Parse(service.Health.Path)
+	if err != nil {
+		return "", fmt.Errorf("invalid health path: %w", err)
+	}
+
+	u := target.JoinPath(ref.Path)
+	if ref.RawQuery != "" {
+		u.RawQuery = ref.RawQuery
+	}
+	u.Fragment = ""
+	if u.Scheme == "h2c" {
+		u.Scheme = "http"
+	}
+	return u.String(), nil
+}
+
+// healthMethod returns the health check's HTTP method, GET by default
+func healthMethod(h *types.HealthConfig) string {
+	if h.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(h.Method)
+}
+
+// ValidateHealth checks a health check's method, expected status codes and
+// body assertions
+func ValidateHealth(h *types.HealthConfig) error {
+	if h.HealthyThreshold < 0 || h.UnhealthyThreshold < 0 {
+		return fmt.Errorf("health thresholds must not be negative")
+	}
+	if h.ReadinessGate && !h.Enabled() {
+		return fmt.Errorf("readinessGate needs a health check to open it")
+	}
+	if h.InitialDelay < 0 {
+		return fmt.Errorf("initialDelay must not be negative")
+	}
+	if h.DegradedAfter < 0 {
+		return fmt.Errorf("degradedAfter must not be negative")
+	}
+	if h.MaxInterval < 0 {
+		return fmt.Errorf("maxInterval must not be negative")
+	}
+	if h.MaxInterval > 0 && h.MaxInterval < h.Interval {
+		return fmt.Errorf("maxInterval (%s) must not be shorter than interval (%s)", h.MaxInterval, h.Interval)
+	}
+	if h.DependencyTimeout < 0 {
+		return fmt.Errorf("dependencyTimeout must not be negative")
+	}
+	if h.DegradedAfter > 0 && h.Timeout > 0 && h.DegradedAfter >= h.Timeout {
+		return fmt.Errorf("degradedAfter (%s) must be shorter than timeout (%s)", h.DegradedAfter, h.Timeout)
+	}
+
+	switch h.Type {
+	case "", types.HealthCheckHTTP:
+		if h.Ping {
+			return fmt.Errorf("ping only applies to websocket health checks")
+		}
+	case types.HealthCheckWebSocket:
+		if h.ViaProxy {
+			return fmt.Errorf("viaProxy doesn't apply to websocket health checks")
+		}
+		if h.Method != "" || h.ExpectStatus != nil || h.ExpectBodyContains != "" || h.ExpectJSON != nil {
+			return fmt.Errorf("method, expectStatus and body assertions don't apply to websocket health checks")
+		}
+		return nil
+	case types.HealthCheckTCP:
+		if h.Path != "" || h.ViaProxy || h.Ping {
+			return fmt.Errorf("path, viaProxy and ping don't apply to tcp health checks")
+		}
+		if h.Method != "" || h.ExpectStatus != nil || h.ExpectBodyContains != "" || h.ExpectJSON != nil {
+			return fmt.Errorf("method, expectStatus and body assertions don't apply to tcp health checks")
+		}
+		return nil
+	case types.HealthCheckExec:
+		if len(h.Command) == 0 {
+			return fmt.Errorf("exec health check requires a command")
+		}
+		if h.ViaProxy {
+			return fmt.Errorf("viaProxy only applies to http health checks")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown health check type %q (want http, websocket, tcp or exec)", h.Type)
+	}
+	if h.ViaProxy && (h.TLS != nil || h.FollowRedirects != nil) {
+		return fmt.Errorf("tls and followRedirects don't apply to viaProxy checks")
+	}
+	if h.Method != "" && !healthMethods[strings.ToUpper(h.Method)] {
+		return fmt.Errorf("unsupported health check method %q", h.Method)
+	}
+	if h.ExpectStatus != nil && len(h.ExpectStatus) == 0 {
+		return fmt.Errorf("expectStatus must list at least one status code")
+	}
+	if _, err := parseExpectStatus(h.ExpectStatus); err != nil {
+		return err
+	}
+	if h.ExpectJSON != nil && h.ExpectJSON.Path == "" {
+		return fmt.Errorf("expectJson requires a path")
+	}
+	if healthMethod(h) == http.MethodHead && (h.ExpectBodyContains != "" || h.ExpectJSON != nil) {
+		return fmt.Errorf("body assertions need a method that returns a body, not HEAD")
+	}
+	return nil
+}
+
+// parseExpectStatus parses status codes ("204"), ranges ("200-299") and
+// classes ("2xx"), defaulting to 2xx
+func parseExpectStatus(specs []string) ([]statusRange, error) {
+	if len(specs) == 0 {
+		return defaultExpectStatus, nil
+	}
+
+	ranges := make([]statusRange, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		var sr statusRange
+		var err error
+		switch {
+		case len(spec) == 3 && strings.HasSuffix(strings.ToLower(spec), "xx"):
+			var class int
+			class, err = strconv.Atoi(spec[:1])
+			sr = statusRange{class * 100, class*100 + 99}
+		case strings.Contains(spec, "-"):
+			lo, hi, _ := strings.Cut(spec, "-")
+			if sr.lo, err = strconv.Atoi(strings.TrimSpace(lo)); err == nil {
+				sr.hi, err = strconv.Atoi(strings.TrimSpace(hi))
+			}
+		default:
+			sr.lo, err = strconv.Atoi(spec)
+			sr.hi = sr.lo
+		}
+		if err != nil || sr.lo < 100 || sr.hi > 599 || sr.lo > sr.hi {
+			return nil, fmt.Errorf("invalid expectStatus %q: want a code, a range like 200-299 or a class like 2xx", spec)
+		}
+		ranges = append(ranges, sr)
+	}
+	return ranges, nil
+}
+
+// expectedStatus reports whether code falls in one of the ranges
+func expectedStatus(ranges []statusRange, code int) bool {
+	for _, sr := range ranges {
+		if code >= sr.lo && code <= sr.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHealthHeaders sets the configured headers on a health check request
+func applyHealthHeaders(h *types.HealthConfig, req *http.Request) {
+	for name, value := range h.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+}
+
+// failed is the result of a check that couldn't be sent
+func failed(reason string) types.CheckResult {
+	return types.CheckResult{Error: reason}
+}
+
+// unexpectedStatus describes a status code the check doesn't accept
+func unexpectedStatus(code int) string {
+	if text := http.StatusText(code); text != "" {
+		return fmt.Sprintf("unexpected status %d %s", code, text)
+	}
+	return fmt.Sprintf("unexpected status %d", code)
+}
+
+// describeRequestError turns a failed health request into a short reason,
+// dropping the URL that every client error repeats
+func describeRequestError(ctx context.Context, err error, timeout time.Duration) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Sprintf("timed out after %s", timeout)
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return err.Error()
+}
+
+// maxHealthBody caps how much of a health response body is read for assertions
+const maxHealthBody = 64 * 1024
+
+// checkBody evaluates the body assertions of a health check and returns why
+// they failed, or "" if they passed or none are configured
+func checkBody(h *types.HealthConfig, body io.Reader) string {
+	if h.ExpectBodyContains == "" && h.ExpectJSON == nil {
+		return ""
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxHealthBody))
+	if err != nil {
+		return fmt.Sprintf("reading body: %v", err)
+	}
+
+	if h.ExpectBodyContains != "" && !bytes.Contains(data, []byte(h.ExpectBodyContains)) {
+		return fmt.Sprintf("body assertion failed: missing %q", h.ExpectBodyContains)
+	}
+
+	if a := h.ExpectJSON; a != nil {
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return fmt.Sprintf("body assertion failed: invalid JSON: %v", err)
+		}
+		path := strings.TrimPrefix(strings.TrimPrefix(a.Path, "$"), ".")
+		value, ok := lookupJSON(doc, path)
+		if !ok {
+			return fmt.Sprintf("body assertion failed: %s missing", path)
+		}
+		got := fmt.Sprint(value)
+		if value == nil {
+			got = "null"
+		}
+		if got != a.Equals {
+			return fmt.Sprintf("body assertion failed: %s=%s", path, got)
+		}
+	}
+
+	return ""
+}
+
+// lookupJSON resolves a dotted path in a decoded JSON document; numeric
+// segments index arrays
+func lookupJSON(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
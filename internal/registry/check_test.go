@@ -0,0 +1,308 @@
+package registry
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestHealthRequest checks that the configured method and headers reach the
+// backend and that expectStatus decides what passes
+func TestHealthRequest(t *testing.T) {
+	type seen struct {
+		method, path, auth, host string
+	}
+	requests := make(chan seen, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- seen{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), r.Host}
+		if r.Header.Get("Authorization") != "Bearer health" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	r := New()
+	defer r.Stop()
+
+	tests := []struct {
+		name   string
+		health types.HealthConfig
+		want   seen
+		err    string
+	}{
+		{
+			name:   "defaults",
+			health: types.HealthConfig{Path: "/health"},
+			want:   seen{method: "GET", path: "/health"},
+			err:    "unexpected status 401 Unauthorized",
+		},
+		{
+			name: "custom header",
+			health: types.HealthConfig{Path: "/health", Headers: map[string]string{
+				"Authorization": "Bearer health",
+				"Host":          "api.internal",
+			}},
+			want: seen{method: "GET", path: "/health", auth: "Bearer health", host: "api.internal"},
+		},
+		{
+			name:   "method",
+			health: types.HealthConfig{Path: "/health", Method: "head", Headers: map[string]string{"Authorization": "Bearer health"}},
+			want:   seen{method: "HEAD", path: "/health", auth: "Bearer health"},
+		},
+		{
+			name:   "204 not expected",
+			health: types.HealthConfig{Path: "/health", ExpectStatus: []string{"200"}, Headers: map[string]string{"Authorization": "Bearer health"}},
+			want:   seen{method: "GET", path: "/health", auth: "Bearer health"},
+			err:    "unexpected status 204 No Content",
+		},
+		{
+			name:   "401 expected",
+			health: types.HealthConfig{Path: "/health", ExpectStatus: []string{"200-204", "4xx"}},
+			want:   seen{method: "GET", path: "/health"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := testService("api", backend.URL, time.Hour)
+			tt.health.Timeout = types.Duration(time.Second)
+			svc.Health = &tt.health
+
+			result := r.probe(context.Background(), svc)
+			got := <-requests
+			if tt.want.host == "" {
+				tt.want.host = svc.TargetURL.Host
+			}
+			if got != tt.want {
+				t.Errorf("backend saw %+v, want %+v", got, tt.want)
+			}
+			if result.Error != tt.err {
+				t.Errorf("check error %q, want %q", result.Error, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateHealthRequest(t *testing.T) {
+	tests := []struct {
+		health types.HealthConfig
+		err    string
+	}{
+		{types.HealthConfig{Method: "HEAD", ExpectStatus: []string{"204", "200-299", "3xx"}}, ""},
+		{types.HealthConfig{Method: "BREW"}, `unsupported health check method "BREW"`},
+		{types.HealthConfig{ExpectStatus: []string{}}, "expectStatus must list at least one status code"},
+		{types.HealthConfig{ExpectStatus: []string{"299-200"}}, `invalid expectStatus "299-200"`},
+		{types.HealthConfig{ExpectStatus: []string{"6xx"}}, `invalid expectStatus "6xx"`},
+		{types.HealthConfig{Method: "HEAD", ExpectBodyContains: "ok"}, "body assertions need a method that returns a body, not HEAD"},
+	}
+	for _, tt := range tests {
+		err := ValidateHealth(&tt.health)
+		if (err == nil) != (tt.err == "") || err != nil && !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("ValidateHealth(%+v) = %v, want %q", tt.health, err, tt.err)
+		}
+	}
+}
+
+func TestHealthURL(t *testing.T) {
+	tests := []struct {
+		target, path, want string
+	}{
+		{"http://localhost:8080", "/health", "http://localhost:8080/health"},
+		{"http://localhost:8080/", "/health", "http://localhost:8080/health"},
+		{"http://localhost:8080", "health", "http://localhost:8080/health"},
+		{"http://localhost:8080", "/health/", "http://localhost:8080/health/"},
+		{"http://localhost:8080", "", "http://localhost:8080"},
+		{"http://localhost:8080/", "/", "http://localhost:8080/"},
+		{"http://localhost:8080/app", "/health", "http://localhost:8080/app/health"},
+		{"http://localhost:8080/app/", "/health", "http://localhost:8080/app/health"},
+		{"http://localhost:8080/app", "/api/../health", "http://localhost:8080/app/health"},
+		{"http://localhost:8080", "/health?full=1&probe=hz", "http://localhost:8080/health?full=1&probe=hz"},
+		{"http://localhost:8080/app?tenant=a", "/health", "http://localhost:8080/app/health?tenant=a"},
+		{"http://localhost:8080/app?tenant=a", "/health?full=1", "http://localhost:8080/app/health?full=1"},
+		{"http://localhost:8080", "/health#top", "http://localhost:8080/health"},
+		{"h2c://localhost:50051", "/health", "http://localhost:50051/health"},
+		{"https://localhost:8443/", "/status", "https://localhost:8443/status"},
+	}
+	for _, tt := range tests {
+		svc := &types.Service{Name: "api", Target: tt.target, Health: &types.HealthConfig{Path: tt.path}}
+		got, err := HealthURL(svc)
+		if err != nil || got != tt.want {
+			t.Errorf("target %s, path %q: %s, %v; want %s", tt.target, tt.path, got, err, tt.want)
+		}
+	}
+
+	if _, err := HealthURL(&types.Service{Target: "http://localhost", Health: &types.HealthConfig{Path: "%zz"}}); err == nil {
+		t.Error("an invalid health path was accepted")
+	}
+}
+
+// TestHealthClient checks an HTTPS backend with its own CA and a health
+// endpoint that redirects to a login page
+func TestHealthClient(t *testing.T) {
+	tlsBackend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsBackend.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsBackend.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}
+	}))
+	defer redirecting.Close()
+
+	no := false
+	tests := []struct {
+		name   string
+		target string
+		health types.HealthConfig
+		err    string
+	}{
+		{"unknown CA", tlsBackend.URL, types.HealthConfig{}, "certificate signed by unknown authority"},
+		{"caFile", tlsBackend.URL, types.HealthConfig{TLS: &types.HealthTLSConfig{CAFile: caFile}}, ""},
+		{"insecureSkipVerify", tlsBackend.URL, types.HealthConfig{TLS: &types.HealthTLSConfig{InsecureSkipVerify: true}}, ""},
+		{"missing caFile", tlsBackend.URL, types.HealthConfig{TLS: &types.HealthTLSConfig{CAFile: caFile + ".missing"}}, "reading CA file"},
+		{"redirect followed", redirecting.URL, types.HealthConfig{}, ""},
+		{"redirect not followed", redirecting.URL, types.HealthConfig{FollowRedirects: &no}, "unexpected status 302 Found"},
+	}
+
+	// One registry, so cached clients must follow the changing settings
+	r := New()
+	defer r.Stop()
+	for _, tt := range tests {
+		svc := testService("api", tt.target, time.Hour)
+		tt.health.Path = "/health"
+		tt.health.Timeout = types.Duration(5 * time.Second)
+		svc.Health = &tt.health
+
+		result := r.probe(context.Background(), svc)
+		if !strings.Contains(result.Error, tt.err) || (tt.err == "") != (result.Error == "") {
+			t.Errorf("%s: check error %q, want %q", tt.name, result.Error, tt.err)
+		}
+	}
+}
+
+// TestLastHealthError records why checks fail on the service and clears the
+// reason once it passes again
+func TestLastHealthError(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer backend.Close()
+
+	// A port that refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + l.Addr().String()
+	l.Close()
+
+	r := New()
+	defer r.Stop()
+	for _, svc := range []*types.Service{testService("down", closed, time.Hour), testService("api", backend.URL, time.Hour)} {
+		svc.Health.InitialDelay = types.Duration(time.Hour) // checked by hand below
+		if err := r.Register(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r.HealthCheck("down")
+	down, _ := r.Get("down")
+	if want := "dial tcp " + l.Addr().String() + ": connect: connection refused"; down.LastError != want || down.LastCode != 0 {
+		t.Errorf("refused: %q, status %d; want %q", down.LastError, down.LastCode, want)
+	}
+
+	r.HealthCheck("api")
+	api, _ := r.Get("api")
+	if api.LastError != "unexpected status 503 Service Unavailable" || api.LastCode != 503 || api.GetStatus() != types.HealthStatusUnhealthy {
+		t.Errorf("503: %q, status %d, %s", api.LastError, api.LastCode, api.GetStatus())
+	}
+
+	status.Store(http.StatusOK)
+	r.HealthCheck("api")
+	if api.LastError != "" || api.LastCode != 200 || api.GetStatus() != types.HealthStatusHealthy {
+		t.Errorf("healthy again: %q, status %d, %s", api.LastError, api.LastCode, api.GetStatus())
+	}
+
+	// Long reasons are cut to MaxCheckError
+	api.RecordCheck(types.CheckResult{Error: strings.Repeat("x", 2*types.MaxCheckError)}, 1, 1)
+	if n := len(api.LastError); n > types.MaxCheckError {
+		t.Errorf("reason of %d bytes kept", n)
+	}
+}
+
+// TestThresholdsStopFlapping feeds a service alternating results: its status
+// only changes after enough consecutive ones, with one event per change
+func TestThresholdsStopFlapping(t *testing.T) {
+	var failing atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+
+	r := New()
+	defer r.Stop()
+	events := r.Watch(context.Background())
+	svc := testService("api", backend.URL, time.Hour)
+	svc.Health.InitialDelay = types.Duration(time.Hour) // checked by hand below
+	svc.Health.UnhealthyThreshold = 3
+	svc.Health.HealthyThreshold = 2
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	<-events // added
+
+	// Each step is a run of results: P passes, F fails
+	steps := []struct {
+		results   string
+		status    types.HealthStatus
+		changes   int
+		failures  int
+		successes int
+	}{
+		{"P", types.HealthStatusHealthy, 1, 0, 1}, // the first result decides
+		{"FPFPFPFPFPFPFPFPFPFP", types.HealthStatusHealthy, 0, 0, 1},
+		{"FF", types.HealthStatusHealthy, 0, 2, 0},
+		{"F", types.HealthStatusUnhealthy, 1, 3, 0},
+		{"PFPFPFPFPFPFPFPFPFPF", types.HealthStatusUnhealthy, 0, 1, 0},
+		{"P", types.HealthStatusUnhealthy, 0, 0, 1},
+		{"P", types.HealthStatusHealthy, 1, 0, 2},
+	}
+	for _, step := range steps {
+		for _, result := range step.results {
+			failing.Store(result == 'F')
+			r.HealthCheck("api")
+		}
+
+		changes := 0
+		for len(events) > 0 {
+			if (<-events).Type == types.EventServiceHealthChanged {
+				changes++
+			}
+		}
+		failures, successes := svc.Streaks()
+		if svc.GetStatus() != step.status || changes != step.changes || failures != step.failures || successes != step.successes {
+			t.Errorf("after %s: %s with %d events, %d failures, %d successes; want %s with %d, %d, %d", step.results,
+				svc.GetStatus(), changes, failures, successes, step.status, step.changes, step.failures, step.successes)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// clientOptions are the health settings a cached client was built from
+type clientOptions struct {
+	tls             types.HealthTLSConfig
+	followRedirects bool
+}
+
+// cachedClient is a health check client and the options it was built with
+type cachedClient struct {
+	opts   clientOptions
+	client *http.Client
+}
+
+// healthClient returns the HTTP client for a service's health checks, building
+// it on first use and again whenever its TLS or redirect settings change
+func (r *Registry) healthClient(service *types.Service) (*http.Client, error) {
+	opts := clientOptions{followRedirects: true}
+	if h := service.Health; h != nil {
+		if h.TLS != nil {
+			opts.tls = *h.TLS
+		}
+		if h.FollowRedirects != nil {
+			opts.followRedirects = *h.FollowRedirects
+		}
+	}
+
+	r.clientsMu.Lock()
+	defer r.clientsMu.Unlock()
+
+	if cached, ok := r.clients[service.Name]; ok && cached.opts == opts {
+		return cached.client, nil
+	}
+
+	client, err := newHealthClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[service.Name] = &cachedClient{opts: opts, client: client}
+	return client, nil
+}
+
+// dropHealthClient forgets the cached client of a removed service
+func (r *Registry) dropHealthClient(name string) {
+	r.clientsMu.Lock()
+	defer r.clientsMu.Unlock()
+	if cached, ok := r.clients[name]; ok {
+		cached.client.CloseIdleConnections()
+		delete(r.clients, name)
+	}
+}
+
+// newHealthClient builds a client that dials directly, ignoring proxy
+// environment variables that could hijack checks of local services
+func newHealthClient(opts clientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+
+	if opts.tls.InsecureSkipVerify || opts.tls.CAFile != "" {
+		tlsConfig := &tls.Config{InsecureSkipVerify: opts.tls.InsecureSkipVerify}
+		if opts.tls.CAFile != "" {
+			pem, err := os.ReadFile(opts.tls.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", opts.tls.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	client := &http.Client{Transport: transport}
+	if !opts.followRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client, nil
+}
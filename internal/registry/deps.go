@@ -0,0 +1,261 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// defaultDependencyTimeout caps the wait for dependencies before a first check
+const defaultDependencyTimeout = time.Minute
+
+// DependencyGraph describes which services depend on which
+type DependencyGraph struct {
+	Order    []string                  `json:"order"` // dependencies before their dependents
+	Services map[string]DependencyNode `json:"services"`
+	Error    string                    `json:"error,omitempty"` // set when the graph has a cycle
+}
+
+// DependencyNode is one service of a DependencyGraph
+type DependencyNode struct {
+	DependsOn  []string           `json:"dependsOn,omitempty"`
+	Dependents []string           `json:"dependents,omitempty"`
+	Status     types.HealthStatus `json:"status"`
+	WaitingFor []string           `json:"waitingFor,omitempty"` // dependencies the first check still waits for
+}
+
+// ValidateDependencies checks that every dependsOn entry names another
+// service in the list and that the dependencies have no cycle
+func ValidateDependencies(services []*types.Service) error {
+	names := make(map[string]bool, len(services))
+	for _, svc := range services {
+		names[svc.Name] = true
+	}
+
+	for _, svc := range services {
+		seen := make(map[string]bool, len(svc.DependsOn))
+		for _, dep := range svc.DependsOn {
+			switch {
+			case dep == svc.Name:
+				return fmt.Errorf("service %s depends on itself", svc.Name)
+			case !names[dep]:
+				return fmt.Errorf("service %s depends on unknown service %q", svc.Name, dep)
+			case seen[dep]:
+				return fmt.Errorf("service %s lists dependency %s twice", svc.Name, dep)
+			}
+			seen[dep] = true
+		}
+	}
+
+	_, err := DependencyOrder(services)
+	return err
+}
+
+// DependencyOrder returns the service names ordered so that every service
+// comes after the services it depends on, keeping the given order where
+// dependencies allow. Dependencies on services not in the list are ignored.
+// A cycle is reported as an error naming its members, e.g.
+// "dependency cycle: api -> auth -> api".
+func DependencyOrder(services []*types.Service) ([]string, error) {
+	byName := make(map[string]*types.Service, len(services))
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(services))
+	order := make([]string, 0, len(services))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range byName[name].DependsOn {
+			if _, ok := byName[dep]; !ok {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, svc := range services {
+		if err := visit(svc.Name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Dependencies returns the dependency graph of the registered services
+func (r *Registry) Dependencies() DependencyGraph {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*types.Service, 0, len(r.services))
+	for _, svc := range r.services {
+		list = append(list, svc)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	graph := DependencyGraph{Services: make(map[string]DependencyNode, len(list))}
+	dependents := make(map[string][]string)
+	for _, svc := range list {
+		for _, dep := range svc.DependsOn {
+			dependents[dep] = append(dependents[dep], svc.Name)
+		}
+	}
+	for _, svc := range list {
+		graph.Services[svc.Name] = DependencyNode{
+			DependsOn:  svc.DependsOn,
+			Dependents: dependents[svc.Name],
+			Status:     svc.GetStatus(),
+			WaitingFor: r.waiting[svc.Name],
+		}
+	}
+
+	order, err := DependencyOrder(list)
+	if err != nil {
+		graph.Error = err.Error()
+	}
+	graph.Order = order
+	return graph
+}
+
+// WaitingFor returns the dependencies a service's first health check is
+// still waiting for
+func (r *Registry) WaitingFor(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.waiting[name]
+}
+
+// awaitsDependencies reports whether the named service has dependencies and
+// has not been checked yet
+func (r *Registry) awaitsDependencies(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	service, ok := r.services[name]
+	return ok && len(service.DependsOn) > 0 && service.GetStatus() == types.HealthStatusUnknown
+}
+
+// waitForDependencies blocks until every dependency of the named service
+// passes its health checks, timeout expires or ctx is done. Registry events
+// trigger the re-evaluation.
+func (r *Registry) waitForDependencies(ctx context.Context, name string, timeout time.Duration) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	events := r.Watch(waitCtx)
+
+	for {
+		pending := r.pendingDependencies(name)
+		r.setWaiting(ctx, name, pending)
+		if len(pending) == 0 {
+			return
+		}
+
+		select {
+		case <-waitCtx.Done():
+			r.setWaiting(ctx, name, nil)
+			return
+		case _, ok := <-events:
+			if !ok {
+				r.setWaiting(ctx, name, nil)
+				return
+			}
+		}
+	}
+}
+
+// setWaiting records the dependencies a service waits for, unless its health
+// loop (ctx) was stopped and possibly replaced meanwhile
+func (r *Registry) setWaiting(ctx context.Context, name string, pending []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	if len(pending) == 0 {
+		delete(r.waiting, name)
+	} else {
+		r.waiting[name] = pending
+	}
+}
+
+// pendingDependencies lists the dependencies of the named service that are
+// not registered or not passing. Dependencies without health checks count as
+// ready.
+func (r *Registry) pendingDependencies(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	service, ok := r.services[name]
+	if !ok {
+		return nil
+	}
+
+	var pending []string
+	for _, dep := range service.DependsOn {
+		d, ok := r.services[dep]
+		if !ok {
+			pending = append(pending, dep)
+			continue
+		}
+		if !d.Health.Enabled() {
+			continue
+		}
+		switch d.GetStatus() {
+		case types.HealthStatusHealthy, types.HealthStatusDegraded:
+		default:
+			pending = append(pending, dep)
+		}
+	}
+	return pending
+}
+
+// downDependencies lists the service's dependencies that are unhealthy
+func (r *Registry) downDependencies(service *types.Service) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var down []string
+	for _, dep := range service.DependsOn {
+		if d, ok := r.services[dep]; ok && d.GetStatus() == types.HealthStatusUnhealthy {
+			down = append(down, dep)
+		}
+	}
+	return down
+}
+
+// dependencyTimeout returns the configured dependency wait or its default
+func dependencyTimeout(h *types.HealthConfig) time.Duration {
+	if h.DependencyTimeout > 0 {
+		return h.DependencyTimeout.Duration()
+	}
+	return defaultDependencyTimeout
+}
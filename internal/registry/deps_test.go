@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// services parses specs like "web:api,auth" into services named before the
+// colon that depend on the comma-separated names after it
+func services(specs ...string) []*types.Service {
+	list := make([]*types.Service, 0, len(specs))
+	for _, spec := range specs {
+		name, deps, _ := strings.Cut(spec, ":")
+		svc := &types.Service{Name: name}
+		if deps != "" {
+			svc.DependsOn = strings.Split(deps, ",")
+		}
+		list = append(list, svc)
+	}
+	return list
+}
+
+func TestDependencyOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []string
+		want     []string
+		err      string
+	}{
+		{"no dependencies keep their order", []string{"web", "api", "db"}, []string{"web", "api", "db"}, ""},
+		{"chain", []string{"web:api", "api:db", "db"}, []string{"db", "api", "web"}, ""},
+		{"chain listed in order", []string{"db", "api:db", "web:api"}, []string{"db", "api", "web"}, ""},
+		{"diamond", []string{"web:api,auth", "api:db", "auth:db", "db"}, []string{"db", "api", "auth", "web"}, ""},
+		{"independent services stay put", []string{"docs", "web:api", "api", "admin"}, []string{"docs", "api", "web", "admin"}, ""},
+		{"unknown dependencies are ignored", []string{"api:cache", "web:api"}, []string{"api", "web"}, ""},
+		{"cycle", []string{"api:auth", "auth:api"}, nil, "dependency cycle: api -> auth -> api"},
+		{"cycle behind a dependent", []string{"web:api", "api:auth", "auth:db", "db:api"}, nil, "dependency cycle: api -> auth -> db -> api"},
+		{"self", []string{"api:api"}, nil, "dependency cycle: api -> api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DependencyOrder(services(tt.services...))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	tests := []struct {
+		services []string
+		err      string
+	}{
+		{[]string{"web:api,auth", "api:db", "auth:db", "db"}, ""},
+		{[]string{"api:api"}, "service api depends on itself"},
+		{[]string{"api:cache", "db"}, `service api depends on unknown service "cache"`},
+		{[]string{"api:db,db", "db"}, "service api lists dependency db twice"},
+		{[]string{"web:api", "api:web"}, "dependency cycle: web -> api -> web"},
+	}
+	for _, tt := range tests {
+		err := ValidateDependencies(services(tt.services...))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("ValidateDependencies(%v) = %q, want %q", tt.services, got, tt.err)
+		}
+	}
+}
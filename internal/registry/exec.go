@@ -0,0 +1,51 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// probeExec runs an exec health check; exit status 0 is healthy and stderr
+// explains a failure. Its latency is the command's run time.
+func (r *Registry) probeExec(ctx context.Context, service *types.Service) types.CheckResult {
+	health := service.Health
+
+	ctx, cancel := context.WithTimeout(ctx, health.Timeout.Duration())
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if health.Shell {
+		cmd = exec.CommandContext(ctx, "sh", "-c", strings.Join(health.Command, " "))
+	} else {
+		cmd = exec.CommandContext(ctx, health.Command[0], health.Command[1:]...)
+	}
+	cmd.Dir = health.Dir
+	// Don't wait forever on pipes held open by children of a killed command
+	cmd.WaitDelay = time.Second
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	result := types.CheckResult{Latency: time.Since(start)}
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.Error = fmt.Sprintf("command timed out after %s", health.Timeout.Duration())
+	default:
+		// RecordCheck bounds the length of the reason
+		result.Error = strings.TrimSpace(stderr.String())
+		if result.Error == "" {
+			result.Error = err.Error()
+		}
+	}
+	return result
+}
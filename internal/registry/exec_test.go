@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// execService returns a service checked by running testdata/check.sh
+func execService(t *testing.T, timeout time.Duration, shell bool, command ...string) *types.Service {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the check script needs sh")
+	}
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := testService("db", refused, time.Hour)
+	svc.Health = &types.HealthConfig{
+		Type:         types.HealthCheckExec,
+		Command:      command,
+		Shell:        shell,
+		Dir:          dir,
+		Interval:     types.Duration(time.Hour),
+		InitialDelay: types.Duration(time.Hour), // checked by hand
+		Timeout:      types.Duration(timeout),
+	}
+	return svc
+}
+
+func TestProbeExec(t *testing.T) {
+	tests := []struct {
+		name    string
+		shell   bool
+		command []string
+		err     string
+	}{
+		{"pass", false, []string{"./check.sh", "pass"}, ""},
+		{"fail", false, []string{"./check.sh", "fail"}, "database is down"},
+		{"fail without stderr", false, []string{"./check.sh", "silent"}, "exit status 4"},
+		{"timeout", false, []string{"./check.sh", "hang"}, "command timed out after 200ms"},
+		{"no shell", false, []string{"./check.sh fail"}, "fork/exec ./check.sh fail: no such file or directory"},
+		{"shell", true, []string{"./check.sh fail", "|| ./check.sh pass"}, ""},
+		{"missing command", false, []string{"./missing.sh"}, "fork/exec ./missing.sh: no such file or directory"},
+	}
+	r := New()
+	defer r.Stop()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := execService(t, 200*time.Millisecond, tt.shell, tt.command...)
+			start := time.Now()
+			result := r.probeExec(context.Background(), svc)
+			if result.Error != tt.err {
+				t.Errorf("check error %q, want %q", result.Error, tt.err)
+			}
+			// A hung command is killed, pipes and all
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("the check took %s", d)
+			}
+		})
+	}
+}
+
+// TestExecChecksDontPileUp checks a service whose command hangs: further
+// checks return its status at once instead of running it again
+func TestExecChecksDontPileUp(t *testing.T) {
+	r := New()
+	defer r.Stop()
+	svc := execService(t, time.Second, false, "./check.sh", "hang")
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan types.HealthStatus)
+	go func() { done <- r.HealthCheck("db") }()
+	eventually(t, "the first check runs", func() bool {
+		_, busy := r.checking.Load("db")
+		return busy
+	})
+
+	start := time.Now()
+	if status := r.HealthCheck("db"); status != types.HealthStatusUnknown {
+		t.Errorf("second check: %s, want unknown", status)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("second check waited %s", d)
+	}
+	if status := <-done; status != types.HealthStatusUnhealthy || svc.LastError != "command timed out after 1s" {
+		t.Errorf("first check: %s, %q", status, svc.LastError)
+	}
+}
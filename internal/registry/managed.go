@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"log"
+	"time"
+
+	"github.com/zymawy/hz/internal/process"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// startingInterval is the longest gap between checks of a managed service
+// waiting for its process to come up
+const startingInterval = time.Second
+
+// SetLogger sets the logger for managed process output
+func (r *Registry) SetLogger(logger *log.Logger) {
+	r.procs.SetLogger(logger)
+}
+
+// Process returns the state of a managed service's process
+func (r *Registry) Process(name string) (process.State, bool) {
+	return r.procs.State(name)
+}
+
+// Starting reports whether a managed service can't take traffic yet: its
+// process isn't running, or it has a health check that hasn't passed since
+// the process started
+func (r *Registry) Starting(name string) bool {
+	state, ok := r.procs.State(name)
+	if !ok {
+		return false
+	}
+	if !state.Running {
+		return true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.starting[name]
+}
+
+// syncProcess starts, replaces or stops the service's process to match its
+// command. Callers must hold r.mu.
+func (r *Registry) syncProcess(service *types.Service) {
+	if service.Command == "" {
+		r.procs.Stop(service.Name)
+		delete(r.starting, service.Name)
+		return
+	}
+	r.procs.Start(service.Name, process.Spec{
+		Command: service.Command,
+		Dir:     service.Cwd,
+		Env:     service.Env,
+	})
+}
+
+// processStarted holds back traffic to a freshly (re)started process until a
+// health check passes, and checks it right away
+func (r *Registry) processStarted(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	service, ok := r.services[name]
+	if !ok || r.stopped || !service.Health.Enabled() || r.paused[name] {
+		return
+	}
+	r.starting[name] = true
+	r.restartHealthLoop(service)
+}
+
+// markStarted ends the start-up gate of a managed service
+func (r *Registry) markStarted(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.starting, name)
+}
+
+// isStarting reports whether a managed service waits for its first passing
+// check since its process started
+func (r *Registry) isStarting(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.starting[name]
+}
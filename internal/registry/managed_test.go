@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestStartupGate runs a managed service whose health check fails at first:
+// it counts as starting, checked every startingInterval, until a check passes,
+// and again once its process is replaced
+func TestStartupGate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("managed processes run through sh")
+	}
+	var failing atomic.Bool
+	failing.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	r := New()
+	defer r.Stop()
+	r.SetLogger(log.New(io.Discard, "", 0))
+	svc := testService("web", backend.URL, time.Hour)
+	svc.Command = "exec sleep 30"
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the process runs", func() bool {
+		state, ok := r.Process("web")
+		return ok && state.Running
+	})
+	eventually(t, "a check fails", func() bool {
+		failures, _ := svc.Streaks()
+		return failures > 0
+	})
+	if !r.Starting("web") {
+		t.Error("web isn't starting before a check passed")
+	}
+	if next, _ := svc.Schedule(); time.Until(next) > 2*startingInterval {
+		t.Errorf("next check in %v, want within %v while starting", time.Until(next), startingInterval)
+	}
+
+	failing.Store(false)
+	eventually(t, "web has started", func() bool { return !r.Starting("web") })
+	if next, _ := svc.Schedule(); time.Until(next) < 30*time.Minute {
+		t.Errorf("next check in %v after starting, want the hour interval", time.Until(next))
+	}
+
+	// A new command replaces the process, closing the gate until the next pass
+	failing.Store(true)
+	updated := testService("web", backend.URL, time.Hour)
+	updated.Command = "exec sleep 31"
+	before, _ := r.Process("web")
+	if err := r.Update(updated); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the new process runs", func() bool {
+		state, ok := r.Process("web")
+		return ok && state.Running && state.PID != before.PID
+	})
+	eventually(t, "web is starting again", func() bool { return r.Starting("web") })
+	failing.Store(false)
+	eventually(t, "web has started again", func() bool { return !r.Starting("web") })
+}
+
+// TestStartupWithoutHealthCheck checks that a managed service without a
+// health check takes traffic as soon as its process runs
+func TestStartupWithoutHealthCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("managed processes run through sh")
+	}
+	r := New()
+	defer r.Stop()
+	r.SetLogger(log.New(io.Discard, "", 0))
+	svc := testService("web", refused, time.Hour)
+	svc.Health = nil
+	svc.Command = "exec sleep 30"
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "web has started", func() bool {
+		state, _ := r.Process("web")
+		return state.Running && !r.Starting("web")
+	})
+	if r.Starting("docs") {
+		t.Error("an unmanaged service counts as starting")
+	}
+}
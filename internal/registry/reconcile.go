@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/zymawy/hz/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ReconcileResult reports what Reconcile changed
+type ReconcileResult struct {
+	// Services are the registered services in the order given to Reconcile.
+	// Unchanged services keep their registered instance, so routes built
+	// from this list share its health state and counters.
+	Services []*types.Service
+
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// Reconcile makes the registry match services: new names are registered,
+// services whose definition changed are updated, unchanged ones are left
+// alone and registered services missing from the list are deregistered.
+// Errors for individual services are joined; the others are still applied.
+func (r *Registry) Reconcile(services []*types.Service) (ReconcileResult, error) {
+	var result ReconcileResult
+	var errs []error
+
+	keep := make(map[string]bool, len(services))
+	for _, svc := range services {
+		keep[svc.Name] = true
+		def := definition(svc)
+
+		r.mu.RLock()
+		current, registered := r.services[svc.Name]
+		unchanged := registered && def != nil && bytes.Equal(r.defs[svc.Name], def)
+		r.mu.RUnlock()
+
+		switch {
+		case unchanged:
+			result.Services = append(result.Services, current)
+			continue
+		case registered:
+			if err := r.Update(svc); err != nil {
+				errs = append(errs, err)
+				result.Services = append(result.Services, current)
+				continue
+			}
+			result.Changed = append(result.Changed, svc.Name)
+		default:
+			if err := r.Register(svc); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			result.Added = append(result.Added, svc.Name)
+		}
+		result.Services = append(result.Services, svc)
+	}
+
+	for _, svc := range r.List() {
+		if keep[svc.Name] {
+			continue
+		}
+		if err := r.Deregister(svc.Name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result.Removed = append(result.Removed, svc.Name)
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// definition serializes the configured fields of a service, leaving out
+// runtime state, to tell whether a reload changed it
+func definition(svc *types.Service) []byte {
+	data, err := yaml.Marshal(svc)
+	if err != nil {
+		return nil // never equal to a stored definition, so it counts as changed
+	}
+	return data
+}
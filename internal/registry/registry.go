@@ -3,37 +3,70 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/zymawy/hz/internal/process"
 	"github.com/zymawy/hz/pkg/types"
 )
 
 // Registry manages registered services and their health status
 type Registry struct {
-	services  map[string]*types.Service
-	mu        sync.RWMutex
-	eventCh   chan types.RegistryEvent
-	client    *http.Client
-	ctx       context.Context
-	cancel    context.CancelFunc
-	wg        sync.WaitGroup
+	services map[string]*types.Service
+	defs     map[string][]byte // definition of each service when it was registered
+	mu       sync.RWMutex
+	watch    watchers // Watch subscribers
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	loops    map[string]context.CancelFunc // stops each service's health loop
+	paused   map[string]bool               // services whose health checks are paused
+	waiting  map[string][]string           // dependencies each first check waits for
+	checking sync.Map                      // names of services with a health check in progress
+	random   func() float64
+	sleep    func(ctx context.Context, d time.Duration) bool // waits between health checks
+
+	clients   map[string]*cachedClient // health check clients by service name
+	clientsMu sync.Mutex
+
+	scan scanState // last local port scan, see Discover
+
+	proxy http.Handler // serves viaProxy health checks
+
+	procs    *process.Manager // managed backend processes
+	starting map[string]bool  // managed services not yet passing since their process started
+
+	stopped bool // set by Stop; mutations fail with ErrStopped afterwards
 }
 
+// ErrStopped is returned by methods that change the registry after Stop
+var ErrStopped = errors.New("registry stopped")
+
 // New creates a new service registry
 func New() *Registry {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Registry{
+	r := &Registry{
 		services: make(map[string]*types.Service),
-		eventCh:  make(chan types.RegistryEvent, 100),
-		client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-		ctx:    ctx,
-		cancel: cancel,
+		defs:     make(map[string][]byte),
+		loops:    make(map[string]context.CancelFunc),
+		paused:   make(map[string]bool),
+		waiting:  make(map[string][]string),
+		clients:  make(map[string]*cachedClient),
+		ctx:      ctx,
+		cancel:   cancel,
+		random:   rand.Float64,
+		sleep:    sleep,
+		procs:    process.NewManager(),
+		starting: make(map[string]bool),
 	}
+	r.procs.OnStart(r.processStarted)
+	return r
 }
 
 // Register adds a service to the registry
@@ -41,6 +74,10 @@ func (r *Registry) Register(service *types.Service) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.stopped {
+		return ErrStopped
+	}
+
 	if service.Name == "" {
 		return fmt.Errorf("service name is required")
 	}
@@ -49,19 +86,156 @@ func (r *Registry) Register(service *types.Service) error {
 		return fmt.Errorf("service target URL is required")
 	}
 
-	// Store service
+	// Store service; a paused name stays paused
 	r.services[service.Name] = service
-	service.SetStatus(types.HealthStatusUnknown)
+	r.defs[service.Name] = definition(service)
+	if r.paused[service.Name] && service.Health.Enabled() {
+		service.SetStatus(types.HealthStatusPaused)
+	} else {
+		delete(r.paused, service.Name)
+		service.SetStatus(types.HealthStatusUnknown)
+	}
 
 	// Emit event
 	r.emitEvent(types.EventServiceAdded, service)
 
-	// Start health checking if configured
-	if service.Health != nil && service.Health.Path != "" {
-		r.wg.Add(1)
-		go r.healthCheckLoop(service)
+	// Replace the health loop of a service registered under the same name
+	r.restartHealthLoop(service)
+	r.syncProcess(service)
+
+	return nil
+}
+
+// Update replaces a registered service with a new definition of the same name.
+// Health status and request counters carry over, and the health loop restarts
+// only if the health config changed.
+func (r *Registry) Update(service *types.Service) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return ErrStopped
 	}
 
+	old, ok := r.services[service.Name]
+	if !ok {
+		return fmt.Errorf("service not found: %s", service.Name)
+	}
+
+	if service.TargetURL == nil {
+		return fmt.Errorf("service target URL is required")
+	}
+
+	if service == old {
+		return nil // already registered as is
+	}
+
+	service.InheritState(old)
+	r.services[service.Name] = service
+	r.defs[service.Name] = definition(service)
+
+	// Nothing left to pause if the new definition has no health check
+	if r.paused[service.Name] && !service.Health.Enabled() {
+		delete(r.paused, service.Name)
+		service.SetStatus(types.HealthStatusUnknown)
+	}
+
+	if !reflect.DeepEqual(old.Health, service.Health) {
+		r.restartHealthLoop(service)
+	}
+	r.syncProcess(service)
+
+	r.emitEvent(types.EventServiceUpdated, service)
+
+	return nil
+}
+
+// restartHealthLoop stops the health loop running for the service's name and
+// starts a new one if checks are configured and not paused. Callers must hold
+// r.mu.
+func (r *Registry) restartHealthLoop(service *types.Service) {
+	r.stopHealthLoop(service.Name)
+
+	if service.Health.Enabled() && !r.paused[service.Name] {
+		r.startHealthLoop(service, service.Health.InitialDelay.Duration())
+	}
+}
+
+// startHealthLoop starts a health loop whose first check runs after delay.
+// Callers must hold r.mu.
+func (r *Registry) startHealthLoop(service *types.Service, delay time.Duration) {
+	ctx, stop := context.WithCancel(r.ctx)
+	r.loops[service.Name] = stop
+	r.wg.Add(1)
+	go r.healthCheckLoop(ctx, service.Name, *service.Health, delay)
+}
+
+// stopHealthLoop stops the service's health loop, if any. A check in flight
+// is abandoned without recording its result. Callers must hold r.mu.
+func (r *Registry) stopHealthLoop(name string) {
+	if stop, ok := r.loops[name]; ok {
+		stop()
+		delete(r.loops, name)
+	}
+	delete(r.waiting, name)
+	if service, ok := r.services[name]; ok {
+		service.SetSchedule(time.Time{}, 0)
+	}
+}
+
+// Pause suspends a service's health checks and marks it paused, e.g. while
+// the backend is stopped on purpose. Paused services count as unknown, not
+// unhealthy.
+func (r *Registry) Pause(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return ErrStopped
+	}
+
+	service, ok := r.services[name]
+	if !ok {
+		return fmt.Errorf("service not found: %s", name)
+	}
+	if !service.Health.Enabled() {
+		return fmt.Errorf("service %s has no health check", name)
+	}
+	if r.paused[name] {
+		return nil
+	}
+
+	r.paused[name] = true
+	r.stopHealthLoop(name)
+	service.SetStatus(types.HealthStatusPaused)
+	r.emitEvent(types.EventServiceHealthChanged, service)
+
+	return nil
+}
+
+// Resume restarts a paused service's health checks, beginning with an
+// immediate check
+func (r *Registry) Resume(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return ErrStopped
+	}
+
+	service, ok := r.services[name]
+	if !ok {
+		return fmt.Errorf("service not found: %s", name)
+	}
+	if !r.paused[name] {
+		return fmt.Errorf("service %s is not paused", name)
+	}
+
+	delete(r.paused, name)
+	service.SetStatus(types.HealthStatusUnknown)
+	r.emitEvent(types.EventServiceHealthChanged, service)
+	r.startHealthLoop(service, 0)
+
 	return nil
 }
 
@@ -80,12 +254,22 @@ func (r *Registry) Deregister(name string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.stopped {
+		return ErrStopped
+	}
+
 	service, ok := r.services[name]
 	if !ok {
 		return fmt.Errorf("service not found: %s", name)
 	}
 
 	delete(r.services, name)
+	delete(r.defs, name)
+	delete(r.paused, name)
+	r.stopHealthLoop(name)
+	r.dropHealthClient(name)
+	r.procs.Stop(name)
+	delete(r.starting, name)
 	r.emitEvent(types.EventServiceRemoved, service)
 
 	return nil
@@ -135,84 +319,122 @@ func (r *Registry) List() []*types.Service {
 	return services
 }
 
-// Watch returns a channel that receives registry events
-func (r *Registry) Watch() <-chan types.RegistryEvent {
-	return r.eventCh
-}
-
 // HealthCheck performs an immediate health check on a service
 func (r *Registry) HealthCheck(name string) types.HealthStatus {
 	r.mu.RLock()
 	service, ok := r.services[name]
+	paused := r.paused[name]
 	r.mu.RUnlock()
 
 	if !ok {
 		return types.HealthStatusUnknown
 	}
+	if paused {
+		return types.HealthStatusPaused
+	}
 
-	if service.Health == nil || service.Health.Path == "" {
+	if !service.Health.Enabled() {
 		return types.HealthStatusHealthy // No health check configured, assume healthy
 	}
 
-	return r.doHealthCheck(service)
+	return r.doHealthCheck(r.ctx, service)
 }
 
-// healthCheckLoop runs periodic health checks for a service
-func (r *Registry) healthCheckLoop(service *types.Service) {
+// healthCheckLoop runs periodic health checks for a service, the first after
+// delay. It checks the service currently registered under name, so updates
+// that keep the health config don't interrupt it.
+func (r *Registry) healthCheckLoop(ctx context.Context, name string, health types.HealthConfig, delay time.Duration) {
 	defer r.wg.Done()
 
-	ticker := time.NewTicker(service.Health.Interval)
-	defer ticker.Stop()
-
-	// Initial check
-	r.doHealthCheck(service)
-
-	for {
-		select {
-		case <-r.ctx.Done():
+	// Give slow services and their dependencies time to boot; the status
+	// stays unknown meanwhile
+	if r.awaitsDependencies(name) {
+		start := time.Now()
+		r.waitForDependencies(ctx, name, dependencyTimeout(&health))
+		delay -= time.Since(start)
+	}
+	for wait := delay; r.sleep(ctx, wait); {
+		r.mu.RLock()
+		service, ok := r.services[name]
+		r.mu.RUnlock()
+		if !ok {
 			return
-		case <-ticker.C:
-			r.doHealthCheck(service)
 		}
+		r.doHealthCheck(ctx, service)
+
+		// Persistently failing services are checked less and less often
+		interval, backoff := r.nextInterval(service, &health)
+		wait = r.jitter(interval)
+		service.SetSchedule(time.Now().Add(wait), backoff)
 	}
 }
 
-// doHealthCheck performs the actual health check
-func (r *Registry) doHealthCheck(service *types.Service) types.HealthStatus {
-	if service.Health == nil || service.Health.Path == "" {
-		return types.HealthStatusHealthy
+// sleep waits for d and reports whether it did before ctx was done
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
+}
 
-	healthURL := fmt.Sprintf("%s%s", service.Target, service.Health.Path)
+// healthJitter is the fraction by which check intervals vary, so that
+// services sharing an interval are not checked in bursts
+const healthJitter = 0.1
 
-	ctx, cancel := context.WithTimeout(r.ctx, service.Health.Timeout)
-	defer cancel()
+// jitter returns interval varied randomly by up to ±healthJitter
+func (r *Registry) jitter(interval time.Duration) time.Duration {
+	offset := (r.random()*2 - 1) * healthJitter * float64(interval)
+	return interval + time.Duration(offset)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
-	if err != nil {
-		service.SetStatus(types.HealthStatusUnhealthy)
-		r.emitEvent(types.EventServiceHealthChanged, service)
-		return types.HealthStatusUnhealthy
+// doHealthCheck performs the actual health check
+func (r *Registry) doHealthCheck(ctx context.Context, service *types.Service) types.HealthStatus {
+	if !service.Health.Enabled() {
+		return types.HealthStatusHealthy
 	}
 
-	resp, err := r.client.Do(req)
-	if err != nil {
-		service.SetStatus(types.HealthStatusUnhealthy)
-		r.emitEvent(types.EventServiceHealthChanged, service)
-		return types.HealthStatusUnhealthy
+	// Don't pile up checks behind one that hangs
+	if _, busy := r.checking.LoadOrStore(service.Name, struct{}{}); busy {
+		return service.GetStatus()
 	}
-	defer resp.Body.Close()
-
-	oldStatus := service.GetStatus()
-	var newStatus types.HealthStatus
-
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		newStatus = types.HealthStatusHealthy
+	defer r.checking.Delete(service.Name)
+
+	var result types.CheckResult
+	if service.Health.Type == types.HealthCheckExec {
+		result = r.probeExec(ctx, service)
+	} else if service.Health.Type == types.HealthCheckWebSocket {
+		result = r.probeWebSocket(ctx, service)
+	} else if service.Health.Type == types.HealthCheckTCP {
+		result = r.probeTCP(ctx, service)
+	} else if service.Health.ViaProxy {
+		result = r.probeViaProxy(ctx, service)
 	} else {
-		newStatus = types.HealthStatusUnhealthy
+		result = r.probe(ctx, service)
+	}
+	if service.Health.RequireDependencies && result.Error == "" {
+		if down := r.downDependencies(service); len(down) > 0 {
+			result.Error = fmt.Sprintf("dependency unhealthy: %s", strings.Join(down, ", "))
+		}
 	}
+	if d := service.Health.DegradedAfter; d > 0 && result.Error == "" && result.Latency > d.Duration() {
+		result.Slow = true
+	}
+
+	// The service was deregistered or the registry stopped mid-check
+	if ctx.Err() != nil {
+		return service.GetStatus()
+	}
+
+	healthy, unhealthy := thresholds(service.Health)
+	oldStatus, newStatus := service.RecordCheck(result, healthy, unhealthy)
 
-	service.SetStatus(newStatus)
+	if result.Error == "" && newStatus != types.HealthStatusPaused {
+		r.markStarted(service.Name)
+	}
 
 	// Emit event if status changed
 	if oldStatus != newStatus {
@@ -222,23 +444,77 @@ func (r *Registry) doHealthCheck(service *types.Service) types.HealthStatus {
 	return newStatus
 }
 
-// emitEvent sends an event to watchers
-func (r *Registry) emitEvent(eventType types.RegistryEventType, service *types.Service) {
-	select {
-	case r.eventCh <- types.RegistryEvent{Type: eventType, Service: service}:
-	default:
-		// Channel full, skip event
+// probe sends one HTTP health check request. Its latency covers the request
+// and reading the body, not the preparation.
+func (r *Registry) probe(ctx context.Context, service *types.Service) types.CheckResult {
+	health := service.Health
+
+	healthURL, err := HealthURL(service)
+	if err != nil {
+		return failed(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, health.Timeout.Duration())
+	defer cancel()
+
+	expect, err := parseExpectStatus(health.ExpectStatus)
+	if err != nil {
+		return failed(err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, healthMethod(health), healthURL, nil)
+	if err != nil {
+		return failed(err.Error())
 	}
+	applyHealthHeaders(health, req)
+
+	client, err := r.healthClient(service)
+	if err != nil {
+		return failed(err.Error())
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return types.CheckResult{
+			Error:   describeRequestError(ctx, err, health.Timeout.Duration()),
+			Latency: time.Since(start),
+		}
+	}
+	defer resp.Body.Close()
+
+	result := types.CheckResult{StatusCode: resp.StatusCode}
+	if !expectedStatus(expect, resp.StatusCode) {
+		result.Error = unexpectedStatus(resp.StatusCode)
+	} else {
+		result.Error = checkBody(health, resp.Body)
+	}
+	result.Latency = time.Since(start)
+	return result
 }
 
-// Stop shuts down the registry and all health checkers
+// Stop terminates managed processes and shuts down the registry and all
+// health checkers. Afterwards Register, Update, Deregister, Pause and Resume
+// return ErrStopped; calling Stop again does nothing.
 func (r *Registry) Stop() {
+	// No health loop can start once stopped is set, so the wait below can't
+	// race a new one
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.stopped = true
+	r.mu.Unlock()
+
+	r.procs.StopAll()
 	r.cancel()
 	r.wg.Wait()
-	close(r.eventCh)
+	r.closeWatchers()
 }
 
-// Healthy returns true if all services are healthy
+// Healthy returns false if any service is unhealthy; degraded, paused and
+// unknown services don't count against it
 func (r *Registry) Healthy() bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -259,22 +535,40 @@ func (r *Registry) Stats() map[string]interface{} {
 	healthy := 0
 	unhealthy := 0
 	unknown := 0
+	paused := 0
+	degraded := 0
+	latency := make(map[string]types.LatencyStats)
 
 	for _, svc := range r.services {
+		if l := svc.Latency(); l.Samples > 0 {
+			latency[svc.Name] = l
+		}
 		switch svc.GetStatus() {
 		case types.HealthStatusHealthy:
 			healthy++
 		case types.HealthStatusUnhealthy:
 			unhealthy++
+		case types.HealthStatusPaused:
+			paused++
+		case types.HealthStatusDegraded:
+			degraded++
 		default:
 			unknown++
 		}
 	}
 
+	r.watch.mu.Lock()
+	watchers := len(r.watch.subs)
+	r.watch.mu.Unlock()
+
 	return map[string]interface{}{
 		"total":     len(r.services),
 		"healthy":   healthy,
 		"unhealthy": unhealthy,
 		"unknown":   unknown,
+		"paused":    paused,
+		"degraded":  degraded,
+		"watchers":  watchers,
+		"latency":   latency,
 	}
 }
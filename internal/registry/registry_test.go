@@ -0,0 +1,303 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// refused is a target nothing listens on, so checks fail at once without
+// leaving connections behind
+const refused = "http://127.0.0.1:1"
+
+// testService returns a service checked every interval
+func testService(name, target string, interval time.Duration) *types.Service {
+	u, _ := url.Parse(target)
+	return &types.Service{
+		Name:      name,
+		Target:    target,
+		TargetURL: u,
+		Health: &types.HealthConfig{
+			Path:     "/health",
+			Interval: types.Duration(interval),
+			Timeout:  types.Duration(time.Second),
+		},
+	}
+}
+
+// healthLoops counts the running health check loop goroutines
+func healthLoops() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return strings.Count(string(buf[:n]), "registry.(*Registry).healthCheckLoop(")
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// eventually fails the test unless cond becomes true within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestDeregisterStopsHealthLoop registers and deregisters services over and
+// over: no health loop or other goroutine may outlive them, even one
+// waiting an hour for its next check
+func TestDeregisterStopsHealthLoop(t *testing.T) {
+	before := runtime.NumGoroutine()
+	r := New()
+
+	for i := 0; i < 20; i++ {
+		if err := r.Register(testService("web", refused, time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Register(testService("api", refused, time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "both services run one loop", func() bool { return healthLoops() == 2 })
+		if err := r.Deregister("web"); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "web's loop ends", func() bool { return healthLoops() == 1 })
+		if err := r.Deregister("api"); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "api's loop ends", func() bool { return healthLoops() == 0 })
+	}
+
+	// Registering the name again starts a fresh loop that checks it
+	svc := testService("web", refused, time.Hour)
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "web is checked again", func() bool { return svc.GetStatus() == types.HealthStatusUnhealthy })
+
+	r.Stop()
+	if n := healthLoops(); n != 0 {
+		t.Errorf("%d health loops left after Stop", n)
+	}
+	eventually(t, "every goroutine ends", func() bool { return runtime.NumGoroutine() <= before })
+}
+
+// TestOneHealthLoopPerService reloads the same services over and over, as
+// config reloads do: each service keeps exactly one health loop
+func TestOneHealthLoopPerService(t *testing.T) {
+	r := New()
+	defer r.Stop()
+
+	config := func(interval time.Duration, target string) []*types.Service {
+		plain := testService("docs", target, 0)
+		plain.Health = nil
+		return []*types.Service{
+			testService("web", target, time.Hour),
+			testService("api", target, interval),
+			plain,
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		// Unchanged, then a changed health config, then a changed target
+		for _, services := range [][]*types.Service{
+			config(time.Hour, refused),
+			config(time.Hour, refused),
+			config(time.Duration(i+1)*time.Hour, refused),
+			config(time.Hour, "http://127.0.0.1:2"),
+		} {
+			if _, err := r.Reconcile(services); err != nil {
+				t.Fatal(err)
+			}
+			eventually(t, "web and api run one loop each", func() bool { return healthLoops() == 2 })
+		}
+
+		if err := r.Update(testService("web", refused, 2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Register(testService("api", refused, time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "web and api run one loop each", func() bool { return healthLoops() == 2 })
+	}
+
+	// A reload that removes the check ends the loop
+	services := config(time.Hour, refused)
+	services[1].Health = nil
+	if _, err := r.Reconcile(services); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "only web runs a loop", func() bool { return healthLoops() == 1 })
+}
+
+// TestUpdateKeepsState updates a service: counters carry over, the health
+// loop only restarts for a changed health config, and watchers hear of it
+func TestUpdateKeepsState(t *testing.T) {
+	r := New()
+	defer r.Stop()
+	events := r.Watch(context.Background())
+
+	svc := testService("web", refused, time.Hour)
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the first check ran", func() bool { return svc.GetStatus() == types.HealthStatusUnhealthy })
+	svc.IncrementRequests()
+	svc.IncrementRequests()
+
+	// Same health config: the loop goes on waiting, with no new check
+	updated := testService("web", "http://127.0.0.1:2", time.Hour)
+	updated.Headers = map[string]string{"X-Env": "dev"}
+	if err := r.Update(updated); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := r.Get("web")
+	if got != updated || got.RequestCount != 2 || got.GetStatus() != types.HealthStatusUnhealthy {
+		t.Errorf("after Update: same instance %v, %d requests, status %s", got == updated, got.RequestCount, got.GetStatus())
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if failures, _ := got.Streaks(); failures != 1 {
+		t.Errorf("%d checks after an update that kept the health config, want 1", failures)
+	}
+
+	// A changed health config restarts the loop, which checks at once
+	changed := testService("web", refused, 2*time.Hour)
+	if err := r.Update(changed); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the new loop checks", func() bool { failures, _ := changed.Streaks(); return failures == 2 })
+
+	var seen []types.RegistryEventType
+	for len(events) > 0 {
+		seen = append(seen, (<-events).Type)
+	}
+	if n := len(seen); n == 0 || seen[n-1] != types.EventServiceUpdated {
+		t.Errorf("events %v, want the last to be %v", seen, types.EventServiceUpdated)
+	}
+
+	if err := r.Update(testService("docs", refused, time.Hour)); err == nil {
+		t.Error("updated a service that isn't registered")
+	}
+}
+
+// TestStopWhileChanging registers, updates and deregisters services from
+// several goroutines while Stop runs; run it with -race. Nothing may panic,
+// and every call either works or fails with ErrStopped.
+func TestStopWhileChanging(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		r := New()
+		events := r.Watch(context.Background())
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 1000)
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				name := fmt.Sprintf("svc%d", g)
+				for i := 0; i < 20; i++ {
+					for _, err := range []error{
+						r.Register(testService(name, refused, time.Hour)),
+						r.Update(testService(name, refused, 2*time.Hour)),
+						r.Pause(name),
+						r.Resume(name),
+						r.Deregister(name),
+					} {
+						if err != nil && !errors.Is(err, ErrStopped) {
+							errs <- err
+						}
+					}
+					r.Watch(context.Background())
+				}
+			}(g)
+		}
+
+		r.Stop()
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("round %d: %v", round, err)
+		}
+
+		if err := r.Register(testService("late", refused, time.Hour)); !errors.Is(err, ErrStopped) {
+			t.Errorf("Register after Stop: %v, want ErrStopped", err)
+		}
+		for range events {
+		} // closed by Stop
+		if _, ok := <-r.Watch(context.Background()); ok {
+			t.Error("Watch after Stop returned an open channel")
+		}
+		if n := healthLoops(); n != 0 {
+			t.Fatalf("%d health loops left after Stop", n)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		random float64
+		want   time.Duration
+	}{
+		{0, 9 * time.Second},
+		{0.25, 9500 * time.Millisecond},
+		{0.5, 10 * time.Second},
+		{1, 11 * time.Second},
+	}
+	for _, tt := range tests {
+		r := &Registry{random: func() float64 { return tt.random }}
+		if got := r.jitter(10 * time.Second); got != tt.want {
+			t.Errorf("jitter with random %v = %v, want %v", tt.random, got, tt.want)
+		}
+	}
+}
+
+// TestInitialDelay checks that the first check waits for the initial delay,
+// with the status unknown meanwhile, and later ones for the jittered interval
+func TestInitialDelay(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	r := New()
+	defer r.Stop()
+	r.random = func() float64 { return 0 }
+	clock := newFakeClock(r)
+
+	svc := testService("api", backend.URL, 10*time.Second)
+	svc.Health.InitialDelay = types.Duration(30 * time.Second)
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := clock.next(t); d != 30*time.Second {
+		t.Errorf("first wait = %v, want 30s", d)
+	}
+	if status := svc.GetStatus(); status != types.HealthStatusUnknown {
+		t.Errorf("status before the first check = %s, want unknown", status)
+	}
+	for i := 0; i < 3; i++ {
+		clock.tick()
+		if d := clock.next(t); d != 9*time.Second {
+			t.Errorf("wait after check %d = %v, want 9s", i+1, d)
+		}
+		if status := svc.GetStatus(); status != types.HealthStatusHealthy {
+			t.Errorf("status after check %d = %s, want healthy", i+1, status)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScanPorts are the ports dev servers commonly listen on
+var DefaultScanPorts = []int{3000, 3001, 4000, 4200, 5000, 5173, 5174, 8000, 8080, 8081, 8888, 9000}
+
+// scanCooldown is how long a scan result is reused before ports are dialed again
+const scanCooldown = 10 * time.Second
+
+// scanParallelism caps concurrent dials during a scan
+const scanParallelism = 16
+
+// ScanOptions configures local port scanning
+type ScanOptions struct {
+	Ports    []int         // ports to probe (default DefaultScanPorts)
+	Timeout  time.Duration // dial and probe timeout per port (default 300ms)
+	Exclude  []int         // ports never suggested, e.g. hz's own listeners
+	Disabled bool          // Discover returns nothing
+}
+
+// Suggestion is a local HTTP server that no registered service targets
+type Suggestion struct {
+	Name      string `json:"name"` // suggested service name
+	Port      int    `json:"port"`
+	Target    string `json:"target"`
+	Framework string `json:"framework,omitempty"` // best guess, e.g. "Vite"
+}
+
+// scanState holds the last scan result for rate limiting
+type scanState struct {
+	mu      sync.Mutex
+	opts    ScanOptions
+	at      time.Time
+	results []Suggestion
+}
+
+// SetScanOptions configures the ports Discover probes
+func (r *Registry) SetScanOptions(opts ScanOptions) {
+	r.scan.mu.Lock()
+	defer r.scan.mu.Unlock()
+	r.scan.opts = opts
+	r.scan.at = time.Time{}
+}
+
+// ScanEnabled reports whether Discover may probe ports
+func (r *Registry) ScanEnabled() bool {
+	r.scan.mu.Lock()
+	defer r.scan.mu.Unlock()
+	return !r.scan.opts.Disabled
+}
+
+// Discover probes local ports for HTTP servers that no registered service
+// targets. It never registers anything. Results are reused for a few seconds,
+// so repeated calls don't rescan.
+func (r *Registry) Discover(ctx context.Context) []Suggestion {
+	r.scan.mu.Lock()
+	defer r.scan.mu.Unlock()
+
+	if r.scan.opts.Disabled {
+		return nil
+	}
+	if !r.scan.at.IsZero() && time.Since(r.scan.at) < scanCooldown {
+		return r.filterSuggestions(r.scan.results)
+	}
+
+	opts := r.scan.opts
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = DefaultScanPorts
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 300 * time.Millisecond
+	}
+	skip := make(map[int]bool, len(opts.Exclude))
+	for _, p := range opts.Exclude {
+		skip[p] = true
+	}
+
+	var (
+		mu    sync.Mutex
+		found []Suggestion
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, scanParallelism)
+	)
+	for _, port := range ports {
+		if skip[port] {
+			continue
+		}
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if s, ok := probePort(ctx, port, timeout); ok {
+				mu.Lock()
+				found = append(found, s)
+				mu.Unlock()
+			}
+		}(port)
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Port < found[j].Port })
+	r.scan.results = found
+	r.scan.at = time.Now()
+
+	return r.filterSuggestions(found)
+}
+
+// filterSuggestions drops ports registered services already target and gives
+// each suggestion a name no service uses
+func (r *Registry) filterSuggestions(found []Suggestion) []Suggestion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	used := make(map[int]bool)
+	names := make(map[string]bool)
+	for _, svc := range r.services {
+		names[svc.Name] = true
+		if svc.TargetURL != nil && isLocalHost(svc.TargetURL.Hostname()) {
+			if p, err := strconv.Atoi(svc.TargetURL.Port()); err == nil {
+				used[p] = true
+			}
+		}
+	}
+
+	out := make([]Suggestion, 0, len(found))
+	for _, s := range found {
+		if used[s.Port] {
+			continue
+		}
+		name := strings.ToLower(strings.ReplaceAll(s.Framework, ".", ""))
+		if name == "" || names[name] {
+			name = fmt.Sprintf("app-%d", s.Port)
+		}
+		names[name] = true
+		s.Name = name
+		out = append(out, s)
+	}
+	return out
+}
+
+// isLocalHost reports whether host refers to this machine
+func isLocalHost(host string) bool {
+	switch host {
+	case "localhost", "127.0.0.1", "::1", "0.0.0.0", "::":
+		return true
+	}
+	return false
+}
+
+// probePort dials port on localhost and, if something listens, sends a GET /
+// to confirm it speaks HTTP and guess the framework
+func probePort(ctx context.Context, port int, timeout time.Duration) (Suggestion, bool) {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return Suggestion{}, false
+	}
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/", nil)
+	if err != nil {
+		return Suggestion{}, false
+	}
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: nil, DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Suggestion{}, false // not HTTP, or too slow to be worth routing to
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
+
+	return Suggestion{
+		Port:      port,
+		Target:    "http://localhost:" + strconv.Itoa(port),
+		Framework: guessFramework(resp.Header, string(body)),
+	}, true
+}
+
+// guessFramework names the dev server behind a response from its headers and
+// page banner, or returns ""
+func guessFramework(h http.Header, body string) string {
+	server := strings.ToLower(h.Get("Server"))
+	poweredBy := strings.ToLower(h.Get("X-Powered-By"))
+	lower := strings.ToLower(body)
+
+	switch {
+	case strings.Contains(lower, "/@vite/client"):
+		return "Vite"
+	case strings.Contains(poweredBy, "next.js"):
+		return "Next.js"
+	case strings.Contains(server, "wsgiserver") || strings.Contains(lower, "django"):
+		return "Django"
+	case h.Get("X-Runtime") != "" || strings.Contains(server, "puma") ||
+		strings.Contains(server, "webrick") || strings.Contains(lower, "ruby on rails"):
+		return "Rails"
+	case strings.Contains(server, "uvicorn"):
+		return "Uvicorn"
+	case strings.Contains(poweredBy, "express"):
+		return "Express"
+	case strings.Contains(poweredBy, "php"):
+		return "PHP"
+	case strings.Contains(lower, "webpack-dev-server") || strings.Contains(lower, "/sockjs-node"):
+		return "Webpack"
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// probeTCP checks that the target accepts a TCP connection, for backends
+// without an HTTP endpoint to ask
+func (r *Registry) probeTCP(ctx context.Context, service *types.Service) types.CheckResult {
+	health := service.Health
+
+	target := service.TargetURL
+	if target == nil {
+		var err error
+		if target, err = url.Parse(service.Target); err != nil {
+			return failed("invalid target: " + err.Error())
+		}
+	}
+	addr := target.Host
+	if target.Port() == "" {
+		port := "80"
+		if target.Scheme == "https" || target.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(target.Hostname(), port)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, health.Timeout.Duration())
+	defer cancel()
+
+	start := time.Now()
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	result := types.CheckResult{Latency: time.Since(start)}
+	if err != nil {
+		result.Error = describeRequestError(ctx, err, health.Timeout.Duration())
+		return result
+	}
+	conn.Close()
+	return result
+}
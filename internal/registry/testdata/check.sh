@@ -0,0 +1,17 @@
+#!/bin/sh
+# Exec health check for exec_test.go: passes, fails or hangs as told
+case "$1" in
+pass)
+	exit 0
+	;;
+fail)
+	echo "database is down" >&2
+	exit 3
+	;;
+silent)
+	exit 4
+	;;
+hang)
+	sleep 30
+	;;
+esac
@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// ProxyCheck marks a health check request sent through the proxy. The proxy
+// fills in RoutedTo so the check can tell whether it reached its service.
+type ProxyCheck struct {
+	Service  string // service being checked
+	RoutedTo string // service the proxy routed the request to, "" if none
+}
+
+type proxyCheckKey struct{}
+
+// ProxyCheckFrom returns the health check marker of a request's context, or
+// nil for client requests
+func ProxyCheckFrom(ctx context.Context) *ProxyCheck {
+	pc, _ := ctx.Value(proxyCheckKey{}).(*ProxyCheck)
+	return pc
+}
+
+// SetProxy sets the handler viaProxy health checks are served by
+func (r *Registry) SetProxy(h http.Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.proxy = h
+}
+
+// probeViaProxy sends the health check through the proxy handler in-process,
+// so routing, rewrites and injected headers apply
+func (r *Registry) probeViaProxy(ctx context.Context, service *types.Service) types.CheckResult {
+	health := service.Health
+
+	r.mu.RLock()
+	handler := r.proxy
+	r.mu.RUnlock()
+	if handler == nil {
+		return failed("viaProxy check without a proxy")
+	}
+
+	ref, err := url.Parse(health.Path)
+	if err != nil {
+		return failed(fmt.Sprintf("invalid health path: %v", err))
+	}
+
+	expect, err := parseExpectStatus(health.ExpectStatus)
+	if err != nil {
+		return failed(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, health.Timeout.Duration())
+	defer cancel()
+
+	check := &ProxyCheck{Service: service.Name}
+	ctx = context.WithValue(ctx, proxyCheckKey{}, check)
+
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: ref.Path, RawQuery: ref.RawQuery}
+	req, err := http.NewRequestWithContext(ctx, healthMethod(health), u.String(), nil)
+	if err != nil {
+		return failed(err.Error())
+	}
+	req.RequestURI = u.RequestURI()
+	req.RemoteAddr = "127.0.0.1:0"
+	applyHealthHeaders(health, req)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	result := types.CheckResult{StatusCode: rec.Code, Latency: time.Since(start)}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.Error = fmt.Sprintf("timed out after %s", health.Timeout.Duration())
+		result.StatusCode = 0
+	case check.RoutedTo == "":
+		result.Error = fmt.Sprintf("no route for %s", ref.Path)
+	case check.RoutedTo != service.Name:
+		result.Error = fmt.Sprintf("%s is routed to %s", ref.Path, check.RoutedTo)
+	case !expectedStatus(expect, rec.Code):
+		result.Error = unexpectedStatus(rec.Code)
+	default:
+		result.Error = checkBody(health, rec.Body)
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// watchBuffer is how many events a subscriber may fall behind before further
+// events are dropped for it
+const watchBuffer = 100
+
+// subscriber is one Watch channel
+type subscriber struct {
+	ch      chan types.RegistryEvent
+	dropped atomic.Int64
+}
+
+// watchers fans events out to every subscriber
+type watchers struct {
+	mu     sync.Mutex
+	subs   map[<-chan types.RegistryEvent]*subscriber
+	closed bool
+}
+
+// Watch returns a new channel that receives every registry event from now on.
+// The channel is closed when ctx is done or the registry stops. A subscriber
+// that falls behind misses events rather than blocking others; see Dropped.
+func (r *Registry) Watch(ctx context.Context) <-chan types.RegistryEvent {
+	sub := &subscriber{ch: make(chan types.RegistryEvent, watchBuffer)}
+
+	r.watch.mu.Lock()
+	if r.watch.closed {
+		r.watch.mu.Unlock()
+		close(sub.ch)
+		return sub.ch
+	}
+	if r.watch.subs == nil {
+		r.watch.subs = make(map[<-chan types.RegistryEvent]*subscriber)
+	}
+	r.watch.subs[sub.ch] = sub
+	r.watch.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-r.ctx.Done():
+		}
+		r.unsubscribe(sub)
+	}()
+
+	return sub.ch
+}
+
+// Dropped returns how many events a Watch channel missed because its buffer
+// was full
+func (r *Registry) Dropped(ch <-chan types.RegistryEvent) int64 {
+	r.watch.mu.Lock()
+	defer r.watch.mu.Unlock()
+	if sub, ok := r.watch.subs[ch]; ok {
+		return sub.dropped.Load()
+	}
+	return 0
+}
+
+// unsubscribe removes a subscriber and closes its channel
+func (r *Registry) unsubscribe(sub *subscriber) {
+	r.watch.mu.Lock()
+	defer r.watch.mu.Unlock()
+	if _, ok := r.watch.subs[sub.ch]; ok {
+		delete(r.watch.subs, sub.ch)
+		close(sub.ch)
+	}
+}
+
+// emitEvent sends an event to every subscriber without blocking
+func (r *Registry) emitEvent(eventType types.RegistryEventType, service *types.Service) {
+	event := types.RegistryEvent{Type: eventType, Service: service}
+
+	r.watch.mu.Lock()
+	defer r.watch.mu.Unlock()
+	for _, sub := range r.watch.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// closeWatchers closes every subscriber channel; later Watch calls get a
+// closed channel
+func (r *Registry) closeWatchers() {
+	r.watch.mu.Lock()
+	defer r.watch.mu.Unlock()
+	for ch, sub := range r.watch.subs {
+		delete(r.watch.subs, ch)
+		close(sub.ch)
+	}
+	r.watch.closed = true
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestWatchSubscribers has three subscribers receive every event while a
+// fourth never reads and a fifth unsubscribes halfway
+func TestWatchSubscribers(t *testing.T) {
+	r := New()
+	defer r.Stop()
+
+	const n = 3 * watchBuffer // more than a stalled subscriber can buffer
+	var chans []<-chan types.RegistryEvent
+	for i := 0; i < 3; i++ {
+		chans = append(chans, r.Watch(context.Background()))
+	}
+	stalled := r.Watch(context.Background())
+	ctx, unsubscribe := context.WithCancel(context.Background())
+	defer unsubscribe()
+	leaving := r.Watch(ctx)
+
+	var wg sync.WaitGroup
+	got := make([][]string, len(chans))
+	received := make([]atomic.Int64, len(chans))
+	for i, ch := range chans {
+		wg.Add(1)
+		go func(i int, ch <-chan types.RegistryEvent) {
+			defer wg.Done()
+			for event := range ch {
+				got[i] = append(got[i], event.Service.Name)
+				received[i].Add(1)
+				if len(got[i]) == n {
+					return
+				}
+			}
+		}(i, ch)
+	}
+
+	for i := 0; i < n; i++ {
+		// Emitting never blocks, so give the readers a chance to keep up
+		if i%(watchBuffer/2) == 0 {
+			for j := range received {
+				eventually(t, "the subscribers catch up", func() bool { return received[j].Load() == int64(i) })
+			}
+		}
+		if i == n/2 {
+			unsubscribe()
+			for range leaving {
+			} // closed once unsubscribed
+		}
+		r.emitEvent(types.EventServiceAdded, &types.Service{Name: fmt.Sprint(i)})
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscribers were blocked")
+	}
+
+	for i := range chans {
+		if len(got[i]) != n {
+			t.Fatalf("subscriber %d got %d events, want %d", i, len(got[i]), n)
+		}
+		for j, name := range got[i] {
+			if name != fmt.Sprint(j) {
+				t.Fatalf("subscriber %d: event %d is %s", i, j, name)
+			}
+		}
+		if d := r.Dropped(chans[i]); d != 0 {
+			t.Errorf("subscriber %d dropped %d events", i, d)
+		}
+	}
+	if d := r.Dropped(stalled); d != n-watchBuffer {
+		t.Errorf("the stalled subscriber dropped %d events, want %d", d, n-watchBuffer)
+	}
+
+	r.Stop()
+	for _, ch := range append(chans, stalled) {
+		for range ch {
+		}
+	}
+}
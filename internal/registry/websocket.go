@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// errPong ends the read loop of a websocket check once the pong arrives
+var errPong = errors.New("pong received")
+
+// probeWebSocket performs a WebSocket handshake against the health path,
+// optionally exchanges a ping and pong, and closes the connection cleanly.
+// A rejected handshake records the status code the server answered with.
+func (r *Registry) probeWebSocket(ctx context.Context, service *types.Service) types.CheckResult {
+	health := service.Health
+
+	healthURL, err := HealthURL(service)
+	if err != nil {
+		return failed(err.Error())
+	}
+	u, err := url.Parse(healthURL)
+	if err != nil {
+		return failed(err.Error())
+	}
+	wsURL := types.WebSocketURL(*u)
+
+	// Reuse the TLS settings of the service's HTTP health client
+	client, err := r.healthClient(service)
+	if err != nil {
+		return failed(err.Error())
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: health.Timeout.Duration()}
+	if t, ok := client.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+
+	header := http.Header{}
+	for name, value := range health.Headers {
+		header.Set(name, value) // the dialer sends Host as the request host
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, health.Timeout.Duration())
+	defer cancel()
+
+	start := time.Now()
+	conn, resp, err := dialer.DialContext(ctx, wsURL.String(), header)
+	if err != nil {
+		result := types.CheckResult{Latency: time.Since(start)}
+		if resp != nil {
+			resp.Body.Close()
+			result.StatusCode = resp.StatusCode
+			result.Error = fmt.Sprintf("handshake rejected with status %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		} else {
+			result.Error = describeRequestError(ctx, err, health.Timeout.Duration())
+		}
+		return result
+	}
+	defer conn.Close()
+
+	result := types.CheckResult{StatusCode: resp.StatusCode}
+	deadline, _ := ctx.Deadline()
+
+	if health.Ping {
+		conn.SetPongHandler(func(string) error { return errPong })
+		if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+			result.Error = fmt.Sprintf("ping failed: %v", err)
+		} else {
+			_ = conn.SetReadDeadline(deadline)
+			for {
+				// Data messages are skipped; the pong handler ends the loop
+				if _, _, err := conn.ReadMessage(); err != nil {
+					if !errors.Is(err, errPong) {
+						result.Error = fmt.Sprintf("no pong: %v", err)
+						if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+							result.Error = fmt.Sprintf("no pong within %s", health.Timeout.Duration())
+						}
+					}
+					break
+				}
+			}
+		}
+	}
+	result.Latency = time.Since(start)
+
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+
+	return result
+}
@@ -0,0 +1,196 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// analyzeRoutes reports duplicate, conflicting and shadowed routes in match
+// order. It is conservative: a route is only called unreachable when an
+// earlier route provably matches every request it could match. With the
+// ignore trailing-slash policy, /users and /users/ are the same path.
+func analyzeRoutes(routes []*types.Route, slashPolicy string) []string {
+	var warnings []string
+
+	for j, later := range routes {
+		for _, earlier := range routes[:j] {
+			a, b := effectiveConfig(earlier, slashPolicy), effectiveConfig(later, slashPolicy)
+			if !covers(a, b) {
+				continue
+			}
+
+			switch {
+			case sameMatchers(a, b) && earlier.Service != later.Service:
+				warnings = append(warnings, fmt.Sprintf("routes %s on %s and %s conflict; %s always wins",
+					DescribeRoute(later.Config), earlier.Service.Name, later.Service.Name, earlier.Service.Name))
+			case sameMatchers(a, b):
+				warnings = append(warnings, fmt.Sprintf("route %s on %s is defined more than once",
+					DescribeRoute(later.Config), later.Service.Name))
+			default:
+				warnings = append(warnings, fmt.Sprintf("route %s on %s is unreachable: shadowed by %s on %s",
+					DescribeRoute(later.Config), later.Service.Name, DescribeRoute(earlier.Config), earlier.Service.Name))
+			}
+			break
+		}
+	}
+
+	return warnings
+}
+
+// effectiveConfig returns a route's conditions with the service's
+// case-insensitive matching and the trailing-slash policy folded in
+func effectiveConfig(route *types.Route, slashPolicy string) types.RouteConfig {
+	cfg := route.Config
+	cfg.CaseInsensitive = cfg.CaseInsensitive || route.Service.CaseInsensitive
+	if slashPolicy == types.TrailingSlashIgnore && !strings.HasPrefix(cfg.Path, "~") {
+		cfg.Path = trimTrailingSlash(cfg.Path)
+	}
+	return cfg
+}
+
+// covers reports whether every request matching b also matches a
+func covers(a, b types.RouteConfig) bool {
+	// Exclusions and anyOf groups make coverage hard to prove
+	if a.ExcludePath != "" || len(a.ExcludeMethods) > 0 || len(a.AnyOf) > 0 || len(b.AnyOf) > 0 {
+		return false
+	}
+
+	for _, cond := range [][2]string{
+		{a.GRPCService, b.GRPCService},
+		{a.Header, b.Header},
+		{a.Subdomain, b.Subdomain},
+		{a.Host, b.Host},
+		{a.Query, b.Query},
+		{strings.Join(a.ClientCIDR, ","), strings.Join(b.ClientCIDR, ",")},
+	} {
+		if cond[0] != "" && cond[0] != cond[1] {
+			return false
+		}
+	}
+
+	if len(a.Methods) > 0 {
+		if len(b.Methods) == 0 {
+			return false
+		}
+		for _, m := range b.Methods {
+			if !containsString(a.Methods, m) {
+				return false
+			}
+		}
+	}
+
+	return pathCovers(a, b)
+}
+
+// pathCovers reports whether a's path matches every path b's path can match
+func pathCovers(a, b types.RouteConfig) bool {
+	if a.Path == "" {
+		return true
+	}
+	if b.Path == "" {
+		return false
+	}
+	// A case-sensitive path misses the other spellings b matches
+	if b.CaseInsensitive && !a.CaseInsensitive {
+		return false
+	}
+	ap, bp := a.Path, b.Path
+	if a.CaseInsensitive {
+		ap, bp = strings.ToLower(ap), strings.ToLower(bp)
+	}
+	if ap == bp {
+		return a.Prefix || !b.Prefix
+	}
+
+	// Only trailing wildcards are analyzed; regex routes are never compared
+	if strings.HasPrefix(ap, "~") || strings.HasPrefix(bp, "~") {
+		return false
+	}
+	base, ok := wildcardBase(ap)
+	if !ok {
+		return false
+	}
+	bp = strings.TrimSuffix(bp, "/")
+	return base == "" || bp == base || strings.HasPrefix(bp, base+"/")
+}
+
+// wildcardBase returns the literal prefix of a pattern ending in /* or /**
+// with no other wildcards or parameters
+func wildcardBase(pattern string) (string, bool) {
+	var base string
+	switch {
+	case strings.HasSuffix(pattern, "/**"):
+		base = strings.TrimSuffix(pattern, "/**")
+	case strings.HasSuffix(pattern, "/*"):
+		base = strings.TrimSuffix(pattern, "/*")
+	default:
+		return "", false
+	}
+	if strings.ContainsAny(base, "*:") {
+		return "", false
+	}
+	return base, true
+}
+
+// sameMatchers reports whether two routes have identical match conditions
+func sameMatchers(a, b types.RouteConfig) bool {
+	return a.Path == b.Path && a.Prefix == b.Prefix && a.CaseInsensitive == b.CaseInsensitive && a.GRPCService == b.GRPCService &&
+		a.Header == b.Header && a.Subdomain == b.Subdomain &&
+		a.Host == b.Host && a.Query == b.Query &&
+		strings.Join(a.ClientCIDR, ",") == strings.Join(b.ClientCIDR, ",") &&
+		strings.Join(a.Methods, ",") == strings.Join(b.Methods, ",") &&
+		a.ExcludePath == b.ExcludePath &&
+		strings.Join(a.ExcludeMethods, ",") == strings.Join(b.ExcludeMethods, ",")
+}
+
+// DescribeRoute renders a route's match conditions for messages
+func DescribeRoute(cfg types.RouteConfig) string {
+	var parts []string
+	if cfg.Path != "" {
+		parts = append(parts, fmt.Sprintf("%q", cfg.Path))
+	}
+	if cfg.GRPCService != "" {
+		parts = append(parts, "grpc "+cfg.GRPCService)
+	}
+	if cfg.Header != "" {
+		parts = append(parts, "header "+DescribeHeader(cfg.Header))
+	}
+	if cfg.Subdomain != "" {
+		parts = append(parts, "subdomain "+cfg.Subdomain)
+	}
+	if cfg.Host != "" {
+		parts = append(parts, "host "+cfg.Host)
+	}
+	if cfg.Query != "" {
+		parts = append(parts, "query "+cfg.Query)
+	}
+	if len(cfg.ClientCIDR) > 0 {
+		parts = append(parts, "from "+strings.Join(cfg.ClientCIDR, ","))
+	}
+	if len(cfg.Methods) > 0 {
+		parts = append(parts, strings.Join(cfg.Methods, ","))
+	}
+	if len(cfg.AnyOf) > 0 {
+		alts := make([]string, 0, len(cfg.AnyOf))
+		for _, entry := range cfg.AnyOf {
+			alts = append(alts, DescribeRoute(entry))
+		}
+		parts = append(parts, "anyOf("+strings.Join(alts, " | ")+")")
+	}
+	if len(parts) == 0 {
+		return "(match all)"
+	}
+	return strings.Join(parts, " ")
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
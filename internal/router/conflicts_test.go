@@ -0,0 +1,91 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+func TestConflictsCaseInsensitive(t *testing.T) {
+	tests := []struct {
+		name    string
+		earlier types.RouteConfig
+		fold    bool // the earlier service matches case-insensitively
+		later   types.RouteConfig
+		warning string
+	}{
+		{
+			name:    "same path",
+			earlier: types.RouteConfig{Path: "/api"},
+			later:   types.RouteConfig{Path: "/api"},
+			warning: "conflict",
+		},
+		{
+			name:    "sensitive before insensitive",
+			earlier: types.RouteConfig{Path: "/api"},
+			later:   types.RouteConfig{Path: "/api", CaseInsensitive: true},
+		},
+		{
+			name:    "insensitive before sensitive",
+			earlier: types.RouteConfig{Path: "/api", CaseInsensitive: true},
+			later:   types.RouteConfig{Path: "/api"},
+			warning: "unreachable",
+		},
+		{
+			name:    "insensitive covers other spelling",
+			earlier: types.RouteConfig{Path: "/API/*", CaseInsensitive: true, Priority: 10},
+			later:   types.RouteConfig{Path: "/api/users"},
+			warning: "unreachable",
+		},
+		{
+			name:    "service-wide",
+			earlier: types.RouteConfig{Path: "/Api"},
+			fold:    true,
+			later:   types.RouteConfig{Path: "/api"},
+			warning: "unreachable",
+		},
+		{
+			name:    "both insensitive",
+			earlier: types.RouteConfig{Path: "/api"},
+			fold:    true,
+			later:   types.RouteConfig{Path: "/api", CaseInsensitive: true},
+			warning: "conflict",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			earlier := &types.Service{Name: "one", Target: "http://127.0.0.1:1", CaseInsensitive: tt.fold, Routes: []types.RouteConfig{tt.earlier}}
+			later := &types.Service{Name: "two", Target: "http://127.0.0.1:2", Routes: []types.RouteConfig{tt.later}}
+			r := New()
+			if err := r.Build([]*types.Service{earlier, later}); err != nil {
+				t.Fatal(err)
+			}
+			warnings := strings.Join(r.Warnings(), "\n")
+			if tt.warning == "" && warnings != "" {
+				t.Errorf("unexpected warnings %q", warnings)
+			}
+			if !strings.Contains(warnings, tt.warning) {
+				t.Errorf("warnings %q, want one containing %q", warnings, tt.warning)
+			}
+		})
+	}
+}
+
+// TestConflictsTrailingSlash finds /docs and /docs/ conflicting only when
+// the trailing-slash policy makes them the same path
+func TestConflictsTrailingSlash(t *testing.T) {
+	for _, policy := range []string{"", types.TrailingSlashStrict, types.TrailingSlashRedirect, types.TrailingSlashIgnore} {
+		one := &types.Service{Name: "one", Target: "http://127.0.0.1:1", Routes: []types.RouteConfig{{Path: "/docs"}}}
+		two := &types.Service{Name: "two", Target: "http://127.0.0.1:2", Routes: []types.RouteConfig{{Path: "/docs/"}, {Path: "~^/docs/$"}}}
+		r := New()
+		r.SetTrailingSlash(policy)
+		if err := r.Build([]*types.Service{one, two}); err != nil {
+			t.Fatal(err)
+		}
+		warnings := strings.Join(r.Warnings(), "\n")
+		if want := policy == types.TrailingSlashIgnore; strings.Contains(warnings, "conflict") != want {
+			t.Errorf("policy %q: warnings %q, want a conflict: %v", policy, warnings, want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var grpcServiceRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*(\.\*)?$`)
+
+// grpcPathPrefix converts a grpcService matcher into the request path prefix
+// it selects: "users.UserService" -> "/users.UserService/", "orders.*" -> "/orders."
+func grpcPathPrefix(service string) (string, error) {
+	if !grpcServiceRe.MatchString(service) {
+		return "", fmt.Errorf("invalid grpcService %q", service)
+	}
+	if pkg, ok := strings.CutSuffix(service, ".*"); ok {
+		return "/" + pkg + ".", nil
+	}
+	return "/" + service + "/", nil
+}
+
+// matchGRPC reports whether the request is a gRPC (or gRPC-Web) call under prefix
+func matchGRPC(req *http.Request, prefix string) bool {
+	if req.Method != http.MethodPost || !strings.HasPrefix(req.URL.Path, prefix) {
+		return false
+	}
+	// application/grpc, application/grpc+proto, application/grpc-web+proto, ...
+	ct := strings.ToLower(req.Header.Get("Content-Type"))
+	return strings.HasPrefix(ct, "application/grpc")
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// headerMatcher is a compiled header condition. Supported forms:
+//
+//	Name            header is present
+//	!Name           header is absent
+//	Name=value      some value equals value (case-insensitive); "Name: value" also works
+//	Name: ~regex    some value matches regex
+//	!Name=value     no value equals value (negation applies to any form)
+type headerMatcher struct {
+	name   string
+	value  string
+	re     *regexp.Regexp
+	negate bool
+}
+
+var headerNameRe = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
+// parseHeaderMatcher compiles a header condition
+func parseHeaderMatcher(spec string) (*headerMatcher, error) {
+	hm := &headerMatcher{}
+
+	s := strings.TrimSpace(spec)
+	if strings.HasPrefix(s, "!") {
+		hm.negate = true
+		s = strings.TrimSpace(s[1:])
+	}
+
+	// Header names can't contain '=' or ':', so the first one separates the value
+	name, value, hasValue := s, "", false
+	if i := strings.IndexAny(s, "=:"); i >= 0 {
+		name, value, hasValue = s[:i], strings.TrimSpace(s[i+1:]), true
+	}
+	name = strings.TrimSpace(name)
+	if !headerNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid header name in %q", spec)
+	}
+	hm.name = http.CanonicalHeaderKey(name)
+
+	if hasValue {
+		if strings.HasPrefix(value, "~") {
+			re, err := regexp.Compile(value[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid header regex in %q: %w", spec, err)
+			}
+			hm.re = re
+		} else {
+			hm.value = value
+		}
+		if hm.re == nil && hm.value == "" {
+			return nil, fmt.Errorf("empty header value in %q", spec)
+		}
+	}
+
+	return hm, nil
+}
+
+// match reports whether the request satisfies the condition; with multiple
+// values for the header, any matching value counts
+func (hm *headerMatcher) match(req *http.Request) bool {
+	values := req.Header.Values(hm.name)
+
+	found := false
+	switch {
+	case hm.re != nil:
+		for _, v := range values {
+			if hm.re.MatchString(v) {
+				found = true
+				break
+			}
+		}
+	case hm.value != "":
+		for _, v := range values {
+			if strings.EqualFold(strings.TrimSpace(v), hm.value) {
+				found = true
+				break
+			}
+		}
+	default:
+		found = len(values) > 0
+	}
+
+	return found != hm.negate
+}
+
+// String renders the condition and its kind for route listings
+func (hm *headerMatcher) String() string {
+	var s string
+	switch {
+	case hm.re != nil:
+		s = fmt.Sprintf("%s matches ~%s", hm.name, hm.re)
+	case hm.value != "":
+		s = fmt.Sprintf("%s=%s", hm.name, hm.value)
+	case hm.negate:
+		return hm.name + " absent"
+	default:
+		return hm.name + " present"
+	}
+	if hm.negate {
+		return "not " + s
+	}
+	return s
+}
+
+// DescribeHeader renders a header condition with its matcher kind, e.g.
+// "Authorization present" or "User-Agent matches ~Mobile"
+func DescribeHeader(spec string) string {
+	hm, err := parseHeaderMatcher(spec)
+	if err != nil {
+		return spec
+	}
+	return hm.String()
+}
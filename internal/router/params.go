@@ -0,0 +1,35 @@
+package router
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+type paramsKey struct{}
+
+// WithParams stores captured path parameters in the request context
+func WithParams(ctx context.Context, params map[string]string) context.Context {
+	return context.WithValue(ctx, paramsKey{}, params)
+}
+
+// ParamsFromContext returns captured path parameters, or nil if none were stored
+func ParamsFromContext(ctx context.Context) map[string]string {
+	if params, ok := ctx.Value(paramsKey{}).(map[string]string); ok {
+		return params
+	}
+	return nil
+}
+
+// WithRouteParams attaches the route's captured parameters to the request
+func WithRouteParams(req *http.Request, route *types.Route) *http.Request {
+	if route.Captures == nil {
+		return req
+	}
+	params := route.Captures(req)
+	if len(params) == 0 {
+		return req
+	}
+	return req.WithContext(WithParams(req.Context(), params))
+}
@@ -0,0 +1,277 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// pathPattern is a compiled segment pattern such as /tenants/:tenant/api/*rest
+type pathPattern struct {
+	segments []patternSegment
+	rest     string // name of the trailing catch-all, "" if none
+	hasRest  bool
+	fold     bool // compare literal segments case-insensitively
+}
+
+// patternSegment is a literal segment, a named parameter, or a wildcard:
+// "*" matches exactly one segment and "**" matches zero or more
+type patternSegment struct {
+	literal string
+	param   string
+	wild    bool
+	multi   bool
+}
+
+// isSegmentPattern reports whether a path needs the segment compiler: it uses
+// :name segments, a named *rest, "**", or a "*" before the last segment
+func isSegmentPattern(pattern string) bool {
+	parts := splitSegments(pattern)
+	for i, seg := range parts {
+		switch {
+		case strings.HasPrefix(seg, ":"), seg == "**":
+			return true
+		case seg == "*":
+			if i != len(parts)-1 {
+				return true
+			}
+		case strings.HasPrefix(seg, "*"):
+			return true
+		}
+	}
+	return false
+}
+
+// compilePathPattern parses :name segments, * and ** wildcards, and a
+// trailing *rest catch-all
+func compilePathPattern(pattern string) (*pathPattern, error) {
+	pp := &pathPattern{}
+	seen := make(map[string]bool)
+
+	parts := splitSegments(pattern)
+	for i, seg := range parts {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name := seg[1:]
+			if !validParamName(name) {
+				return nil, fmt.Errorf("invalid parameter %q in path %q", seg, pattern)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicate parameter %q in path %q", name, pattern)
+			}
+			seen[name] = true
+			pp.segments = append(pp.segments, patternSegment{param: name})
+		case seg == "**":
+			pp.segments = append(pp.segments, patternSegment{multi: true})
+		case seg == "*" && i != len(parts)-1:
+			pp.segments = append(pp.segments, patternSegment{wild: true})
+		case strings.HasPrefix(seg, "*"):
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("catch-all %q must be the last segment in path %q", seg, pattern)
+			}
+			name := seg[1:]
+			if name != "" && !validParamName(name) {
+				return nil, fmt.Errorf("invalid catch-all %q in path %q", seg, pattern)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicate parameter %q in path %q", name, pattern)
+			}
+			pp.hasRest = true
+			pp.rest = name
+		default:
+			pp.segments = append(pp.segments, patternSegment{literal: seg})
+		}
+	}
+
+	return pp, nil
+}
+
+// match matches an escaped request path, returning decoded captures
+func (pp *pathPattern) match(escapedPath string) (map[string]string, bool) {
+	parts := splitSegments(escapedPath)
+	params := make(map[string]string)
+	var failed []bool
+	for _, seg := range pp.segments {
+		if seg.multi {
+			failed = make([]bool, (len(pp.segments)+1)*(len(parts)+1))
+			break
+		}
+	}
+	if !pp.matchSegments(0, 0, parts, params, failed) {
+		return nil, false
+	}
+	return params, true
+}
+
+// matchSegments matches pattern segments from si on against path segments
+// from pi on, backtracking over "**" wildcards. failed remembers positions
+// that didn't match, so several "**" take polynomial rather than exponential
+// time; it is nil for patterns without one.
+func (pp *pathPattern) matchSegments(si, pi int, parts []string, params map[string]string, failed []bool) bool {
+	key := si*(len(parts)+1) + pi
+	if failed != nil && failed[key] {
+		return false
+	}
+	if pp.matchSegment(si, pi, parts, params, failed) {
+		return true
+	}
+	if failed != nil {
+		failed[key] = true
+	}
+	return false
+}
+
+// matchSegment matches the pattern segment at si, then the rest
+func (pp *pathPattern) matchSegment(si, pi int, parts []string, params map[string]string, failed []bool) bool {
+	if si == len(pp.segments) {
+		if !pp.hasRest {
+			return pi == len(parts)
+		}
+		if pp.rest != "" {
+			rest, err := url.PathUnescape(strings.Join(parts[pi:], "/"))
+			if err != nil {
+				return false
+			}
+			params[pp.rest] = rest
+		}
+		return true
+	}
+
+	seg := pp.segments[si]
+	if seg.multi {
+		for i := pi; i <= len(parts); i++ {
+			if pp.matchSegments(si+1, i, parts, params, failed) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if pi == len(parts) {
+		return false
+	}
+	if !seg.wild {
+		value, err := url.PathUnescape(parts[pi])
+		if err != nil {
+			return false
+		}
+		if seg.param == "" {
+			if value != seg.literal && !(pp.fold && strings.EqualFold(value, seg.literal)) {
+				return false
+			}
+		} else {
+			// A parameter is one segment: an encoded slash or a dot segment
+			// could move it elsewhere in a rewritten path
+			if value == "." || value == ".." || strings.Contains(value, "/") {
+				return false
+			}
+			params[seg.param] = value
+		}
+	}
+	return pp.matchSegments(si+1, pi+1, parts, params, failed)
+}
+
+// names returns the parameter names this pattern captures
+func (pp *pathPattern) names() []string {
+	names := make([]string, 0, len(pp.segments)+1)
+	for _, seg := range pp.segments {
+		if seg.param != "" {
+			names = append(names, seg.param)
+		}
+	}
+	if pp.rest != "" {
+		names = append(names, pp.rest)
+	}
+	return names
+}
+
+// splitSegments splits a path into its non-empty segments
+func splitSegments(p string) []string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) == 1 && parts[0] == "" {
+		return nil
+	}
+	return parts
+}
+
+var paramNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validParamName reports whether a parameter name can be used as a placeholder
+func validParamName(name string) bool {
+	return paramNameRe.MatchString(name)
+}
+
+// placeholderRe matches {name} placeholders, and the ${name} form earlier
+// versions used, which collides with environment variables and is ignored
+var placeholderRe = regexp.MustCompile(`\$?\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandParams substitutes {name} placeholders with captured parameters, as
+// they are. Placeholders for parameters that weren't captured stay.
+func ExpandParams(s string, params map[string]string) string {
+	if len(params) == 0 || !strings.Contains(s, "{") {
+		return s
+	}
+	return expandParams(s, params, func(s string) string { return s }, func(v string) string { return v })
+}
+
+// expandPath substitutes {name} placeholders in a configured path with
+// captured parameters and returns the escaped path. Captured values are
+// escaped segment by segment, so they can't add "." or ".." segments.
+func expandPath(s string, params map[string]string) string {
+	return expandParams(s, params, escapePath, escapeParam)
+}
+
+// expandParams substitutes placeholders, passing the text between them
+// through literal and the captured values through value
+func expandParams(s string, params map[string]string, literal, value func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(s, -1) {
+		v, ok := params[s[m[2]:m[3]]]
+		if !ok || s[m[0]] == '$' {
+			continue
+		}
+		b.WriteString(literal(s[last:m[0]]))
+		b.WriteString(value(v))
+		last = m[1]
+	}
+	b.WriteString(literal(s[last:]))
+	return b.String()
+}
+
+// escapeParam escapes a captured value for a path. A catch-all's slashes stay
+// separators; "." and ".." segments are encoded.
+func escapeParam(value string) string {
+	segs := strings.Split(value, "/")
+	for i, seg := range segs {
+		if seg == "." || seg == ".." {
+			segs[i] = strings.ReplaceAll(seg, ".", "%2E")
+		} else {
+			segs[i] = url.PathEscape(seg)
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// placeholders returns the {name} references in a string
+func placeholders(s string) []string {
+	var names []string
+	for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		if !strings.HasPrefix(m[0], "$") {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// legacyPlaceholders returns the ${name} references in a string
+func legacyPlaceholders(s string) []string {
+	var names []string
+	for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		if strings.HasPrefix(m[0], "$") {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
@@ -0,0 +1,324 @@
+package router
+
+import (
+	"math/rand"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+func TestExpandParams(t *testing.T) {
+	params := map[string]string{"tenant": "acme", "rest": "a b/c"}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"{tenant}", "acme"},
+		{"tenant={tenant}; rest={rest}", "tenant=acme; rest=a b/c"},
+		{"{missing}", "{missing}"},
+		{"${tenant}", "${tenant}"}, // the old form collides with env variables
+		{"{not a name}", "{not a name}"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		if got := ExpandParams(tt.in, params); got != tt.want {
+			t.Errorf("ExpandParams(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	tests := []struct {
+		in     string
+		params map[string]string
+		want   string
+	}{
+		{"/t/{tenant}/api", map[string]string{"tenant": "acme"}, "/t/acme/api"},
+		{"/t/{tenant}", map[string]string{"tenant": "a b"}, "/t/a%20b"},
+		{"/t/{tenant}", map[string]string{"tenant": "x?y#z"}, "/t/x%3Fy%23z"},
+		{"/t/{tenant}", map[string]string{"tenant": ".."}, "/t/%2E%2E"},
+		{"/files/{rest}", map[string]string{"rest": "a/b/c"}, "/files/a/b/c"},
+		{"/files/{rest}", map[string]string{"rest": "../../etc/passwd"}, "/files/%2E%2E/%2E%2E/etc/passwd"},
+		{"/files/{rest}", map[string]string{"rest": "./x"}, "/files/%2E/x"},
+		{"/a b/{tenant}", map[string]string{"tenant": "acme"}, "/a%20b/acme"},
+		{"/t/${tenant}", map[string]string{"tenant": "acme"}, "/t/$%7Btenant%7D"},
+	}
+	for _, tt := range tests {
+		if got := expandPath(tt.in, tt.params); got != tt.want {
+			t.Errorf("expandPath(%q, %v) = %q, want %q", tt.in, tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestParamIsOneSegment(t *testing.T) {
+	pp, err := compilePathPattern("/tenants/:tenant/*rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		match  bool
+		tenant string
+		rest   string
+	}{
+		{"/tenants/acme/api/users", true, "acme", "api/users"},
+		{"/tenants/a%20b/x", true, "a b", "x"},
+		{"/tenants/..%2Fadmin/x", false, "", ""},
+		{"/tenants/acme%2F..%2Fother/x", false, "", ""},
+		{"/tenants/../x", false, "", ""},
+		{"/tenants/./x", false, "", ""},
+		{"/tenants/%2E%2E/x", false, "", ""},
+	}
+	for _, tt := range tests {
+		params, ok := pp.match(tt.path)
+		if ok != tt.match {
+			t.Errorf("match(%q) = %v, want %v", tt.path, ok, tt.match)
+			continue
+		}
+		if ok && (params["tenant"] != tt.tenant || params["rest"] != tt.rest) {
+			t.Errorf("match(%q) captured %v", tt.path, params)
+		}
+	}
+}
+
+func TestDoubleStar(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/**/api", "/api", true},
+		{"/**/api", "/a/b/api", true},
+		{"/**/api", "/a/b/api/x", false},
+		{"/a/**/b/**/c", "/a/b/c", true},
+		{"/a/**/b/**/c", "/a/x/b/y/z/c", true},
+		{"/a/**/b/**/c", "/a/x/c/b", false},
+		{"/**/:id/edit", "/users/7/edit", true},
+		{"/**/*rest", "/a/b", true},
+		{"/**/x", "/" + strings.Repeat("a/", 40) + "x", true},
+		{"/**/*/y", "/a", false},
+	}
+	for _, tt := range tests {
+		pp, err := compilePathPattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := pp.match(tt.path); ok != tt.match {
+			t.Errorf("%s matching %s = %v, want %v", tt.pattern, tt.path, ok, tt.match)
+		}
+	}
+}
+
+// TestDoubleStarBacktracking checks that many "**" against a long path that
+// doesn't match return quickly instead of trying every split
+func TestDoubleStarBacktracking(t *testing.T) {
+	pp, err := compilePathPattern("/" + strings.Repeat("**/a/", 12) + "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/" + strings.Repeat("a/", 200) + "c"
+
+	done := make(chan bool, 1)
+	go func() {
+		_, ok := pp.match(path)
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("matched a path that doesn't end in b")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("matching took over 5s")
+	}
+}
+
+func TestMidPathWildcards(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/api/*/admin", "/api/v1/admin", true},
+		{"/api/*/admin", "/api/admin", false},
+		{"/api/*/admin", "/api/v1/v2/admin", false},
+		{"/files/*/download", "/files/report.pdf/download", true},
+		{"/files/*/download", "/files/report.pdf/download/x", false},
+		{"/*/*/edit", "/users/7/edit", true},
+	}
+	for _, tt := range tests {
+		pp, err := compilePathPattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := pp.match(tt.path); ok != tt.match {
+			t.Errorf("%s matching %s = %v, want %v", tt.pattern, tt.path, ok, tt.match)
+		}
+	}
+}
+
+// TestPatternsAgainstRegex compares random patterns with a regex written
+// from the same segments
+func TestPatternsAgainstRegex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	patternTokens := []string{"a", "b", "*", "**"}
+	pathTokens := []string{"a", "b", "c"}
+
+	for i := 0; i < 2000; i++ {
+		var segs []string
+		var expr strings.Builder
+		expr.WriteString("^")
+		n := 1 + rng.Intn(5)
+		for j := 0; j < n; j++ {
+			seg := patternTokens[rng.Intn(len(patternTokens))]
+			segs = append(segs, seg)
+			switch {
+			case seg == "**", seg == "*" && j == n-1:
+				expr.WriteString("(?:/[^/]+)*")
+			case seg == "*":
+				expr.WriteString("/[^/]+")
+			default:
+				expr.WriteString("/" + seg)
+			}
+		}
+		expr.WriteString("$")
+		pattern := "/" + strings.Join(segs, "/")
+		pp, err := compilePathPattern(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := regexp.MustCompile(expr.String())
+
+		for k := 0; k < 10; k++ {
+			var path strings.Builder
+			for m := rng.Intn(7); m > 0; m-- {
+				path.WriteString("/" + pathTokens[rng.Intn(len(pathTokens))])
+			}
+			p := path.String()
+			want := ref.MatchString(p)
+			if p == "" {
+				p = "/"
+			}
+			if _, got := pp.match(p); got != want {
+				t.Fatalf("%s matching %s = %v, reference %s says %v", pattern, p, got, ref, want)
+			}
+		}
+	}
+}
+
+func TestWildcardSpecificity(t *testing.T) {
+	services := []*types.Service{
+		{Name: "any", Target: "http://127.0.0.1:1", Routes: []types.RouteConfig{{Path: "/api/**"}}},
+		{Name: "admin", Target: "http://127.0.0.1:2", Routes: []types.RouteConfig{{Path: "/api/*/admin"}}},
+		{Name: "users", Target: "http://127.0.0.1:3", Routes: []types.RouteConfig{{Path: "/api/users/*"}}},
+		{Name: "me", Target: "http://127.0.0.1:4", Routes: []types.RouteConfig{{Path: "/api/users/me"}}},
+	}
+	r := New()
+	if err := r.Build(services); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"/api/users/me":   "me",
+		"/api/users/7":    "users",
+		"/api/users/7/x":  "users",
+		"/api/v1/admin":   "admin",
+		"/api/v1/reports": "any",
+		"/api":            "any",
+	}
+	for path, want := range tests {
+		route, err := r.Match(httptest.NewRequest("GET", path, nil))
+		if err != nil || route == nil {
+			t.Errorf("%s: no route: %v", path, err)
+			continue
+		}
+		if route.Service.Name != want {
+			t.Errorf("%s went to %s, want %s", path, route.Service.Name, want)
+		}
+	}
+}
+
+func TestRewriteWithParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string
+		rewrite types.RewriteConfig
+		path    string
+		want    string
+	}{
+		{"replace", "/tenants/:tenant/*rest", types.RewriteConfig{Replace: "/internal/{tenant}/{rest}"}, "/tenants/acme/users/1", "/internal/acme/users/1"},
+		{"prefix", "/tenants/:tenant/*", types.RewriteConfig{StripPrefix: "/tenants/{tenant}", Prefix: "/t-{tenant}"}, "/tenants/acme/users", "/t-acme/users"},
+		{"escaped value", "/tenants/:tenant/*rest", types.RewriteConfig{Replace: "/internal/{tenant}/{rest}"}, "/tenants/a%20b/x", "/internal/a%20b/x"},
+		{"dot segments in catch-all", "/files/*rest", types.RewriteConfig{Replace: "/srv/files/{rest}"}, "/files/a/../../b", "/srv/files/a/%2E%2E/%2E%2E/b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrite := tt.rewrite
+			svc := &types.Service{Name: "api", Target: "http://127.0.0.1:1", Rewrite: &rewrite, Routes: []types.RouteConfig{{Path: tt.route}}}
+			r := New()
+			if err := r.Build([]*types.Service{svc}); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			route, err := r.Match(req)
+			if err != nil || route == nil {
+				t.Fatalf("no route for %s: %v", tt.path, err)
+			}
+			req = WithRouteParams(req, route)
+			RewriteURL(req, route.EffectiveRewrite())
+			if got := req.URL.EscapedPath(); got != tt.want {
+				t.Errorf("rewrote %s to %s, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceholderValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		svc     *types.Service
+		err     string
+		warning string
+	}{
+		{
+			name: "captured",
+			svc:  &types.Service{Name: "api", Headers: map[string]string{"X-Tenant": "{tenant}"}, Routes: []types.RouteConfig{{Path: "/t/:tenant/*"}}},
+		},
+		{
+			name: "not captured",
+			svc:  &types.Service{Name: "api", Headers: map[string]string{"X-Tenant": "{tenant}"}, Routes: []types.RouteConfig{{Path: "/api/*"}}},
+			err:  "uses {tenant} but route",
+		},
+		{
+			name: "default service",
+			svc:  &types.Service{Name: "api", Default: true, Rewrite: &types.RewriteConfig{Prefix: "/{tenant}"}},
+			err:  "is the default service",
+		},
+		{
+			name:    "old form",
+			svc:     &types.Service{Name: "api", Headers: map[string]string{"X-Tenant": "${tenant}"}, Routes: []types.RouteConfig{{Path: "/t/:tenant/*"}}},
+			warning: "path parameters are written {tenant}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.svc.Target = "http://127.0.0.1:1"
+			r := New()
+			err := r.Build([]*types.Service{tt.svc})
+			if tt.err == "" && err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("Build error = %v, want one containing %q", err, tt.err)
+			}
+			warnings := strings.Join(r.Warnings(), "\n")
+			if tt.warning != "" && !strings.Contains(warnings, tt.warning) {
+				t.Errorf("warnings %q, want one containing %q", warnings, tt.warning)
+			}
+		})
+	}
+}
@@ -2,12 +2,17 @@
 package router
 
 import (
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"path"
-	"sort"
+	"regexp"
 	"strings"
 	"sync"
 
+	"github.com/zymawy/hz/internal/clientip"
 	"github.com/zymawy/hz/pkg/types"
 )
 
@@ -15,6 +20,11 @@ import (
 type Router struct {
 	routes       []*types.Route
 	defaultRoute *types.Route
+	options      types.RoutingConfig
+	slashPolicy  string
+	logger       *log.Logger
+	warned       sync.Map // patterns already reported as loose matches
+	warnings     []string
 	mu           sync.RWMutex
 }
 
@@ -22,9 +32,29 @@ type Router struct {
 func New() *Router {
 	return &Router{
 		routes: make([]*types.Route, 0),
+		logger: log.Default(),
 	}
 }
 
+// SetLogger sets the logger
+func (r *Router) SetLogger(logger *log.Logger) {
+	r.logger = logger
+}
+
+// SetOptions sets global matching options, applied on the next Build
+func (r *Router) SetOptions(opts types.RoutingConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.options = opts
+}
+
+// SetTrailingSlash sets the trailing-slash policy, applied on the next Build
+func (r *Router) SetTrailingSlash(policy string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.slashPolicy = policy
+}
+
 // Build compiles routes from service configurations
 func (r *Router) Build(services []*types.Service) error {
 	r.mu.Lock()
@@ -32,69 +62,165 @@ func (r *Router) Build(services []*types.Service) error {
 
 	r.routes = make([]*types.Route, 0)
 	r.defaultRoute = nil
+	r.warnings = nil
 
+	byName := make(map[string]*types.Service, len(services))
 	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+
+	var legacy []string
+	for _, svc := range services {
+		if err := validatePlaceholders(svc); err != nil {
+			return err
+		}
+		legacy = append(legacy, legacyPlaceholderWarnings(svc)...)
+
+		// Config loading compiles rewrite regexes; cover services built
+		// elsewhere without writing to svc, which requests may be reading
+		svcRewrite, err := compiledRewrite(svc.Rewrite)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+
 		// Handle default service
 		if svc.Default {
 			r.defaultRoute = &types.Route{
-				Pattern: "*",
-				Service: svc,
+				Pattern:  "*",
+				Service:  svc,
+				Fallback: true,
 				MatchFunc: func(req *http.Request) bool {
 					return true
 				},
+				Rewrite: svcRewrite,
 			}
 		}
 
 		// Build routes from service configuration
 		for _, cfg := range svc.Routes {
-			route := r.buildRoute(svc, cfg)
+			rewrite := svcRewrite
+			if cfg.Rewrite != nil {
+				if rewrite, err = compiledRewrite(cfg.Rewrite); err != nil {
+					return fmt.Errorf("service %s: route %s: %w", svc.Name, DescribeRoute(cfg), err)
+				}
+			}
+			route, err := r.buildRoute(svc, cfg)
+			if err != nil {
+				return fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+			if route != nil && len(cfg.Split) > 0 {
+				if route.Pick, err = buildSplit(cfg, byName); err != nil {
+					return fmt.Errorf("service %s: %w", svc.Name, err)
+				}
+			}
 			if route != nil {
+				route.Rewrite = rewrite
 				r.routes = append(r.routes, route)
 			}
 		}
 	}
 
-	// Sort routes by priority (higher first) and specificity
-	sort.Slice(r.routes, func(i, j int) bool {
-		if r.routes[i].Config.Priority != r.routes[j].Config.Priority {
-			return r.routes[i].Config.Priority > r.routes[j].Config.Priority
-		}
-		// More specific paths first
-		return len(r.routes[i].Pattern) > len(r.routes[j].Pattern)
-	})
+	sortRoutes(r.routes)
+	r.warnings = append(legacy, analyzeRoutes(r.routes, r.slashPolicy)...)
 
 	return nil
 }
 
+// Warnings returns duplicate, conflicting and shadowed routes, and outdated
+// ${name} placeholders, found by the last Build
+func (r *Router) Warnings() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.warnings...)
+}
+
 // buildRoute creates a Route from configuration
-func (r *Router) buildRoute(svc *types.Service, cfg types.RouteConfig) *types.Route {
-	route := &types.Route{
-		Service: svc,
-		Config:  cfg,
+func (r *Router) buildRoute(svc *types.Service, cfg types.RouteConfig) (*types.Route, error) {
+	methods, err := normalizeMethods(cfg)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Method = ""
+	cfg.Methods = methods
+
+	if len(cfg.ExcludeMethods) > 0 {
+		if cfg.ExcludeMethods, err = normalizeMethods(types.RouteConfig{Methods: cfg.ExcludeMethods}); err != nil {
+			return nil, fmt.Errorf("excludeMethods: %w", err)
+		}
+	}
+
+	cm, err := r.compileMatcher(cfg, svc.CaseInsensitive)
+	if err != nil {
+		return nil, err
+	}
+	if cm == nil {
+		return nil, nil
+	}
+
+	return &types.Route{
+		Pattern:   cm.pattern,
+		Service:   svc,
+		Config:    cfg,
+		MatchFunc: cm.match,
+		Captures:  cm.captures,
+	}, nil
+}
+
+// compiledMatcher is the compiled form of a route's or anyOf entry's conditions
+type compiledMatcher struct {
+	match    func(*http.Request) bool
+	captures func(*http.Request) map[string]string // nil if nothing is captured
+	pattern  string                                // most specific path pattern, for sorting
+}
 
-	// Build match function based on configuration
+// compileMatcher compiles match conditions into a matcher tree. Fields are
+// AND-ed together and with the anyOf group, whose entries are OR-ed. It
+// returns nil if cfg has no conditions.
+func (r *Router) compileMatcher(cfg types.RouteConfig, fold bool) (*compiledMatcher, error) {
+	methods, err := normalizeMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cm := &compiledMatcher{}
 	matchers := make([]func(*http.Request) bool, 0)
+	pathOpts := pathOptions{
+		prefix: cfg.Prefix,
+		fold:   cfg.CaseInsensitive || fold,
+	}
 
 	// Path matcher
 	if cfg.Path != "" {
-		route.Pattern = cfg.Path
-		pathPattern := cfg.Path
+		pm, err := r.compilePath(cfg.Path, pathOpts)
+		if err != nil {
+			return nil, err
+		}
+		cm.pattern = cfg.Path
+		cm.captures = pm.captures
+		matchers = append(matchers, pm.match)
+	}
+
+	// gRPC matcher
+	if cfg.GRPCService != "" {
+		prefix, err := grpcPathPrefix(cfg.GRPCService)
+		if err != nil {
+			return nil, err
+		}
+		if cm.pattern == "" {
+			cm.pattern = prefix + "*"
+		}
 		matchers = append(matchers, func(req *http.Request) bool {
-			return matchPath(req.URL.Path, pathPattern)
+			return matchGRPC(req, prefix)
 		})
 	}
 
 	// Header matcher
 	if cfg.Header != "" {
-		parts := strings.SplitN(cfg.Header, "=", 2)
-		if len(parts) == 2 {
-			headerName := strings.TrimSpace(parts[0])
-			headerValue := strings.TrimSpace(parts[1])
-			matchers = append(matchers, func(req *http.Request) bool {
-				return strings.EqualFold(req.Header.Get(headerName), headerValue)
-			})
+		hm, err := parseHeaderMatcher(cfg.Header)
+		if err != nil {
+			return nil, err
 		}
+		matchers = append(matchers, hm.match)
 	}
 
 	// Subdomain matcher
@@ -105,29 +231,172 @@ func (r *Router) buildRoute(svc *types.Service, cfg types.RouteConfig) *types.Ro
 		})
 	}
 
+	// Host matcher
+	if cfg.Host != "" {
+		hostPattern := normalizeHost(cfg.Host)
+		matchers = append(matchers, func(req *http.Request) bool {
+			return matchHost(req.Host, hostPattern)
+		})
+	}
+
+	// Query matcher
+	if cfg.Query != "" {
+		conditions, err := parseQueryConditions(cfg.Query)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, func(req *http.Request) bool {
+			return matchQuery(req.URL.Query(), conditions)
+		})
+	}
+
+	// Client IP matcher
+	if len(cfg.ClientCIDR) > 0 {
+		prefixes, err := clientip.ParsePrefixes(cfg.ClientCIDR)
+		if err != nil {
+			return nil, fmt.Errorf("clientCidr: %w", err)
+		}
+		matchers = append(matchers, func(req *http.Request) bool {
+			addr, ok := clientip.Resolve(req)
+			return ok && clientip.Contains(prefixes, addr)
+		})
+	}
+
 	// Method matcher
-	if cfg.Method != "" {
-		method := strings.ToUpper(cfg.Method)
+	if len(methods) > 0 {
+		allowed := make(map[string]bool, len(methods))
+		for _, m := range methods {
+			allowed[m] = true
+		}
 		matchers = append(matchers, func(req *http.Request) bool {
-			return req.Method == method
+			return allowed[req.Method]
 		})
 	}
 
+	// anyOf group: entries are OR-ed, captures come from the first matching entry
+	if len(cfg.AnyOf) > 0 {
+		group, err := r.compileAnyOf(cfg.AnyOf, pathOpts.fold)
+		if err != nil {
+			return nil, err
+		}
+		if cm.pattern == "" {
+			cm.pattern = group.pattern
+		}
+		cm.captures = mergeCaptures(cm.captures, group.captures)
+		matchers = append(matchers, group.match)
+	}
+
 	// Combine all matchers
 	if len(matchers) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	route.MatchFunc = func(req *http.Request) bool {
+	// Exclusions veto an otherwise matching request
+	exclusions := make([]func(*http.Request) bool, 0)
+	if cfg.ExcludePath != "" {
+		pm, err := r.compilePath(cfg.ExcludePath, pathOpts)
+		if err != nil {
+			return nil, fmt.Errorf("excludePath: %w", err)
+		}
+		exclusions = append(exclusions, pm.match)
+	}
+	if len(cfg.ExcludeMethods) > 0 {
+		excluded, err := normalizeMethods(types.RouteConfig{Methods: cfg.ExcludeMethods})
+		if err != nil {
+			return nil, fmt.Errorf("excludeMethods: %w", err)
+		}
+		exclusions = append(exclusions, func(req *http.Request) bool {
+			for _, m := range excluded {
+				if req.Method == m {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	cm.match = func(req *http.Request) bool {
 		for _, match := range matchers {
 			if !match(req) {
 				return false
 			}
 		}
+		for _, exclude := range exclusions {
+			if exclude(req) {
+				return false
+			}
+		}
 		return true
 	}
 
-	return route
+	return cm, nil
+}
+
+// compileAnyOf compiles anyOf entries into a single OR matcher
+func (r *Router) compileAnyOf(entries []types.RouteConfig, fold bool) (*compiledMatcher, error) {
+	branches := make([]*compiledMatcher, 0, len(entries))
+	group := &compiledMatcher{}
+
+	for i, entry := range entries {
+		if entry.Priority != 0 || len(entry.Split) > 0 || entry.StickyHeader != "" || entry.Rewrite != nil {
+			return nil, fmt.Errorf("anyOf entry %d: only match conditions are allowed", i)
+		}
+		branch, err := r.compileMatcher(entry, fold)
+		if err != nil {
+			return nil, fmt.Errorf("anyOf entry %d: %w", i, err)
+		}
+		if branch == nil {
+			return nil, fmt.Errorf("anyOf entry %d has no conditions", i)
+		}
+		branches = append(branches, branch)
+
+		// Sort by the most specific branch
+		if comparePaths(scorePath(branch.pattern, false), scorePath(group.pattern, false)) > 0 {
+			group.pattern = branch.pattern
+		}
+	}
+
+	group.match = func(req *http.Request) bool {
+		for _, b := range branches {
+			if b.match(req) {
+				return true
+			}
+		}
+		return false
+	}
+	group.captures = func(req *http.Request) map[string]string {
+		for _, b := range branches {
+			if b.match(req) {
+				if b.captures == nil {
+					return nil
+				}
+				return b.captures(req)
+			}
+		}
+		return nil
+	}
+
+	return group, nil
+}
+
+// mergeCaptures combines two capture funcs; values from first win
+func mergeCaptures(first, second func(*http.Request) map[string]string) func(*http.Request) map[string]string {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func(req *http.Request) map[string]string {
+		params := second(req)
+		if params == nil {
+			params = make(map[string]string)
+		}
+		for k, v := range first(req) {
+			params[k] = v
+		}
+		return params
+	}
 }
 
 // Match finds the best matching route for a request
@@ -138,11 +407,16 @@ func (r *Router) Match(req *http.Request) (*types.Route, error) {
 	// Try explicit routes first (in priority/specificity order)
 	for _, route := range r.routes {
 		if route.MatchFunc(req) {
+			if route.Pick != nil {
+				picked := *route
+				picked.Service = route.Pick(req)
+				return &picked, nil
+			}
 			return route, nil
 		}
 	}
 
-	// Fall back to default route
+	// Fall back to default route, marked Fallback so callers can tell it apart
 	if r.defaultRoute != nil {
 		return r.defaultRoute, nil
 	}
@@ -158,12 +432,7 @@ func (r *Router) AddRoute(route *types.Route) error {
 	r.routes = append(r.routes, route)
 
 	// Re-sort after adding
-	sort.Slice(r.routes, func(i, j int) bool {
-		if r.routes[i].Config.Priority != r.routes[j].Config.Priority {
-			return r.routes[i].Config.Priority > r.routes[j].Config.Priority
-		}
-		return len(r.routes[i].Pattern) > len(r.routes[j].Pattern)
-	})
+	sortRoutes(r.routes)
 
 	return nil
 }
@@ -198,9 +467,9 @@ func (r *Router) Routes() []*types.Route {
 	return routes
 }
 
-// matchPath matches URL path against a pattern
-// Supports wildcards: /api/* matches /api/foo, /api/foo/bar
-func matchPath(urlPath, pattern string) bool {
+// matchPath matches URL path against a pattern. Plain patterns match exactly,
+// or also on sub-paths when prefix is set; "/*" and "*" suffixes are wildcards.
+func matchPath(urlPath, pattern string, prefix bool) bool {
 	// Exact match
 	if urlPath == pattern {
 		return true
@@ -221,8 +490,332 @@ func matchPath(urlPath, pattern string) bool {
 		return strings.HasPrefix(urlPath, prefix)
 	}
 
-	// Check if pattern is a prefix (for backward compatibility)
-	return strings.HasPrefix(urlPath, pattern)
+	if urlPath == pattern {
+		return true
+	}
+	if !prefix {
+		return false
+	}
+
+	// Prefix matches stop at segment boundaries: /api matches /api/x, not /apix
+	return pattern == "/" || strings.HasPrefix(urlPath, pattern+"/")
+}
+
+// matchPathLegacy is the pre-strictPaths behaviour where plain patterns match
+// any path starting with them. Matches the strict rules would reject are logged.
+func (r *Router) matchPathLegacy(urlPath, pattern string, prefix bool) bool {
+	if matchPath(urlPath, pattern, prefix) {
+		return true
+	}
+	if !strings.HasPrefix(path.Clean("/"+urlPath), path.Clean("/"+pattern)) {
+		return false
+	}
+
+	if _, seen := r.warned.LoadOrStore(pattern, true); !seen {
+		r.logger.Printf("[router] DEPRECATED: path %q loosely matched %q; set routing.strictPaths: true and use prefix: true or %q", pattern, urlPath, strings.TrimSuffix(pattern, "/")+"/*")
+	}
+	return true
+}
+
+// pathMatcher is a compiled path pattern
+type pathMatcher struct {
+	match    func(*http.Request) bool
+	captures func(*http.Request) map[string]string // nil if the pattern captures nothing
+}
+
+// pathOptions are per-route settings that change how a path pattern matches
+type pathOptions struct {
+	prefix bool // plain patterns also match sub-paths
+	fold   bool // case-insensitive matching
+}
+
+// compilePath compiles a path pattern: "~" prefix means a regular expression,
+// :name and *rest segments capture parameters, anything else uses matchPath.
+// Case folding never changes the request path or captured values.
+func (r *Router) compilePath(pattern string, opts pathOptions) (*pathMatcher, error) {
+	// With the ignore policy both sides are matched without a trailing slash;
+	// the request itself, and so the upstream path, is never modified
+	reqPath := func(req *http.Request) string { return req.URL.Path }
+	escPath := func(req *http.Request) string { return req.URL.EscapedPath() }
+	if r.slashPolicy == types.TrailingSlashIgnore {
+		reqPath = func(req *http.Request) string { return trimTrailingSlash(req.URL.Path) }
+		escPath = func(req *http.Request) string { return trimTrailingSlash(req.URL.EscapedPath()) }
+		if !strings.HasPrefix(pattern, "~") {
+			pattern = trimTrailingSlash(pattern)
+		}
+	}
+
+	if strings.HasPrefix(pattern, "~") {
+		expr := strings.TrimPrefix(pattern, "~")
+		if opts.fold {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path regex %q: %w", pattern, err)
+		}
+		pm := &pathMatcher{
+			match: func(req *http.Request) bool {
+				return re.MatchString(reqPath(req))
+			},
+		}
+		if hasNamedGroups(re) {
+			pm.captures = func(req *http.Request) map[string]string {
+				return regexCaptures(re, reqPath(req))
+			}
+		}
+		return pm, nil
+	}
+
+	if isSegmentPattern(pattern) {
+		pp, err := compilePathPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		pp.fold = opts.fold
+		return &pathMatcher{
+			match: func(req *http.Request) bool {
+				_, ok := pp.match(escPath(req))
+				return ok
+			},
+			captures: func(req *http.Request) map[string]string {
+				params, _ := pp.match(escPath(req))
+				return params
+			},
+		}, nil
+	}
+
+	// Plain patterns compare lowercased copies of both sides
+	fold := func(p string) string { return p }
+	if opts.fold {
+		fold = strings.ToLower
+		pattern = fold(pattern)
+	}
+
+	if !r.options.StrictPaths {
+		return &pathMatcher{
+			match: func(req *http.Request) bool {
+				return r.matchPathLegacy(fold(reqPath(req)), pattern, opts.prefix)
+			},
+		}, nil
+	}
+
+	return &pathMatcher{
+		match: func(req *http.Request) bool {
+			return matchPath(fold(reqPath(req)), pattern, opts.prefix)
+		},
+	}, nil
+}
+
+// validMethods lists the HTTP methods accepted in route configuration
+var validMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodConnect: true,
+	http.MethodTrace:   true,
+}
+
+// normalizeMethods merges the legacy method field into methods, uppercasing,
+// de-duplicating and rejecting unknown methods
+func normalizeMethods(cfg types.RouteConfig) ([]string, error) {
+	all := cfg.Methods
+	if cfg.Method != "" {
+		all = append([]string{cfg.Method}, all...)
+	}
+
+	seen := make(map[string]bool)
+	methods := make([]string, 0, len(all))
+	for _, m := range all {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if !validMethods[m] {
+			return nil, fmt.Errorf("unknown HTTP method %q", m)
+		}
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
+// validatePlaceholders checks that every {name} used in the service's headers
+// and in each route's effective rewrite is captured by that route
+func validatePlaceholders(svc *types.Service) error {
+	var shared []string
+	for _, value := range svc.Headers {
+		shared = append(shared, placeholders(value)...)
+	}
+	serviceRewrite := rewritePlaceholders(svc.Rewrite)
+
+	if svc.Default {
+		if used := append(shared, serviceRewrite...); len(used) > 0 {
+			return fmt.Errorf("service %s uses {%s} but is the default service, whose fallback route captures no parameters", svc.Name, used[0])
+		}
+	}
+
+	for _, cfg := range svc.Routes {
+		used := append([]string(nil), shared...)
+		if cfg.Rewrite != nil {
+			used = append(used, rewritePlaceholders(cfg.Rewrite)...)
+		} else {
+			used = append(used, serviceRewrite...)
+		}
+		if len(used) == 0 {
+			continue
+		}
+
+		names, err := routeParamNames(cfg)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		for _, name := range used {
+			if !names[name] {
+				return fmt.Errorf("service %s uses {%s} but route %s does not capture it", svc.Name, name, DescribeRoute(cfg))
+			}
+		}
+	}
+	return nil
+}
+
+// compiledRewrite returns rw with its regex compiled. Config loading
+// compiles them; for rewrites it hasn't, a compiled copy is returned, so
+// the shared config is never written to.
+func compiledRewrite(rw *types.RewriteConfig) (*types.RewriteConfig, error) {
+	if rw == nil || rw.Regex == "" || rw.RegexCompiled != nil {
+		return rw, nil
+	}
+	re, err := regexp.Compile(rw.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite regex: %w", err)
+	}
+	compiled := *rw
+	compiled.RegexCompiled = re
+	return &compiled, nil
+}
+
+// rewritePlaceholders returns the {name} placeholders used by rewrite rules
+func rewritePlaceholders(rw *types.RewriteConfig) []string {
+	return rewriteFields(rw, placeholders)
+}
+
+// rewriteFields collects find's results from the rewrite fields that take
+// placeholders
+func rewriteFields(rw *types.RewriteConfig, find func(string) []string) []string {
+	if rw == nil {
+		return nil
+	}
+	var found []string
+	found = append(found, find(rw.Prefix)...)
+	found = append(found, find(rw.StripPrefix)...)
+	found = append(found, find(rw.Replace)...)
+	return found
+}
+
+// legacyPlaceholderWarnings reports ${name} placeholders left from earlier
+// versions, which are no longer filled in
+func legacyPlaceholderWarnings(svc *types.Service) []string {
+	var names []string
+	for _, value := range svc.Headers {
+		names = append(names, legacyPlaceholders(value)...)
+	}
+	names = append(names, rewriteFields(svc.Rewrite, legacyPlaceholders)...)
+	for _, cfg := range svc.Routes {
+		names = append(names, rewriteFields(cfg.Rewrite, legacyPlaceholders)...)
+	}
+
+	var warnings []string
+	for _, name := range names {
+		warnings = append(warnings, fmt.Sprintf("service %s uses ${%s}, which is left as is; path parameters are written {%s}", svc.Name, name, name))
+	}
+	return warnings
+}
+
+// routeParamNames returns the parameters a route always captures: those of its
+// own path plus those captured by every anyOf entry
+func routeParamNames(cfg types.RouteConfig) (map[string]bool, error) {
+	names, err := paramNames(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var common map[string]bool
+	for _, entry := range cfg.AnyOf {
+		entryNames, err := routeParamNames(entry)
+		if err != nil {
+			return nil, err
+		}
+		if common == nil {
+			common = entryNames
+			continue
+		}
+		for name := range common {
+			if !entryNames[name] {
+				delete(common, name)
+			}
+		}
+	}
+	for name := range common {
+		names[name] = true
+	}
+	return names, nil
+}
+
+// paramNames returns the parameter names a path pattern captures
+func paramNames(pattern string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	switch {
+	case strings.HasPrefix(pattern, "~"):
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "~"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid path regex %q: %w", pattern, err)
+		}
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				names[name] = true
+			}
+		}
+	case isSegmentPattern(pattern):
+		pp, err := compilePathPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range pp.names() {
+			names[name] = true
+		}
+	}
+	return names, nil
+}
+
+// hasNamedGroups reports whether a regex defines any named capture groups
+func hasNamedGroups(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// regexCaptures returns the named groups captured from a path
+func regexCaptures(re *regexp.Regexp, urlPath string) map[string]string {
+	match := re.FindStringSubmatch(urlPath)
+	if match == nil {
+		return nil
+	}
+
+	params := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" && i < len(match) {
+			params[name] = match[i]
+		}
+	}
+	return params
 }
 
 // matchSubdomain matches host against subdomain pattern
@@ -236,29 +829,218 @@ func matchSubdomain(host, subdomain string) bool {
 	return strings.HasPrefix(host, subdomain+".")
 }
 
-// RewriteURL applies rewrite rules to a request URL
+// matchHost matches a request Host against an exact or "*."-prefixed pattern.
+// The pattern must already be normalized with normalizeHost.
+func matchHost(reqHost, pattern string) bool {
+	host := normalizeHost(reqHost)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// normalizeHost lowercases a host and strips its port, IPv6 brackets and trailing dot
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// queryCondition requires a query parameter, optionally with a specific value
+type queryCondition struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// parseQueryConditions parses "beta=1&debug" into AND-ed conditions
+func parseQueryConditions(query string) ([]queryCondition, error) {
+	var conditions []queryCondition
+	for _, part := range strings.Split(query, "&") {
+		if part == "" {
+			continue
+		}
+
+		rawName, rawValue, hasValue := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil || name == "" {
+			return nil, fmt.Errorf("invalid query condition %q", part)
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query condition %q", part)
+		}
+
+		conditions = append(conditions, queryCondition{name: name, value: value, hasValue: hasValue})
+	}
+	return conditions, nil
+}
+
+// matchQuery checks every condition against the parsed query. A repeated
+// parameter matches if any of its values does.
+func matchQuery(values url.Values, conditions []queryCondition) bool {
+	for _, cond := range conditions {
+		got, ok := values[cond.name]
+		if !ok {
+			return false
+		}
+		if !cond.hasValue {
+			continue
+		}
+
+		found := false
+		for _, v := range got {
+			if v == cond.value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// DescribeRewrite renders rewrite rules in the order RewriteURL applies them
+func DescribeRewrite(rw *types.RewriteConfig) string {
+	if rw == nil {
+		return "none"
+	}
+	var parts []string
+	if rw.Regex != "" {
+		parts = append(parts, fmt.Sprintf("regex %s → %s", rw.Regex, rw.Replacement))
+	}
+	if rw.StripSegments > 0 {
+		parts = append(parts, fmt.Sprintf("stripSegments %d", rw.StripSegments))
+	}
+	if rw.StripPrefix != "" {
+		parts = append(parts, "stripPrefix "+rw.StripPrefix)
+	}
+	if rw.Prefix != "" {
+		parts = append(parts, "prefix "+rw.Prefix)
+	}
+	if rw.Replace != "" {
+		parts = append(parts, "replace "+rw.Replace)
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// RewriteURL applies rewrite rules to a request URL. {name} placeholders in
+// the prefix rules are filled from path parameters captured by the matched
+// route, escaped.
 func RewriteURL(req *http.Request, rewrite *types.RewriteConfig) {
 	if rewrite == nil {
 		return
 	}
 
-	// Strip prefix
+	params := ParamsFromContext(req.Context())
+
+	// A matching regex rule takes precedence over the prefix rules
+	if rewriteRegex(req, rewrite) {
+		return
+	}
+
+	// Work on the escaped path so encoded characters such as %2F survive;
+	// the query string is never touched by these rules
+	p := req.URL.EscapedPath()
+
+	// Strip leading segments whatever their value, e.g. a tenant slug
+	if rewrite.StripSegments > 0 {
+		segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+		if rewrite.StripSegments >= len(segs) {
+			p = "/"
+		} else {
+			p = "/" + strings.Join(segs[rewrite.StripSegments:], "/")
+		}
+	}
+
+	// Strip prefix on segment boundaries: /api strips /api/x but not /apifoo
 	if rewrite.StripPrefix != "" {
-		req.URL.Path = strings.TrimPrefix(req.URL.Path, rewrite.StripPrefix)
-		if !strings.HasPrefix(req.URL.Path, "/") {
-			req.URL.Path = "/" + req.URL.Path
+		prefix := strings.TrimSuffix(expandPath(rewrite.StripPrefix, params), "/")
+		if hasPathPrefix(p, prefix) {
+			p = strings.TrimPrefix(p, prefix)
+			if !strings.HasPrefix(p, "/") {
+				p = "/" + p
+			}
 		}
 	}
 
 	// Add prefix
 	if rewrite.Prefix != "" {
-		if !strings.HasPrefix(req.URL.Path, rewrite.Prefix) {
-			req.URL.Path = rewrite.Prefix + req.URL.Path
+		prefix := strings.TrimSuffix(expandPath(rewrite.Prefix, params), "/")
+		if !hasPathPrefix(p, prefix) {
+			p = prefix + p
 		}
 	}
 
 	// Replace path
 	if rewrite.Replace != "" {
-		req.URL.Path = rewrite.Replace
+		p = expandPath(rewrite.Replace, params)
+	}
+
+	setEscapedPath(req.URL, p)
+}
+
+// hasPathPrefix reports whether p equals prefix or continues it with a "/"
+func hasPathPrefix(p, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// escapePath escapes a configured (unescaped) path for comparison with EscapedPath
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// setEscapedPath sets both Path and RawPath from an escaped path, keeping the
+// original encoding of characters like %2F intact upstream
+func setEscapedPath(u *url.URL, escaped string) {
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+	u.Path = unescaped
+	u.RawPath = ""
+	if escapePath(unescaped) != escaped {
+		u.RawPath = escaped
+	}
+}
+
+// rewriteRegex applies the regex rewrite rule, reporting whether it matched.
+// A "?" in the replacement sets query parameters ahead of the original ones.
+func rewriteRegex(req *http.Request, rewrite *types.RewriteConfig) bool {
+	re := rewrite.RegexCompiled
+	if re == nil {
+		return false
+	}
+
+	match := re.FindStringSubmatchIndex(req.URL.Path)
+	if match == nil {
+		return false
+	}
+
+	result := string(re.ExpandString(nil, rewrite.Replacement, req.URL.Path, match))
+
+	newPath, newQuery, hasQuery := strings.Cut(result, "?")
+	if !strings.HasPrefix(newPath, "/") {
+		newPath = "/" + newPath
+	}
+	req.URL.Path = newPath
+	req.URL.RawPath = ""
+
+	if hasQuery && newQuery != "" {
+		if req.URL.RawQuery != "" {
+			newQuery += "&" + req.URL.RawQuery
+		}
+		req.URL.RawQuery = newQuery
 	}
+	return true
 }
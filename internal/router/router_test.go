@@ -0,0 +1,706 @@
+package router
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		pattern string
+		prefix  bool
+		want    bool
+	}{
+		{"/api", "/api", false, true},
+		{"/api/users", "/api", false, false},
+		{"/api/users", "/api", true, true},
+		{"/apiview/x", "/api", true, false},
+		{"/api-docs", "/api", true, false},
+		{"/anything", "/", true, true},
+		{"/api", "/api/*", false, true},
+		{"/api/users/1", "/api/*", false, true},
+		{"/apifoo", "/api/*", false, false},
+		{"/apifoo", "/api*", false, true},
+		{"/api/../admin", "/api/*", false, false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.path, tt.pattern, tt.prefix); got != tt.want {
+			t.Errorf("matchPath(%q, %q, prefix %v) = %v, want %v", tt.path, tt.pattern, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestStrictPaths(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix bool
+		strict bool
+		want   bool
+	}{
+		{"/api", false, true, true},
+		{"/api/users", false, true, false},
+		{"/api/users", true, true, true},
+		{"/apiview", true, true, false},
+		{"/api", false, false, true},
+		{"/api/users", false, false, true},
+		{"/apiview", false, false, true}, // the legacy loose match, logged
+		{"/other", false, false, false},
+	}
+	for _, tt := range tests {
+		var logs bytes.Buffer
+		r := New()
+		r.SetLogger(log.New(&logs, "", 0))
+		r.SetOptions(types.RoutingConfig{StrictPaths: tt.strict})
+		svc := &types.Service{Name: "api", Target: "http://127.0.0.1:1", Routes: []types.RouteConfig{{Path: "/api", Prefix: tt.prefix}}}
+		if err := r.Build([]*types.Service{svc}); err != nil {
+			t.Fatal(err)
+		}
+
+		route, _ := r.Match(httptest.NewRequest("GET", tt.path, nil))
+		if got := route != nil; got != tt.want {
+			t.Errorf("strict %v, prefix %v: %s matched %v, want %v", tt.strict, tt.prefix, tt.path, got, tt.want)
+		}
+		loose := tt.want && !tt.strict && tt.path != "/api"
+		if got := strings.Contains(logs.String(), "DEPRECATED"); got != loose {
+			t.Errorf("strict %v: %s logged deprecation %v, want %v: %s", tt.strict, tt.path, got, loose, logs.String())
+		}
+	}
+}
+
+// TestBuildLeavesRewriteAlone checks that Build compiles rewrite regexes
+// into its own routes instead of the service config, which requests served
+// by the previous build may be reading
+func TestBuildLeavesRewriteAlone(t *testing.T) {
+	shared := &types.RewriteConfig{Regex: `^/api/users/(\d+)$`, Replacement: "/internal/users?id=$1"}
+	routeRewrite := &types.RewriteConfig{Regex: `^/v2/(.*)$`, Replacement: "/next/$1"}
+	svc := &types.Service{
+		Name:    "api",
+		Target:  "http://127.0.0.1:1",
+		Default: true,
+		Rewrite: shared,
+		Routes: []types.RouteConfig{
+			{Path: "/api/*"},
+			{Path: "/v2/*", Rewrite: routeRewrite},
+		},
+	}
+
+	r := New()
+	if err := r.Build([]*types.Service{svc}); err != nil {
+		t.Fatal(err)
+	}
+	if shared.RegexCompiled != nil || routeRewrite.RegexCompiled != nil {
+		t.Fatal("Build wrote the compiled regex into the service config")
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/users/7", "/internal/users?id=7"},
+		{"/v2/items", "/next/items"},
+		{"/api/users/7/x", "/api/users/7/x"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		route, err := r.Match(req)
+		if err != nil || route == nil {
+			t.Fatalf("no route for %s: %v", tt.path, err)
+		}
+		RewriteURL(req, route.EffectiveRewrite())
+		if got := req.URL.RequestURI(); got != tt.want {
+			t.Errorf("rewrote %s to %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+// service returns a service named name that is matched by routes
+func service(name string, routes ...types.RouteConfig) *types.Service {
+	return &types.Service{Name: name, Target: "http://127.0.0.1:1", Routes: routes}
+}
+
+// buildRouter builds a router with strict paths from services
+func buildRouter(t *testing.T, services ...*types.Service) *Router {
+	t.Helper()
+	r := New()
+	r.SetLogger(log.New(io.Discard, "", 0))
+	r.SetOptions(types.RoutingConfig{StrictPaths: true})
+	if err := r.Build(services); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// matchName returns the name of the service matched by req, or "" for none
+func matchName(t *testing.T, r *Router, req *http.Request) string {
+	t.Helper()
+	route, err := r.Match(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route == nil {
+		return ""
+	}
+	return route.Service.Name
+}
+
+func TestMatchHost(t *testing.T) {
+	r := buildRouter(t,
+		service("exact", types.RouteConfig{Host: "app.example.com"}),
+		service("wildcard", types.RouteConfig{Host: "*.example.org"}),
+		service("ipv6", types.RouteConfig{Host: "[::1]"}),
+		service("fqdn", types.RouteConfig{Host: "Docs.Example.NET."}),
+		service("sub", types.RouteConfig{Subdomain: "api"}),
+	)
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"app.example.com", "exact"},
+		{"APP.Example.Com", "exact"},
+		{"app.example.com:8443", "exact"},
+		{"app.example.com.", "exact"},
+		{"app.example.com.:8443", "exact"},
+		{"www.app.example.com", ""},
+		{"a.example.org", "wildcard"},
+		{"a.b.example.org:80", "wildcard"},
+		{"a.example.org.", "wildcard"},
+		{"example.org", ""}, // the wildcard needs a subdomain
+		{"badexample.org", ""},
+		{"[::1]:8080", "ipv6"},
+		{"[::1]", "ipv6"},
+		{"[::2]:8080", ""},
+		{"docs.example.net", "fqdn"},
+		{"docs.example.net.:443", "fqdn"},
+		{"api.localhost:8080", "sub"},
+		{"api.localhost.", "sub"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = tt.host
+		if got := matchName(t, r, req); got != tt.want {
+			t.Errorf("host %q matched %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	r := buildRouter(t,
+		service("beta", types.RouteConfig{Query: "beta=1&debug"}),
+		service("tag", types.RouteConfig{Query: "tag=b"}),
+		service("encoded", types.RouteConfig{Query: "q=a%20b&filter%5Bname%5D=x%26y"}),
+	)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"beta=1&debug", "beta"},
+		{"debug=&beta=1", "beta"},
+		{"beta=1", ""}, // every condition must hold
+		{"beta=2&debug", ""},
+		{"beta=2&beta=1&debug=0", "beta"}, // any value of a repeated key
+		{"tag=a&tag=b", "tag"},
+		{"tag=b&tag=a", "tag"},
+		{"tag=a&tag=c", ""},
+		{"tag=a,b", ""},
+		{"q=a%20b&filter%5Bname%5D=x%26y", "encoded"},
+		{"q=a+b&filter[name]=x%26y", "encoded"},
+		{"q=a+b&filter[name]=x&y", ""}, // an unescaped & splits the value
+		{"q=a%2520b&filter[name]=x%26y", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/?"+tt.query, nil)
+		if got := matchName(t, r, req); got != tt.want {
+			t.Errorf("query %q matched %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	if _, err := parseQueryConditions("q=%zz"); err == nil {
+		t.Error("parseQueryConditions accepted a bad escape")
+	}
+}
+
+func TestMatchMethods(t *testing.T) {
+	web := service("web")
+	web.Default = true
+	r := buildRouter(t,
+		service("preflight", types.RouteConfig{Path: "/api/*", Methods: []string{"options"}}),
+		service("connect", types.RouteConfig{Methods: []string{"CONNECT"}}),
+		service("legacy", types.RouteConfig{Path: "/api/*", Method: "post"}),
+		service("both", types.RouteConfig{Path: "/api/*", Method: "delete", Methods: []string{" Put ", "DELETE"}}),
+		web,
+	)
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"OPTIONS", "/api/users", "preflight"},
+		{"OPTIONS", "/other", "web"},
+		{"CONNECT", "/tunnel", "connect"},
+		{"POST", "/api/users", "legacy"},
+		{"DELETE", "/api/users", "both"},
+		{"PUT", "/api/users", "both"},
+		{"GET", "/api/users", "web"},
+		{"HEAD", "/api/users", "web"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := matchName(t, r, req); got != tt.want {
+			t.Errorf("%s %s matched %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	// The legacy field is merged into methods, which routes then report
+	for _, route := range r.Routes() {
+		if route.Service.Name == "both" {
+			if got := strings.Join(route.Config.Methods, ","); got != "DELETE,PUT" || route.Config.Method != "" {
+				t.Errorf("both has method %q and methods %s, want DELETE,PUT only", route.Config.Method, got)
+			}
+		}
+	}
+
+	for _, cfg := range []types.RouteConfig{
+		{Path: "/", Method: "FETCH"},
+		{Path: "/", Methods: []string{"GET", "PURGE"}},
+		{Path: "/", ExcludeMethods: []string{""}},
+	} {
+		if err := New().Build([]*types.Service{service("api", cfg)}); err == nil {
+			t.Errorf("Build accepted %+v", cfg)
+		}
+	}
+}
+
+func TestMatchExclusions(t *testing.T) {
+	web := service("web")
+	web.Default = true
+	r := buildRouter(t,
+		// The exclusions overlap: DELETE /api/admin/x is vetoed by both
+		service("api", types.RouteConfig{
+			Path:           "/api/*",
+			ExcludePath:    "/api/admin/*",
+			ExcludeMethods: []string{"delete", "PATCH"},
+		}),
+		// The exclusion is nested several segments below the include
+		service("files", types.RouteConfig{
+			Path:        "/files/*",
+			ExcludePath: "/files/:owner/private/*",
+		}),
+		service("docs", types.RouteConfig{
+			Path:        "/docs",
+			Prefix:      true,
+			ExcludePath: "~^/docs/v[0-9]+/drafts(/|$)",
+		}),
+		web,
+	)
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/api/users", "api"},
+		{"GET", "/api/admin", "web"},
+		{"GET", "/api/admin/users", "web"},
+		{"GET", "/api/administrator", "api"},
+		{"DELETE", "/api/users", "web"},
+		{"DELETE", "/api/admin/users", "web"},
+		{"PATCH", "/api/users", "web"},
+		{"GET", "/files/ann/public/a.txt", "files"},
+		{"GET", "/files/ann/private", "web"},
+		{"GET", "/files/ann/private/a/b.txt", "web"},
+		{"GET", "/files/private/a.txt", "files"},
+		{"GET", "/docs/v2/guide", "docs"},
+		{"GET", "/docs/v2/drafts", "web"},
+		{"GET", "/docs/v2/drafts/next", "web"},
+		{"GET", "/docs/v2/draftsman", "docs"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := matchName(t, r, req); got != tt.want {
+			t.Errorf("%s %s matched %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestRewriteEncodedSlash checks that an encoded slash stays inside its
+// segment through the prefix rules, and reaches the backend still encoded
+func TestRewriteEncodedSlash(t *testing.T) {
+	tests := []struct {
+		rewrite types.RewriteConfig
+		target  string
+		want    string
+	}{
+		{types.RewriteConfig{StripPrefix: "/api"}, "/api/files/a%2Fb", "/files/a%2Fb"},
+		{types.RewriteConfig{StripPrefix: "/api"}, "/api/files/a%2Fb?x=1%2F2", "/files/a%2Fb?x=1%2F2"},
+		{types.RewriteConfig{StripPrefix: "/api"}, "/api%2Ffiles/a", "/api%2Ffiles/a"}, // not a segment boundary
+		{types.RewriteConfig{StripPrefix: "/api/"}, "/api/a%2F", "/a%2F"},
+		{types.RewriteConfig{StripPrefix: "/api"}, "/api/a%2fb", "/a%2fb"},
+		{types.RewriteConfig{StripSegments: 2}, "/t/acme/files/a%2Fb", "/files/a%2Fb"},
+		{types.RewriteConfig{StripSegments: 1}, "/a%2Fb/c", "/c"}, // one segment, not two
+		{types.RewriteConfig{StripSegments: 1}, "/a%2Fb", "/"},
+		{types.RewriteConfig{StripSegments: 1, StripPrefix: "/files"}, "/acme/files/a%2Fb", "/a%2Fb"},
+		{types.RewriteConfig{StripPrefix: "/api", Prefix: "/v1"}, "/api/a%2Fb", "/v1/a%2Fb"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		RewriteURL(req, &tt.rewrite)
+		if got := req.URL.RequestURI(); got != tt.want {
+			t.Errorf("%s rewrote %s to %s, want %s", DescribeRewrite(&tt.rewrite), tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	shop := service("shop", types.RouteConfig{Path: "/Shop/*"})
+	shop.CaseInsensitive = true
+	r := buildRouter(t,
+		service("menu", types.RouteConfig{Path: "/Café/menu", CaseInsensitive: true}),
+		service("profile", types.RouteConfig{Path: "/Users/:id/Profile", CaseInsensitive: true}),
+		service("street", types.RouteConfig{Path: "~^/Straße/(?P<no>[0-9]+)$", CaseInsensitive: true}),
+		service("exact", types.RouteConfig{Path: "/Exact"}),
+		service("books", types.RouteConfig{Host: "BÜCHER.Example", Path: "/books"}),
+		shop,
+	)
+
+	tests := []struct {
+		host   string
+		path   string
+		want   string
+		params map[string]string
+	}{
+		{"", "/café/MENU", "menu", nil},
+		{"", "/CAFÉ/menu", "menu", nil},
+		{"", "/caf%C3%A9/Menu", "menu", nil},
+		{"", "/cafe/menu", "", nil},
+		{"", "/users/AbC/PROFILE", "profile", map[string]string{"id": "AbC"}},
+		{"", "/USERS/%C3%84/profile", "profile", map[string]string{"id": "Ä"}},
+		{"", "/straße/12", "street", map[string]string{"no": "12"}},
+		{"", "/STRAẞE/12", "street", map[string]string{"no": "12"}},
+		{"", "/STRASSE/12", "", nil}, // no multi-letter folding
+		{"", "/Exact", "exact", nil},
+		{"", "/exact", "", nil},
+		{"bücher.example", "/books", "books", nil},
+		{"BÜCHER.EXAMPLE:8080", "/books", "books", nil},
+		{"bucher.example", "/books", "", nil},
+		{"bücher.example", "/Books", "", nil}, // the host doesn't fold the path
+		{"", "/SHOP/Items", "shop", nil},
+		{"", "/shop", "shop", nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		route, _ := r.Match(req)
+		got := ""
+		if route != nil {
+			got = route.Service.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s%s matched %q, want %q", tt.host, tt.path, got, tt.want)
+			continue
+		}
+		if tt.params != nil {
+			if params := route.Captures(req); !maps.Equal(params, tt.params) {
+				t.Errorf("%s captured %v, want %v", tt.path, params, tt.params)
+			}
+		}
+	}
+}
+
+func TestMatchClientIP(t *testing.T) {
+	web := service("web")
+	web.Default = true
+	r := buildRouter(t,
+		service("office", types.RouteConfig{ClientCIDR: []string{"10.0.0.0/8", "2001:db8::/32"}}),
+		service("lan", types.RouteConfig{ClientCIDR: []string{"::ffff:192.168.1.0/120"}}),
+		service("home", types.RouteConfig{ClientCIDR: []string{"203.0.113.7"}}),
+		service("loopback6", types.RouteConfig{ClientCIDR: []string{"::1"}}),
+		web,
+	)
+
+	tests := []struct {
+		remote string
+		xff    string
+		tunnel bool
+		direct bool
+		want   string
+	}{
+		{"10.1.2.3:5000", "", false, false, "office"},
+		{"[2001:db8::5]:443", "", false, false, "office"},
+		{"[2001:db9::5]:443", "", false, false, "web"},
+		{"[::ffff:10.1.2.3]:80", "", false, false, "office"}, // v4-mapped
+		{"[::ffff:192.168.1.9]:80", "", false, false, "lan"},
+		{"192.168.1.9:80", "", false, false, "lan"},
+		{"192.168.2.9:80", "", false, false, "web"},
+		{"[::1]:80", "", false, false, "loopback6"},
+		{"127.0.0.1:80", "", false, false, "web"},
+
+		// Forwarded addresses only count for tunnel traffic
+		{"127.0.0.1:80", "203.0.113.7", false, false, "web"},
+		{"127.0.0.1:80", "203.0.113.7", true, false, "home"},
+		{"127.0.0.1:80", "10.9.9.9, 203.0.113.7", true, false, "home"}, // the edge's own entry
+		{"127.0.0.1:80", "203.0.113.7, 10.9.9.9", true, false, "office"},
+		{"127.0.0.1:80", "::ffff:203.0.113.7", true, false, "home"},
+		{"127.0.0.1:80", "2001:db8::1", true, false, "office"},
+		{"10.0.0.1:80", "not an address", true, false, "office"},
+		{"203.0.113.7:80", "10.0.0.1", true, true, "home"}, // direct tunnel connections
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.tunnel {
+			ctx := clientip.WithTunnel(req.Context())
+			if tt.direct {
+				ctx = clientip.WithDirect(ctx)
+			}
+			req = req.WithContext(ctx)
+		}
+		if got := matchName(t, r, req); got != tt.want {
+			t.Errorf("%s (forwarded %q, tunnel %v, direct %v) matched %q, want %q",
+				tt.remote, tt.xff, tt.tunnel, tt.direct, got, tt.want)
+		}
+	}
+}
+
+// TestMatchHeaderValues sends headers with several values: a condition holds
+// if any value matches, and a negated one only if none does
+func TestMatchHeaderValues(t *testing.T) {
+	tests := []struct {
+		spec   string
+		values []string
+		want   bool
+	}{
+		{"X-Tenant=acme", []string{"beta", "acme"}, true},
+		{"X-Tenant=acme", []string{" ACME "}, true},
+		{"X-Tenant=acme", []string{"beta", "gamma"}, false},
+		{"X-Tenant=acme", []string{"beta, acme"}, false}, // one value, not split on commas
+		{"X-Tenant: ~^ac", []string{"beta", "acme"}, true},
+		{"X-Tenant: ~^ac", []string{"beta, acme"}, false},
+		{"X-Tenant: ~acme$", []string{"beta, acme"}, true},
+		{"!X-Tenant=acme", []string{"beta", "acme"}, false},
+		{"!X-Tenant=acme", []string{"beta", "gamma"}, true},
+		{"X-Tenant", []string{"", ""}, true},
+		{"!X-Tenant", []string{"beta", "acme"}, false},
+		{"!X-Tenant", nil, true},
+	}
+	for _, tt := range tests {
+		hm, err := parseHeaderMatcher(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, v := range tt.values {
+			req.Header.Add("x-tenant", v)
+		}
+		if got := hm.match(req); got != tt.want {
+			t.Errorf("%q with values %q = %v, want %v", tt.spec, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestMatchNestedAnyOf(t *testing.T) {
+	web := service("web")
+	web.Default = true
+	r := buildRouter(t,
+		service("beta", types.RouteConfig{
+			Path:           "/api/*",
+			ExcludeMethods: []string{"DELETE"},
+			AnyOf: []types.RouteConfig{
+				{Header: "X-Beta"},
+				{Query: "beta=1", ExcludePath: "/api/legacy/*"},
+				{
+					AnyOf: []types.RouteConfig{
+						{Host: "beta.test"},
+						{ClientCIDR: []string{"10.0.0.0/8"}},
+					},
+					ExcludePath: "/api/admin/*",
+				},
+			},
+		}),
+		service("users", types.RouteConfig{
+			AnyOf: []types.RouteConfig{
+				{AnyOf: []types.RouteConfig{{Path: "/u/:id"}, {Path: "/users/:id"}}},
+				{Path: "/people/:id", ExcludePath: "/people/me"},
+			},
+		}),
+		web,
+	)
+
+	tests := []struct {
+		method string
+		target string
+		host   string
+		remote string
+		beta   bool
+		want   string
+		id     string
+	}{
+		{"GET", "/api/x", "", "", true, "beta", ""},
+		{"DELETE", "/api/x", "", "", true, "web", ""}, // the route's exclusion vetoes every entry
+		{"GET", "/api/x", "", "", false, "web", ""},
+		{"GET", "/other", "", "", true, "web", ""},
+		{"GET", "/api/x?beta=1", "", "", false, "beta", ""},
+		{"GET", "/api/legacy/x?beta=1", "", "", false, "web", ""},
+		{"GET", "/api/legacy/x", "", "", true, "beta", ""}, // an entry's exclusion only covers that entry
+		{"GET", "/api/x", "beta.test", "", false, "beta", ""},
+		{"GET", "/api/admin/x", "beta.test", "", false, "web", ""},
+		{"GET", "/api/x", "", "10.1.1.1:1234", false, "beta", ""},
+		{"GET", "/api/admin/x", "", "10.1.1.1:1234", false, "web", ""},
+		{"GET", "/api/admin/x?beta=1", "", "10.1.1.1:1234", false, "beta", ""},
+		{"GET", "/u/7", "", "", false, "users", "7"},
+		{"GET", "/users/8", "", "", false, "users", "8"},
+		{"GET", "/people/9", "", "", false, "users", "9"},
+		{"GET", "/people/me", "", "", false, "web", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		if tt.remote != "" {
+			req.RemoteAddr = tt.remote
+		}
+		if tt.beta {
+			req.Header.Set("X-Beta", "1")
+		}
+		route, _ := r.Match(req)
+		if route.Service.Name != tt.want {
+			t.Errorf("%s %s (host %q, from %q, beta %v) matched %q, want %q",
+				tt.method, tt.target, tt.host, tt.remote, tt.beta, route.Service.Name, tt.want)
+			continue
+		}
+		if tt.id != "" {
+			if got := route.Captures(req)["id"]; got != tt.id {
+				t.Errorf("%s captured id %q, want %q", tt.target, got, tt.id)
+			}
+		}
+	}
+
+	empty := service("api", types.RouteConfig{AnyOf: []types.RouteConfig{{AnyOf: []types.RouteConfig{{}}}}})
+	err := New().Build([]*types.Service{empty})
+	if want := "service api: anyOf entry 0: anyOf entry 0 has no conditions"; err == nil || err.Error() != want {
+		t.Errorf("Build with an empty nested entry = %v, want %s", err, want)
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	tests := []struct {
+		policy   string
+		target   string
+		want     string
+		redirect string
+	}{
+		{types.TrailingSlashStrict, "/api/users", "users", ""},
+		{types.TrailingSlashStrict, "/api/users/", "users", ""}, // plain patterns compare cleaned paths
+		{types.TrailingSlashStrict, "/", "root", ""},
+		{types.TrailingSlashStrict, "/items/7", "item", ""},
+		{types.TrailingSlashStrict, "/items/7/", "item", ""},
+		{types.TrailingSlashStrict, "/v2", "v2", ""},
+		{types.TrailingSlashStrict, "/v2/", "", ""}, // regexes see the path as sent
+
+		{types.TrailingSlashIgnore, "/api/users/", "users", ""},
+		{types.TrailingSlashIgnore, "/api/users//", "users", ""},
+		{types.TrailingSlashIgnore, "/api/users/?page=2", "users", ""},
+		{types.TrailingSlashIgnore, "/", "root", ""},
+		{types.TrailingSlashIgnore, "/items/7/", "item", ""},
+		{types.TrailingSlashIgnore, "/items/7/?q=a/", "item", ""},
+		{types.TrailingSlashIgnore, "/v2/", "v2", ""},
+
+		{types.TrailingSlashRedirect, "/", "root", ""},
+		{types.TrailingSlashRedirect, "/api/users", "users", ""},
+		{types.TrailingSlashRedirect, "/api/users/", "", "/api/users"},
+		{types.TrailingSlashRedirect, "/api/users/?page=2&next=%2Fa%2F", "", "/api/users?page=2&next=%2Fa%2F"},
+		{types.TrailingSlashRedirect, "/api/users?next=/", "users", ""},
+		{types.TrailingSlashRedirect, "/files/a%2F", "", ""}, // an encoded slash is part of the name
+		{types.TrailingSlashRedirect, "//", "", "/"},
+		{types.TrailingSlashRedirect, "///evil.example/", "", "/evil.example"}, // never protocol-relative
+	}
+	for _, tt := range tests {
+		r := New()
+		r.SetLogger(log.New(io.Discard, "", 0))
+		r.SetOptions(types.RoutingConfig{StrictPaths: true})
+		r.SetTrailingSlash(tt.policy)
+		err := r.Build([]*types.Service{
+			service("users", types.RouteConfig{Path: "/api/users"}),
+			service("root", types.RouteConfig{Path: "/"}),
+			service("item", types.RouteConfig{Path: "/items/:id"}),
+			service("v2", types.RouteConfig{Path: "~^/v2$"}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("GET", tt.target, nil)
+		redirect, ok := r.RedirectTarget(req)
+		if redirect != tt.redirect || ok != (tt.redirect != "") {
+			t.Errorf("%s: %s redirects to %q, want %q", tt.policy, tt.target, redirect, tt.redirect)
+		}
+		if ok {
+			continue
+		}
+		if got := matchName(t, r, req); got != tt.want {
+			t.Errorf("%s: %s matched %q, want %q", tt.policy, tt.target, got, tt.want)
+		}
+	}
+}
+
+// TestRewritePrecedence checks that a route's rewrite replaces its service's
+// as a whole, and that the default route uses the service's
+func TestRewritePrecedence(t *testing.T) {
+	web := service("web",
+		types.RouteConfig{Path: "/api/*"},
+		types.RouteConfig{Path: "/api/v2/*", Rewrite: &types.RewriteConfig{StripPrefix: "/api/v2", Prefix: "/next"}},
+		types.RouteConfig{Path: "/api/raw/*", Rewrite: &types.RewriteConfig{}},
+	)
+	web.Default = true
+	web.Rewrite = &types.RewriteConfig{Prefix: "/svc"}
+	orders := service("orders",
+		types.RouteConfig{Path: "/orders/*"},
+		types.RouteConfig{Path: "/o/*", Rewrite: &types.RewriteConfig{Regex: `^/o/(\d+)$`, Replacement: "/num/$1", StripPrefix: "/o"}},
+	)
+	orders.Rewrite = &types.RewriteConfig{Regex: `^/orders/(\d+)$`, Replacement: "/v1/orders?id=$1", StripPrefix: "/orders"}
+	r := buildRouter(t, web, orders)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/api/users", "/svc/api/users"},     // the service's
+		{"/api/v2/items", "/next/items"},     // the route's, without the service's prefix
+		{"/api/raw/x?q=1", "/api/raw/x?q=1"}, // an empty block turns rewriting off
+		{"/home", "/svc/home"},               // the default route
+		{"/orders/7", "/v1/orders?id=7"},     // the service's regex
+		{"/orders/list", "/list"},            // the service's prefix rules when it doesn't match
+		{"/o/5", "/num/5"},                   // the route's regex
+		{"/o/x", "/x"},                       // the route's prefix rules, never the service's
+		{"/o/orders/7", "/orders/7"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		route, _ := r.Match(req)
+		if route == nil {
+			t.Fatalf("no route for %s", tt.target)
+		}
+		RewriteURL(req, route.EffectiveRewrite())
+		if got := req.URL.RequestURI(); got != tt.want {
+			t.Errorf("%s (%s) rewrote %s to %s, want %s", route.Service.Name, route.Pattern, tt.target, got, tt.want)
+		}
+	}
+}
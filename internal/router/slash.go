@@ -0,0 +1,45 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// trimTrailingSlash removes trailing slashes from a path, keeping the root "/"
+func trimTrailingSlash(p string) string {
+	trimmed := strings.TrimRight(p, "/")
+	if trimmed == "" && p != "" {
+		return "/"
+	}
+	return trimmed
+}
+
+// RedirectTarget returns the canonical URL a request should be redirected to
+// under the redirect trailing-slash policy: the same path without trailing
+// slashes, keeping the query. ok is false when no redirect is needed.
+func (r *Router) RedirectTarget(req *http.Request) (target string, ok bool) {
+	r.mu.RLock()
+	policy := r.slashPolicy
+	r.mu.RUnlock()
+
+	if policy != types.TrailingSlashRedirect {
+		return "", false
+	}
+
+	escaped := req.URL.EscapedPath()
+	canonical := trimTrailingSlash(escaped)
+	if canonical == escaped {
+		return "", false
+	}
+
+	// A leading "//" would make the Location protocol-relative
+	if strings.HasPrefix(canonical, "//") {
+		canonical = "/" + strings.TrimLeft(canonical, "/")
+	}
+	if req.URL.RawQuery != "" {
+		canonical += "?" + req.URL.RawQuery
+	}
+	return canonical, true
+}
@@ -0,0 +1,135 @@
+package router
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// Path kinds, from most to least specific
+const (
+	pathExact    = iota // only literal segments
+	pathSegments        // :name parameters or single-segment * wildcards
+	pathRegex           // ~regex
+	pathCatchAll        // trailing * / ** / *rest, or prefix: true
+	pathAny             // no path condition
+)
+
+// pathScore describes how specific a path pattern is
+type pathScore struct {
+	literals int // literal segments (for regex: those in its anchored literal prefix)
+	kind     int
+}
+
+// sortRoutes orders routes for matching. With equal priority, routes compare by
+// structure rather than string length:
+//
+//  1. more literal path segments first
+//  2. path kind: exact, then parameters/single wildcards, regex, catch-alls, no path
+//  3. more non-path conditions (host, subdomain, header, query, gRPC, client, methods)
+//  4. a narrower method set
+//
+// Remaining ties keep definition order.
+func sortRoutes(routes []*types.Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.Config.Priority != b.Config.Priority {
+			return a.Config.Priority > b.Config.Priority
+		}
+		if c := comparePaths(scorePath(a.Pattern, a.Config.Prefix), scorePath(b.Pattern, b.Config.Prefix)); c != 0 {
+			return c > 0
+		}
+		if ca, cb := conditionCount(a.Config), conditionCount(b.Config); ca != cb {
+			return ca > cb
+		}
+		return methodSpecificity(a.Config.Methods) > methodSpecificity(b.Config.Methods)
+	})
+}
+
+// comparePaths returns 1 if a is more specific than b, -1 if less, 0 if equal
+func comparePaths(a, b pathScore) int {
+	switch {
+	case a.literals != b.literals:
+		if a.literals > b.literals {
+			return 1
+		}
+		return -1
+	case a.kind != b.kind:
+		if a.kind < b.kind {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// scorePath computes the structural score of a path pattern
+func scorePath(pattern string, prefix bool) pathScore {
+	if pattern == "" {
+		return pathScore{kind: pathAny}
+	}
+
+	if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+		score := pathScore{kind: pathRegex}
+		re, err := regexp.Compile(expr)
+		if err != nil || !strings.HasPrefix(expr, "^") {
+			return score
+		}
+		// Only segments closed by a "/" in the literal prefix are certain
+		lit, complete := re.LiteralPrefix()
+		segs := strings.Split(strings.TrimPrefix(lit, "/"), "/")
+		score.literals = len(segs) - 1
+		if complete && segs[len(segs)-1] != "" {
+			score.literals++
+		}
+		return score
+	}
+
+	score := pathScore{kind: pathExact}
+	parts := splitSegments(pattern)
+	for i, seg := range parts {
+		switch {
+		case seg == "**", strings.HasPrefix(seg, "*") && i == len(parts)-1:
+			score.kind = pathCatchAll
+		case strings.HasPrefix(seg, ":"), seg == "*":
+			if score.kind < pathSegments {
+				score.kind = pathSegments
+			}
+		default:
+			score.literals++
+		}
+	}
+	if prefix && score.kind < pathCatchAll {
+		score.kind = pathCatchAll
+	}
+	return score
+}
+
+// conditionCount counts the non-path conditions of a route
+func conditionCount(cfg types.RouteConfig) int {
+	n := 0
+	for _, set := range []bool{
+		cfg.Host != "",
+		cfg.Subdomain != "",
+		cfg.Header != "",
+		cfg.Query != "",
+		cfg.GRPCService != "",
+		len(cfg.ClientCIDR) > 0,
+		len(cfg.Methods) > 0,
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// methodSpecificity scores a method set: fewer methods is more specific, none is least
+func methodSpecificity(methods []string) int {
+	if len(methods) == 0 {
+		return 0
+	}
+	return len(validMethods) + 1 - len(methods)
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestSortRoutes builds overlapping routes in a scrambled order and checks
+// the exact order they are matched in
+func TestSortRoutes(t *testing.T) {
+	r := buildRouter(t,
+		service("catch", types.RouteConfig{Path: "/**"}),
+		service("host-only", types.RouteConfig{Host: "app.test"}),
+		service("api", types.RouteConfig{Path: "/api/*"}),
+		service("users-prefix", types.RouteConfig{Path: "/api/users", Prefix: true}),
+		service("users-re", types.RouteConfig{Path: `~^/api/users/[0-9]+$`}),
+		service("me", types.RouteConfig{Path: "/api/users/me"}),
+		service("re-any", types.RouteConfig{Path: "~/api"}),
+		service("users-write", types.RouteConfig{Path: "/api/users/*", Methods: []string{"POST", "PUT"}}),
+		service("users-all", types.RouteConfig{Path: "/api/users/*"}),
+		service("methods-only", types.RouteConfig{Methods: []string{"GET"}}),
+		service("user", types.RouteConfig{Path: "/api/users/:id"}),
+		service("api-host", types.RouteConfig{Path: "/api/*", Host: "api.test"}),
+		service("host-header", types.RouteConfig{Host: "app.test", Header: "X-Beta"}),
+		service("me-get", types.RouteConfig{Path: "/api/users/me", Methods: []string{"GET"}}),
+		service("users-post", types.RouteConfig{Path: "/api/users/*", Methods: []string{"POST"}}),
+		service("prio", types.RouteConfig{Path: "/*", Priority: 10}),
+	)
+
+	want := []string{
+		"prio",   // priority before anything else
+		"me-get", // three literal segments, then a condition
+		"me",
+		"user",         // two literal segments: a parameter,
+		"users-re",     // then a regex with the same literal prefix,
+		"users-post",   // then catch-alls, a single method first,
+		"users-write",  // then two,
+		"users-prefix", // then none, in definition order
+		"users-all",
+		"api-host", // one literal segment, host before none
+		"api",
+		"re-any",       // no literal segments: an unanchored regex,
+		"catch",        // a catch-all,
+		"host-header",  // then no path, two conditions first,
+		"methods-only", // then one, a method set before none
+		"host-only",
+	}
+	var got []string
+	for _, route := range r.Routes() {
+		got = append(got, route.Service.Name)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("routes sorted as\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package router
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// buildSplit compiles a weighted picker from a split route configuration
+func buildSplit(cfg types.RouteConfig, services map[string]*types.Service) (func(*http.Request) *types.Service, error) {
+	targets := make([]*types.Service, 0, len(cfg.Split))
+	weights := make([]int, 0, len(cfg.Split))
+	total := 0
+
+	for _, t := range cfg.Split {
+		svc, ok := services[t.Service]
+		if !ok {
+			return nil, fmt.Errorf("split references unknown service %q", t.Service)
+		}
+		if t.Weight < 0 {
+			return nil, fmt.Errorf("split weight for %q must not be negative", t.Service)
+		}
+		targets = append(targets, svc)
+		weights = append(weights, t.Weight)
+		total += t.Weight
+	}
+
+	if total <= 0 {
+		return nil, fmt.Errorf("split weights must sum to a positive number")
+	}
+
+	sticky := cfg.StickyHeader
+	return func(req *http.Request) *types.Service {
+		// Pin clients with the sticky header to a stable bucket
+		var n int
+		if v := req.Header.Get(sticky); sticky != "" && v != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(v))
+			n = int(h.Sum32() % uint32(total))
+		} else {
+			n = rand.Intn(total)
+		}
+
+		for i, w := range weights {
+			if n < w {
+				return targets[i]
+			}
+			n -= w
+		}
+		return targets[len(targets)-1]
+	}, nil
+}
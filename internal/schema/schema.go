@@ -0,0 +1,149 @@
+// Package schema generates a JSON Schema for hz config files from the
+// types.Config struct tree, for editor completion and validation
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// Draft is the JSON Schema dialect of the generated schema
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// DurationPattern matches the duration strings config files accept, like
+// 500ms, 30s or 1m30s
+const DurationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^0$`
+
+// EnvPattern matches values that are environment variable references, which
+// are allowed for every field since config files are expanded before parsing
+const EnvPattern = `\$`
+
+// byteSizePattern matches ByteSize strings like 64KB or 1MB
+const byteSizePattern = `^[0-9]+ *([KkMmGg]?[Bb])?$`
+
+var (
+	durationType = reflect.TypeOf(types.Duration(0))
+	byteSizeType = reflect.TypeOf(types.ByteSize(0))
+)
+
+// Schema is a JSON Schema document or subschema
+type Schema map[string]interface{}
+
+// Generate returns the schema of an hz config file. Struct types other than
+// the root are shared through $defs, which also handles recursive types like
+// RouteConfig.
+func Generate() Schema {
+	g := &generator{defs: make(map[string]Schema)}
+	root := g.object(reflect.TypeOf(types.Config{}))
+	root["$schema"] = Draft
+	root["title"] = "hz configuration"
+	root["$defs"] = g.defs
+	return root
+}
+
+// JSON returns the schema as indented JSON
+func JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(Generate(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type generator struct {
+	defs map[string]Schema
+}
+
+// schemaOf returns the schema for values of type t
+func (g *generator) schemaOf(t reflect.Type) Schema {
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		// null drops a block, such as a health block inherited from defaults
+		return Schema{"anyOf": []Schema{g.schemaOf(t.Elem()), {"type": "null"}}}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case durationType:
+		return Schema{"type": []string{"string", "integer"}, "pattern": DurationPattern + "|" + EnvPattern}
+	case byteSizeType:
+		return Schema{"type": []string{"integer", "string"}, "pattern": byteSizePattern + "|" + EnvPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = nil // reserve the name before recursing
+			g.defs[name] = g.object(t)
+		}
+		return Schema{"$ref": "#/$defs/" + name}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return Schema{"type": "object"}
+		}
+		return Schema{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Bool:
+		return Schema{"type": []string{"boolean", "string"}, "pattern": EnvPattern}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": []string{"integer", "string"}, "pattern": EnvPattern}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": []string{"number", "string"}, "pattern": EnvPattern}
+	case reflect.String:
+		return Schema{"type": []string{"string", "number"}} // YAML numbers decode into strings
+	}
+	return Schema{} // interface{}: anything
+}
+
+// object returns the schema of a struct: its yaml fields, x- annotations and
+// nothing else, matching how hz rejects unknown keys
+func (g *generator) object(t reflect.Type) Schema {
+	properties := make(map[string]Schema)
+	g.addFields(t, properties)
+	return Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"patternProperties":    map[string]Schema{"^x-": {}},
+		"additionalProperties": false,
+	}
+}
+
+// addFields adds the schema of each yaml field of t to properties
+func (g *generator) addFields(t reflect.Type, properties map[string]Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			g.addFields(f.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		s := g.schemaOf(f.Type)
+		if enum := f.Tag.Get("enum"); enum != "" {
+			s = Schema{"anyOf": []Schema{
+				{"enum": strings.Split(enum, ",")},
+				{"type": "string", "pattern": EnvPattern},
+			}}
+		}
+		if desc := f.Tag.Get("desc"); desc != "" {
+			s["description"] = desc // next to $ref too, as 2020-12 allows
+		}
+		properties[name] = s
+	}
+}
@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestGolden compares the generated schema with testdata/hz.schema.json, so
+// that config changes show up in review; go test -update rewrites it
+func TestGolden(t *testing.T) {
+	got, err := JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := JSON(); !bytes.Equal(got, again) {
+		t.Fatal("two runs generated different schemas")
+	}
+	if !json.Valid(got) {
+		t.Fatal("the schema isn't valid JSON")
+	}
+
+	golden := filepath.Join("testdata", "hz.schema.json")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the schema differs from %s; run go test ./internal/schema -update and review the diff", golden)
+	}
+}
@@ -0,0 +1,161 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// endpoint is one tunnel the Manager keeps open: the only one, or one of
+// tunnel.endpoints
+type endpoint struct {
+	domain   string
+	service  string       // every request goes to this service, if set
+	handler  http.Handler // serves the endpoint's requests
+	multiple bool         // one of tunnel.endpoints
+	listener net.Listener
+	status   types.TunnelStatus
+}
+
+// label names the endpoint in log messages, after "tunnel"
+func (e *endpoint) label() string {
+	switch {
+	case !e.multiple:
+		return ""
+	case e.domain != "":
+		return " " + e.domain
+	case e.service != "":
+		return " for " + e.service
+	default:
+		return " (random domain)"
+	}
+}
+
+// supervise serves an endpoint and, when its listener fails, opens a new
+// one with exponential backoff until ctx is canceled by Stop
+func (m *Manager) supervise(ctx context.Context, p provider, e *endpoint, listener net.Listener) {
+	for {
+		err := m.serve(e, listener)
+		if ctx.Err() != nil || errors.Is(err, errNoHandler) {
+			return // stopped
+		}
+		if err == nil {
+			err = errors.New("listener closed")
+		}
+		listener.Close() // lets the provider drop a broken session
+		m.logger.Printf("[tunnel] %s tunnel%s lost: %v", m.Provider(), e.label(), err)
+		m.update(e, func(s *types.TunnelStatus) {
+			s.State, s.Active, s.Error, s.Attempts = types.TunnelStateReconnecting, false, err.Error(), 0
+		})
+
+		if listener = m.reconnect(ctx, p, e); listener == nil {
+			return // stopped while reconnecting
+		}
+	}
+}
+
+// Tunnel reconnection: the delay doubles from reconnectMin up to
+// reconnectMax, and each wait is jittered down by up to half
+const (
+	reconnectMin = time.Second
+	reconnectMax = time.Minute
+)
+
+// reconnect opens an endpoint's tunnel again, retrying with backoff. It
+// returns nil when ctx is canceled first, or when ngrok stopped the session.
+func (m *Manager) reconnect(ctx context.Context, p provider, e *endpoint) net.Listener {
+	backoff := reconnectMin
+	for attempt := 1; ; attempt++ {
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		m.update(e, func(s *types.TunnelStatus) {
+			s.Attempts, s.NextAttempt = attempt, time.Now().Add(wait)
+		})
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil
+		}
+
+		m.logger.Printf("[tunnel] reconnecting %s tunnel%s (attempt %d)", m.Provider(), e.label(), attempt)
+		listener, publicURL, err := p.listen(ctx, m.endpointConfig(e), m.logger, func(url string, err error) { m.report(e, url, err) })
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, errStoppedRemotely) {
+				m.logger.Printf("[tunnel] %v; not reconnecting", err)
+				m.update(e, func(s *types.TunnelStatus) {
+					*s = types.TunnelStatus{State: types.TunnelStateFailed, Error: err.Error()}
+				})
+				return nil
+			}
+			backoff = min(backoff*2, reconnectMax)
+			m.logger.Printf("[tunnel] attempt %d failed: %v", attempt, err)
+			m.update(e, func(s *types.TunnelStatus) { s.Error = err.Error() })
+			continue
+		}
+
+		m.mu.Lock()
+		if ctx.Err() != nil {
+			m.mu.Unlock()
+			listener.Close()
+			return nil
+		}
+		e.listener = listener
+		m.mu.Unlock()
+
+		m.logReconnected(e, publicURL)
+		m.update(e, func(s *types.TunnelStatus) { *s = activeStatus(publicURL) })
+		return listener
+	}
+}
+
+// errNoHandler ends serving when Start was given no handler
+var errNoHandler = errors.New("no handler")
+
+// serve handles an endpoint's connections until the listener fails or is
+// closed
+func (m *Manager) serve(e *endpoint, listener net.Listener) error {
+	m.mu.RLock()
+	next, policy, timeouts, direct := e.handler, m.policy, m.server, m.direct
+	redirect := m.config.ForceHTTPSRedirect && m.Provider() == ProviderNgrok && len(orderSchemes(m.config.Schemes)) == 2
+	m.mu.RUnlock()
+	if next == nil {
+		m.logger.Println("[tunnel] no handler configured, tunnel inactive")
+		return errNoHandler
+	}
+
+	if redirect {
+		next = redirectHTTPS(next)
+	}
+	if policy != nil {
+		next = policy.handler(next)
+	}
+
+	server := &http.Server{
+		Handler:     m.traffic.handler(next),
+		ConnContext: schemeContext(func() string { return m.publicScheme(e) }, direct),
+	}
+	timeouts.ApplyTimeouts(server)
+
+	err := server.Serve(m.traffic.listener(listener))
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// publicScheme returns the scheme of an endpoint's public URL
+func (m *Manager) publicScheme(e *endpoint) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if e.status.URL == nil {
+		return ""
+	}
+	return e.status.URL.Scheme
+}
@@ -0,0 +1,66 @@
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// TestServeStreamsPastThirtySeconds checks that a streaming response through
+// the tunnel isn't cut off by a write timeout, as the old fixed 30s one did
+func TestServeStreamsPastThirtySeconds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams for over 30s")
+	}
+	const (
+		streamFor = 32 * time.Second
+		every     = time.Second
+	)
+
+	m := New(&types.TunnelConfig{})
+	e := &endpoint{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for i := 0; i < int(streamFor/every); i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			flusher.Flush()
+			time.Sleep(every)
+		}
+		fmt.Fprint(w, "data: done\n\n")
+	})}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() { _ = m.serve(e, listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	start := time.Now()
+	last := ""
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			last = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("stream broke after %s: %v", time.Since(start).Round(time.Second), err)
+	}
+	if last != "data: done" {
+		t.Fatalf("stream ended after %s at %q", time.Since(start).Round(time.Second), last)
+	}
+}
@@ -0,0 +1,58 @@
+package tunnel
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/zymawy/hz/internal/clientip"
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// ipPolicy is a parsed tunnel.ipPolicy
+type ipPolicy struct {
+	allow, deny []netip.Prefix
+}
+
+// parseIPPolicy parses the CIDRs of a tunnel.ipPolicy
+func parseIPPolicy(p *types.TunnelIPPolicy) (*ipPolicy, error) {
+	allow, err := clientip.ParsePrefixes(p.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := clientip.ParsePrefixes(p.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &ipPolicy{allow: allow, deny: deny}, nil
+}
+
+// allows reports whether addr may use the tunnel: denied addresses never
+// may, and with allow entries only the addresses in them may
+func (p *ipPolicy) allows(addr netip.Addr) bool {
+	if clientip.Contains(p.deny, addr) {
+		return false
+	}
+	return len(p.allow) == 0 || clientip.Contains(p.allow, addr)
+}
+
+// handler refuses tunnel requests the policy doesn't allow. Requests the
+// tunnel server forwarded no client address for are refused too, since
+// their origin can't be checked.
+func (p *ipPolicy) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := clientip.Forwarded(r); !ok || !p.allows(addr) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// prefixStrings formats prefixes as CIDRs, bare IPs included
+func prefixStrings(prefixes []netip.Prefix) []string {
+	out := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = p.String()
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+	ngrokconfig "golang.ngrok.com/ngrok/config"
+)
+
+// TestIPPolicyOptions checks the CIDR restrictions tunnel.ipPolicy gives
+// ngrok endpoints
+func TestIPPolicyOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *types.TunnelIPPolicy
+		want   string // the endpoint's IPRestriction as JSON
+		err    string
+	}{
+		{name: "none", want: "null"},
+		{
+			name: "allow and deny",
+			policy: &types.TunnelIPPolicy{
+				Allow: []string{"203.0.113.0/24", " 10.1.2.3/8 ", "2001:db8::/32"},
+				Deny:  []string{"203.0.113.9"},
+			},
+			want: `{"allow_cidrs":["203.0.113.0/24","10.0.0.0/8","2001:db8::/32"],"deny_cidrs":["203.0.113.9/32"]}`,
+		},
+		{
+			name:   "mapped IPv4 and bare IPv6",
+			policy: &types.TunnelIPPolicy{Allow: []string{"::ffff:192.0.2.0/120", "2001:db8::1"}},
+			want:   `{"allow_cidrs":["192.0.2.0/24","2001:db8::1/128"]}`,
+		},
+		{
+			name:   "deny only",
+			policy: &types.TunnelIPPolicy{Deny: []string{"198.51.100.0/24"}},
+			want:   `{"deny_cidrs":["198.51.100.0/24"]}`,
+		},
+		{name: "empty", policy: &types.TunnelIPPolicy{}, want: "null"},
+		{
+			name:   "invalid",
+			policy: &types.TunnelIPPolicy{Allow: []string{"203.0.113.0/24"}, Deny: []string{"office"}},
+			err:    `tunnel.ipPolicy: invalid CIDR "office"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := ipPolicyOptions(tt.policy)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			endpoint := ngrokconfig.HTTPEndpoint(opts...).(interface{ Opts() any }).Opts()
+			data, err := json.Marshal(endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields struct{ IPRestriction json.RawMessage }
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(fields.IPRestriction); got != tt.want {
+				t.Errorf("IPRestriction %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIPPolicyFallback opens a localtunnel tunnel, which has no edge IP
+// policy: hz checks the client address the server forwards instead
+func TestIPPolicyFallback(t *testing.T) {
+	s := startLTServer(t)
+	var logs bytes.Buffer
+	m := New(&types.TunnelConfig{
+		Enabled:  true,
+		Provider: ProviderLocaltunnel,
+		Server:   s.api.URL,
+		IPPolicy: &types.TunnelIPPolicy{Allow: []string{"203.0.113.0/24", "2001:db8::/32"}, Deny: []string{"203.0.113.9"}},
+	})
+	m.SetLogger(log.New(&logs, "", 0))
+	err := m.Start(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hz")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+	if !strings.Contains(logs.String(), "localtunnel has no edge IP policy; hz enforces tunnel.ipPolicy on tunnel requests instead") {
+		t.Errorf("the enforcement point wasn't logged:\n%s", logs.String())
+	}
+
+	tests := []struct {
+		forwardedFor string
+		code         int
+	}{
+		{"203.0.113.5", http.StatusOK},
+		{"2001:db8::7", http.StatusOK},
+		{"::ffff:203.0.113.5", http.StatusOK},
+		{"198.51.100.1, 203.0.113.5", http.StatusOK}, // the server's entry is the last one
+		{"203.0.113.5, 198.51.100.1", http.StatusForbidden},
+		{"203.0.113.9", http.StatusForbidden},
+		{"198.51.100.1", http.StatusForbidden},
+		{"", http.StatusForbidden}, // no address to check
+		{"unknown", http.StatusForbidden},
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, m.GetPublicURL()+"/", nil)
+		if tt.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("X-Forwarded-For %q: %d, want %d", tt.forwardedFor, resp.StatusCode, tt.code)
+		}
+	}
+
+	t.Run("invalid CIDR", func(t *testing.T) {
+		m := New(&types.TunnelConfig{
+			Enabled:  true,
+			Provider: ProviderLocaltunnel,
+			Server:   s.api.URL,
+			IPPolicy: &types.TunnelIPPolicy{Allow: []string{"300.0.0.0/8"}},
+		})
+		m.SetLogger(log.New(io.Discard, "", 0))
+		defer m.Stop()
+		if err := m.Start(http.NotFoundHandler()); err == nil || !strings.Contains(err.Error(), `tunnel.ipPolicy: invalid CIDR "300.0.0.0/8"`) {
+			t.Fatalf("Start = %v, want an invalid CIDR error", err)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package tunnel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The OS keyring entry holding the ngrok auth token
+const (
+	keyringService = "hz"
+	keyringAccount = "ngrok-authtoken"
+)
+
+// ErrNoKeyringToken means the keyring has no auth token saved
+var ErrNoKeyringToken = errors.New("no auth token saved in the keyring")
+
+// KeyringToken reads the auth token saved with SaveKeyringToken
+func KeyringToken() (string, error) {
+	name, args, err := keyringLookup()
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", ErrNoKeyringToken
+		}
+		return "", fmt.Errorf("failed to read the keyring: %w", err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", ErrNoKeyringToken
+	}
+	return token, nil
+}
+
+// SaveKeyringToken saves the auth token in the OS keyring: the login
+// keychain on macOS, the Secret Service (through secret-tool) on Linux
+func SaveKeyringToken(token string) error {
+	name, args, stdin, err := keyringStore(token)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("failed to save the token in the keyring: %s", msg)
+		}
+		return fmt.Errorf("failed to save the token in the keyring: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package tunnel
+
+// keyringLookup returns the command printing the saved token
+func keyringLookup() (string, []string, error) {
+	return "security", []string{"find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w"}, nil
+}
+
+// keyringStore returns the command saving token, and its standard input.
+// security only takes the password as an argument.
+func keyringStore(token string) (string, []string, string, error) {
+	return "security", []string{"add-generic-password", "-U", "-s", keyringService, "-a", keyringAccount, "-l", "hz ngrok auth token", "-w", token}, "", nil
+}
@@ -0,0 +1,30 @@
+package tunnel
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// keyringLookup returns the command printing the saved token
+func keyringLookup() (string, []string, error) {
+	if err := needSecretTool(); err != nil {
+		return "", nil, err
+	}
+	return "secret-tool", []string{"lookup", "service", keyringService, "account", keyringAccount}, nil
+}
+
+// keyringStore returns the command saving token, and its standard input
+func keyringStore(token string) (string, []string, string, error) {
+	if err := needSecretTool(); err != nil {
+		return "", nil, "", err
+	}
+	return "secret-tool", []string{"store", "--label=hz ngrok auth token", "service", keyringService, "account", keyringAccount}, token, nil
+}
+
+// needSecretTool checks that libsecret's secret-tool is installed
+func needSecretTool() error {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return fmt.Errorf("the keyring needs secret-tool (package libsecret-tools or libsecret)")
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !linux
+
+package tunnel
+
+import "fmt"
+
+// keyringLookup returns the command printing the saved token
+func keyringLookup() (string, []string, error) {
+	return "", nil, fmt.Errorf("the keyring is not supported on this platform; use tunnel.authtokenFile")
+}
+
+// keyringStore returns the command saving token, and its standard input
+func keyringStore(token string) (string, []string, string, error) {
+	return "", nil, "", fmt.Errorf("the keyring is not supported on this platform; use tunnel.authtokenFile")
+}
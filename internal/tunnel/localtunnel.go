@@ -0,0 +1,300 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// DefaultLocaltunnelServer is the public localtunnel server, used when
+// tunnel.server is not set
+const DefaultLocaltunnelServer = "https://localtunnel.me"
+
+// localtunnel reconnection: each connection slot retries with a delay
+// doubling up to ltMaxBackoff, and after ltRenewAfter failures in a row the
+// tunnel is registered again, asking for the same subdomain
+const (
+	ltMinBackoff = time.Second
+	ltMaxBackoff = 30 * time.Second
+	ltRenewAfter = 3
+)
+
+// localtunnelProvider speaks the localtunnel protocol: the server assigns a
+// random subdomain and a TCP port, and the client keeps a pool of
+// connections to that port over which the server sends the public requests.
+// No account or token is needed.
+type localtunnelProvider struct{}
+
+// ltAssignment is the server's answer to a tunnel request
+type ltAssignment struct {
+	ID           string `json:"id"`
+	Port         int    `json:"port"`
+	MaxConnCount int    `json:"max_conn_count"`
+	URL          string `json:"url"`
+	Message      string `json:"message"` // set on errors
+}
+
+// edgeIPPolicy is false: localtunnel servers forward every client
+func (localtunnelProvider) edgeIPPolicy() bool { return false }
+
+// forwardsClients is true: localtunnel servers set X-Forwarded-For
+func (localtunnelProvider) forwardsClients() bool { return true }
+
+// listen registers a tunnel and opens its connection pool
+func (localtunnelProvider) listen(ctx context.Context, cfg *types.TunnelConfig, logger *log.Logger, report func(string, error)) (net.Listener, string, error) {
+	server := cfg.Server
+	if server == "" {
+		server = DefaultLocaltunnelServer
+	}
+	base, err := url.Parse(server)
+	if err != nil || base.Host == "" {
+		return nil, "", fmt.Errorf("invalid localtunnel server %q", server)
+	}
+
+	l := &ltListener{
+		ctx:    ctx,
+		server: base,
+		client: &http.Client{Timeout: 15 * time.Second},
+		logger: logger,
+		report: report,
+		done:   make(chan struct{}),
+	}
+	a, err := l.register("?new")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create localtunnel tunnel: %w", err)
+	}
+	l.assign(a)
+
+	l.conns = make(chan net.Conn, a.MaxConnCount)
+	for i := 0; i < a.MaxConnCount; i++ {
+		go l.keepConnected()
+	}
+	return l, a.URL, nil
+}
+
+// ltListener is a localtunnel tunnel as a net.Listener. Accept returns the
+// pooled connections to the server; a slot opens a new one when its
+// connection is closed.
+type ltListener struct {
+	ctx    context.Context
+	server *url.URL
+	client *http.Client
+	logger *log.Logger
+	report func(string, error)
+	conns  chan net.Conn
+
+	mu       sync.Mutex
+	id       string
+	url      string
+	remote   string // host:port to connect the pool to
+	gen      int    // incremented by every registration
+	failing  bool   // a failure was reported and no connection made since
+	renewing bool   // a slot is registering the tunnel again
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// register asks the server for a tunnel: "?new" for a random subdomain or
+// the id of the previous one to get it back
+func (l *ltListener) register(path string) (*ltAssignment, error) {
+	req, err := http.NewRequestWithContext(l.ctx, http.MethodGet, l.server.JoinPath("/").String()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var a ltAssignment
+	if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return nil, fmt.Errorf("unexpected answer from %s (%s)", l.server.Host, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || a.Port == 0 {
+		if a.Message == "" {
+			a.Message = resp.Status
+		}
+		return nil, fmt.Errorf("%s: %s", l.server.Host, a.Message)
+	}
+	if a.MaxConnCount <= 0 {
+		a.MaxConnCount = 1
+	}
+	return &a, nil
+}
+
+// assign switches the pool to a registered tunnel
+func (l *ltListener) assign(a *ltAssignment) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.id, l.url = a.ID, a.URL
+	l.remote = net.JoinHostPort(l.server.Hostname(), strconv.Itoa(a.Port))
+	l.gen++
+}
+
+// keepConnected keeps one pool slot connected until the listener closes
+func (l *ltListener) keepConnected() {
+	backoff := ltMinBackoff
+	failures := 0
+	for {
+		l.mu.Lock()
+		remote, gen := l.remote, l.gen
+		l.mu.Unlock()
+
+		var d net.Dialer
+		conn, err := d.DialContext(l.ctx, "tcp", remote)
+		if err != nil {
+			if l.isClosed() {
+				return
+			}
+			failures++
+			l.failed(err)
+			if failures >= ltRenewAfter {
+				l.renew(gen)
+				failures = 0
+			}
+			select {
+			case <-time.After(backoff):
+			case <-l.done:
+				return
+			}
+			backoff = min(backoff*2, ltMaxBackoff)
+			continue
+		}
+		failures, backoff = 0, ltMinBackoff
+		l.connected()
+
+		closed := make(chan struct{})
+		c := &ltConn{Conn: conn, closed: closed}
+		select {
+		case l.conns <- c:
+		case <-l.done:
+			conn.Close()
+			return
+		}
+		// The server closes connections it is done with; open the next one
+		select {
+		case <-closed:
+		case <-l.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// failed reports the first failure after the tunnel worked
+func (l *ltListener) failed(err error) {
+	l.mu.Lock()
+	report := !l.failing
+	l.failing = true
+	l.mu.Unlock()
+	if report {
+		l.report("", err)
+	}
+}
+
+// connected reports the tunnel working again after a failure
+func (l *ltListener) connected() {
+	l.mu.Lock()
+	report := l.failing
+	l.failing = false
+	publicURL := l.url
+	l.mu.Unlock()
+	if report {
+		l.report(publicURL, nil)
+	}
+}
+
+// renew registers the tunnel again, once for all slots that saw generation
+// gen fail; the server may have restarted and forgotten it
+func (l *ltListener) renew(gen int) {
+	l.mu.Lock()
+	if gen != l.gen || l.renewing {
+		l.mu.Unlock()
+		return // another slot renews it
+	}
+	l.renewing = true
+	id := l.id
+	l.mu.Unlock()
+
+	a, err := l.register(url.PathEscape(id))
+	l.mu.Lock()
+	l.renewing = false
+	l.mu.Unlock()
+	if err != nil {
+		l.logger.Printf("[tunnel] localtunnel registration failed: %v", err)
+		return
+	}
+	l.assign(a)
+}
+
+// Accept waits for the next pooled connection
+func (l *ltListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the pool; the server drops the tunnel once no connection is
+// left
+func (l *ltListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	for {
+		select {
+		case c := <-l.conns:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// isClosed reports whether Close was called
+func (l *ltListener) isClosed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Addr returns the public URL as the listener address
+func (l *ltListener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return ltAddr(l.url)
+}
+
+// ltAddr is a public tunnel URL as a net.Addr
+type ltAddr string
+
+func (a ltAddr) Network() string { return "localtunnel" }
+func (a ltAddr) String() string  { return string(a) }
+
+// ltConn signals its slot when it is closed
+type ltConn struct {
+	net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Close closes the connection and frees its slot
+func (c *ltConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() { close(c.closed) })
+	return err
+}
@@ -0,0 +1,220 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// ltTestServer is an in-process localtunnel server. Its API assigns the
+// "stub" tunnel; each connection to its public listener is relayed over
+// one the client pooled.
+type ltTestServer struct {
+	api    *httptest.Server
+	public net.Listener
+	url    string // public URL of the tunnel
+
+	mu         sync.Mutex
+	pool       net.Listener // where clients connect their pool
+	registered []string     // request URIs of the registrations
+}
+
+// startLTServer runs a localtunnel server on local ports
+func startLTServer(t *testing.T) *ltTestServer {
+	t.Helper()
+	s := &ltTestServer{}
+	var err error
+	if s.public, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.public.Close() })
+	s.url = "http://" + s.public.Addr().String()
+	s.restart(t)
+	t.Cleanup(func() { s.listener().Close() })
+
+	s.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.registered = append(s.registered, r.URL.RequestURI())
+		port := s.pool.Addr().(*net.TCPAddr).Port
+		s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(ltAssignment{ID: "stub", Port: port, MaxConnCount: 2, URL: s.url})
+	}))
+	t.Cleanup(s.api.Close)
+
+	go func() {
+		for {
+			client, err := s.public.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				pooled, err := s.listener().Accept()
+				if err != nil {
+					client.Close()
+					return
+				}
+				go func() {
+					_, _ = io.Copy(pooled, client)
+					pooled.Close()
+				}()
+				_, _ = io.Copy(client, pooled)
+				client.Close()
+			}()
+		}
+	}()
+	return s
+}
+
+// restart moves the pool to a new port, like a server restarted without
+// its tunnels: the pooled connections are dropped and the old port refuses
+// new ones
+func (s *ltTestServer) restart(t *testing.T) {
+	t.Helper()
+	pool, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	old := s.pool
+	s.pool = pool
+	s.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+func (s *ltTestServer) listener() net.Listener {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pool
+}
+
+func (s *ltTestServer) registrations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.registered)
+}
+
+// ltGet requests path through the tunnel on a new connection
+func ltGet(t *testing.T, publicURL, path string) string {
+	t.Helper()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+	resp, err := client.Get(publicURL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// TestLocaltunnel serves HTTP through an in-process localtunnel server,
+// then restarts it: the tunnel is reported lost, registered again under
+// the same id and reported back
+func TestLocaltunnel(t *testing.T) {
+	s := startLTServer(t)
+	reports := make(chan string, 10)
+	report := func(url string, err error) {
+		if err != nil {
+			url = "lost"
+		}
+		reports <- url
+	}
+
+	cfg := &types.TunnelConfig{Provider: ProviderLocaltunnel, Server: s.api.URL}
+	l, publicURL, err := localtunnelProvider{}.listen(context.Background(), cfg, log.New(io.Discard, "", 0), report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hz saw %s", r.URL.Path)
+	}))
+
+	if publicURL != s.url || l.Addr().String() != publicURL {
+		t.Fatalf("public URL %q, listener address %q, want %q", publicURL, l.Addr(), s.url)
+	}
+	// More requests than pooled connections: slots open new ones
+	for _, path := range []string{"/", "/api/users", "/a", "/b"} {
+		if body, want := ltGet(t, publicURL, path), "hz saw "+path; body != want {
+			t.Errorf("got %q, want %q", body, want)
+		}
+	}
+
+	t.Run("server restart", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("waits for the reconnect backoff")
+		}
+		s.restart(t)
+		for _, want := range []string{"lost", s.url} {
+			select {
+			case got := <-reports:
+				if got != want {
+					t.Fatalf("reported %q, want %q", got, want)
+				}
+			case <-time.After(15 * time.Second):
+				t.Fatalf("no report, want %q", want)
+			}
+		}
+		if got, want := s.registrations(), []string{"/?new", "/stub"}; !slices.Equal(got, want) {
+			t.Errorf("registrations %q, want %q", got, want)
+		}
+		if body := ltGet(t, publicURL, "/again"); body != "hz saw /again" {
+			t.Errorf("after the restart got %q", body)
+		}
+	})
+
+	if err := l.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept after Close = %v, want net.ErrClosed", err)
+	}
+}
+
+// TestLocaltunnelRefused checks the errors of registrations the server
+// refuses or doesn't understand
+func TestLocaltunnelRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{"message", http.StatusConflict, `{"message":"subdomain in use"}`, ": subdomain in use"},
+		{"status only", http.StatusServiceUnavailable, `{}`, ": 503 Service Unavailable"},
+		{"no port", http.StatusOK, `{"id":"stub"}`, ": 200 OK"},
+		{"not JSON", http.StatusBadGateway, "<html>", "unexpected answer from"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer api.Close()
+
+			cfg := &types.TunnelConfig{Provider: ProviderLocaltunnel, Server: api.URL}
+			_, _, err := localtunnelProvider{}.listen(context.Background(), cfg, log.New(io.Discard, "", 0), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
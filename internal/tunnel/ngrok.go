@@ -0,0 +1,190 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zymawy/hz/pkg/types"
+	"golang.ngrok.com/ngrok"
+	ngrokconfig "golang.ngrok.com/ngrok/config"
+)
+
+// ngrokProvider opens tunnels with the ngrok agent SDK, which reconnects by
+// itself. All endpoints share one agent session, since free accounts only
+// get one.
+type ngrokProvider struct {
+	mu      sync.Mutex
+	sess    ngrok.Session
+	refs    int         // open listeners on sess
+	stopped atomic.Bool // by the ngrok dashboard or API
+}
+
+// errStoppedRemotely ends reconnecting once ngrok stopped the session,
+// usually for another agent to take it over
+var errStoppedRemotely = errors.New("the ngrok session was stopped from the ngrok dashboard or API")
+
+// edgeIPPolicy is true: ngrok restricts client CIDRs itself
+func (*ngrokProvider) edgeIPPolicy() bool { return true }
+
+// forwardsClients is true: ngrok's edge sets X-Forwarded-For
+func (*ngrokProvider) forwardsClients() bool { return true }
+
+// session returns the agent session, connecting it on first use
+func (p *ngrokProvider) session(ctx context.Context, cfg *types.TunnelConfig, logger *log.Logger) (ngrok.Session, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Find the auth token: config, token file, keyring, then ngrok's config
+	authToken, source, err := ResolveAuthToken(cfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w\n\nRun 'ngrok config add-authtoken <token>' or 'hz tunnel --token <token>'", err)
+	}
+	if p.stopped.Load() {
+		return nil, "", errStoppedRemotely
+	}
+	if p.sess != nil {
+		return p.sess, source, nil
+	}
+	logger.Printf("[tunnel] Using auth token %s from %s", MaskToken(authToken), source)
+
+	sess, err := ngrok.Connect(ctx,
+		ngrok.WithAuthtoken(authToken),
+		ngrok.WithMetadata(newSessionMetadata()),
+		ngrok.WithStopHandler(func(context.Context, ngrok.Session) error {
+			p.stopped.Store(true) // ngrok closes the session after this
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to ngrok: %w", err)
+	}
+	p.sess = sess
+	return sess, source, nil
+}
+
+// release notes a listener closed, or failing to open when opened is
+// false, and ends the session once nothing uses it: a session without
+// listeners may be broken, so the next listen connects a new one
+func (p *ngrokProvider) release(opened bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if opened {
+		p.refs--
+	}
+	if p.refs == 0 && p.sess != nil {
+		p.sess.Close()
+		p.sess = nil
+	}
+}
+
+// listen creates an ngrok HTTP endpoint on the shared session
+func (p *ngrokProvider) listen(ctx context.Context, cfg *types.TunnelConfig, logger *log.Logger, report func(string, error)) (net.Listener, string, error) {
+	sess, source, err := p.session(ctx, cfg, logger)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Use the system domain if not set in hz config; it can serve only one
+	// endpoint
+	domain := cfg.Domain
+	if domain == "" && len(cfg.Endpoints) == 0 && source == TokenSourceNgrok {
+		if _, sysDomain, err := LoadSystemNgrokConfig(); err == nil && sysDomain != "" {
+			domain = sysDomain
+			logger.Printf("[tunnel] Using system domain: %s", domain)
+		}
+	}
+
+	// Build ngrok options
+	opts := []ngrokconfig.HTTPEndpointOption{}
+
+	// Add custom domain if configured
+	if domain != "" {
+		opts = append(opts, ngrokconfig.WithDomain(domain))
+	}
+
+	if cfg.Compression {
+		opts = append(opts, ngrokconfig.WithCompression())
+	}
+	if cfg.CircuitBreaker > 0 {
+		opts = append(opts, ngrokconfig.WithCircuitBreaker(cfg.CircuitBreaker))
+	}
+
+	// Require a login at ngrok's edge; validation checked the entries
+	for _, login := range cfg.BasicAuth {
+		user, password, _ := strings.Cut(login, ":")
+		opts = append(opts, ngrokconfig.WithBasicAuth(user, password))
+	}
+	if len(cfg.BasicAuth) > 0 {
+		logger.Printf("[tunnel] Basic auth enabled for %d user(s)", len(cfg.BasicAuth))
+	}
+
+	// Refuse clients outside tunnel.ipPolicy at ngrok's edge
+	policyOpts, err := ipPolicyOptions(cfg.IPPolicy)
+	if err != nil {
+		return nil, "", err
+	}
+	opts = append(opts, policyOpts...)
+
+	// Create a listener per scheme, https first for the public URL
+	var listeners []net.Listener
+	for _, scheme := range orderSchemes(cfg.Schemes) {
+		tun, err := sess.Listen(ctx, ngrokconfig.HTTPEndpoint(append(opts, ngrokconfig.WithScheme(ngrokconfig.Scheme(scheme)))...))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			p.release(false)
+			return nil, "", fmt.Errorf("failed to create ngrok %s tunnel: %w", scheme, err)
+		}
+		p.mu.Lock()
+		p.refs++
+		p.mu.Unlock()
+		listeners = append(listeners, &ngrokListener{Tunnel: tun, provider: p})
+	}
+	if len(listeners) == 1 {
+		return listeners[0], listenerURL(listeners[0]), nil
+	}
+	logger.Printf("[tunnel] Also serving %s", listenerURL(listeners[1]))
+	merged := mergeListeners(listeners)
+	return merged, listenerURL(merged), nil
+}
+
+// ipPolicyOptions translates tunnel.ipPolicy into ngrok's CIDR
+// restrictions
+func ipPolicyOptions(p *types.TunnelIPPolicy) ([]ngrokconfig.HTTPEndpointOption, error) {
+	if p == nil {
+		return nil, nil
+	}
+	policy, err := parseIPPolicy(p)
+	if err != nil {
+		return nil, fmt.Errorf("tunnel.ipPolicy: %w", err)
+	}
+	var opts []ngrokconfig.HTTPEndpointOption
+	if len(policy.allow) > 0 {
+		opts = append(opts, ngrokconfig.WithAllowCIDRString(prefixStrings(policy.allow)...))
+	}
+	if len(policy.deny) > 0 {
+		opts = append(opts, ngrokconfig.WithDenyCIDRString(prefixStrings(policy.deny)...))
+	}
+	return opts, nil
+}
+
+// ngrokListener releases its session when closed
+type ngrokListener struct {
+	ngrok.Tunnel
+	provider  *ngrokProvider
+	closeOnce sync.Once
+}
+
+// Close closes the tunnel and releases the session
+func (l *ngrokListener) Close() error {
+	err := l.Tunnel.Close()
+	l.closeOnce.Do(func() { l.provider.release(true) })
+	return err
+}
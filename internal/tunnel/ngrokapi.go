@@ -0,0 +1,158 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+	"golang.ngrok.com/ngrok"
+)
+
+// NgrokAPIURL is the ngrok REST API
+const NgrokAPIURL = "https://api.ngrok.com"
+
+// errSessionLimit is the ngrok error for an account out of agent sessions
+const errSessionLimit = "ERR_NGROK_108"
+
+// IsSessionLimit reports whether err is ngrok refusing a session because the
+// account already has as many as its plan allows, typically a forgotten
+// agent on a free account
+func IsSessionLimit(err error) bool {
+	var nerr ngrok.Error
+	return errors.As(err, &nerr) && nerr.ErrorCode() == errSessionLimit
+}
+
+// ResolveAPIKey returns the ngrok API key: tunnel.apiKey, else
+// $NGROK_API_KEY. The auth token can't be used for the API.
+func ResolveAPIKey(cfg *types.TunnelConfig) string {
+	if cfg.APIKey != "" {
+		return cfg.APIKey
+	}
+	return os.Getenv("NGROK_API_KEY")
+}
+
+// NgrokSession is an agent session open on the ngrok account
+type NgrokSession struct {
+	ID           string    `json:"id"`
+	IP           string    `json:"ip"`
+	OS           string    `json:"os"`
+	Region       string    `json:"region"`
+	AgentVersion string    `json:"agent_version"`
+	Metadata     string    `json:"metadata"`
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// sessionMetadata is what hz sets as its sessions' metadata, so they can be
+// told apart from other agents'
+type sessionMetadata struct {
+	Agent    string `json:"agent"`
+	Hostname string `json:"hostname,omitempty"`
+	PID      int    `json:"pid"`
+}
+
+// newSessionMetadata describes this hz process
+func newSessionMetadata() string {
+	host, _ := os.Hostname()
+	data, _ := json.Marshal(sessionMetadata{Agent: "hz", Hostname: host, PID: os.Getpid()})
+	return string(data)
+}
+
+// Hostname returns the host of an hz session, or "" for other agents
+func (s NgrokSession) Hostname() string {
+	var meta sessionMetadata
+	if json.Unmarshal([]byte(s.Metadata), &meta) != nil || meta.Agent != "hz" {
+		return ""
+	}
+	return meta.Hostname
+}
+
+// NgrokAPI is a client for the session endpoints of the ngrok REST API
+type NgrokAPI struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+// NewNgrokAPI creates a client for the ngrok API with the API key
+func NewNgrokAPI(apiKey string) *NgrokAPI {
+	return &NgrokAPI{
+		BaseURL: NgrokAPIURL,
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Sessions lists the agent sessions open on the account, oldest first
+func (a *NgrokAPI) Sessions(ctx context.Context) ([]NgrokSession, error) {
+	var sessions []NgrokSession
+	next := a.BaseURL + "/tunnel_sessions"
+	for next != "" {
+		var page struct {
+			Sessions []NgrokSession `json:"tunnel_sessions"`
+			Next     string         `json:"next_page_uri"`
+		}
+		if err := a.do(ctx, http.MethodGet, next, &page); err != nil {
+			return nil, fmt.Errorf("failed to list ngrok sessions: %w", err)
+		}
+		sessions = append(sessions, page.Sessions...)
+		next = page.Next
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].StartedAt.Before(sessions[j].StartedAt) })
+	return sessions, nil
+}
+
+// StopSession asks the agent of a session to stop, freeing it
+func (a *NgrokAPI) StopSession(ctx context.Context, id string) error {
+	if err := a.do(ctx, http.MethodPost, a.BaseURL+"/tunnel_sessions/"+url.PathEscape(id)+"/stop", nil); err != nil {
+		return fmt.Errorf("failed to stop ngrok session %s: %w", id, err)
+	}
+	return nil
+}
+
+// do sends an API request and decodes the JSON response into out, if set
+func (a *NgrokAPI) do(ctx context.Context, method, endpoint string, out interface{}) error {
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader("{}")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.APIKey)
+	req.Header.Set("Ngrok-Version", "2")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code string `json:"error_code"`
+			Msg  string `json:"msg"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Msg != "" {
+			return fmt.Errorf("%s (%s)", apiErr.Msg, apiErr.Code)
+		}
+		return fmt.Errorf("ngrok API answered %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
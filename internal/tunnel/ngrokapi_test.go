@@ -0,0 +1,200 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// ngrokError is an error from the ngrok agent with a code
+type ngrokError struct{ code, msg string }
+
+func (e ngrokError) Error() string     { return e.msg + "\n\n" + e.code }
+func (e ngrokError) Msg() string       { return e.msg }
+func (e ngrokError) ErrorCode() string { return e.code }
+
+func TestIsSessionLimit(t *testing.T) {
+	limit := ngrokError{errSessionLimit, "Your account is limited to 1 simultaneous ngrok agent sessions."}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"session limit", limit, true},
+		{"wrapped", fmt.Errorf("failed to connect to ngrok: %w", limit), true},
+		{"other code", ngrokError{"ERR_NGROK_105", "The authtoken you specified is invalid."}, false},
+		{"plain error", errors.New("ERR_NGROK_108"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSessionLimit(tt.err); got != tt.want {
+				t.Errorf("IsSessionLimit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAPIKey(t *testing.T) {
+	t.Setenv("NGROK_API_KEY", "from-env")
+	if got := ResolveAPIKey(&types.TunnelConfig{APIKey: "from-config"}); got != "from-config" {
+		t.Errorf("with tunnel.apiKey: %q", got)
+	}
+	if got := ResolveAPIKey(&types.TunnelConfig{AuthToken: "token"}); got != "from-env" {
+		t.Errorf("without tunnel.apiKey: %q, want $NGROK_API_KEY", got)
+	}
+}
+
+// ngrokAPIStub serves the session endpoints of the ngrok API: two pages of
+// sessions, and stopping them
+type ngrokAPIStub struct {
+	*httptest.Server
+	mu      sync.Mutex
+	stopped []string // ids of the sessions stopped
+}
+
+func newNgrokAPIStub(t *testing.T) *ngrokAPIStub {
+	t.Helper()
+	s := &ngrokAPIStub{}
+	started := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	pages := map[string]string{
+		"/tunnel_sessions": `{"tunnel_sessions": [
+			{"id": "ts_new", "ip": "198.51.100.7", "os": "linux", "agent_version": "3.5.0", "started_at": "` + started.Add(time.Hour).Format(time.RFC3339) + `"}
+		], "next_page_uri": "{api}/tunnel_sessions?before_id=ts_new"}`,
+		"/tunnel_sessions?before_id=ts_new": `{"tunnel_sessions": [
+			{"id": "ts_old", "ip": "203.0.113.5", "os": "darwin", "agent_version": "hz", "metadata": "{\"agent\":\"hz\",\"hostname\":\"laptop\",\"pid\":42}", "started_at": "` + started.Format(time.RFC3339) + `"}
+		], "next_page_uri": null}`,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer api-key" || r.Header.Get("Ngrok-Version") != "2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error_code": "ERR_NGROK_202", "status_code": 401, "msg": "The API key you specified is invalid."}`)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && pages[r.URL.RequestURI()] != "":
+			io.WriteString(w, strings.ReplaceAll(pages[r.URL.RequestURI()], "{api}", s.URL))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/stop"):
+			body, _ := io.ReadAll(r.Body)
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/tunnel_sessions/"), "/stop")
+			if r.Header.Get("Content-Type") != "application/json" || string(body) != "{}" {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error_code": "ERR_NGROK_400", "msg": "bad body"}`)
+				return
+			}
+			if id != "ts_old" && id != "ts_new" {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"error_code": "ERR_NGROK_404", "status_code": 404, "msg": "Resource not found"}`)
+				return
+			}
+			s.mu.Lock()
+			s.stopped = append(s.stopped, id)
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, "<html>bad gateway</html>")
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// api returns a client of the stub with apiKey
+func (s *ngrokAPIStub) api(apiKey string) *NgrokAPI {
+	api := NewNgrokAPI(apiKey)
+	api.BaseURL = s.URL
+	return api
+}
+
+func TestNgrokAPISessions(t *testing.T) {
+	s := newNgrokAPIStub(t)
+	sessions, err := s.api("api-key").Sessions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both pages, oldest first
+	var ids []string
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	if want := []string{"ts_old", "ts_new"}; !slices.Equal(ids, want) {
+		t.Fatalf("sessions %v, want %v", ids, want)
+	}
+	old, other := sessions[0], sessions[1]
+	if old.IP != "203.0.113.5" || old.OS != "darwin" || !old.StartedAt.Equal(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("session %+v", old)
+	}
+	if old.Hostname() != "laptop" || other.Hostname() != "" {
+		t.Errorf("hostnames %q and %q, want laptop for the hz session only", old.Hostname(), other.Hostname())
+	}
+}
+
+func TestNgrokAPIStopSession(t *testing.T) {
+	s := newNgrokAPIStub(t)
+	api := s.api("api-key")
+	if err := api.StopSession(context.Background(), "ts_old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.StopSession(context.Background(), "ts_gone"); err == nil || err.Error() != "failed to stop ngrok session ts_gone: Resource not found (ERR_NGROK_404)" {
+		t.Errorf("stopping an unknown session: %v", err)
+	}
+	if !slices.Equal(s.stopped, []string{"ts_old"}) {
+		t.Errorf("stopped %v, want [ts_old]", s.stopped)
+	}
+}
+
+// TestNgrokAPIErrors checks that API failures are reported, for hz to fall
+// back to the plain session limit error
+func TestNgrokAPIErrors(t *testing.T) {
+	s := newNgrokAPIStub(t)
+	tests := []struct {
+		name string
+		api  *NgrokAPI
+		err  string
+	}{
+		{"wrong key", s.api("auth-token"), "failed to list ngrok sessions: The API key you specified is invalid. (ERR_NGROK_202)"},
+		{"no JSON error", &NgrokAPI{BaseURL: s.URL + "/v0", APIKey: "api-key", Client: http.DefaultClient}, "failed to list ngrok sessions: ngrok API answered 502 Bad Gateway"},
+		{"unreachable", &NgrokAPI{BaseURL: "http://127.0.0.1:1", APIKey: "api-key", Client: http.DefaultClient}, "failed to list ngrok sessions: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, err := tt.api.Sessions(context.Background())
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) || sessions != nil {
+				t.Fatalf("Sessions = %v, %v; want an error starting with %q", sessions, err, tt.err)
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := s.api("api-key").Sessions(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("error %v, want context.Canceled", err)
+		}
+	})
+}
+
+// TestNgrokAPIMalformed checks a page that isn't the expected JSON
+func TestNgrokAPIMalformed(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"tunnel_sessions": "none"})
+	}))
+	defer api.Close()
+	_, err := (&NgrokAPI{BaseURL: api.URL, Client: http.DefaultClient}).Sessions(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to list ngrok sessions: json: ") {
+		t.Fatalf("error %v, want a decoding error", err)
+	}
+}
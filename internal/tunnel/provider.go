@@ -0,0 +1,52 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// Tunnel providers
+const (
+	ProviderNgrok       = "ngrok"
+	ProviderLocaltunnel = "localtunnel"
+	ProviderSSH         = "ssh"
+)
+
+// Providers lists the supported tunnel providers
+var Providers = []string{ProviderNgrok, ProviderLocaltunnel, ProviderSSH}
+
+// provider opens the public endpoint of a tunnel as a listener: each
+// accepted connection carries HTTP requests from the internet
+type provider interface {
+	// listen opens the tunnel and returns its public URL. Providers that
+	// reconnect by themselves call report when the tunnel is lost (err set)
+	// and when it is back, with its possibly new URL.
+	listen(ctx context.Context, cfg *types.TunnelConfig, logger *log.Logger, report func(url string, err error)) (net.Listener, string, error)
+
+	// edgeIPPolicy reports whether listen applies tunnel.ipPolicy at the
+	// provider's edge; otherwise the Manager enforces it
+	edgeIPPolicy() bool
+
+	// forwardsClients reports whether the provider's edge passes the client
+	// address in X-Forwarded-For; otherwise connections come straight from
+	// the clients
+	forwardsClients() bool
+}
+
+// newProvider returns the implementation of a tunnel.provider value
+func newProvider(name string) (provider, error) {
+	switch name {
+	case "", ProviderNgrok:
+		return &ngrokProvider{}, nil
+	case ProviderLocaltunnel:
+		return localtunnelProvider{}, nil
+	case ProviderSSH:
+		return sshProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown tunnel provider %q", name)
+	}
+}
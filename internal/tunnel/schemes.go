@@ -0,0 +1,154 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/zymawy/hz/internal/clientip"
+)
+
+// orderSchemes returns tunnel.schemes with https first, the scheme of the
+// public URL; https alone when unset
+func orderSchemes(schemes []string) []string {
+	if len(schemes) == 0 {
+		return []string{"https"}
+	}
+	ordered := slices.Clone(schemes)
+	slices.SortFunc(ordered, func(a, b string) int {
+		switch {
+		case a == b:
+			return 0
+		case a == "https":
+			return -1
+		case b == "https":
+			return 1
+		}
+		return 0
+	})
+	return ordered
+}
+
+// connScheme returns the public scheme a tunnel connection arrived on:
+// ngrok tells for each connection, other providers serve their URL's
+func connScheme(conn net.Conn, publicScheme string) string {
+	if c, ok := conn.(*countingConn); ok {
+		conn = c.Conn
+	}
+	if c, ok := conn.(interface{ Proto() string }); ok {
+		if proto := c.Proto(); proto == "http" || proto == "https" {
+			return proto
+		}
+	}
+	if publicScheme != "" {
+		return publicScheme
+	}
+	return "https"
+}
+
+// redirectHTTPS answers tunnel requests made over http with a permanent
+// redirect to https, keeping the method and body
+func redirectHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientip.Scheme(r) == "http" {
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mergedListener accepts connections from several listeners, the tunnels
+// of one endpoint on different schemes. It fails, to be reopened, when any
+// of them does.
+type mergedListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// mergeListeners accepts from all listeners at once; the first one's
+// address and URL stand for the merged listener
+func mergeListeners(listeners []net.Listener) *mergedListener {
+	m := &mergedListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error, len(listeners)),
+		done:      make(chan struct{}),
+	}
+	for _, l := range listeners {
+		go m.accept(l)
+	}
+	return m
+}
+
+// accept hands l's connections to Accept until l fails
+func (m *mergedListener) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			m.errs <- err
+			return
+		}
+		select {
+		case m.conns <- conn:
+		case <-m.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept returns the next connection from any of the listeners
+func (m *mergedListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-m.conns:
+		return conn, nil
+	case err := <-m.errs:
+		return nil, err
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes every listener
+func (m *mergedListener) Close() error {
+	var errs []error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, l := range m.listeners {
+			if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				errs = append(errs, err)
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Addr returns the first listener's address
+func (m *mergedListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
+
+// URL returns the first listener's public URL
+func (m *mergedListener) URL() string {
+	return listenerURL(m.listeners[0])
+}
+
+// schemeContext marks a tunnel connection's requests as tunnel traffic,
+// so their forwarded client address is trusted, with the scheme used.
+// Connections straight from clients are marked direct instead.
+func schemeContext(publicScheme func() string, direct bool) func(context.Context, net.Conn) context.Context {
+	return func(ctx context.Context, conn net.Conn) context.Context {
+		ctx = clientip.WithTunnel(ctx)
+		if direct {
+			ctx = clientip.WithDirect(ctx)
+		}
+		return clientip.WithScheme(ctx, connScheme(conn, publicScheme()))
+	}
+}
@@ -0,0 +1,330 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSH connections: how long connecting may take, and how often the server
+// is asked whether it is still there
+const (
+	sshDialTimeout = 15 * time.Second
+	sshKeepalive   = 15 * time.Second
+)
+
+// sshProvider asks an SSH server to listen on a port and forward its
+// connections to hz, like ssh -R. When the connection drops, the listener
+// fails and the Manager reconnects.
+type sshProvider struct{}
+
+// edgeIPPolicy is false: sshd forwards every client
+func (sshProvider) edgeIPPolicy() bool { return false }
+
+// forwardsClients is false: forwarded connections come from the clients
+func (sshProvider) forwardsClients() bool { return false }
+
+// listen connects to the SSH server and has it listen on tunnel.ssh.remotePort
+func (sshProvider) listen(ctx context.Context, cfg *types.TunnelConfig, logger *log.Logger, _ func(string, error)) (net.Listener, string, error) {
+	s := cfg.SSH
+	if s == nil || s.Host == "" {
+		return nil, "", errors.New("tunnel.ssh.host is not set")
+	}
+	addr := sshAddr(s.Host)
+
+	hostKeys, algorithms, err := sshHostKeyCallback(s, addr)
+	if err != nil {
+		return nil, "", err
+	}
+	auth, closeAgent, err := sshAuth(s)
+	if err != nil {
+		return nil, "", err
+	}
+	defer closeAgent()
+
+	login := s.User
+	if login == "" {
+		login = currentUser()
+	}
+	clientConfig := &ssh.ClientConfig{
+		User:              login,
+		Auth:              auth,
+		HostKeyCallback:   hostKeys,
+		HostKeyAlgorithms: algorithms,
+		Timeout:           sshDialTimeout,
+	}
+
+	d := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("ssh %s@%s: %w", login, addr, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+
+	forwarded, err := client.Listen("tcp", net.JoinHostPort("0.0.0.0", strconv.Itoa(s.RemotePort)))
+	if err != nil {
+		client.Close()
+		return nil, "", fmt.Errorf("%s refused to forward port %d (is it in use, or below 1024?): %w", addr, s.RemotePort, err)
+	}
+
+	port := s.RemotePort
+	if a, ok := forwarded.Addr().(*net.TCPAddr); ok && a.Port != 0 {
+		port = a.Port // the server's pick for port 0
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	publicURL := "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+
+	l := &sshListener{
+		Listener: forwarded,
+		client:   client,
+		addr:     addr,
+		url:      publicURL,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+	go l.keepAlive()
+	return l, publicURL, nil
+}
+
+// sshAddr adds the default port to a tunnel.ssh.host without one
+func sshAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, "22")
+}
+
+// currentUser is the login used without tunnel.ssh.user, as with ssh
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// sshAuth returns the keys to log in with: tunnel.ssh.keyFile, or else the
+// SSH agent's keys and the default key files. The returned func closes the
+// agent connection once logged in.
+func sshAuth(s *types.TunnelSSH) ([]ssh.AuthMethod, func(), error) {
+	if s.KeyFile != "" {
+		signer, err := readSSHKey(ExpandHome(s.KeyFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, func() {}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	var signers []ssh.Signer
+	home, _ := os.UserHomeDir()
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		if signer, err := readSSHKey(filepath.Join(home, ".ssh", name)); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		return nil, nil, errors.New("no SSH key found: set tunnel.ssh.keyFile or add a key to ssh-agent")
+	}
+	return methods, closeAgent, nil
+}
+
+// readSSHKey reads an unencrypted private key
+func readSSHKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("SSH key %s needs a passphrase; add it to ssh-agent and leave tunnel.ssh.keyFile unset", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// sshHostKeyCallback verifies the server's key against known_hosts, unless
+// tunnel.ssh.insecureIgnoreHostKey is set. It also returns the key types
+// known_hosts has for addr, for the server to offer one of them.
+func sshHostKeyCallback(s *types.TunnelSSH, addr string) (ssh.HostKeyCallback, []string, error) {
+	if s.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	}
+
+	path := s.KnownHostsFile
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	path = ExpandHome(path)
+	known, err := knownhosts.New(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("no known_hosts file at %s to verify %s; connect once with ssh to trust it, or set tunnel.ssh.knownHostsFile", path, addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	check := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := known(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		switch {
+		case !errors.As(err, &keyErr):
+			return err
+		case len(keyErr.Want) == 0:
+			return fmt.Errorf("%s isn't in %s; connect once with ssh to trust it", hostname, path)
+		default:
+			// Want has no particular order; name the first line
+			want := slices.MinFunc(keyErr.Want, func(a, b knownhosts.KnownKey) int { return a.Line - b.Line })
+			return fmt.Errorf("the host key of %s doesn't match %s:%d; it changed, or someone is impersonating it", hostname, want.Filename, want.Line)
+		}
+	}
+	return check, knownKeyAlgorithms(known, addr), nil
+}
+
+// knownKeyAlgorithms lists the key algorithms of addr's keys in known_hosts.
+// Without it, the server may offer a key type known_hosts has no entry for.
+func knownKeyAlgorithms(known ssh.HostKeyCallback, addr string) []string {
+	var keyErr *knownhosts.KeyError
+	if err := known(addr, &net.TCPAddr{IP: net.IPv4zero}, probeKey{}); !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, k := range keyErr.Want {
+		if k.Key.Type() == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, k.Key.Type())
+	}
+	return algorithms
+}
+
+// probeKey matches no known_hosts entry, so checking it lists the known keys
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "hz-probe" }
+func (probeKey) Marshal() []byte                              { return []byte("hz-probe") }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return errors.New("probe key") }
+
+// sshListener is a port forwarded by the SSH server. Closing it closes the
+// SSH connection.
+type sshListener struct {
+	net.Listener
+	client *ssh.Client
+	addr   string
+	url    string
+	logger *log.Logger
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// keepAlive closes the connection when the server stops answering, which
+// makes Accept fail so the Manager reconnects
+func (l *sshListener) keepAlive() {
+	ticker := time.NewTicker(sshKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		answered := make(chan error, 1)
+		go func() {
+			_, _, err := l.client.SendRequest("keepalive@openssh.com", true, nil)
+			answered <- err
+		}()
+		var err error
+		select {
+		case err = <-answered:
+		case <-time.After(sshKeepalive):
+			err = errors.New("no answer")
+		case <-l.done:
+			return
+		}
+		if err != nil {
+			l.logger.Printf("[tunnel] ssh keepalive to %s failed: %v", l.addr, err)
+			l.client.Close()
+			return
+		}
+	}
+}
+
+// Accept waits for the next forwarded connection
+func (l *sshListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if errors.Is(err, io.EOF) {
+		if l.isClosed() {
+			return nil, net.ErrClosed
+		}
+		return nil, fmt.Errorf("ssh connection to %s closed", l.addr)
+	}
+	return conn, err
+}
+
+// isClosed reports whether Close was called
+func (l *sshListener) isClosed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops forwarding and closes the SSH connection
+func (l *sshListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	l.Listener.Close()
+	return l.client.Close()
+}
+
+// Addr returns the public URL as the listener address
+func (l *sshListener) Addr() net.Addr {
+	return sshURL(l.url)
+}
+
+// sshURL is a public tunnel URL as a net.Addr
+type sshURL string
+
+func (a sshURL) Network() string { return "ssh" }
+func (a sshURL) String() string  { return string(a) }
@@ -0,0 +1,386 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zymawy/hz/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestSSHAddr(t *testing.T) {
+	tests := map[string]string{
+		"tunnel.example.com":      "tunnel.example.com:22",
+		"tunnel.example.com:2222": "tunnel.example.com:2222",
+		"10.0.0.5":                "10.0.0.5:22",
+		"::1":                     "[::1]:22",
+		"[::1]:2222":              "[::1]:2222",
+	}
+	for in, want := range tests {
+		if got := sshAddr(in); got != want {
+			t.Errorf("sshAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// testHostKey returns a new ed25519 or ecdsa public key
+func testHostKey(t *testing.T, ecdsaKey bool) ssh.PublicKey {
+	t.Helper()
+	var raw interface{}
+	if ecdsaKey {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw = &k.PublicKey
+	} else {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw = pub
+	}
+	key, err := ssh.NewPublicKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSSHHostKeyCallback(t *testing.T) {
+	known := testHostKey(t, false)
+	knownECDSA := testHostKey(t, true)
+	other := testHostKey(t, false)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "known_hosts")
+	lines := []string{
+		"# trusted hosts",
+		knownhosts.Line([]string{"tunnel.example.com"}, known),
+		knownhosts.Line([]string{"tunnel.example.com"}, knownECDSA),
+		knownhosts.Line([]string{knownhosts.Normalize("alt.example.com:2222")}, known),
+		knownhosts.Line([]string{knownhosts.HashHostname("hashed.example.com")}, known),
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 22}
+
+	tests := []struct {
+		name string
+		ssh  types.TunnelSSH
+		addr string
+		key  ssh.PublicKey
+		err  string
+	}{
+		{name: "known key", addr: "tunnel.example.com:22", key: known},
+		{name: "second known key", addr: "tunnel.example.com:22", key: knownECDSA},
+		{name: "known on another port", addr: "alt.example.com:2222", key: known},
+		{name: "hashed hostname", addr: "hashed.example.com:22", key: known},
+		{name: "changed key", addr: "tunnel.example.com:22", key: other, err: "doesn't match " + path + ":2"},
+		{name: "unknown host", addr: "new.example.com:22", key: known, err: "new.example.com:22 isn't in " + path},
+		{name: "other port isn't trusted", addr: "tunnel.example.com:2222", key: known, err: "isn't in"},
+		{name: "insecure", ssh: types.TunnelSSH{InsecureIgnoreHostKey: true}, addr: "new.example.com:22", key: other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.ssh
+			if !s.InsecureIgnoreHostKey {
+				s.KnownHostsFile = path
+			}
+			check, _, err := sshHostKeyCallback(&s, tt.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = check(tt.addr, remote, tt.key)
+			if tt.err == "" && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+
+	t.Run("key algorithms", func(t *testing.T) {
+		_, algorithms, err := sshHostKeyCallback(&types.TunnelSSH{KnownHostsFile: path}, "tunnel.example.com:22")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256} {
+			if !slices.Contains(algorithms, want) {
+				t.Errorf("algorithms %v lack %s", algorithms, want)
+			}
+		}
+		if _, algorithms, _ := sshHostKeyCallback(&types.TunnelSSH{KnownHostsFile: path}, "new.example.com:22"); len(algorithms) != 0 {
+			t.Errorf("algorithms %v for an unknown host", algorithms)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, _, err := sshHostKeyCallback(&types.TunnelSSH{KnownHostsFile: filepath.Join(dir, "nope")}, "tunnel.example.com:22")
+		if err == nil || !strings.Contains(err.Error(), "no known_hosts file") {
+			t.Fatalf("error %v, want one about the missing file", err)
+		}
+	})
+
+	t.Run("default file in home", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("USERPROFILE", home)
+		if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(lines[1]+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range []string{"", "~/.ssh/known_hosts"} {
+			check, _, err := sshHostKeyCallback(&types.TunnelSSH{KnownHostsFile: file}, "tunnel.example.com:22")
+			if err != nil {
+				t.Fatalf("%q: %v", file, err)
+			}
+			if err := check("tunnel.example.com:22", remote, known); err != nil {
+				t.Errorf("%q: rejected: %v", file, err)
+			}
+		}
+	})
+}
+
+// sshTestServer is an in-process SSH server that forwards ports like sshd
+// does for ssh -R
+type sshTestServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+}
+
+// startSSHServer runs an SSH server on a local port that lets authorized
+// log in and forward ports
+func startSSHServer(t *testing.T, authorized ssh.PublicKey) *sshTestServer {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHConn(t, conn, config)
+		}
+	}()
+	return &sshTestServer{addr: l.Addr().String(), hostKey: hostSigner.PublicKey()}
+}
+
+// serveSSHConn answers tcpip-forward requests by listening locally and
+// opening a forwarded-tcpip channel for each connection
+func serveSSHConn(t *testing.T, conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go func() {
+		for ch := range chans {
+			ch.Reject(ssh.Prohibited, "only port forwarding")
+		}
+	}()
+
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for req := range reqs {
+		if req.Type != "tcpip-forward" {
+			req.Reply(false, nil)
+			continue
+		}
+		var forward struct {
+			Addr string
+			Port uint32
+		}
+		if err := ssh.Unmarshal(req.Payload, &forward); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(forward.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		listeners = append(listeners, l)
+		port := uint32(l.Addr().(*net.TCPAddr).Port)
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+		go func() {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				origin := c.RemoteAddr().(*net.TCPAddr)
+				payload := ssh.Marshal(struct {
+					Addr       string
+					Port       uint32
+					OriginAddr string
+					OriginPort uint32
+				}{forward.Addr, port, origin.IP.String(), uint32(origin.Port)})
+				ch, chReqs, err := sconn.OpenChannel("forwarded-tcpip", payload)
+				if err != nil {
+					c.Close()
+					continue
+				}
+				go ssh.DiscardRequests(chReqs)
+				go func() {
+					io.Copy(ch, c)
+					ch.CloseWrite()
+				}()
+				go func() {
+					io.Copy(c, ch)
+					c.Close()
+					ch.Close()
+				}()
+			}
+		}()
+	}
+}
+
+// writeClientKey writes a new private key to a file and returns its path
+// and public key
+func writeClientKey(t *testing.T, dir string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "hz test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, sshPub
+}
+
+// TestSSHForwarding serves HTTP through a port the SSH server forwards
+func TestSSHForwarding(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, clientKey := writeClientKey(t, dir)
+	server := startSSHServer(t, clientKey)
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.addr)}, server.hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &types.TunnelConfig{Provider: "ssh", SSH: &types.TunnelSSH{
+		Host:           server.addr,
+		User:           "hz",
+		KeyFile:        keyFile,
+		KnownHostsFile: knownHosts,
+	}}
+	logger := log.New(io.Discard, "", 0)
+
+	l, publicURL, err := sshProvider{}.listen(context.Background(), cfg, logger, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hz saw %s", r.URL.Path)
+	}))
+
+	if !strings.HasPrefix(publicURL, "http://127.0.0.1:") || l.Addr().String() != publicURL {
+		t.Fatalf("public URL %q, listener address %q", publicURL, l.Addr())
+	}
+	for _, path := range []string{"/", "/api/users"} {
+		resp, err := http.Get(publicURL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := "hz saw " + path; string(body) != want {
+			t.Errorf("got %q, want %q", body, want)
+		}
+	}
+
+	if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept after Close = %v, want net.ErrClosed", err)
+	}
+
+	t.Run("unknown client key", func(t *testing.T) {
+		otherKey, _ := writeClientKey(t, t.TempDir())
+		other := *cfg.SSH
+		other.KeyFile = otherKey
+		_, _, err := sshProvider{}.listen(context.Background(), &types.TunnelConfig{SSH: &other}, logger, nil)
+		if err == nil || !strings.Contains(err.Error(), "ssh hz@"+server.addr) {
+			t.Fatalf("error %v, want a login failure", err)
+		}
+	})
+
+	t.Run("changed host key", func(t *testing.T) {
+		impostor := startSSHServer(t, clientKey)
+		// known_hosts trusts the first server's key for the impostor's address
+		line := knownhosts.Line([]string{knownhosts.Normalize(impostor.addr)}, server.hostKey)
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		if err := os.WriteFile(path, []byte(line+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		other := *cfg.SSH
+		other.Host, other.KnownHostsFile = impostor.addr, path
+		_, _, err := sshProvider{}.listen(context.Background(), &types.TunnelConfig{SSH: &other}, logger, nil)
+		if err == nil || !strings.Contains(err.Error(), "doesn't match") {
+			t.Fatalf("error %v, want a host key mismatch", err)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// Where ResolveAuthToken found a token, in the order it looks
+const (
+	TokenSourceConfig  = "config"
+	TokenSourceFile    = "authtokenFile"
+	TokenSourceKeyring = "keyring"
+	TokenSourceNgrok   = "ngrok config"
+)
+
+// ResolveAuthToken finds the auth token for a tunnel: the authtoken setting,
+// then authtokenFile, then the OS keyring when keyring is set, then the ngrok
+// agent's own config. It returns the token and where it came from.
+func ResolveAuthToken(cfg *types.TunnelConfig) (token, source string, err error) {
+	if cfg.AuthToken != "" {
+		return cfg.AuthToken, TokenSourceConfig, nil
+	}
+	if cfg.AuthTokenFile != "" {
+		token, err := ReadTokenFile(cfg.AuthTokenFile)
+		if err != nil {
+			return "", "", err
+		}
+		return token, TokenSourceFile, nil
+	}
+
+	var keyringErr error
+	if cfg.Keyring {
+		if token, keyringErr = KeyringToken(); keyringErr == nil {
+			return token, TokenSourceKeyring, nil
+		}
+	}
+
+	token, _, err = LoadSystemNgrokConfig()
+	if err == nil {
+		return token, TokenSourceNgrok, nil
+	}
+	if keyringErr != nil {
+		return "", "", fmt.Errorf("no ngrok auth token in the keyring (%v) or the ngrok config", keyringErr)
+	}
+	return "", "", fmt.Errorf("no ngrok auth token configured and none found in system: %w", err)
+}
+
+// ReadTokenFile reads an auth token from a file holding nothing else. Files
+// other users can read are refused, as the token would leak to them.
+func ReadTokenFile(path string) (string, error) {
+	path = ExpandHome(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read auth token file: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o004 != 0 {
+		return "", fmt.Errorf("auth token file %s is readable by every user; run 'chmod 600 %s'", path, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read auth token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("auth token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// ExpandHome replaces a leading ~ in path with the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// MaskToken shows at most the first 4 characters of a token
+func MaskToken(token string) string {
+	if len(token) < 8 {
+		return "****"
+	}
+	return token[:4] + "***"
+}
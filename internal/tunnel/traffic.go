@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// traffic counts tunnel connections, bytes and requests; it is updated per
+// connection and read, so every counter is atomic
+type traffic struct {
+	connections atomic.Int64
+	open        atomic.Int64
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+	requests    atomic.Int64
+}
+
+// snapshot returns the counts so far
+func (t *traffic) snapshot() *types.TunnelTraffic {
+	return &types.TunnelTraffic{
+		LifetimeConnections: t.connections.Load(),
+		OpenConnections:     t.open.Load(),
+		LifetimeBytesIn:     t.bytesIn.Load(),
+		LifetimeBytesOut:    t.bytesOut.Load(),
+		LifetimeRequests:    t.requests.Load(),
+	}
+}
+
+// listener counts the connections accepted from l
+func (t *traffic) listener(l net.Listener) net.Listener {
+	return &countingListener{Listener: l, traffic: t}
+}
+
+// handler counts the requests next serves
+func (t *traffic) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.requests.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// countingListener wraps a tunnel listener's connections in countingConns
+type countingListener struct {
+	net.Listener
+	traffic *traffic
+}
+
+// Accept counts the connection as accepted and open
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.traffic.connections.Add(1)
+	l.traffic.open.Add(1)
+	return &countingConn{Conn: conn, traffic: l.traffic}, nil
+}
+
+// countingConn counts the bytes through a tunnel connection, and its close
+type countingConn struct {
+	net.Conn
+	traffic   *traffic
+	closeOnce sync.Once
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.traffic.bytesIn.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.traffic.bytesOut.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	c.closeOnce.Do(func() { c.traffic.open.Add(-1) })
+	return c.Conn.Close()
+}
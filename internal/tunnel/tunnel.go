@@ -1,35 +1,46 @@
-// Package tunnel manages ngrok tunnel connections
+// Package tunnel manages tunnel connections through ngrok or localtunnel
 package tunnel
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/zymawy/hz/pkg/types"
-	"golang.ngrok.com/ngrok"
-	ngrokconfig "golang.ngrok.com/ngrok/config"
 	"gopkg.in/yaml.v3"
 )
 
-// Manager handles ngrok tunnel lifecycle
+// Manager handles the tunnel lifecycle
 type Manager struct {
 	config    *types.TunnelConfig
-	tunnel    ngrok.Tunnel
-	listener  net.Listener
-	status    types.TunnelStatus
+	endpoints []*endpoint        // opened by Start
+	status    types.TunnelStatus // combined from the endpoints
 	mu        sync.RWMutex
 	ctx       context.Context
 	cancel    context.CancelFunc
 	logger    *log.Logger
 	handler   http.Handler
+	server    types.ServerConfig // listener timeouts for tunnel traffic
+	policy    *ipPolicy          // tunnel.ipPolicy, when hz enforces it
+	direct    bool               // the provider's connections come straight from clients
+
+	listeners []func(types.TunnelStatus) // OnChange functions
+	traffic   traffic                    // since New, across restarts
+	watchdog  types.TunnelWatchdogStatus // since New, across restarts
+
+	urlFileMu sync.Mutex
+	urlFile   struct{ path, url string } // what tunnel.urlFile holds
 }
 
 // ngrokSystemConfig represents ngrok's native config structure
@@ -120,117 +131,308 @@ func New(config *types.TunnelConfig) *Manager {
 		cancel: cancel,
 		logger: log.Default(),
 		status: types.TunnelStatus{
-			Active: false,
+			State: types.TunnelStateStopped,
 		},
+		server: defaultServerTimeouts,
 	}
 }
 
-// Start establishes the ngrok tunnel
+// defaultServerTimeouts guard tunnel traffic until SetServerConfig, like
+// the config defaults: stalled clients time out, but responses never do, so
+// streams and WebSockets last as long as they would locally
+var defaultServerTimeouts = types.ServerConfig{
+	ReadHeaderTimeout: types.Duration(10 * time.Second),
+	IdleTimeout:       types.Duration(2 * time.Minute),
+}
+
+// ServiceHandlers is implemented by handlers that can send every request to
+// one service, like the proxy. Start needs it for endpoints bound to a
+// service.
+type ServiceHandlers interface {
+	ServiceHandler(name string) http.Handler
+}
+
+// Start opens the tunnel, or each of tunnel.endpoints, with the configured
+// provider. An endpoint that fails to open doesn't stop the others; Start
+// only fails when none opened. A tunnel lost later is reopened with backoff
+// until Stop.
 func (m *Manager) Start(handler http.Handler) error {
 	if !m.config.Enabled {
 		return nil
 	}
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	m.handler = handler
+	p, err := newProvider(m.config.Provider)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
 
-	// Auto-detect ngrok credentials if not configured
-	authToken := m.config.AuthToken
-	domain := m.config.Domain
-
-	if authToken == "" {
-		m.logger.Println("[tunnel] No auth token in config, checking system ngrok config...")
-		if sysToken, sysDomain, err := LoadSystemNgrokConfig(); err == nil {
-			authToken = sysToken
-			m.logger.Println("[tunnel] Found ngrok auth token in system config")
-			// Use system domain if not set in hz config
-			if domain == "" && sysDomain != "" {
-				domain = sysDomain
-				m.logger.Printf("[tunnel] Using system domain: %s", domain)
-			}
-		} else {
-			return fmt.Errorf("no ngrok auth token configured and none found in system: %w\n\nRun 'ngrok config add-authtoken <token>' or 'hz tunnel --token <token>'", err)
+	m.direct = !p.forwardsClients()
+
+	// Without an edge IP policy, hz checks tunnel requests itself
+	m.policy = nil
+	if m.config.IPPolicy != nil && !p.edgeIPPolicy() {
+		if m.policy, err = parseIPPolicy(m.config.IPPolicy); err != nil {
+			m.mu.Unlock()
+			return fmt.Errorf("tunnel.ipPolicy: %w", err)
+		}
+		m.logger.Printf("[tunnel] %s has no edge IP policy; hz enforces tunnel.ipPolicy on tunnel requests instead", m.Provider())
+	}
+
+	m.endpoints, err = newEndpoints(m.config, handler)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	ctx, endpoints := m.ctx, m.endpoints
+	if w := m.config.Watchdog; w != nil && w.Enabled {
+		go m.watch(ctx, *w)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, e := range endpoints {
+		if err := m.open(ctx, p, e); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	if len(errs) == len(endpoints) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
 
-	// Build ngrok options
-	opts := []ngrokconfig.HTTPEndpointOption{}
+// newEndpoints lists the tunnels to open: one per tunnel.endpoints entry, or
+// the single tunnel at tunnel.domain
+func newEndpoints(cfg *types.TunnelConfig, handler http.Handler) ([]*endpoint, error) {
+	if len(cfg.Endpoints) == 0 {
+		return []*endpoint{{domain: cfg.Domain, handler: handler}}, nil
+	}
 
-	// Add custom domain if configured
-	if domain != "" {
-		opts = append(opts, ngrokconfig.WithDomain(domain))
+	endpoints := make([]*endpoint, 0, len(cfg.Endpoints))
+	for _, ep := range cfg.Endpoints {
+		e := &endpoint{domain: ep.Domain, service: ep.Service, handler: handler, multiple: true}
+		if ep.Service != "" {
+			services, ok := handler.(ServiceHandlers)
+			if !ok {
+				return nil, fmt.Errorf("tunnel endpoint for service %s: the handler can't route to a single service", ep.Service)
+			}
+			e.handler = services.ServiceHandler(ep.Service)
+		}
+		endpoints = append(endpoints, e)
 	}
+	return endpoints, nil
+}
 
-	// Create listener
-	var err error
-	m.listener, err = ngrok.Listen(m.ctx,
-		ngrokconfig.HTTPEndpoint(opts...),
-		ngrok.WithAuthtoken(authToken),
-	)
+// open opens an endpoint's tunnel and serves it in the background,
+// reopening it when it is lost
+func (m *Manager) open(ctx context.Context, p provider, e *endpoint) error {
+	listener, publicURL, err := p.listen(ctx, m.endpointConfig(e), m.logger, func(url string, err error) { m.report(e, url, err) })
 	if err != nil {
-		m.status.Error = err.Error()
-		return fmt.Errorf("failed to create ngrok tunnel: %w", err)
+		m.logger.Printf("[tunnel] %s tunnel%s failed: %v", m.Provider(), e.label(), err)
+		m.update(e, func(s *types.TunnelStatus) {
+			*s = types.TunnelStatus{State: types.TunnelStateFailed, Error: err.Error()}
+		})
+		return err
 	}
 
-	// Store tunnel reference if available
-	if tun, ok := m.listener.(ngrok.Tunnel); ok {
-		m.tunnel = tun
-	}
+	m.mu.Lock()
+	e.listener = listener
+	m.mu.Unlock()
+	m.update(e, func(s *types.TunnelStatus) { *s = activeStatus(publicURL) })
+	m.logger.Printf("[tunnel] %s tunnel%s established: %s", m.Provider(), e.label(), publicURL)
 
-	// Update status
-	m.status = types.TunnelStatus{
+	go m.supervise(ctx, p, e, listener)
+	return nil
+}
+
+// endpointConfig is the tunnel config an endpoint's tunnel is opened with
+func (m *Manager) endpointConfig(e *endpoint) *types.TunnelConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cfg := *m.config
+	cfg.Domain = e.domain
+	return &cfg
+}
+
+// activeStatus is the status of a tunnel just opened at publicURL
+func activeStatus(publicURL string) types.TunnelStatus {
+	u, _ := url.Parse(publicURL)
+	return types.TunnelStatus{
+		State:     types.TunnelStateActive,
 		Active:    true,
-		PublicURL: m.listener.Addr().String(),
+		PublicURL: publicURL,
+		URL:       u,
 		StartedAt: time.Now(),
 	}
+}
+
+// listenerURL returns the public URL of a tunnel listener: its URL method's,
+// like ngrok tunnels have, or else its address with a scheme added
+func listenerURL(l net.Listener) string {
+	if t, ok := l.(interface{ URL() string }); ok && t.URL() != "" {
+		return t.URL()
+	}
+	addr := l.Addr()
+	if strings.Contains(addr.String(), "://") {
+		return addr.String()
+	}
+	scheme := "https"
+	if addr.Network() == "http" {
+		scheme = "http"
+	}
+	return scheme + "://" + addr.String()
+}
 
-	m.logger.Printf("[tunnel] ngrok tunnel established: %s", m.status.PublicURL)
+// OnChange registers a function called with the new status whenever the
+// state, public URL or reconnect attempt of the tunnel or one of its
+// endpoints changes
+func (m *Manager) OnChange(fn func(types.TunnelStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
 
-	// Start serving in background
-	go m.serve()
+// update changes an endpoint's status, or every endpoint's when e is nil,
+// and notifies the OnChange listeners
+func (m *Manager) update(e *endpoint, change func(*types.TunnelStatus)) {
+	m.mu.Lock()
+	before := statusKey(m.status)
+	if e != nil {
+		change(&e.status)
+	} else {
+		for _, e := range m.endpoints {
+			change(&e.status)
+		}
+	}
+	m.status = m.aggregate()
+	status := m.status
+	listeners := m.listeners
+	m.mu.Unlock()
 
-	return nil
+	if statusKey(status) == before {
+		return
+	}
+	m.syncURLFile()
+	for _, fn := range listeners {
+		fn(status)
+	}
+}
+
+// statusKey sums up what OnChange listeners are told about
+func statusKey(s types.TunnelStatus) string {
+	key := fmt.Sprintf("%s %s %d", s.State, s.PublicURL, s.Attempts)
+	for _, e := range s.Endpoints {
+		key += fmt.Sprintf("|%s %s %d", e.State, e.PublicURL, e.Attempts)
+	}
+	return key
+}
+
+// aggregate combines the endpoint statuses: the single tunnel's as is, or
+// for tunnel.endpoints the first active URL, each endpoint's status, and
+// partial while only some are active
+func (m *Manager) aggregate() types.TunnelStatus {
+	if len(m.endpoints) == 0 {
+		return types.TunnelStatus{State: types.TunnelStateStopped}
+	}
+	if !m.endpoints[0].multiple {
+		return m.endpoints[0].status
+	}
+
+	var status types.TunnelStatus
+	states := make(map[types.TunnelState]int)
+	for _, e := range m.endpoints {
+		states[e.status.State]++
+		status.Endpoints = append(status.Endpoints, types.TunnelEndpointStatus{Domain: e.domain, Service: e.service, TunnelStatus: e.status})
+		if e.status.Active && !status.Active {
+			status.Active, status.PublicURL, status.URL, status.StartedAt = true, e.status.PublicURL, e.status.URL, e.status.StartedAt
+		}
+		if !e.status.Active && status.Error == "" {
+			status.Error = e.status.Error
+		}
+	}
+	switch {
+	case len(states) == 1:
+		status.State = m.endpoints[0].status.State
+	case states[types.TunnelStateActive] > 0:
+		status.State = types.TunnelStatePartial
+	case states[types.TunnelStateReconnecting] > 0:
+		status.State = types.TunnelStateReconnecting
+	default:
+		status.State = types.TunnelStateFailed
+	}
+	return status
 }
 
-// serve handles incoming connections
-func (m *Manager) serve() {
-	if m.handler == nil {
-		m.logger.Println("[tunnel] no handler configured, tunnel inactive")
+// report records a provider losing or regaining an endpoint's tunnel by
+// itself
+func (m *Manager) report(e *endpoint, publicURL string, err error) {
+	if err != nil {
+		m.logger.Printf("[tunnel] %s tunnel%s lost, reconnecting: %v", m.Provider(), e.label(), err)
+		m.update(e, func(s *types.TunnelStatus) {
+			s.State, s.Active, s.Error = types.TunnelStateReconnecting, false, err.Error()
+		})
 		return
 	}
+	m.logReconnected(e, publicURL)
+	m.update(e, func(s *types.TunnelStatus) {
+		started := s.StartedAt
+		*s = activeStatus(publicURL)
+		s.StartedAt = started
+	})
+}
 
-	server := &http.Server{
-		Handler:      m.handler,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+// logReconnected logs an endpoint's tunnel being back, at publicURL
+func (m *Manager) logReconnected(e *endpoint, publicURL string) {
+	m.mu.RLock()
+	previous := e.status.PublicURL
+	m.mu.RUnlock()
+	if publicURL != previous {
+		m.logger.Printf("[tunnel] %s tunnel%s reconnected with a new URL: %s", m.Provider(), e.label(), publicURL)
+	} else {
+		m.logger.Printf("[tunnel] %s tunnel%s reconnected: %s", m.Provider(), e.label(), publicURL)
 	}
+}
 
-	if err := server.Serve(m.listener); err != nil && err != http.ErrServerClosed {
-		m.logger.Printf("[tunnel] serve error: %v", err)
-		m.mu.Lock()
-		m.status.Error = err.Error()
-		m.status.Active = false
-		m.mu.Unlock()
+// Provider returns the configured tunnel provider
+func (m *Manager) Provider() string {
+	if m.config.Provider == "" {
+		return ProviderNgrok
 	}
+	return m.config.Provider
 }
 
-// Stop closes the ngrok tunnel
+// Stop closes the tunnel and its endpoints, canceling reconnections in
+// progress
 func (m *Manager) Stop() error {
 	m.cancel()
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	var listeners []net.Listener
+	for _, e := range m.endpoints {
+		if e.listener != nil {
+			listeners = append(listeners, e.listener)
+			e.listener = nil
+		}
+	}
+	m.mu.Unlock()
 
-	if m.listener != nil {
-		if err := m.listener.Close(); err != nil {
-			return fmt.Errorf("failed to close tunnel: %w", err)
+	var errs []error
+	for _, l := range listeners {
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
 		}
 	}
 
-	m.status.Active = false
-	m.logger.Println("[tunnel] ngrok tunnel closed")
+	m.update(nil, func(s *types.TunnelStatus) {
+		s.State, s.Active, s.Attempts, s.NextAttempt = types.TunnelStateStopped, false, 0, time.Time{}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to close tunnel: %w", err)
+	}
+	m.logger.Printf("[tunnel] %s tunnel closed", m.Provider())
 
 	return nil
 }
@@ -242,11 +444,17 @@ func (m *Manager) GetPublicURL() string {
 	return m.status.PublicURL
 }
 
-// Status returns the current tunnel status
+// Status returns the current tunnel status, with its traffic so far
 func (m *Manager) Status() types.TunnelStatus {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.status
+	status := m.status
+	if w := m.config.Watchdog; w != nil && w.Enabled {
+		watchdog := m.watchdog
+		status.Watchdog = &watchdog
+	}
+	m.mu.RUnlock()
+	status.Traffic = m.traffic.snapshot()
+	return status
 }
 
 // IsActive returns whether the tunnel is active
@@ -261,6 +469,15 @@ func (m *Manager) SetLogger(logger *log.Logger) {
 	m.logger = logger
 }
 
+// SetServerConfig applies the local server's timeouts to tunnel traffic too,
+// so streams through the tunnel last as long as local ones. They apply to
+// tunnels opened after the call.
+func (m *Manager) SetServerConfig(server types.ServerConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.server = server
+}
+
 // Restart recreates the tunnel
 func (m *Manager) Restart(handler http.Handler) error {
 	if err := m.Stop(); err != nil {
@@ -268,14 +485,27 @@ func (m *Manager) Restart(handler http.Handler) error {
 	}
 
 	// Create new context
+	m.mu.Lock()
 	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.mu.Unlock()
 
 	return m.Start(handler)
 }
 
-// UpdateConfig updates tunnel configuration
+// UpdateConfig updates tunnel configuration. A running tunnel keeps the
+// settings it started with until Restart, which is logged when its logins
+// change; a moved tunnel.urlFile is written at once.
 func (m *Manager) UpdateConfig(config *types.TunnelConfig) {
+	defer m.syncURLFile()
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if len(m.endpoints) > 0 {
+		if !slices.Equal(m.config.BasicAuth, config.BasicAuth) {
+			m.logger.Printf("[tunnel] tunnel.basicAuth changed; restart the tunnel (restart hz) to apply it")
+		}
+		if !slices.Equal(m.config.Endpoints, config.Endpoints) {
+			m.logger.Printf("[tunnel] tunnel.endpoints changed; restart the tunnel (restart hz) to apply it")
+		}
+	}
 	m.config = config
 }
@@ -0,0 +1,137 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// fakeTunnel is a listener like an ngrok tunnel: its address is a bare
+// host:port and its URL method has the public URL
+type fakeTunnel struct {
+	net.Listener
+	addr fakeAddr
+	url  string
+}
+
+func (l *fakeTunnel) Addr() net.Addr { return l.addr }
+func (l *fakeTunnel) URL() string    { return l.url }
+
+// fakeAddr is a listener address on network "network"
+type fakeAddr struct{ network, addr string }
+
+func (a fakeAddr) Network() string { return a.network }
+func (a fakeAddr) String() string  { return a.addr }
+
+// fakeListener is a listener with only an address
+type fakeListener struct {
+	net.Listener
+	addr fakeAddr
+}
+
+func (l *fakeListener) Addr() net.Addr { return l.addr }
+
+// localListener listens on a local port until the test ends
+func localListener(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestListenerURL(t *testing.T) {
+	ngrokAddr := fakeAddr{"tcp", "xyz.ngrok-free.app:443"}
+	// A merged listener accepts from both, so they need to be real ones
+	merged := mergeListeners([]net.Listener{
+		&fakeTunnel{Listener: localListener(t), addr: ngrokAddr, url: "https://xyz.ngrok-free.app"},
+		&fakeTunnel{Listener: localListener(t), addr: ngrokAddr, url: "http://xyz.ngrok-free.app"},
+	})
+	defer merged.Close()
+
+	tests := []struct {
+		name     string
+		listener net.Listener
+		want     string
+	}{
+		{"tunnel URL", &fakeTunnel{addr: ngrokAddr, url: "https://xyz.ngrok-free.app"}, "https://xyz.ngrok-free.app"},
+		{"http tunnel URL", &fakeTunnel{addr: ngrokAddr, url: "http://xyz.ngrok-free.app"}, "http://xyz.ngrok-free.app"},
+		{"tunnel without a URL", &fakeTunnel{addr: ngrokAddr}, "https://xyz.ngrok-free.app:443"},
+		{"address with a scheme", &fakeListener{addr: fakeAddr{"localtunnel", "https://abc.loca.lt"}}, "https://abc.loca.lt"},
+		{"http address", &fakeListener{addr: fakeAddr{"http", "tunnel.example.com:8080"}}, "http://tunnel.example.com:8080"},
+		{"other address", &fakeListener{addr: fakeAddr{"tcp", "tunnel.example.com"}}, "https://tunnel.example.com"},
+		{"merged listeners", merged, "https://xyz.ngrok-free.app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listenerURL(tt.listener); got != tt.want {
+				t.Errorf("listenerURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeProvider opens its listener as the tunnel
+type fakeProvider struct{ listener net.Listener }
+
+func (p fakeProvider) listen(context.Context, *types.TunnelConfig, *log.Logger, func(string, error)) (net.Listener, string, error) {
+	return p.listener, listenerURL(p.listener), nil
+}
+
+func (fakeProvider) edgeIPPolicy() bool    { return true }
+func (fakeProvider) forwardsClients() bool { return true }
+
+// TestPublicURLStatus opens a fake ngrok tunnel: the status has its public
+// URL, and parsed, until a reconnect reports a new one
+func TestPublicURLStatus(t *testing.T) {
+	tun := &fakeTunnel{Listener: localListener(t), addr: fakeAddr{"tcp", "xyz.ngrok-free.app:443"}, url: "https://xyz.ngrok-free.app"}
+
+	m := New(&types.TunnelConfig{Enabled: true})
+	m.SetLogger(log.New(io.Discard, "", 0))
+	var changes []types.TunnelStatus
+	m.OnChange(func(s types.TunnelStatus) { changes = append(changes, s) })
+	var err error
+	m.endpoints, err = newEndpoints(m.config, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := m.endpoints[0]
+	if err := m.open(m.ctx, fakeProvider{tun}, e); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	status := m.Status()
+	if m.GetPublicURL() != "https://xyz.ngrok-free.app" || status.PublicURL != m.GetPublicURL() {
+		t.Fatalf("public URL %q, status %q", m.GetPublicURL(), status.PublicURL)
+	}
+	if status.URL == nil || status.URL.Scheme != "https" || status.URL.Host != "xyz.ngrok-free.app" {
+		t.Fatalf("parsed URL %v", status.URL)
+	}
+	if !status.Active || status.State != types.TunnelStateActive || len(changes) != 1 || changes[0].URL.String() != status.PublicURL {
+		t.Errorf("status %+v after %d changes", status, len(changes))
+	}
+
+	started := status.StartedAt
+	time.Sleep(time.Millisecond)
+	m.report(e, "", io.ErrUnexpectedEOF)
+	if status := m.Status(); status.Active || status.PublicURL != "https://xyz.ngrok-free.app" {
+		t.Errorf("lost tunnel status %+v", status)
+	}
+	m.report(e, "http://abc.ngrok-free.app", nil)
+	status = m.Status()
+	if status.PublicURL != "http://abc.ngrok-free.app" || status.URL == nil || status.URL.Scheme != "http" || status.URL.Host != "abc.ngrok-free.app" {
+		t.Errorf("after reconnecting: public URL %q, parsed %v", status.PublicURL, status.URL)
+	}
+	if !status.StartedAt.Equal(started) {
+		t.Errorf("started at %v, want %v kept across the reconnect", status.StartedAt, started)
+	}
+}
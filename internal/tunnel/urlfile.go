@@ -0,0 +1,89 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// syncURLFile makes tunnel.urlFile hold the public URL while the tunnel is
+// active, and removes it otherwise, so readers never see an empty URL
+func (m *Manager) syncURLFile() {
+	m.urlFileMu.Lock()
+	defer m.urlFileMu.Unlock()
+
+	m.mu.RLock()
+	path, status := m.config.URLFile, m.status
+	m.mu.RUnlock()
+
+	publicURL := ""
+	if status.Active {
+		publicURL = status.PublicURL
+	}
+	if path == m.urlFile.path && publicURL == m.urlFile.url {
+		return
+	}
+
+	// Moved by a reload: the old file goes
+	if m.urlFile.path != "" && m.urlFile.path != path {
+		if err := removeURLFile(m.urlFile.path); err != nil {
+			m.logger.Printf("[tunnel] %v", err)
+		}
+	}
+	m.urlFile.path, m.urlFile.url = path, ""
+	if path == "" {
+		return
+	}
+
+	if publicURL == "" {
+		if err := removeURLFile(path); err != nil {
+			m.logger.Printf("[tunnel] %v", err)
+		}
+		return
+	}
+	if err := writeURLFile(path, publicURL); err != nil {
+		m.logger.Printf("[tunnel] %v", err)
+		return
+	}
+	m.urlFile.url = publicURL
+}
+
+// writeURLFile replaces the file at path with publicURL, through a rename so
+// readers see the old URL or the new one, never part of it
+func writeURLFile(path, publicURL string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to write tunnel.urlFile: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write tunnel.urlFile: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // after a failure; renamed otherwise
+
+	if _, err := tmp.WriteString(publicURL); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write tunnel.urlFile: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write tunnel.urlFile: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write tunnel.urlFile: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write tunnel.urlFile: %w", err)
+	}
+	return nil
+}
+
+// removeURLFile removes the URL file, if there is one
+func removeURLFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove tunnel.urlFile: %w", err)
+	}
+	return nil
+}
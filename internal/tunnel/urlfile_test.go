@@ -0,0 +1,123 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// rotatingProvider opens its listeners in turn, like a provider assigning
+// a new URL on every reconnect
+type rotatingProvider struct{ listeners chan net.Listener }
+
+func (p rotatingProvider) listen(context.Context, *types.TunnelConfig, *log.Logger, func(string, error)) (net.Listener, string, error) {
+	select {
+	case l := <-p.listeners:
+		return l, listenerURL(l), nil
+	default:
+		return nil, "", errors.New("no listener left")
+	}
+}
+
+func (rotatingProvider) edgeIPPolicy() bool    { return true }
+func (rotatingProvider) forwardsClients() bool { return true }
+
+// readURLFile returns what the URL file at path holds, "(none)" when
+// there is none, or the read error
+func readURLFile(path string) string {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "(none)"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// TestURLFileReconnect loses a tunnel that comes back with a new URL: the
+// URL file is removed meanwhile and then holds the new URL
+func TestURLFileReconnect(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".hz", "tunnel-url")
+	p := rotatingProvider{listeners: make(chan net.Listener, 2)}
+	for _, u := range []string{"https://first.ngrok-free.app", "https://second.ngrok-free.app"} {
+		p.listeners <- &fakeTunnel{Listener: localListener(t), addr: fakeAddr{"tcp", "ngrok:443"}, url: u}
+	}
+
+	m := New(&types.TunnelConfig{Enabled: true, URLFile: path})
+	m.SetLogger(log.New(io.Discard, "", 0))
+	// Each status change reports what the file held once it was announced
+	changes := make(chan string, 10)
+	m.OnChange(func(s types.TunnelStatus) { changes <- string(s.State) + " " + readURLFile(path) })
+	var err error
+	m.endpoints, err = newEndpoints(m.config, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := m.endpoints[0]
+	if err := m.open(m.ctx, p, e); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-changes:
+				if got != w {
+					t.Fatalf("change %q, want %q", got, w)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no change, want %q", w)
+			}
+		}
+	}
+	expect("active https://first.ngrok-free.app")
+
+	// The listener fails: supervise reconnects, and the provider assigns the
+	// second URL
+	m.mu.RLock()
+	first := e.listener
+	m.mu.RUnlock()
+	first.Close()
+	expect("reconnecting (none)", "reconnecting (none)", "active https://second.ngrok-free.app")
+
+	// A reload moves the file
+	moved := filepath.Join(dir, "tunnel-url")
+	m.UpdateConfig(&types.TunnelConfig{Enabled: true, URLFile: moved})
+	if got := readURLFile(moved); got != "https://second.ngrok-free.app" {
+		t.Errorf("moved file holds %q", got)
+	}
+	if got := readURLFile(path); got != "(none)" {
+		t.Errorf("old file holds %q after the move", got)
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readURLFile(moved); got != "(none)" {
+		t.Errorf("file holds %q after Stop", got)
+	}
+	for _, d := range []string{dir, filepath.Dir(path)} {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				t.Errorf("%s left in %s", entry.Name(), d)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zymawy/hz/pkg/types"
+)
+
+// PingPath is answered by hz itself, with PingHeader set, for the watchdog
+// to tell hz's answers from errors of the tunnel's edge
+const (
+	PingPath   = "/__hz/ping"
+	PingHeader = "X-Hz-Ping"
+)
+
+// watch checks the tunnel through its public URLs every interval and
+// restarts it after cfg.FailureThreshold failures in a row. Checks pause
+// while an endpoint reconnects, which already replaces its tunnel. It runs
+// until ctx, the context of one Start, is canceled.
+func (m *Manager) watch(ctx context.Context, cfg types.TunnelWatchdog) {
+	client := &http.Client{Timeout: time.Duration(cfg.Timeout)}
+	ticker := time.NewTicker(time.Duration(cfg.Interval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		urls, ok := m.watchedURLs()
+		if !ok {
+			m.setWatchdog(func(w *types.TunnelWatchdogStatus) { w.Failures = 0 })
+			continue
+		}
+
+		var err error
+		for _, u := range urls {
+			if err = m.ping(ctx, client, u); err != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var failures int
+		m.setWatchdog(func(w *types.TunnelWatchdogStatus) {
+			w.LastCheck = time.Now()
+			if err == nil {
+				w.Failures, w.LastError = 0, ""
+				return
+			}
+			w.Failures++
+			w.LastError = err.Error()
+			failures = w.Failures
+		})
+		if err == nil {
+			continue
+		}
+
+		m.logger.Printf("[tunnel] watchdog check failed (%d/%d): %v", failures, cfg.FailureThreshold, err)
+		if failures < cfg.FailureThreshold {
+			continue
+		}
+
+		reason := fmt.Sprintf("%d failed checks in a row, last: %v", failures, err)
+		m.logger.Printf("[tunnel] watchdog restarting the tunnel after %s", reason)
+		m.setWatchdog(func(w *types.TunnelWatchdogStatus) {
+			w.Failures = 0
+			w.Restarts++
+			w.LastRestart, w.RestartReason = time.Now(), reason
+		})
+		m.mu.RLock()
+		handler := m.handler
+		m.mu.RUnlock()
+		if err := m.Restart(handler); err != nil {
+			m.logger.Printf("[tunnel] watchdog restart failed: %v", err)
+		}
+		return // Restart started a new watchdog
+	}
+}
+
+// watchedURLs returns the public URLs of the active endpoints, or false
+// while the tunnel is down or one of its endpoints is reconnecting
+func (m *Manager) watchedURLs() ([]string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var urls []string
+	for _, e := range m.endpoints {
+		switch {
+		case e.status.State == types.TunnelStateReconnecting:
+			return nil, false
+		case e.status.Active && e.status.PublicURL != "":
+			urls = append(urls, e.status.PublicURL)
+		}
+	}
+	return urls, len(urls) > 0
+}
+
+// ping requests PingPath through a public URL, and fails unless hz answered
+func (m *Manager) ping(ctx context.Context, client *http.Client, publicURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(publicURL, "/")+PingPath, nil)
+	if err != nil {
+		return err
+	}
+	// Skip the interstitial pages of ngrok's free domains and localtunnel.me
+	req.Header.Set("ngrok-skip-browser-warning", "1")
+	req.Header.Set("bypass-tunnel-reminder", "1")
+
+	m.mu.RLock()
+	logins := m.config.BasicAuth
+	m.mu.RUnlock()
+	if len(logins) > 0 {
+		user, password, _ := strings.Cut(logins[0], ":")
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.Header.Get(PingHeader) == "" {
+		return fmt.Errorf("%s answered %s without reaching hz", publicURL, resp.Status)
+	}
+	return nil
+}
+
+// setWatchdog changes the watchdog's status
+func (m *Manager) setWatchdog(change func(*types.TunnelWatchdogStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change(&m.watchdog)
+}
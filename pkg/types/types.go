@@ -2,10 +2,18 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
 )
 
 // HealthStatus represents service health state
@@ -15,48 +23,382 @@ const (
 	HealthStatusHealthy   HealthStatus = "healthy"
 	HealthStatusUnhealthy HealthStatus = "unhealthy"
 	HealthStatusUnknown   HealthStatus = "unknown"
+	HealthStatusPaused    HealthStatus = "paused"   // checks suspended by Registry.Pause
+	HealthStatusDegraded  HealthStatus = "degraded" // checks pass but slower than degradedAfter
 )
 
 // Service represents a backend service that can receive proxied requests
 type Service struct {
-	Name      string            `yaml:"name" json:"name"`
-	Target    string            `yaml:"target" json:"target"`
+	Name      string            `yaml:"name" json:"name" desc:"Unique service name"`
+	Target    string            `yaml:"target" json:"target" desc:"Backend URL or port, like http://localhost:8080"`
 	TargetURL *url.URL          `yaml:"-" json:"-"`
-	Default   bool              `yaml:"default,omitempty" json:"default,omitempty"`
-	Health    *HealthConfig     `yaml:"health,omitempty" json:"health,omitempty"`
-	Routes    []RouteConfig     `yaml:"routes,omitempty" json:"routes,omitempty"`
-	Rewrite   *RewriteConfig    `yaml:"rewrite,omitempty" json:"rewrite,omitempty"`
-	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Default   bool              `yaml:"default,omitempty" json:"default,omitempty" desc:"Receive requests no route matches"`
+	Disabled  bool              `yaml:"disabled,omitempty" json:"disabled,omitempty" desc:"Keep the service in the config but don't register or route it"`
+	Health    *HealthConfig     `yaml:"health,omitempty" json:"health,omitempty" desc:"Health check settings"`
+	Routes    []RouteConfig     `yaml:"routes,omitempty" json:"routes,omitempty" desc:"Rules that send requests to this service"`
+	Rewrite   *RewriteConfig    `yaml:"rewrite,omitempty" json:"rewrite,omitempty" desc:"URL rewriting applied before proxying"`
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty" desc:"Headers added to proxied requests"`
+	WebSocket *WebSocketConfig  `yaml:"websocket,omitempty" json:"websocket,omitempty"`
+	Replay    *ReplayConfig     `yaml:"replay,omitempty" json:"replay,omitempty"`
+
+	// Command is a managed backend process hz starts, restarts when it
+	// crashes and stops on shutdown; it runs through the shell in Cwd
+	// (default: the config file's directory) with Env added
+	Command string            `yaml:"command,omitempty" json:"command,omitempty" desc:"Command hz runs and restarts as this service's backend"`
+	Cwd     string            `yaml:"cwd,omitempty" json:"cwd,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+
+	// DependsOn names services that must pass their health checks before this
+	// service is first checked
+	DependsOn []string `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty" desc:"Services that must be healthy before this one is checked"`
+
+	// CaseInsensitive applies case-insensitive path matching to all routes
+	CaseInsensitive bool `yaml:"caseInsensitive,omitempty" json:"caseInsensitive,omitempty"`
+
+	// Concurrency limiting
+	MaxConcurrent int          `yaml:"maxConcurrent,omitempty" json:"maxConcurrent,omitempty" desc:"Most requests proxied at once (0 = unlimited)"`
+	Queue         *QueueConfig `yaml:"queue,omitempty" json:"queue,omitempty"`
+
+	// Maintenance answers requests with 503 instead of proxying them; it can
+	// be toggled at runtime with SetMaintenance
+	Maintenance *MaintenanceConfig `yaml:"maintenance,omitempty" json:"maintenance,omitempty"`
+
+	// Dynamic marks services registered by discovery rather than the config file
+	Dynamic bool `yaml:"-" json:"dynamic,omitempty"`
 
 	// Runtime state
-	Status       HealthStatus `yaml:"-" json:"status"`
-	LastCheck    time.Time    `yaml:"-" json:"lastCheck,omitempty"`
-	RequestCount int64        `yaml:"-" json:"requestCount"`
-	ErrorCount   int64        `yaml:"-" json:"errorCount"`
-	mu           sync.RWMutex `yaml:"-" json:"-"`
+	Status       HealthStatus    `yaml:"-" json:"status"`
+	LastCheck    time.Time       `yaml:"-" json:"lastCheck,omitempty"`
+	RequestCount int64           `yaml:"-" json:"requestCount"`
+	ErrorCount   int64           `yaml:"-" json:"errorCount"`
+	InFlight     int64           `yaml:"-" json:"inFlight"`
+	LastError    string          `yaml:"-" json:"lastError,omitempty"` // why health checks fail; cleared once healthy
+	LastCode     int             `yaml:"-" json:"lastStatusCode,omitempty"`
+	LastLatency  time.Duration   `yaml:"-" json:"lastLatency,omitempty"`
+	NextCheck    time.Time       `yaml:"-" json:"nextCheck,omitempty"`
+	Backoff      time.Duration   `yaml:"-" json:"backoff,omitempty"` // stretched check interval while failing, 0 if none
+	latencies    []time.Duration // recent check durations, oldest first
+	Failures     int             `yaml:"-" json:"consecutiveFailures,omitempty"`
+	Successes    int             `yaml:"-" json:"consecutiveSuccesses,omitempty"`
+	slow, fast   int             // consecutive passing checks over and under degradedAfter
+	ready        bool            // has been healthy or degraded at least once
+	mu           sync.RWMutex    `yaml:"-" json:"-"`
+}
+
+// Duration is a time.Duration written as a string like 30s or 1m30s in
+// config files and JSON. Plain integers are read as nanoseconds, which is how
+// older versions of hz saved some durations.
+type Duration time.Duration
+
+// Duration returns d as a time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String formats d like time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := parseDuration(value.Value, value.Kind == yaml.ScalarNode && value.Tag == "!!int")
+	if err != nil {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %s", value.Line, err)}}
+	}
+	*d = parsed
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		parsed, err := parseDuration(string(data), true)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	}
+	parsed, err := parseDuration(s, false)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// parseDuration parses a duration string, or nanoseconds when integer is set
+func parseDuration(s string, integer bool) (Duration, error) {
+	if integer {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", s)
+		}
+		return Duration(n), nil
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (use a value like 500ms, 30s or 5m)", s)
+	}
+	return Duration(parsed), nil
 }
 
 // HealthConfig defines health check parameters for a service
 type HealthConfig struct {
-	Path     string        `yaml:"path" json:"path"`
-	Interval time.Duration `yaml:"interval" json:"interval"`
-	Timeout  time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Type     string   `yaml:"type,omitempty" json:"type,omitempty" enum:"http,websocket,tcp,exec" desc:"Check type (default http)"`
+	Path     string   `yaml:"path,omitempty" json:"path,omitempty" desc:"Path requested by HTTP and WebSocket checks"`
+	Interval Duration `yaml:"interval" json:"interval" desc:"Time between checks, like 30s"`
+	Timeout  Duration `yaml:"timeout,omitempty" json:"timeout,omitempty" desc:"Longest time a check may take, like 5s"`
+
+	// InitialDelay postpones the first check, e.g. for services that boot slowly
+	InitialDelay Duration `yaml:"initialDelay,omitempty" json:"initialDelay,omitempty"`
+
+	// Consecutive results needed to change status (defaults 3 and 1)
+	UnhealthyThreshold int `yaml:"unhealthyThreshold,omitempty" json:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int `yaml:"healthyThreshold,omitempty" json:"healthyThreshold,omitempty"`
+
+	// MaxInterval caps the check interval, which doubles while a service
+	// stays unhealthy (default 5m; set it to Interval to disable backoff)
+	MaxInterval Duration `yaml:"maxInterval,omitempty" json:"maxInterval,omitempty"`
+
+	// DegradedAfter marks passing checks slower than this as degraded (0 = off)
+	DegradedAfter Duration `yaml:"degradedAfter,omitempty" json:"degradedAfter,omitempty"`
+
+	// DependencyTimeout caps how long the first check waits for the services
+	// in DependsOn (default 1m); RequireDependencies fails checks while one of
+	// them is unhealthy
+	DependencyTimeout   Duration `yaml:"dependencyTimeout,omitempty" json:"dependencyTimeout,omitempty"`
+	RequireDependencies bool     `yaml:"requireDependencies,omitempty" json:"requireDependencies,omitempty"`
+
+	Method       string            `yaml:"method,omitempty" json:"method,omitempty"`                                                                            // default GET
+	Headers      map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`                                                                          // e.g. Authorization
+	ExpectStatus []string          `yaml:"expectStatus,omitempty" json:"expectStatus,omitempty" desc:"Healthy status codes, ranges (200-299) or classes (2xx)"` // codes, ranges (200-299) or classes (2xx); default 2xx
+
+	// ReadinessGate answers requests with 503 until the service first turns
+	// healthy, instead of forwarding them to a backend that is still booting
+	ReadinessGate bool `yaml:"readinessGate,omitempty" json:"readinessGate,omitempty"`
+
+	// ViaProxy sends HTTP checks through hz's own routing, so Path is a public
+	// path and route rewrites and injected headers apply
+	ViaProxy bool `yaml:"viaProxy,omitempty" json:"viaProxy,omitempty"`
+
+	// Client options for HTTP checks, which always dial directly (no HTTP_PROXY)
+	TLS             *HealthTLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+	FollowRedirects *bool            `yaml:"followRedirects,omitempty" json:"followRedirects,omitempty"` // default true
+
+	// Body assertions, checked after the status code
+	ExpectBodyContains string         `yaml:"expectBodyContains,omitempty" json:"expectBodyContains,omitempty"`
+	ExpectJSON         *JSONAssertion `yaml:"expectJson,omitempty" json:"expectJson,omitempty"`
+
+	// Ping makes websocket checks send a ping and wait for the pong after the
+	// handshake
+	Ping bool `yaml:"ping,omitempty" json:"ping,omitempty"`
+
+	// Exec checks run Command (through sh -c with Shell) in Dir, which defaults
+	// to the config file's directory; exit code 0 means healthy
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+	Shell   bool     `yaml:"shell,omitempty" json:"shell,omitempty"`
+	Dir     string   `yaml:"dir,omitempty" json:"dir,omitempty"`
+}
+
+// Health check types
+const (
+	HealthCheckHTTP      = "http"
+	HealthCheckExec      = "exec"
+	HealthCheckWebSocket = "websocket"
+	HealthCheckTCP       = "tcp"
+)
+
+// Enabled reports whether the health check has something to run
+func (h *HealthConfig) Enabled() bool {
+	if h == nil {
+		return false
+	}
+	if h.Type == HealthCheckExec {
+		return len(h.Command) > 0
+	}
+	if h.Type == HealthCheckWebSocket {
+		return true // path defaults to /
+	}
+	if h.Type == HealthCheckTCP {
+		return true
+	}
+	return h.Path != ""
+}
+
+// WebSocketURL returns u with its scheme switched to the WebSocket equivalent:
+// http and h2c become ws, https becomes wss
+func WebSocketURL(u url.URL) url.URL {
+	switch u.Scheme {
+	case "http", "h2c":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	return u
+}
+
+// HealthTLSConfig configures certificate verification for https health checks
+type HealthTLSConfig struct {
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty" json:"insecureSkipVerify,omitempty"`
+	CAFile             string `yaml:"caFile,omitempty" json:"caFile,omitempty"` // PEM bundle, relative to the config file
+}
+
+// JSONAssertion requires the value at a dotted path ("$.status", "checks.0.state")
+// of a JSON response body to equal a string
+type JSONAssertion struct {
+	Path   string `yaml:"path" json:"path"`
+	Equals string `yaml:"equals" json:"equals"`
 }
 
 // RouteConfig defines how requests are matched to a service
 type RouteConfig struct {
-	Path      string `yaml:"path,omitempty" json:"path,omitempty"`
-	Header    string `yaml:"header,omitempty" json:"header,omitempty"`
-	Subdomain string `yaml:"subdomain,omitempty" json:"subdomain,omitempty"`
-	Method    string `yaml:"method,omitempty" json:"method,omitempty"`
-	Priority  int    `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Path      string   `yaml:"path,omitempty" json:"path,omitempty" desc:"Path pattern, like /api/* or /users/{id}"`
+	Header    string   `yaml:"header,omitempty" json:"header,omitempty" desc:"Header match: name=value, name, !name or name=~regex"`
+	Subdomain string   `yaml:"subdomain,omitempty" json:"subdomain,omitempty" desc:"Subdomain of the request host"`
+	Host      string   `yaml:"host,omitempty" json:"host,omitempty" desc:"Request host, like app.test"`
+	Query     string   `yaml:"query,omitempty" json:"query,omitempty"`
+	Method    string   `yaml:"method,omitempty" json:"method,omitempty"` // Deprecated: use Methods
+	Methods   []string `yaml:"methods,omitempty" json:"methods,omitempty" desc:"HTTP methods the route matches"`
+
+	// GRPCService matches gRPC calls to a service ("users.UserService") or
+	// package ("orders.*"), checking the application/grpc content type
+	GRPCService string `yaml:"grpcService,omitempty" json:"grpcService,omitempty"`
+
+	// ClientCIDR matches the effective client IP (CIDRs or bare IPs)
+	ClientCIDR []string `yaml:"clientCidr,omitempty" json:"clientCidr,omitempty"`
+
+	// Exclusions: a route matches only if none of these apply
+	ExcludePath    string   `yaml:"excludePath,omitempty" json:"excludePath,omitempty"`
+	ExcludeMethods []string `yaml:"excludeMethods,omitempty" json:"excludeMethods,omitempty"`
+
+	Priority        int  `yaml:"priority,omitempty" json:"priority,omitempty" desc:"Higher priorities are matched first"`
+	Prefix          bool `yaml:"prefix,omitempty" json:"prefix,omitempty"` // plain paths also match sub-paths
+	CaseInsensitive bool `yaml:"caseInsensitive,omitempty" json:"caseInsensitive,omitempty"`
+
+	// AnyOf entries are OR-ed together; the other fields are AND-ed with the group
+	AnyOf []RouteConfig `yaml:"anyOf,omitempty" json:"anyOf,omitempty"`
+
+	// Weighted traffic splitting between services
+	Split        []SplitTarget `yaml:"split,omitempty" json:"split,omitempty"`
+	StickyHeader string        `yaml:"stickyHeader,omitempty" json:"stickyHeader,omitempty"`
+
+	// Rewrite replaces the service's rewrite for requests matched by this
+	// route; an empty block passes the path through untouched
+	Rewrite *RewriteConfig `yaml:"rewrite,omitempty" json:"rewrite,omitempty"`
+
+	// Maintenance puts only this route into maintenance
+	Maintenance *MaintenanceConfig `yaml:"maintenance,omitempty" json:"maintenance,omitempty"`
+}
+
+// SplitTarget is one weighted destination of a split route
+type SplitTarget struct {
+	Service string `yaml:"service" json:"service"`
+	Weight  int    `yaml:"weight" json:"weight"`
 }
 
 // RewriteConfig defines URL rewriting rules
 type RewriteConfig struct {
-	Prefix      string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
-	StripPrefix string `yaml:"stripPrefix,omitempty" json:"stripPrefix,omitempty"`
-	Replace     string `yaml:"replace,omitempty" json:"replace,omitempty"`
+	Prefix        string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	StripPrefix   string `yaml:"stripPrefix,omitempty" json:"stripPrefix,omitempty" desc:"Prefix removed from the path"`
+	StripSegments int    `yaml:"stripSegments,omitempty" json:"stripSegments,omitempty"` // drop the first N path segments
+	Replace       string `yaml:"replace,omitempty" json:"replace,omitempty"`
+
+	// Regex rewrites the path (and optionally query) using capture groups,
+	// e.g. regex ^/api/v1/users/(\d+)$ with replacement /internal/users?id=$1
+	Regex         string         `yaml:"regex,omitempty" json:"regex,omitempty" desc:"Regular expression applied to the path; use with replacement"`
+	Replacement   string         `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	RegexCompiled *regexp.Regexp `yaml:"-" json:"-"`
+}
+
+// MaintenanceConfig makes hz answer requests with 503 Service Unavailable
+type MaintenanceConfig struct {
+	Enabled    bool   `yaml:"enabled" json:"enabled"`
+	Message    string `yaml:"message,omitempty" json:"message,omitempty"`
+	RetryAfter int    `yaml:"retryAfter,omitempty" json:"retryAfter,omitempty"` // seconds, sent as Retry-After
+}
+
+// QueueConfig defines how requests wait when a service is at its concurrency limit
+type QueueConfig struct {
+	Size    int      `yaml:"size" json:"size"`
+	Timeout Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// WebSocketConfig defines WebSocket proxying limits for a service
+type WebSocketConfig struct {
+	MaxMessageSize    ByteSize `yaml:"maxMessageSize,omitempty" json:"maxMessageSize,omitempty"`
+	EnableCompression bool     `yaml:"enableCompression,omitempty" json:"enableCompression,omitempty"`
+	ReadBufferSize    ByteSize `yaml:"readBufferSize,omitempty" json:"readBufferSize,omitempty"`
+	WriteBufferSize   ByteSize `yaml:"writeBufferSize,omitempty" json:"writeBufferSize,omitempty"`
+	ExcludeFromLimit  bool     `yaml:"excludeFromLimit,omitempty" json:"excludeFromLimit,omitempty"`
+}
+
+// ReplayConfig defines how requests are matched against a recorded session
+// when a service target uses the replay:// scheme
+type ReplayConfig struct {
+	MatchHeaders  []string `yaml:"matchHeaders,omitempty" json:"matchHeaders,omitempty"`
+	IgnoreHeaders []string `yaml:"ignoreHeaders,omitempty" json:"ignoreHeaders,omitempty"`
+	IgnoreQuery   []string `yaml:"ignoreQuery,omitempty" json:"ignoreQuery,omitempty"`
+}
+
+// ByteSize is a size in bytes that accepts human units like "64KB" or "1MB"
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// UnmarshalText parses plain integers or values with a B/KB/MB/GB suffix
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+	multiplier := ByteSize(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid byte size: %q", string(text))
+	}
+	*b = ByteSize(n) * multiplier
+	return nil
+}
+
+// MarshalText writes the size using the largest unit that divides it evenly
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// String returns the size in human-readable form
+func (b ByteSize) String() string {
+	for _, unit := range byteUnits {
+		if b != 0 && b%unit.size == 0 {
+			return fmt.Sprintf("%d%s", b/unit.size, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
 }
 
 // Route represents a compiled route ready for matching
@@ -65,47 +407,288 @@ type Route struct {
 	Service   *Service
 	Config    RouteConfig
 	MatchFunc func(r *http.Request) bool
+	Captures  func(r *http.Request) map[string]string // named path captures, nil if none
+	Pick      func(r *http.Request) *Service          // chooses the service for split routes
+	Fallback  bool                                    // the default service, matched when no route did
+	Rewrite   *RewriteConfig                          // rewrite rules in effect, regex compiled; set by the router
 }
 
 // TunnelConfig defines ngrok tunnel settings
 type TunnelConfig struct {
-	Enabled   bool   `yaml:"enabled" json:"enabled"`
-	Provider  string `yaml:"provider" json:"provider"`
-	AuthToken string `yaml:"authtoken" json:"authtoken"`
-	Domain    string `yaml:"domain,omitempty" json:"domain,omitempty"`
-	Region    string `yaml:"region,omitempty" json:"region,omitempty"`
+	Enabled   bool   `yaml:"enabled" json:"enabled" desc:"Start the tunnel with hz start"`
+	Provider  string `yaml:"provider" json:"provider" enum:"ngrok,localtunnel,ssh" desc:"Tunnel provider: ngrok (default), localtunnel, which needs no account, or ssh, a reverse tunnel through your own host"`
+	AuthToken string `yaml:"authtoken" json:"authtoken" desc:"Provider auth token; use ${NGROK_AUTHTOKEN} to keep it out of the file"`
+
+	// AuthTokenFile and Keyring keep the token out of the config file; they
+	// are tried in that order when AuthToken is empty
+	AuthTokenFile string `yaml:"authtokenFile,omitempty" json:"authtokenFile,omitempty" desc:"File holding the auth token, like ~/.hz/ngrok_token (must not be world-readable)"`
+	Keyring       bool   `yaml:"keyring,omitempty" json:"keyring,omitempty" desc:"Read the auth token saved with 'hz tunnel --token X --save-keyring'"`
+
+	// APIKey lets hz list and stop the account's ngrok sessions; it is not
+	// the auth token. NGROK_API_KEY is used when empty.
+	APIKey string `yaml:"apiKey,omitempty" json:"apiKey,omitempty" desc:"ngrok API key for listing and stopping sessions (default: $NGROK_API_KEY)"`
+
+	Domain string `yaml:"domain,omitempty" json:"domain,omitempty" desc:"Reserved domain for the tunnel"`
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+
+	// BasicAuth makes ngrok ask for one of these "user:password" logins
+	// before a request reaches hz
+	BasicAuth []string `yaml:"basicAuth,omitempty" json:"basicAuth,omitempty" desc:"user:password logins ngrok requires at its edge"`
+
+	// Server is the localtunnel server, for self-hosted ones
+	Server string `yaml:"server,omitempty" json:"server,omitempty" desc:"localtunnel server URL (default https://localtunnel.me)"`
+
+	// SSH is the host the ssh provider forwards a port of, like ssh -R
+	SSH *TunnelSSH `yaml:"ssh,omitempty" json:"ssh,omitempty" desc:"Host and login of the ssh provider's reverse tunnel"`
+
+	// Edge options of ngrok endpoints: gzip responses, and stop sending
+	// requests while this ratio of responses are 5xx errors
+	Compression    bool    `yaml:"compression,omitempty" json:"compression,omitempty" desc:"Gzip responses at ngrok's edge"`
+	CircuitBreaker float64 `yaml:"circuitBreaker,omitempty" json:"circuitBreaker,omitempty" desc:"5xx response ratio (0-1) at which ngrok stops sending requests"`
+
+	// Schemes the tunnel is reachable on, https only by default. With both,
+	// ForceHTTPSRedirect sends http requests to https before routing.
+	Schemes            []string `yaml:"schemes,omitempty" json:"schemes,omitempty" desc:"Public schemes of ngrok endpoints: [https] (default), [http] or [http, https]"`
+	ForceHTTPSRedirect bool     `yaml:"forceHttpsRedirect,omitempty" json:"forceHttpsRedirect,omitempty" desc:"Redirect http tunnel requests to https (308) when both schemes are exposed"`
+
+	// IPPolicy limits which client addresses reach the tunnel
+	IPPolicy *TunnelIPPolicy `yaml:"ipPolicy,omitempty" json:"ipPolicy,omitempty" desc:"Client CIDRs allowed or denied through the tunnel"`
+
+	// Endpoints opens several tunnels at once, each optionally bound to a
+	// service, instead of one tunnel at Domain
+	Endpoints []TunnelEndpoint `yaml:"endpoints,omitempty" json:"endpoints,omitempty" desc:"Several tunnels, each at its own domain and optionally for one service"`
+
+	// Watchdog checks the tunnel end to end and restarts it when it stops
+	// answering
+	Watchdog *TunnelWatchdog `yaml:"watchdog,omitempty" json:"watchdog,omitempty" desc:"Restart the tunnel when requests through its public URL stop reaching hz"`
+
+	// URLFile holds the public URL while the tunnel is active, for scripts
+	URLFile string `yaml:"urlFile,omitempty" json:"urlFile,omitempty" desc:"File kept holding the public URL while the tunnel is active, like ./.hz/tunnel-url"`
+}
+
+// TunnelWatchdog requests /__hz/ping through the public URL every Interval
+// and restarts the tunnel after FailureThreshold failures in a row
+type TunnelWatchdog struct {
+	Enabled          bool     `yaml:"enabled" json:"enabled"`
+	Interval         Duration `yaml:"interval,omitempty" json:"interval,omitempty" desc:"Time between checks (default 30s)"`
+	Timeout          Duration `yaml:"timeout,omitempty" json:"timeout,omitempty" desc:"Longest time a check may take (default 10s)"`
+	FailureThreshold int      `yaml:"failureThreshold,omitempty" json:"failureThreshold,omitempty" desc:"Failed checks in a row that restart the tunnel (default 3)"`
+}
+
+// TunnelSSH is a reverse tunnel through an SSH server: the server listens on
+// RemotePort and forwards its connections to hz
+type TunnelSSH struct {
+	Host                  string `yaml:"host" json:"host" desc:"SSH server as host or host:port (default port 22)"`
+	User                  string `yaml:"user,omitempty" json:"user,omitempty" desc:"Login user (default: the current user)"`
+	KeyFile               string `yaml:"keyFile,omitempty" json:"keyFile,omitempty" desc:"Private key file (default: the SSH agent, then ~/.ssh/id_ed25519, id_ecdsa and id_rsa)"`
+	RemotePort            int    `yaml:"remotePort" json:"remotePort" desc:"Port the server listens on for the public URL (0: the server picks one)"`
+	KnownHostsFile        string `yaml:"knownHostsFile,omitempty" json:"knownHostsFile,omitempty" desc:"known_hosts file to verify the server's key (default ~/.ssh/known_hosts)"`
+	InsecureIgnoreHostKey bool   `yaml:"insecureIgnoreHostKey,omitempty" json:"insecureIgnoreHostKey,omitempty" desc:"Accept any server key, for throwaway hosts only"`
+}
+
+// TunnelEndpoint is one of several tunnels. Requests to an endpoint with a
+// service all go to that service; the others are routed as usual.
+type TunnelEndpoint struct {
+	Domain  string `yaml:"domain,omitempty" json:"domain,omitempty" desc:"Reserved domain of this tunnel (default: a random one)"`
+	Service string `yaml:"service,omitempty" json:"service,omitempty" desc:"Service that gets every request of this tunnel"`
 }
 
+// TunnelIPPolicy restricts tunnel clients by address. Deny wins; with allow
+// entries, other addresses are refused.
+type TunnelIPPolicy struct {
+	Allow []string `yaml:"allow,omitempty" json:"allow,omitempty" desc:"Only these CIDRs or IPs may use the tunnel"`
+	Deny  []string `yaml:"deny,omitempty" json:"deny,omitempty" desc:"These CIDRs or IPs may not use the tunnel"`
+}
+
+// TunnelState is the lifecycle state of the tunnel
+type TunnelState string
+
+const (
+	TunnelStateStopped      TunnelState = "stopped"
+	TunnelStateActive       TunnelState = "active"
+	TunnelStateReconnecting TunnelState = "reconnecting" // lost, retrying with backoff
+	TunnelStateFailed       TunnelState = "failed"       // could not be opened
+	TunnelStatePartial      TunnelState = "partial"      // some endpoints are down
+)
+
 // TunnelStatus represents current tunnel state
 type TunnelStatus struct {
-	Active    bool      `json:"active"`
-	PublicURL string    `json:"publicUrl,omitempty"`
-	StartedAt time.Time `json:"startedAt,omitempty"`
-	Error     string    `json:"error,omitempty"`
+	State     TunnelState `json:"state"`
+	Active    bool        `json:"active"`
+	PublicURL string      `json:"publicUrl,omitempty"`
+	URL       *url.URL    `json:"-"` // PublicURL parsed, for its scheme and host
+	StartedAt time.Time   `json:"startedAt,omitempty"`
+	Error     string      `json:"error,omitempty"`
+
+	// While reconnecting: attempts made so far and when the next one starts
+	Attempts    int       `json:"reconnectAttempts,omitempty"`
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+
+	// Endpoints has the state of each of tunnel.endpoints, when set
+	Endpoints []TunnelEndpointStatus `json:"endpoints,omitempty"`
+
+	// Traffic counts what came through the tunnel, across all endpoints
+	Traffic *TunnelTraffic `json:"traffic,omitempty"`
+
+	// Watchdog has the watchdog's checks and restarts, when enabled
+	Watchdog *TunnelWatchdogStatus `json:"watchdog,omitempty"`
+}
+
+// TunnelWatchdogStatus is what the tunnel watchdog found
+type TunnelWatchdogStatus struct {
+	Failures      int       `json:"consecutiveFailures"`
+	LastCheck     time.Time `json:"lastCheck,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	Restarts      int       `json:"restarts"` // since hz started
+	LastRestart   time.Time `json:"lastRestart,omitempty"`
+	RestartReason string    `json:"restartReason,omitempty"`
+}
+
+// TunnelTraffic counts tunnel traffic. Lifetime counters start when hz
+// starts and keep counting across reconnects and restarts of the tunnel.
+type TunnelTraffic struct {
+	LifetimeConnections int64 `json:"lifetimeConnections"` // accepted
+	OpenConnections     int64 `json:"openConnections"`
+	LifetimeBytesIn     int64 `json:"lifetimeBytesIn"` // read from tunnel clients
+	LifetimeBytesOut    int64 `json:"lifetimeBytesOut"`
+	LifetimeRequests    int64 `json:"lifetimeRequests"` // served by the tunnel-side server
+}
+
+// TunnelEndpointStatus is the state of one of tunnel.endpoints
+type TunnelEndpointStatus struct {
+	Domain  string `json:"domain,omitempty"`
+	Service string `json:"service,omitempty"`
+	TunnelStatus
 }
 
 // ServerConfig defines the proxy server settings
 type ServerConfig struct {
-	Port         int           `yaml:"port" json:"port"`
-	Host         string        `yaml:"host" json:"host"`
-	ReadTimeout  time.Duration `yaml:"readTimeout,omitempty" json:"readTimeout,omitempty"`
-	WriteTimeout time.Duration `yaml:"writeTimeout,omitempty" json:"writeTimeout,omitempty"`
+	Port         int    `yaml:"port" json:"port" desc:"Port hz listens on (default 3000)"`
+	Host         string `yaml:"host" json:"host" desc:"Address hz listens on (default 0.0.0.0)"`
+	DebugHeaders bool   `yaml:"debugHeaders,omitempty" json:"debugHeaders,omitempty"` // add X-Hz-* route headers to responses
+
+	// LogBuffer is how many recent log lines hz keeps for hz logs
+	LogBuffer int `yaml:"logBuffer,omitempty" json:"logBuffer,omitempty" desc:"Recent log lines kept for hz logs (default 1000)"`
+
+	// Listener timeouts, for the local server and the tunnel alike.
+	// ReadTimeout and WriteTimeout bound the whole request and response, so
+	// they are off by default: anything else cuts SSE streams, long polls and
+	// large uploads off mid-way. ReadHeaderTimeout (default 10s) and
+	// IdleTimeout (default 2m) guard against stalled clients instead.
+	ReadHeaderTimeout Duration `yaml:"readHeaderTimeout,omitempty" json:"readHeaderTimeout,omitempty" desc:"Longest time to read request headers (default 10s)"`
+	ReadTimeout       Duration `yaml:"readTimeout,omitempty" json:"readTimeout,omitempty" desc:"Longest time to read a whole request, body included (default 0: no limit)"`
+	WriteTimeout      Duration `yaml:"writeTimeout,omitempty" json:"writeTimeout,omitempty" desc:"Longest time to write a whole response (default 0: no limit, so streams stay open)"`
+	IdleTimeout       Duration `yaml:"idleTimeout,omitempty" json:"idleTimeout,omitempty" desc:"How long an idle keep-alive connection stays open (default 2m)"`
+
+	// StrictRouting answers unmatched requests with a 404 instead of the
+	// default service; StrictPrefixes does the same only under these paths
+	StrictRouting  bool     `yaml:"strictRouting,omitempty" json:"strictRouting,omitempty" desc:"Answer unmatched requests with 404 instead of the default service"`
+	StrictPrefixes []string `yaml:"strictPrefixes,omitempty" json:"strictPrefixes,omitempty"`
+
+	// TrailingSlash is the trailing-slash policy: strict (default), ignore or redirect
+	TrailingSlash string `yaml:"trailingSlash,omitempty" json:"trailingSlash,omitempty" enum:"strict,ignore,redirect" desc:"How /users and /users/ relate (default strict)"`
+
+	ForwardProxy *ForwardProxyConfig `yaml:"forwardProxy,omitempty" json:"forwardProxy,omitempty"`
+}
+
+// ApplyTimeouts sets the listener timeouts of srv from the configuration
+func (s ServerConfig) ApplyTimeouts(srv *http.Server) {
+	srv.ReadHeaderTimeout = s.ReadHeaderTimeout.Duration()
+	srv.ReadTimeout = s.ReadTimeout.Duration()
+	srv.WriteTimeout = s.WriteTimeout.Duration()
+	srv.IdleTimeout = s.IdleTimeout.Duration()
+}
+
+// ForwardProxyConfig enables an HTTP forward-proxy listener restricted to
+// configured services, for tools that only support a system proxy
+type ForwardProxyConfig struct {
+	Port int    `yaml:"port" json:"port"`
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
 }
 
 // LoggingConfig defines logging settings
 type LoggingConfig struct {
-	Level  string `yaml:"level" json:"level"`
-	Format string `yaml:"format" json:"format"`
+	Level  string `yaml:"level" json:"level" enum:"debug,info,warn,error" desc:"Log level (default info)"`
+	Format string `yaml:"format" json:"format" enum:"text,json" desc:"Log format (default text)"`
 	Output string `yaml:"output,omitempty" json:"output,omitempty"`
 }
 
 // Config is the root configuration structure
 type Config struct {
-	Version  string         `yaml:"version" json:"version"`
-	Server   ServerConfig   `yaml:"server" json:"server"`
-	Tunnel   TunnelConfig   `yaml:"tunnel" json:"tunnel"`
-	Services []*Service     `yaml:"services" json:"services"`
-	Logging  LoggingConfig  `yaml:"logging" json:"logging"`
+	Version   string           `yaml:"version" json:"version" desc:"Config format version"`
+	Include   []string         `yaml:"include,omitempty" json:"include,omitempty" desc:"Glob patterns of files whose services and settings are merged into this one"` // globs of files merged into this one
+	Server    ServerConfig     `yaml:"server" json:"server" desc:"Proxy server settings"`
+	Tunnel    TunnelConfig     `yaml:"tunnel" json:"tunnel" desc:"Public tunnel settings"`
+	Services  []*Service       `yaml:"services" json:"services" desc:"Backends hz routes requests to"`
+	Defaults  *ServiceDefaults `yaml:"defaults,omitempty" json:"defaults,omitempty" desc:"Settings every service inherits unless it sets them itself"`
+	Routing   RoutingConfig    `yaml:"routing,omitempty" json:"routing,omitempty" desc:"Routing settings"`
+	Discovery DiscoveryConfig  `yaml:"discovery,omitempty" json:"discovery,omitempty" desc:"Sources that register services at runtime"`
+	Logging   LoggingConfig    `yaml:"logging" json:"logging" desc:"Logging settings"`
+
+	// Extensions holds free-form user annotations that hz ignores
+	Extensions map[string]interface{} `yaml:"extensions,omitempty" json:"extensions,omitempty" desc:"Free-form annotations hz ignores"`
+}
+
+// ActiveServices returns the services that are not disabled
+func (c *Config) ActiveServices() []*Service {
+	active := make([]*Service, 0, len(c.Services))
+	for _, svc := range c.Services {
+		if !svc.Disabled {
+			active = append(active, svc)
+		}
+	}
+	return active
+}
+
+// ServiceDefaults holds service settings every service inherits. A service
+// overrides them key by key: health.path in a service keeps the default
+// health.interval, and headers are merged by name.
+type ServiceDefaults struct {
+	Health          *HealthConfig     `yaml:"health,omitempty" json:"health,omitempty" desc:"Health check settings for every service"`
+	Headers         map[string]string `yaml:"headers,omitempty" json:"headers,omitempty" desc:"Headers added to every service's proxied requests"`
+	WebSocket       *WebSocketConfig  `yaml:"websocket,omitempty" json:"websocket,omitempty"`
+	Replay          *ReplayConfig     `yaml:"replay,omitempty" json:"replay,omitempty"`
+	CaseInsensitive bool              `yaml:"caseInsensitive,omitempty" json:"caseInsensitive,omitempty"`
+	MaxConcurrent   int               `yaml:"maxConcurrent,omitempty" json:"maxConcurrent,omitempty"`
+	Queue           *QueueConfig      `yaml:"queue,omitempty" json:"queue,omitempty"`
+}
+
+// DiscoveryConfig enables registering services found at runtime
+type DiscoveryConfig struct {
+	Docker *DockerDiscoveryConfig `yaml:"docker,omitempty" json:"docker,omitempty"`
+	Scan   *ScanDiscoveryConfig   `yaml:"scan,omitempty" json:"scan,omitempty"`
+}
+
+// ScanDiscoveryConfig sets the local ports 'hz start' probes for dev servers
+type ScanDiscoveryConfig struct {
+	Ports   []int    `yaml:"ports,omitempty" json:"ports,omitempty"`     // default: common dev ports
+	Timeout Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"` // per port, default 300ms
+}
+
+// DockerDiscoveryConfig registers running containers that carry hz labels
+type DockerDiscoveryConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	LabelPrefix string `yaml:"labelPrefix,omitempty" json:"labelPrefix,omitempty"` // default "hz"
+	Host        string `yaml:"host,omitempty" json:"host,omitempty"`               // default $DOCKER_HOST or unix:///var/run/docker.sock
+}
+
+// Enabled reports whether any source that registers services is turned on
+func (d DiscoveryConfig) Enabled() bool {
+	return d.Docker != nil && d.Docker.Enabled
+}
+
+// Trailing-slash policies for server.trailingSlash
+const (
+	TrailingSlashStrict   = "strict"   // /users and /users/ are different paths
+	TrailingSlashIgnore   = "ignore"   // both forms match the same routes
+	TrailingSlashRedirect = "redirect" // 308 from /users/ to /users before routing
+)
+
+// RoutingConfig defines global route matching behaviour
+type RoutingConfig struct {
+	// StrictPaths makes plain path patterns match exactly (or on segment
+	// boundaries with prefix: true) instead of the legacy loose prefix match
+	StrictPaths bool `yaml:"strictPaths,omitempty" json:"strictPaths,omitempty"`
 }
 
 // RegistryEvent represents a change in the service registry
@@ -126,13 +709,41 @@ const (
 
 // ProxyStats holds proxy performance metrics
 type ProxyStats struct {
-	TotalRequests   int64         `json:"totalRequests"`
-	ActiveRequests  int64         `json:"activeRequests"`
-	TotalErrors     int64         `json:"totalErrors"`
-	AverageLatency  time.Duration `json:"averageLatency"`
-	BytesIn         int64         `json:"bytesIn"`
-	BytesOut        int64         `json:"bytesOut"`
-	WebSocketConns  int64         `json:"websocketConns"`
+	TotalRequests  int64         `json:"totalRequests"`
+	TunnelRequests int64         `json:"tunnelRequests"` // of TotalRequests, through the tunnel
+	LocalRequests  int64         `json:"localRequests"`  // of TotalRequests, from local clients
+	ActiveRequests int64         `json:"activeRequests"`
+	TotalErrors    int64         `json:"totalErrors"`
+	AverageLatency time.Duration `json:"averageLatency"`
+	BytesIn        int64         `json:"bytesIn"`
+	BytesOut       int64         `json:"bytesOut"`
+	WebSocketConns int64         `json:"websocketConns"`
+	ForwardConns   int64         `json:"forwardConns"`
+}
+
+// EffectiveRewrite returns the rewrite rules for requests matched by the route:
+// those the router resolved, or else its own if configured, otherwise the
+// service's
+func (r *Route) EffectiveRewrite() *RewriteConfig {
+	if r.Rewrite != nil {
+		return r.Rewrite
+	}
+	if r.Config.Rewrite != nil {
+		return r.Config.Rewrite
+	}
+	return r.Service.Rewrite
+}
+
+// ActiveMaintenance returns the maintenance settings in effect for the route,
+// the route's own before the service's, or nil if it is serving normally
+func (r *Route) ActiveMaintenance() *MaintenanceConfig {
+	if m := r.Config.Maintenance; m != nil && m.Enabled {
+		return m
+	}
+	if m := r.Service.GetMaintenance(); m != nil && m.Enabled {
+		return m
+	}
+	return nil
 }
 
 // IncrementRequests atomically increments request count
@@ -149,12 +760,239 @@ func (s *Service) IncrementErrors() {
 	s.ErrorCount++
 }
 
+// IncrementInFlight atomically increments the in-flight request count
+func (s *Service) IncrementInFlight() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.InFlight++
+}
+
+// DecrementInFlight atomically decrements the in-flight request count
+func (s *Service) DecrementInFlight() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.InFlight--
+}
+
+// Counters returns the request, error and in-flight counts
+func (s *Service) Counters() (requests, errors, inFlight int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.RequestCount, s.ErrorCount, s.InFlight
+}
+
+// SetMaintenance replaces the service's maintenance settings at runtime
+func (s *Service) SetMaintenance(m *MaintenanceConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Maintenance = m
+}
+
+// GetMaintenance returns the service's maintenance settings, nil if unset
+func (s *Service) GetMaintenance() *MaintenanceConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Maintenance
+}
+
 // SetStatus updates service health status
 func (s *Service) SetStatus(status HealthStatus) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Status = status
 	s.LastCheck = time.Now()
+	s.Failures, s.Successes = 0, 0
+	s.slow, s.fast = 0, 0
+}
+
+// InheritState copies health state and request counters from the service this
+// one replaces. In-flight counts stay with the old service, which the requests
+// holding them will decrement.
+func (s *Service) InheritState(old *Service) {
+	old.mu.RLock()
+	defer old.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Status = old.Status
+	s.LastCheck = old.LastCheck
+	s.LastError = old.LastError
+	s.LastCode = old.LastCode
+	s.LastLatency = old.LastLatency
+	s.latencies = append([]time.Duration(nil), old.latencies...)
+	s.Failures = old.Failures
+	s.Successes = old.Successes
+	s.slow, s.fast = old.slow, old.fast
+	s.ready = old.ready
+	s.NextCheck = old.NextCheck
+	s.Backoff = old.Backoff
+	s.RequestCount = old.RequestCount
+	s.ErrorCount = old.ErrorCount
+}
+
+// CheckResult is the outcome of one health check
+type CheckResult struct {
+	Error      string        // why the check failed, "" if it passed
+	StatusCode int           // HTTP status received, 0 if none
+	Latency    time.Duration // time the check took
+	Slow       bool          // passed, but took longer than degradedAfter
+}
+
+// MaxCheckError bounds the length of a recorded health check error
+const MaxCheckError = 256
+
+// RecordCheck records a health check result and returns the status before and
+// after it. Status changes only after threshold consecutive results that
+// disagree with it; the first result after Unknown applies immediately. Slow
+// passes turn a healthy service degraded after unhealthyThreshold of them, and
+// fast passes turn it healthy again after healthyThreshold. LastError keeps
+// the latest failure until the service is no longer unhealthy. Results for a
+// paused service are ignored.
+func (s *Service) RecordCheck(result CheckResult, healthyThreshold, unhealthyThreshold int) (old, current HealthStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old = s.Status
+	if old == HealthStatusPaused {
+		return old, old
+	}
+	s.LastCheck = time.Now()
+	s.LastCode = result.StatusCode
+	s.LastLatency = result.Latency
+	if result.Latency > 0 {
+		if len(s.latencies) == LatencyWindow {
+			s.latencies = append(s.latencies[:0], s.latencies[1:]...)
+		}
+		s.latencies = append(s.latencies, result.Latency)
+	}
+	unknown := old == "" || old == HealthStatusUnknown
+
+	switch {
+	case result.Error != "":
+		s.LastError = truncate(result.Error, MaxCheckError)
+		s.Failures++
+		s.Successes, s.slow, s.fast = 0, 0, 0
+		if unknown || s.Failures >= unhealthyThreshold {
+			s.Status = HealthStatusUnhealthy
+		}
+	case result.Slow:
+		s.Successes++
+		s.slow++
+		s.Failures, s.fast = 0, 0
+		switch {
+		case unknown,
+			old == HealthStatusUnhealthy && s.Successes >= healthyThreshold,
+			old == HealthStatusHealthy && s.slow >= unhealthyThreshold:
+			s.Status = HealthStatusDegraded
+		}
+	default:
+		s.Successes++
+		s.fast++
+		s.Failures, s.slow = 0, 0
+		switch {
+		case unknown,
+			old == HealthStatusUnhealthy && s.Successes >= healthyThreshold,
+			old == HealthStatusDegraded && s.fast >= healthyThreshold:
+			s.Status = HealthStatusHealthy
+		}
+	}
+
+	if result.Error == "" && s.Status != HealthStatusUnhealthy {
+		s.LastError = ""
+	}
+	if s.Status == HealthStatusHealthy || s.Status == HealthStatusDegraded {
+		s.ready = true
+	}
+	return old, s.Status
+}
+
+// Gated reports whether the service's readiness gate holds back requests
+// because it has never been healthy
+func (s *Service) Gated() bool {
+	if !s.Health.Enabled() || !s.Health.ReadinessGate {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.ready
+}
+
+// LatencyWindow is how many recent health check durations a service keeps
+const LatencyWindow = 20
+
+// LatencyStats summarizes the durations of recent health checks
+type LatencyStats struct {
+	Samples int           `json:"samples"`
+	Min     time.Duration `json:"min"`
+	Avg     time.Duration `json:"avg"`
+	Max     time.Duration `json:"max"`
+}
+
+// Latency summarizes the last LatencyWindow health check durations
+func (s *Service) Latency() LatencyStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := LatencyStats{Samples: len(s.latencies)}
+	if stats.Samples == 0 {
+		return stats
+	}
+	var total time.Duration
+	stats.Min = s.latencies[0]
+	for _, d := range s.latencies {
+		total += d
+		if d < stats.Min {
+			stats.Min = d
+		}
+		if d > stats.Max {
+			stats.Max = d
+		}
+	}
+	stats.Avg = total / time.Duration(stats.Samples)
+	return stats
+}
+
+// LastResult returns the latest health check's error, status code and latency
+func (s *Service) LastResult() CheckResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return CheckResult{Error: s.LastError, StatusCode: s.LastCode, Latency: s.LastLatency}
+}
+
+// truncate shortens s to at most max bytes without splitting a character
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max - len("...")
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// SetSchedule records when the next health check runs and the backoff
+// interval in effect, if any
+func (s *Service) SetSchedule(next time.Time, backoff time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.NextCheck = next
+	s.Backoff = backoff
+}
+
+// Schedule returns when the next health check runs and the backoff interval
+// in effect; next is zero while no checks are scheduled
+func (s *Service) Schedule() (next time.Time, backoff time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.NextCheck, s.Backoff
+}
+
+// Streaks returns the consecutive failed and passed health checks
+func (s *Service) Streaks() (failures, successes int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Failures, s.Successes
 }
 
 // GetStatus returns current health status
@@ -163,3 +1001,24 @@ func (s *Service) GetStatus() HealthStatus {
 	defer s.mu.RUnlock()
 	return s.Status
 }
+
+// SetLastError records why the last health check failed, "" if it passed
+func (s *Service) SetLastError(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastError = reason
+}
+
+// GetLastError returns why health checks fail, "" once the service is healthy
+func (s *Service) GetLastError() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LastError
+}
+
+// GetLastCheck returns the time of the last health status update
+func (s *Service) GetLastCheck() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LastCheck
+}
@@ -0,0 +1,110 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDurationYAML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  string
+	}{
+		{in: "30s", want: 30 * time.Second},
+		{in: "1m30s", want: 90 * time.Second},
+		{in: "500ms", want: 500 * time.Millisecond},
+		{in: `"2m"`, want: 2 * time.Minute},
+		{in: "30000000000", want: 30 * time.Second}, // nanoseconds, as older versions saved them
+		{in: "0", want: 0},
+		{in: "30", want: 30}, // a bare number is nanoseconds, not seconds
+		{in: "soon", err: `invalid duration "soon"`},
+		{in: `"30"`, err: `invalid duration "30"`},
+		{in: "1.5", err: `invalid duration "1.5"`},
+	}
+	for _, tt := range tests {
+		var v struct {
+			Interval Duration `yaml:"interval"`
+		}
+		err := yaml.Unmarshal([]byte("interval: "+tt.in), &v)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want one containing %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+		} else if v.Interval.Duration() != tt.want {
+			t.Errorf("%s read as %s, want %s", tt.in, v.Interval, tt.want)
+		}
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{in: `"30s"`, want: 30 * time.Second},
+		{in: `"1h"`, want: time.Hour},
+		{in: `30000000000`, want: 30 * time.Second},
+		{in: `"later"`, err: true},
+		{in: `true`, err: true},
+	}
+	for _, tt := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(tt.in), &d)
+		if tt.err != (err != nil) {
+			t.Errorf("%s: error %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if !tt.err && d.Duration() != tt.want {
+			t.Errorf("%s read as %s, want %s", tt.in, d, tt.want)
+		}
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	h := HealthConfig{Interval: Duration(30 * time.Second), Timeout: Duration(1500 * time.Millisecond), MaxInterval: Duration(5 * time.Minute)}
+
+	data, err := yaml.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"interval: 30s", "timeout: 1.5s", "maxInterval: 5m0s"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("YAML %q lacks %q", data, want)
+		}
+	}
+	if strings.Contains(string(data), "initialDelay") {
+		t.Errorf("YAML %q has the unset initialDelay", data)
+	}
+	var fromYAML HealthConfig
+	if err := yaml.Unmarshal(data, &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"interval":"30s"`) {
+		t.Errorf("JSON %s lacks \"interval\":\"30s\"", data)
+	}
+	var fromJSON HealthConfig
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, got := range []HealthConfig{fromYAML, fromJSON} {
+		if got.Interval != h.Interval || got.Timeout != h.Timeout || got.MaxInterval != h.MaxInterval {
+			t.Errorf("round trip gave %+v, want %+v", got, h)
+		}
+	}
+}